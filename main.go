@@ -11,19 +11,23 @@ import (
 	"os"
 	"runtime"
 	"runtime/debug"
+	"strings"
 	"time"
 
 	agentconfig "github.com/adevinta/vulcan-agent/config"
-	"github.com/adevinta/vulcan-local/pkg/checktypes"
 	"github.com/adevinta/vulcan-local/pkg/cmd"
 	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/container"
+	"github.com/adevinta/vulcan-local/pkg/gitservice"
+	"github.com/adevinta/vulcan-local/pkg/kubernetes"
+	"github.com/adevinta/vulcan-local/pkg/reporting"
+	"github.com/adevinta/vulcan-local/pkg/scan"
 	"github.com/sirupsen/logrus"
 )
 
 const (
 	envDefaultChecktypesUri  = "VULCAN_CHECKTYPES"
 	envDefaultVulcanLocalUri = "VULCAN_CONFIG"
-	checktypesDefaultURL     = "https://raw.githubusercontent.com/adevinta/vulcan-local/master/script/checktypes-stable.json"
 )
 
 var (
@@ -40,30 +44,26 @@ func main() {
 	var err error
 
 	log := logrus.New()
-	log.SetFormatter(&logrus.TextFormatter{
-		DisableColors:   false,
-		FullTimestamp:   true,
-		TimestampFormat: time.RFC3339,
-		ForceColors:     true,
-	})
+	log.SetFormatter(logFormatter("text"))
 
-	cfg := &config.Config{
-		Conf: config.Conf{
-			DockerBin:   "docker",
-			GitBin:      "git",
-			LogLevel:    logrus.InfoLevel,
-			Concurrency: 3,
-			IfName:      "docker0",
-			Vars:        map[string]string{},
-		},
-		Reporting: config.Reporting{
-			Format:   "json",
-			Severity: config.SeverityHigh,
-		},
-		CheckTypes: map[checktypes.ChecktypeRef]checktypes.Checktype{},
-		Checks:     []config.Check{},
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		exitCode, err = cmd.Diff(os.Args[2:], scan.DefaultHistoryDir(), log)
+		if err != nil {
+			log.Error(err)
+		}
+		os.Exit(exitCode)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "hook" {
+		exitCode, err = cmd.Hook(os.Args[2:], log)
+		if err != nil {
+			log.Error(err)
+		}
+		os.Exit(exitCode)
 	}
 
+	cfg := scan.DefaultConfig()
+
 	cmdTargets := []*config.Target{}
 	cmdRepositories := []string{}
 	cmdConfigs := []string{}
@@ -94,10 +94,36 @@ func main() {
 	flag.Func("l", genFlagMsg("log level", "", cfg.Conf.LogLevel.String(), "", logrus.AllLevels), func(s string) error {
 		return cfg.Conf.LogLevel.UnmarshalText([]byte(s))
 	})
+	flag.StringVar(&cfg.Conf.LogFormat, "log-format", cfg.Conf.LogFormat, genFlagMsg("log format", "", "", "", logFormats))
+	flag.StringVar(&cfg.Conf.ProgressFile, "progress-file", cfg.Conf.ProgressFile, "file streaming the progress of the scan as json lines (eg progress.ndjson)")
+	flag.StringVar(&cfg.Conf.ArtifactsDir, "artifacts-dir", cfg.Conf.ArtifactsDir, "directory collecting the evidence files, raw output and attachments of the checks (eg artifacts)")
+	flag.StringVar(&cfg.Conf.MetricsAddr, "metrics-addr", cfg.Conf.MetricsAddr, "address serving the Prometheus metrics of the scans in /metrics (eg localhost:9090)")
 	flag.StringVar(&cfg.Conf.Policy, "p", "", "policy to execute")
+	flag.StringVar(&cfg.Conf.Profile, "profile", "", "profile of the config files to apply (eg quick)")
 	flag.StringVar(&cfg.Reporting.OutputFile, "r", "", "results file (eg results.json)")
+	flag.StringVar(&cfg.Reporting.OutputFile, "report-file", "", "results file, same as -r (eg report.html)")
+	flag.StringVar(&cfg.Reporting.Format, "report", cfg.Reporting.Format, genFlagMsg("results file format", "sarif", "", "", reporting.Formats()))
+	flag.StringVar(&cfg.Reporting.SBOM, "sbom", cfg.Reporting.SBOM, "CycloneDX SBOM file with the components found by the checks (eg sbom.cdx.json)")
+	flag.StringVar(&cfg.Reporting.Baseline, "baseline", cfg.Reporting.Baseline, "file with the accepted findings to suppress")
+	flag.StringVar(&cfg.Reporting.History, "history", cfg.Reporting.History, "directory storing the findings of the scans compared by the diff command, disabled if empty")
+	flag.BoolVar(&cfg.Reporting.UpdateBaseline, "update-baseline", false, "write the current findings to the baseline file")
+	flag.BoolVar(&cfg.Reporting.Dedup, "dedup", cfg.Reporting.Dedup, "merge the same vulnerability reported by several checks")
 	flag.StringVar(&cfg.Conf.Include, "i", cfg.Conf.Include, "include checktype regex")
+	flag.StringVar(&cfg.Conf.Include, "include", cfg.Conf.Include, "include checktype regex, same as -i (eg 'trivy|semgrep')")
 	flag.StringVar(&cfg.Conf.Exclude, "e", cfg.Conf.Exclude, "exclude checktype regex")
+	flag.StringVar(&cfg.Conf.Exclude, "exclude", cfg.Conf.Exclude, "exclude checktype regex, same as -e")
+	flag.Func("include-tag", genFlagMsg("only run the checktypes with some of the tags, comma separated", "fast", "", "", nil), func(s string) error {
+		cfg.Conf.IncludeTags = appendList(cfg.Conf.IncludeTags, s)
+		return nil
+	})
+	flag.Func("exclude-tag", genFlagMsg("don't run the checktypes with some of the tags, comma separated", "experimental", "", "", nil), func(s string) error {
+		cfg.Conf.ExcludeTags = appendList(cfg.Conf.ExcludeTags, s)
+		return nil
+	})
+	flag.Func("asset-type", genFlagMsg("only run the checks on targets of the asset types, comma separated", "GitRepository", "", "", nil), func(s string) error {
+		cfg.Conf.AssetTypes = appendList(cfg.Conf.AssetTypes, s)
+		return nil
+	})
 	flag.Func("t", genFlagMsg("target to scan", ".", "", "", nil), func(s string) error {
 		cmdTargets = append(cmdTargets, &config.Target{
 			Target: s,
@@ -128,23 +154,94 @@ func main() {
 		}
 		return nil
 	})
+	flag.Func("ref", genFlagMsg("git ref to serve for the last target (-t) when it's a local git repository", "main", "", "", nil), func(s string) error {
+		if len(cmdTargets) == 0 {
+			return fmt.Errorf("missing target")
+		}
+		lastTarget := cmdTargets[len(cmdTargets)-1]
+		if lastTarget.Ref != "" {
+			return fmt.Errorf("ref already defined for target %s", lastTarget.Target)
+		}
+		lastTarget.Ref = s
+		return nil
+	})
 	flag.Func("s", genFlagMsg("filter by severity", "", cfg.Reporting.Severity.Data().Name, "", config.SeverityNames()), func(s string) error {
 		return cfg.Reporting.Severity.UnmarshalText([]byte(s))
 	})
-	flag.Func("checktypes", genFlagMsg("checktype uris", "", checktypesDefaultURL, envDefaultChecktypesUri, nil), func(s string) error {
+	flag.Func("checktypes", genFlagMsg("checktype uris", "", scan.DefaultChecktypesURL, envDefaultChecktypesUri, nil), func(s string) error {
 		cmdRepositories = append(cmdRepositories, s)
 		return nil
 	})
+	flag.StringVar(&cfg.Conf.DevCheck, "dev-check", "", "directory with the manifest.toml and Dockerfile of a checktype to build and run against the targets (eg ./vulcan-mycheck)")
+	flag.Func("runtime", genFlagMsg("container runtime to run the checks", "", cfg.Conf.Runtime, "", append(container.Names(), kubernetes.Runtime)), func(s string) error {
+		cfg.Conf.Runtime = s
+		return nil
+	})
 	flag.StringVar(&cfg.Conf.DockerBin, cfg.Conf.DockerBin, cfg.Conf.DockerBin, "docker binary")
+	flag.StringVar(&cfg.Conf.PodmanBin, cfg.Conf.PodmanBin, cfg.Conf.PodmanBin, "podman binary")
 	flag.StringVar(&cfg.Conf.GitBin, cfg.Conf.GitBin, cfg.Conf.GitBin, "git binary")
 	flag.StringVar(&cfg.Conf.IfName, "ifname", cfg.Conf.IfName, "network interface where agent will be available for the checks")
+	flag.BoolVar(&cfg.Conf.MultiplexGit, "multiplex-git", cfg.Conf.MultiplexGit, "serve all the local git repositories through a single http server")
+	flag.Func("snapshot-strategy", genFlagMsg("how the snapshots of the local directories are created", "", cfg.Conf.Snapshot, "", gitservice.SnapshotStrategies()), func(s string) error {
+		cfg.Conf.Snapshot = s
+		return nil
+	})
+	flag.StringVar(&cfg.Conf.GitBind, "git-bind-address", cfg.Conf.GitBind, genFlagMsg("address where the local git servers listen", "172.17.0.1", "0.0.0.0", "", nil))
+	flag.StringVar(&cfg.Conf.LocalServices.Iface, "local-services-iface", cfg.Conf.LocalServices.Iface, genFlagMsg("address where the local services reachable by the checks listen", "172.17.0.1", "0.0.0.0", "", nil))
+	flag.StringVar(&cfg.Conf.LocalServices.PortRange, "port-range", cfg.Conf.LocalServices.PortRange, genFlagMsg("range of ports of the local services reachable by the checks", "42000-42100", "", "", nil))
+	flag.BoolVar(&cfg.Conf.NoSubmodules, "skip-submodules", cfg.Conf.NoSubmodules, "don't serve the content of the git submodules of the local directories")
+	flag.BoolVar(&cfg.Conf.LFS.Skip, "skip-lfs", cfg.Conf.LFS.Skip, "serve the git LFS pointer files instead of the content of the objects")
+	flag.StringVar(&cfg.Conf.LFS.MaxSize, "lfs-max-size", cfg.Conf.LFS.MaxSize, genFlagMsg("size of the biggest git LFS object served, the bigger ones are served as pointers", "1GB", cfg.Conf.LFS.MaxSize, "", nil))
+	flag.StringVar(&cfg.Conf.DockerContext, "docker-context", cfg.Conf.DockerContext, "docker context of the daemon running the checks (eg remote)")
+	flag.StringVar(&cfg.Conf.AdvertiseAddr, "advertise-address", cfg.Conf.AdvertiseAddr, "address of this machine the checks use to reach the local services (eg 10.0.0.5)")
+	flag.Func("proxy", genFlagMsg("http and https proxy used by vulcan-local and the checks", "http://proxy.corp:3128", "", "", nil), func(s string) error {
+		cfg.Conf.Proxy.HTTPProxy = s
+		cfg.Conf.Proxy.HTTPSProxy = s
+		return nil
+	})
+	flag.Func("no-proxy", genFlagMsg("hosts, domains and networks not proxied, comma separated", ".corp,10.0.0.0/8", "", "", nil), func(s string) error {
+		cfg.Conf.Proxy.NoProxy = appendList(cfg.Conf.Proxy.NoProxy, s)
+		return nil
+	})
+	flag.StringVar(&cfg.Conf.Proxy.CABundle, "ca-bundle", cfg.Conf.Proxy.CABundle, "PEM file with the extra CA certificates trusted by vulcan-local and the checks")
+	flag.Func("redact", genFlagMsg("regexp of the secrets masked in the logs, reports and artifacts, can be repeated", `'password=(\S+)'`, "", "", nil), func(s string) error {
+		cfg.Conf.Redaction.Patterns = append(cfg.Conf.Redaction.Patterns, s)
+		return nil
+	})
+	flag.IntVar(&cfg.Conf.Redaction.Reveal, "redact-reveal", cfg.Conf.Redaction.Reveal, "number of characters kept at the start of the masked secrets")
+	flag.BoolVar(&cfg.Conf.Redaction.Disabled, "no-redact", cfg.Conf.Redaction.Disabled, "don't mask the secrets in the logs, reports and artifacts")
+	flag.BoolVar(&cfg.Conf.DryRun, "dry-run", false, "print the checks that would run, and why the rest are skipped, without running them")
+	flag.BoolVar(&cfg.Conf.Watch, "watch", false, "run the checks again when the local directory targets change")
+	flag.BoolVar(&cfg.Conf.TUI, "tui", false, "show a live table with the progress of the checks")
+	flag.BoolVar(&cfg.Conf.LocalRegistry, "local-registry", cfg.Conf.LocalRegistry, "serve the local images to the checks through an ephemeral registry")
+	flag.BoolVar(&cfg.Discovery.Enabled, "discover", cfg.Discovery.Enabled, "add a target for every project (go.mod, package.json, Dockerfile, ...) found in the local directories")
+	flag.BoolVar(&cfg.Conf.Staged, "staged", false, "only scan the files staged in the local git repositories with the fast checks, i.e. in a pre-commit hook")
+	flag.StringVar(&cfg.Conf.Diff, "diff", cfg.Conf.Diff, "only scan the local targets changed since the git ref (eg main)")
+	flag.IntVar(&cfg.Conf.Timeout, "timeout", cfg.Conf.Timeout, "default timeout in seconds of the checks")
+	flag.IntVar(&cfg.Conf.Retries, "retries", cfg.Conf.Retries, "default number of retries of the checks failing for transient errors")
+	flag.StringVar(&cfg.Conf.CacheDir, "cache-dir", cfg.Conf.CacheDir, "directory to cache the checktype catalogs, image digests and check durations")
+	flag.StringVar(&cfg.Conf.CacheTTL, "cache-ttl", cfg.Conf.CacheTTL, "time the cached results of the checks on local targets are valid, forever if 0")
+	flag.BoolVar(&cfg.Conf.NoCache, "no-cache", false, "run all the checks without using the cached results")
+	flag.StringVar(&cfg.Conf.Resume, "resume", "", "id of the interrupted run to resume, running only its unfinished checks")
+	flag.StringVar(&cfg.Conf.LockFile, "lock-file", cfg.Conf.LockFile, "file pinning the images of the checktypes to their digests")
+	flag.BoolVar(&cfg.Conf.UpdateLock, "update", false, "resolve the digests of the images of the checktypes and write them to the lock file")
+	flag.BoolVar(&cfg.Conf.Offline, "offline", cfg.Conf.Offline, "use the cached checktypes and the local images without pulling")
 	flag.IntVar(&cfg.Conf.Concurrency, "concurrency", cfg.Conf.Concurrency, "max number of checks/containers to run concurrently")
 	defPullPolicyName, _ := cfg.Conf.PullPolicy.String()
 	flag.Func("pullpolicy", genFlagMsg("when to pull for check images", "", defPullPolicyName, "", agentconfig.PullPolicies()), func(s string) error {
 		return cfg.Conf.PullPolicy.UnmarshalText([]byte(s))
 	})
+	flag.Func("pull-policy", genFlagMsg("when to pull the check images", "", strings.ToLower(defPullPolicyName), "", []string{"always", "ifnotpresent", "never"}), func(s string) error {
+		for _, p := range agentconfig.PullPolicies() {
+			if strings.EqualFold(p, s) {
+				return cfg.Conf.PullPolicy.UnmarshalText([]byte(p))
+			}
+		}
+		return fmt.Errorf("invalid pull policy %s", s)
+	})
 	flag.Parse()
 	log.SetLevel(cfg.Conf.LogLevel)
+	log.SetFormatter(logFormatter(cfg.Conf.LogFormat))
 
 	if showHelp {
 		flag.Usage()
@@ -176,6 +273,10 @@ func main() {
 		cmdConfigs = append(cmdConfigs, env)
 	}
 	if len(cmdConfigs) > 0 {
+		// The config files are read into an empty config, as the values
+		// already set are not overwritten by them, and the defaults are set
+		// to the fields they leave empty.
+		*cfg = config.Config{Conf: config.Conf{Profile: cfg.Conf.Profile}}
 		for _, uri := range cmdConfigs {
 			err = config.ReadConfig(uri, cfg, log)
 			if err != nil {
@@ -183,8 +284,26 @@ func main() {
 				return
 			}
 		}
+		if err = scan.SetDefaults(cfg); err != nil {
+			log.Errorf("Unable to set the defaults of the config %+v", err)
+			return
+		}
 		// Overwrite the yaml config with the command line flags.
 		flag.Parse()
+		log.SetLevel(cfg.Conf.LogLevel)
+	}
+	if cfg.Conf.Staged && !flagSet("s") {
+		// Any finding in the staged files fails the commit.
+		cfg.Reporting.Severity = config.SeverityLow
+	}
+	if !validLogFormat(cfg.Conf.LogFormat) {
+		log.Errorf("Invalid log format %s %v", cfg.Conf.LogFormat, logFormats)
+		return
+	}
+	log.SetFormatter(logFormatter(cfg.Conf.LogFormat))
+	if _, ok := cfg.Profiles[cfg.Conf.Profile]; cfg.Conf.Profile != "" && !ok {
+		log.Errorf("Profile %s not defined in the config files", cfg.Conf.Profile)
+		return
 	}
 	if repo := os.Getenv(envDefaultChecktypesUri); repo != "" {
 		log.Debugf("Adding config from %s uri=%s", envDefaultChecktypesUri, repo)
@@ -194,8 +313,8 @@ func main() {
 	cfg.Conf.Repositories = append(cfg.Conf.Repositories, cmdRepositories...)
 
 	if len(cfg.Conf.Repositories) == 0 {
-		log.Infof("No checktypes specified. Using default %s", checktypesDefaultURL)
-		cfg.Conf.Repositories = []string{checktypesDefaultURL}
+		log.Infof("No checktypes specified. Using default %s", scan.DefaultChecktypesURL)
+		cfg.Conf.Repositories = []string{scan.DefaultChecktypesURL}
 	}
 
 	// Overwrite config targets in case of command line targets
@@ -206,9 +325,76 @@ func main() {
 		}
 	}
 
-	exitCode, err = cmd.Run(cfg, log)
+	if cfg.Conf.TUI && !isTerminal(os.Stderr) {
+		log.Infof("Disabling the tui as the output is not a terminal")
+		cfg.Conf.TUI = false
+	}
+
+	if cfg.Conf.Watch {
+		exitCode, err = cmd.Watch(cfg, log)
+	} else {
+		exitCode, err = cmd.Run(cfg, log)
+	}
 	if err != nil {
 		log.Error(err)
 	}
 	os.Exit(exitCode)
 }
+
+// logFormats are the supported formats of the logs.
+var logFormats = []string{"text", "json"}
+
+func validLogFormat(format string) bool {
+	for _, f := range logFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// logFormatter returns the logrus formatter of the log format, text if the
+// format is unknown.
+func logFormatter(format string) logrus.Formatter {
+	if format == "json" {
+		return &logrus.JSONFormatter{TimestampFormat: time.RFC3339}
+	}
+	return &logrus.TextFormatter{
+		DisableColors:   false,
+		FullTimestamp:   true,
+		TimestampFormat: time.RFC3339,
+		ForceColors:     true,
+	}
+}
+
+// appendList appends the comma separated values not already in the list.
+func appendList(list []string, values string) []string {
+	for _, v := range strings.Split(values, ",") {
+		v = strings.TrimSpace(v)
+		found := v == ""
+		for _, l := range list {
+			found = found || l == v
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// flagSet returns true if the flag was set in the command line.
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// isTerminal returns true if the file is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package checktypes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adevinta/vulcan-agent/log"
+	"github.com/docker/docker/client"
+)
+
+const (
+	catalogsDir   = "catalogs"
+	imagesFile    = "images.json"
+	durationsFile = "durations.json"
+)
+
+// Cache stores in a local directory the downloaded checktype catalogs and
+// the digests of the images used by the checks, so they can be reused in
+// offline mode, and the durations of the checks of the previous scans.
+type Cache struct {
+	Dir string
+	// Offline forces to load the remote catalogs from the cache.
+	Offline bool
+}
+
+// ImageDigests contains the digests of the images indexed by image.
+type ImageDigests map[string]string
+
+// Durations contains the durations of the checks indexed by checktype name.
+type Durations map[string]time.Duration
+
+func (c *Cache) catalogPath(u string) string {
+	return filepath.Join(c.Dir, catalogsDir, fmt.Sprintf("%x.json", sha256.Sum256([]byte(u))))
+}
+
+// Catalog returns the cached content of the catalog.
+func (c *Cache) Catalog(u string) ([]byte, error) {
+	content, err := os.ReadFile(c.catalogPath(u))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("checktypes catalog %s not found in cache %s", u, c.Dir)
+	}
+	return content, err
+}
+
+// StoreCatalog stores the content of the catalog.
+func (c *Cache) StoreCatalog(u string, content []byte) error {
+	path := c.catalogPath(u)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o644)
+}
+
+// Images returns the recorded image digests.
+func (c *Cache) Images() (ImageDigests, error) {
+	digests := ImageDigests{}
+	content, err := os.ReadFile(filepath.Join(c.Dir, imagesFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return digests, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &digests); err != nil {
+		return nil, fmt.Errorf("invalid images cache: %w", err)
+	}
+	return digests, nil
+}
+
+// RecordImages stores the digests of the given images, keeping the ones
+// already recorded for other images.
+func (c *Cache) RecordImages(digests ImageDigests) error {
+	current, err := c.Images()
+	if err != nil {
+		return err
+	}
+	for image, digest := range digests {
+		current[image] = digest
+	}
+	content, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(c.Dir, imagesFile), content, 0o644)
+}
+
+// Durations returns the recorded durations of the checktypes.
+func (c *Cache) Durations() (Durations, error) {
+	durations := Durations{}
+	content, err := os.ReadFile(filepath.Join(c.Dir, durationsFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return durations, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &durations); err != nil {
+		return nil, fmt.Errorf("invalid durations cache: %w", err)
+	}
+	return durations, nil
+}
+
+// RecordDurations stores the durations of the given checktypes. The duration
+// already recorded for a checktype is averaged with the new one, so a single
+// slow run doesn't change the estimation too much.
+func (c *Cache) RecordDurations(durations Durations) error {
+	current, err := c.Durations()
+	if err != nil {
+		return err
+	}
+	for name, d := range durations {
+		if prev, ok := current[name]; ok {
+			d = (prev + d) / 2
+		}
+		current[name] = d
+	}
+	content, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(c.Dir, durationsFile), content, 0o644)
+}
+
+// LocalImageDigests returns the digests of the images available locally.
+// The images not found are returned in the missing list.
+func LocalImageDigests(images []string, l log.Logger) (ImageDigests, []string, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cli.Close()
+	digests := ImageDigests{}
+	missing := []string{}
+	for _, image := range images {
+		info, _, err := cli.ImageInspectWithRaw(context.Background(), image)
+		if client.IsErrNotFound(err) {
+			missing = append(missing, image)
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to inspect image %s: %w", image, err)
+		}
+		digest := info.ID
+		if len(info.RepoDigests) > 0 {
+			digest = info.RepoDigests[0]
+			if i := strings.Index(digest, "@"); i >= 0 {
+				digest = digest[i+1:]
+			}
+		}
+		l.Debugf("Local image %s digest=%s", image, digest)
+		digests[image] = digest
+	}
+	sort.Strings(missing)
+	return digests, missing, nil
+}
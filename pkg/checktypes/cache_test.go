@@ -0,0 +1,97 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package checktypes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	loggerUser *logrus.Logger
+)
+
+func init() {
+	if len(os.Args) > 1 && os.Args[1][:5] == "-test" {
+		loggerUser = logrus.New()
+		loggerUser.SetFormatter(&logrus.TextFormatter{
+			DisableColors:   false,
+			FullTimestamp:   true,
+			TimestampFormat: time.RFC3339,
+			ForceColors:     true,
+		})
+	}
+}
+
+func TestImportCached(t *testing.T) {
+	catalog := `{"checktypes": [{"name": "vulcan-trivy", "image": "vulcansec/vulcan-trivy:1", "assets": ["DockerImage"]}]}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(catalog))
+	}))
+	url := srv.URL + "/checktypes.json"
+	cache := &Cache{Dir: t.TempDir()}
+
+	if _, err := ImportCached([]string{url}, &Cache{Dir: cache.Dir, Offline: true}, loggerUser); err == nil {
+		t.Fatal("expected error importing an uncached catalog in offline mode")
+	}
+
+	cts, err := ImportCached([]string{url}, cache, loggerUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cts["vulcan-trivy"]; !ok {
+		t.Fatalf("checktype not imported %v", cts)
+	}
+
+	srv.Close()
+	for _, offline := range []bool{true, false} {
+		cts, err = ImportCached([]string{url}, &Cache{Dir: cache.Dir, Offline: offline}, loggerUser)
+		if err != nil {
+			t.Fatalf("unexpected error offline=%v: %v", offline, err)
+		}
+		if ct, ok := cts["vulcan-trivy"]; !ok || ct.Image != "vulcansec/vulcan-trivy:1" {
+			t.Errorf("checktype not loaded from cache offline=%v %v", offline, cts)
+		}
+	}
+}
+
+func TestRecordImages(t *testing.T) {
+	cache := &Cache{Dir: t.TempDir()}
+	if err := cache.RecordImages(ImageDigests{"a:1": "sha256:a", "b:1": "sha256:b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.RecordImages(ImageDigests{"a:1": "sha256:new"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := cache.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["a:1"] != "sha256:new" || got["b:1"] != "sha256:b" {
+		t.Errorf("unexpected digests %v", got)
+	}
+}
+
+func TestRecordDurations(t *testing.T) {
+	cache := &Cache{Dir: t.TempDir()}
+	if err := cache.RecordDurations(Durations{"a": time.Minute, "b": time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.RecordDurations(Durations{"a": 3 * time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := cache.Durations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["a"] != 2*time.Minute || got["b"] != time.Second {
+		t.Errorf("unexpected durations %v", got)
+	}
+}
@@ -36,6 +36,7 @@ type Checktype struct {
 	RequiredVars []string               `json:"required_vars"`
 	QueueName    string                 `json:"queue_name,omitempty"`
 	Assets       []string               `json:"assets"`
+	Tags         []string               `json:"tags,omitempty"`
 }
 
 // Checktypes contains a collection of checktypes indexed by checktype name.
@@ -59,6 +60,13 @@ type JSONChecktypes struct {
 // Import loads the information of the checktypes defined in the specified repos
 // url's.
 func Import(repos []string, l log.Logger) (map[ChecktypeRef]Checktype, error) {
+	return ImportCached(repos, nil, l)
+}
+
+// ImportCached loads the checktypes like Import but storing the remote
+// catalogs in the cache, or reading them from it in offline mode. If the
+// cache is nil it behaves like Import.
+func ImportCached(repos []string, cache *Cache, l log.Logger) (map[ChecktypeRef]Checktype, error) {
 	var checktypes = make(map[ChecktypeRef]Checktype)
 	for _, repo := range repos {
 		if strings.HasPrefix(repo, "file://") {
@@ -71,7 +79,7 @@ func Import(repos []string, l log.Logger) (map[ChecktypeRef]Checktype, error) {
 		if err != nil {
 			return nil, err
 		}
-		rchecktypes, err := checktypesFrom(repoURL, l)
+		rchecktypes, err := checktypesFrom(repoURL, cache, l)
 		if err != nil {
 			return nil, fmt.Errorf("unable to load repository %s: %w", repo, err)
 		}
@@ -83,7 +91,7 @@ func Import(repos []string, l log.Logger) (map[ChecktypeRef]Checktype, error) {
 	return checktypes, nil
 }
 
-func checktypesFrom(u *neturl.URL, l log.Logger) ([]Checktype, error) {
+func checktypesFrom(u *neturl.URL, cache *Cache, l log.Logger) ([]Checktype, error) {
 	code, err := isChecktypeCode(u)
 	if err != nil {
 		return nil, err
@@ -91,7 +99,7 @@ func checktypesFrom(u *neturl.URL, l log.Logger) ([]Checktype, error) {
 	if code {
 		return checktypesFromCode(u, l)
 	}
-	return checktypesFromJSON(u, l)
+	return checktypesFromJSON(u, cache, l)
 }
 
 func isChecktypeCode(u *neturl.URL) (bool, error) {
@@ -105,8 +113,8 @@ func isChecktypeCode(u *neturl.URL) (bool, error) {
 	return dirInfo.IsDir(), nil
 }
 
-func checktypesFromJSON(u *neturl.URL, l log.Logger) ([]Checktype, error) {
-	content, err := content.Download(u)
+func checktypesFromJSON(u *neturl.URL, cache *Cache, l log.Logger) ([]Checktype, error) {
+	content, err := downloadCatalog(u, cache, l)
 	if err != nil {
 		return nil, err
 	}
@@ -119,6 +127,32 @@ func checktypesFromJSON(u *neturl.URL, l log.Logger) ([]Checktype, error) {
 	return jchecktypes.Checktypes, nil
 }
 
+// downloadCatalog downloads the catalog. The remote catalogs are stored in the
+// cache, and read from it when offline or the download fails.
+func downloadCatalog(u *neturl.URL, cache *Cache, l log.Logger) ([]byte, error) {
+	remote := u.Scheme == "http" || u.Scheme == "https"
+	if cache == nil || !remote {
+		return content.Download(u)
+	}
+	if cache.Offline {
+		l.Debugf("Loading checktypes catalog %s from cache", u.String())
+		return cache.Catalog(u.String())
+	}
+	body, err := content.Download(u)
+	if err != nil {
+		cached, cerr := cache.Catalog(u.String())
+		if cerr != nil {
+			return nil, err
+		}
+		l.Errorf("Using cached checktypes catalog %s: %v", u.String(), err)
+		return cached, nil
+	}
+	if err := cache.StoreCatalog(u.String(), body); err != nil {
+		l.Errorf("Unable to cache checktypes catalog %s: %v", u.String(), err)
+	}
+	return body, nil
+}
+
 // checktypesFromCode returns the checktypes info defined as code in a
 // directory. We support two forms of repositories:
 // One that contains only one check. It's indicated by a path that points
@@ -171,6 +205,24 @@ func checktypesFromCode(u *neturl.URL, l log.Logger) ([]Checktype, error) {
 	return checktypes, nil
 }
 
+// DevChecktype returns the checktype defined as code in the directory, which
+// must contain its manifest.toml and Dockerfile. It's used to develop new
+// checktypes without publishing their images.
+func DevChecktype(dirpath string, l log.Logger) (Checktype, error) {
+	dirpath, err := filepath.Abs(dirpath)
+	if err != nil {
+		return Checktype{}, err
+	}
+	if _, err := os.Stat(filepath.Join(dirpath, "Dockerfile")); err != nil {
+		return Checktype{}, fmt.Errorf("missing Dockerfile for checktype in %s: %w", dirpath, err)
+	}
+	ct, err := readChecktype(dirpath, l)
+	if errors.Is(err, errNoChecktypeDir) {
+		return Checktype{}, fmt.Errorf("missing manifest.toml for checktype in %s", dirpath)
+	}
+	return ct, err
+}
+
 func readChecktype(dirpath string, l log.Logger) (Checktype, error) {
 	l.Debugf("Looking if the directory %s contains the code of a checktype", dirpath)
 	manifestPath := filepath.Join(dirpath, "manifest.toml")
@@ -202,6 +254,7 @@ func readChecktype(dirpath string, l log.Logger) (Checktype, error) {
 		Options:      options,
 		RequiredVars: m.RequiredVars,
 		Assets:       assets,
+		Tags:         m.Tags,
 	}
 	return ct, nil
 }
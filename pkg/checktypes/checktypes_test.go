@@ -0,0 +1,98 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package checktypes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDevChecktype(t *testing.T) {
+	manifest := `Description = "Dev check"
+Timeout = 60
+AssetTypes = ["Hostname", "WebAddress"]
+Options = """{"depth": 1}"""
+`
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    Checktype
+		wantErr bool
+	}{
+		{
+			name:  "Valid",
+			files: map[string]string{"manifest.toml": manifest, "Dockerfile": "FROM alpine"},
+			want: Checktype{
+				Name:        "vulcan-dev",
+				Description: "Dev check",
+				Timeout:     60,
+				Options:     map[string]interface{}{"depth": float64(1)},
+				Assets:      []string{"Hostname", "WebAddress"},
+			},
+		},
+		{
+			name:    "MissingDockerfile",
+			files:   map[string]string{"manifest.toml": manifest},
+			wantErr: true,
+		},
+		{
+			name:    "MissingManifest",
+			files:   map[string]string{"Dockerfile": "FROM alpine"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "vulcan-dev")
+			if err := os.Mkdir(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := DevChecktype(dir, loggerUser)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err != nil {
+				return
+			}
+			tt.want.Image = "code://" + dir
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected checktype (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHasGoCode(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  bool
+	}{
+		{name: "Module", files: []string{"go.mod", "Dockerfile"}, want: true},
+		{name: "GoFiles", files: []string{"main.go", "Dockerfile"}, want: true},
+		{name: "Dockerfile", files: []string{"check.py", "Dockerfile"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := hasGoCode(dir); got != tt.want {
+				t.Errorf("unexpected result got=%v want=%v", got, tt.want)
+			}
+		})
+	}
+}
@@ -52,11 +52,14 @@ func (c Code) Build(logger log.Logger) (string, error) {
 		logger.Infof("No changes in checktype in dir %s, reusing image %s", string(c), c.imageName())
 		return c.imageName(), nil
 	}
-	logger.Infof("Compiling checktype in dir %s", c)
 	dir := string(c)
-	// Run go build in the checktype dir.
-	if err := goBuildDir(dir); err != nil {
-		return "", err
+	// Run go build in the checktype dir, the checktypes written in other
+	// languages are built by their Dockerfile.
+	if hasGoCode(dir) {
+		logger.Infof("Compiling checktype in dir %s", c)
+		if err := goBuildDir(dir); err != nil {
+			return "", err
+		}
 	}
 	// Build a Tar file with the docker image contents.
 	logger.Infof("Building image for checktype in dir %s", dir)
@@ -148,6 +151,15 @@ func (c Code) imageName() string {
 	return fmt.Sprintf("%s-%s", image, "local")
 }
 
+// hasGoCode returns true if the dir contains a go module or go files.
+func hasGoCode(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+		return true
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	return len(files) > 0
+}
+
 func goBuildDir(dir string) error {
 	args := []string{"build", "-a", "-ldflags", "-extldflags -static", "."}
 	cmd := exec.Command("go", args...)
@@ -0,0 +1,191 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package checktypes
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/adevinta/vulcan-agent/log"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Lock pins the images of the checktypes to the digests resolved when it
+// was updated, so the scans are reproducible even if the tags are mutated.
+type Lock struct {
+	Checktypes map[string]LockedChecktype `json:"checktypes"`
+}
+
+// LockedChecktype is the image of a checktype in the catalog and its digest.
+type LockedChecktype struct {
+	Image  string `json:"image"`
+	Digest string `json:"digest"`
+}
+
+// ReadLock reads the lockfile in the path.
+func ReadLock(path string) (*Lock, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lock := &Lock{}
+	if err := json.Unmarshal(content, lock); err != nil {
+		return nil, fmt.Errorf("invalid lockfile %s: %w", path, err)
+	}
+	return lock, nil
+}
+
+// Write stores the lock in the path.
+func (l *Lock) Write(path string) error {
+	content, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0o644)
+}
+
+// DigestResolver returns the digest of an image.
+type DigestResolver func(image string) (string, error)
+
+// ResolveLock returns a lock with the digests of the images of the
+// checktypes. The checktypes defined as code are not locked.
+func ResolveLock(cts Checktypes, resolve DigestResolver, l log.Logger) (*Lock, error) {
+	lock := &Lock{Checktypes: map[string]LockedChecktype{}}
+	refs := []string{}
+	for ref := range cts {
+		refs = append(refs, string(ref))
+	}
+	sort.Strings(refs)
+	for _, ref := range refs {
+		ct := cts[ChecktypeRef(ref)]
+		if _, ok := ParseCode(ct.Image); ok {
+			continue
+		}
+		digest, err := resolve(ct.Image)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve image %s of checktype %s: %w", ct.Image, ct.Name, err)
+		}
+		l.Debugf("Locked checktype %s image=%s digest=%s", ct.Name, ct.Image, digest)
+		lock.Checktypes[ct.Name] = LockedChecktype{Image: ct.Image, Digest: digest}
+	}
+	return lock, nil
+}
+
+// Pin replaces the images of the checktypes with the pinned ones and returns
+// the images of the checktypes not found in the lock.
+func (l *Lock) Pin(cts Checktypes, logger log.Logger) ([]string, error) {
+	unpinned := []string{}
+	for ref, ct := range cts {
+		if _, ok := ParseCode(ct.Image); ok {
+			continue
+		}
+		locked, ok := l.Checktypes[ct.Name]
+		if !ok {
+			unpinned = append(unpinned, ct.Image)
+			continue
+		}
+		if locked.Image != ct.Image {
+			logger.Infof("Image of checktype %s changed to %s, using the locked %s", ct.Name, ct.Image, locked.Image)
+		}
+		image, err := PinnedImage(locked.Image, locked.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid locked checktype %s: %w", ct.Name, err)
+		}
+		ct.Image = image
+		cts[ref] = ct
+	}
+	sort.Strings(unpinned)
+	return unpinned, nil
+}
+
+// PinnedImage returns the reference of the image by digest.
+func PinnedImage(image, digest string) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", err
+	}
+	// Keep the repository as written in the catalog.
+	repo := image
+	switch r := ref.(type) {
+	case name.Tag:
+		repo = strings.TrimSuffix(image, ":"+r.TagStr())
+	case name.Digest:
+		repo = strings.TrimSuffix(image, "@"+r.DigestStr())
+	}
+	d, err := name.NewDigest(fmt.Sprintf("%s@%s", repo, digest))
+	if err != nil {
+		return "", err
+	}
+	return d.String(), nil
+}
+
+// RegistryAuth contains the credentials of a registry.
+type RegistryAuth struct {
+	Server   string
+	Username string
+	Password string
+}
+
+// registryKeychain resolves the credentials of the given registries, falling
+// back to the docker config.
+type registryKeychain []RegistryAuth
+
+func (k registryKeychain) Resolve(r authn.Resource) (authn.Authenticator, error) {
+	for _, a := range k {
+		if SameRegistry(a.Server, r.RegistryStr()) {
+			return &authn.Basic{Username: a.Username, Password: a.Password}, nil
+		}
+	}
+	return authn.DefaultKeychain.Resolve(r)
+}
+
+// SameRegistry returns true if the server of some credentials, optionally
+// with the scheme, is the given registry (eg docker.io and index.docker.io).
+func SameRegistry(server, registry string) bool {
+	reg, err := name.NewRegistry(strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://"))
+	if err != nil {
+		return false
+	}
+	return reg.RegistryStr() == registry
+}
+
+// ImageRegistry returns the registry of the image (eg index.docker.io).
+func ImageRegistry(image string) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", err
+	}
+	return ref.Context().RegistryStr(), nil
+}
+
+// RemoteDigestResolver returns a resolver of the digests of the images in
+// their remote registries using the credentials of the auths.
+func RemoteDigestResolver(auths []RegistryAuth, opts ...name.Option) DigestResolver {
+	return func(image string) (string, error) {
+		ref, err := name.ParseReference(image, opts...)
+		if err != nil {
+			return "", err
+		}
+		if d, ok := ref.(name.Digest); ok {
+			return d.DigestStr(), nil
+		}
+		kc := remote.WithAuthFromKeychain(registryKeychain(auths))
+		desc, err := remote.Head(ref, kc)
+		if err != nil {
+			// Some registries don't support HEAD requests on manifests.
+			d, gerr := remote.Get(ref, kc)
+			if gerr != nil {
+				return "", err
+			}
+			return d.Digest.String(), nil
+		}
+		return desc.Digest.String(), nil
+	}
+}
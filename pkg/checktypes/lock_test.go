@@ -0,0 +1,139 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package checktypes
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const testDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000001"
+
+func TestPinnedImage(t *testing.T) {
+	tests := []struct {
+		image   string
+		want    string
+		wantErr bool
+	}{
+		{image: "vulcansec/vulcan-trivy:edge", want: "vulcansec/vulcan-trivy@" + testDigest},
+		{image: "alpine", want: "alpine@" + testDigest},
+		{image: "registry.example.com:5000/vulcan-tls:1", want: "registry.example.com:5000/vulcan-tls@" + testDigest},
+		{image: "vulcansec/vulcan-nuclei@sha256:" + strings.Repeat("f", 64), want: "vulcansec/vulcan-nuclei@" + testDigest},
+		{image: "INVALID:", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			got, err := PinnedImage(tt.image, testDigest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("unexpected image got=%s want=%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLock(t *testing.T) {
+	catalog := func() Checktypes {
+		return Checktypes{
+			"vulcan-trivy": {Name: "vulcan-trivy", Image: "vulcansec/vulcan-trivy:edge"},
+			"vulcan-tls":   {Name: "vulcan-tls", Image: "vulcansec/vulcan-tls:edge"},
+			"vulcan-dev":   {Name: "vulcan-dev", Image: "code:///checks/vulcan-dev"},
+		}
+	}
+	resolve := func(image string) (string, error) {
+		if image == "vulcansec/vulcan-tls:edge" {
+			return "", fmt.Errorf("not found")
+		}
+		return testDigest, nil
+	}
+	if _, err := ResolveLock(catalog(), resolve, loggerUser); err == nil {
+		t.Fatal("expected error resolving unknown image")
+	}
+
+	cts := catalog()
+	delete(cts, "vulcan-tls")
+	lock, err := ResolveLock(cts, resolve, loggerUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "vulcan.lock")
+	if err := lock.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	lock, err = ReadLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Lock{Checktypes: map[string]LockedChecktype{
+		"vulcan-trivy": {Image: "vulcansec/vulcan-trivy:edge", Digest: testDigest},
+	}}
+	if diff := cmp.Diff(want, lock); diff != "" {
+		t.Errorf("unexpected lock (-want +got):\n%s", diff)
+	}
+
+	cts = catalog()
+	unpinned, err := lock.Pin(cts, loggerUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"vulcansec/vulcan-tls:edge"}, unpinned); diff != "" {
+		t.Errorf("unexpected unpinned images (-want +got):\n%s", diff)
+	}
+	images := map[string]string{}
+	for ref, ct := range cts {
+		images[string(ref)] = ct.Image
+	}
+	wantImages := map[string]string{
+		"vulcan-trivy": "vulcansec/vulcan-trivy@" + testDigest,
+		"vulcan-tls":   "vulcansec/vulcan-tls:edge",
+		"vulcan-dev":   "code:///checks/vulcan-dev",
+	}
+	if diff := cmp.Diff(wantImages, images); diff != "" {
+		t.Errorf("unexpected pinned images (-want +got):\n%s", diff)
+	}
+}
+
+func TestRemoteDigestResolver(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	defer srv.Close()
+	img, err := random.Image(64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image := strings.TrimPrefix(srv.URL, "http://") + "/vulcan-check:1"
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	want, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolve := RemoteDigestResolver(nil)
+	got, err := resolve(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want.String() {
+		t.Errorf("unexpected digest got=%s want=%s", got, want)
+	}
+	if _, err := resolve(strings.TrimPrefix(srv.URL, "http://") + "/unknown:1"); err == nil {
+		t.Error("expected error resolving unknown image")
+	}
+}
@@ -99,6 +99,7 @@ type Manifest struct {
 	RequiredVars []string
 	QueueName    string
 	AssetTypes   AssetTypes
+	Tags         []string
 }
 
 // UnmarshalOptions returns the options interpreted as json.
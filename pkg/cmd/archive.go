@@ -0,0 +1,134 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	agentlog "github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/generator"
+	"github.com/docker/docker/client"
+)
+
+var (
+	loadedImageRegex   = regexp.MustCompile(`Loaded image: (\S+)`)
+	loadedImageIDRegex = regexp.MustCompile(`Loaded image ID: (\S+)`)
+)
+
+// loadImage loads the image archive in the runtime and returns the
+// reference of the image. The var allows to replace it in the tests.
+var loadImage = func(path string) (string, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	ctx := context.Background()
+	resp, err := cli.ImageLoad(ctx, f, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	ref, id, err := parseLoadOutput(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("unable to load image archive %s: %w", path, err)
+	}
+	if ref != "" {
+		return ref, nil
+	}
+	// Archives without tags, i.e. OCI layouts, only contain the image id.
+	ref = archiveImageRef(path)
+	if err := cli.ImageTag(ctx, id, ref); err != nil {
+		return "", fmt.Errorf("unable to tag image %s from archive %s: %w", id, path, err)
+	}
+	return ref, nil
+}
+
+// parseLoadOutput returns the first image reference or id loaded.
+func parseLoadOutput(r io.Reader) (ref, id string, err error) {
+	dec := json.NewDecoder(r)
+	for {
+		var msg struct {
+			Stream string `json:"stream"`
+			Error  string `json:"error"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return "", "", err
+		}
+		if msg.Error != "" {
+			return "", "", errors.New(msg.Error)
+		}
+		if m := loadedImageRegex.FindStringSubmatch(msg.Stream); m != nil && ref == "" {
+			ref = m[1]
+		}
+		if m := loadedImageIDRegex.FindStringSubmatch(msg.Stream); m != nil && id == "" {
+			id = m[1]
+		}
+	}
+	if ref == "" && id == "" {
+		return "", "", errors.New("no image loaded")
+	}
+	return ref, id, nil
+}
+
+// archiveImageRef returns a stable reference for the images loaded from the
+// archive without tags.
+func archiveImageRef(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	name = regexp.MustCompile(`[^a-z0-9._-]+`).ReplaceAllString(name, "-")
+	name = strings.Trim(name, "-._")
+	if name == "" {
+		name = "image"
+	}
+	sum := sha256.Sum256([]byte(path))
+	return fmt.Sprintf("vulcan-local/%s:%x", name, sum[:6])
+}
+
+// loadImageArchives loads the image archives targeted by the checks and
+// sets the loaded image as the new target of the checks.
+func loadImageArchives(checks []config.Check, log agentlog.Logger) error {
+	loaded := map[string]string{}
+	for i := range checks {
+		c := &checks[i]
+		if c.AssetType != "DockerImage" || c.Id == "" {
+			continue
+		}
+		path, err := generator.GetValidImageArchive(c.Target)
+		if err != nil {
+			continue
+		}
+		ref, ok := loaded[path]
+		if !ok {
+			log.Infof("Loading image archive %s", c.Target)
+			if ref, err = loadImage(path); err != nil {
+				return err
+			}
+			log.Debugf("Loaded image archive %s image=%s", c.Target, ref)
+			loaded[path] = ref
+		}
+		c.NewTarget = ref
+	}
+	return nil
+}
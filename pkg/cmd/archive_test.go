@@ -0,0 +1,93 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseLoadOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		wantRef string
+		wantID  string
+		wantErr bool
+	}{
+		{
+			name:    "Tagged",
+			output:  `{"stream":"Loaded image: alpine:3.16\n"}` + "\n" + `{"stream":"Loaded image: busybox:latest\n"}`,
+			wantRef: "alpine:3.16",
+		},
+		{
+			name:   "Untagged",
+			output: `{"stream":"Loaded image ID: sha256:0123456789ab\n"}`,
+			wantID: "sha256:0123456789ab",
+		},
+		{
+			name:    "Error",
+			output:  `{"error":"invalid tar header"}`,
+			wantErr: true,
+		},
+		{
+			name:    "Empty",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, id, err := parseLoadOutput(strings.NewReader(tt.output))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if ref != tt.wantRef || id != tt.wantID {
+				t.Errorf("unexpected ref=%s id=%s", ref, id)
+			}
+		})
+	}
+}
+
+func TestLoadImageArchives(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "My Image.tar")
+	if err := os.WriteFile(archive, []byte("archive"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loads := 0
+	defer func(f func(string) (string, error)) { loadImage = f }(loadImage)
+	loadImage = func(path string) (string, error) {
+		loads++
+		return archiveImageRef(path), nil
+	}
+	checks := []config.Check{
+		{Id: "1", Target: archive, AssetType: "DockerImage"},
+		{Id: "2", Target: archive, AssetType: "DockerImage"},
+		{Id: "3", Target: "alpine:latest", AssetType: "DockerImage"},
+		{Id: "4", Target: dir, AssetType: "GitRepository"},
+	}
+	if err := loadImageArchives(checks, loggerUser); err != nil {
+		t.Fatal(err)
+	}
+	if loads != 1 {
+		t.Errorf("unexpected number of loads %d", loads)
+	}
+	got := []string{}
+	for _, c := range checks {
+		got = append(got, c.NewTarget)
+	}
+	ref := archiveImageRef(archive)
+	if !strings.HasPrefix(ref, "vulcan-local/my-image:") {
+		t.Errorf("unexpected image reference %s", ref)
+	}
+	if diff := cmp.Diff([]string{ref, ref, "", ""}, got); diff != "" {
+		t.Errorf("unexpected targets (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/adevinta/vulcan-agent/backend/docker"
+	agentlog "github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-local/pkg/redact"
+	report "github.com/adevinta/vulcan-report"
+)
+
+const (
+	// checkArtifactsDir is the directory of the check containers where the
+	// checks write their evidence files.
+	checkArtifactsDir = "/vulcan/artifacts"
+	// artifactsVar is the env var of the checks with checkArtifactsDir.
+	artifactsVar = "VULCAN_ARTIFACTS_DIR"
+	// artifactsGroup is the name of the resources group of the
+	// vulnerabilities referencing the artifacts of their checks.
+	artifactsGroup = "Artifacts"
+	// outputArtifact is the file with the raw output of the check.
+	outputArtifact = "output.log"
+	// attachmentsDir is the directory of the attachments of the
+	// vulnerabilities in the artifacts of a check.
+	attachmentsDir = "attachments"
+)
+
+// artifacts collects the evidence of the checks in a directory per check:
+// the files written by the checks in checkArtifactsDir, their raw output and
+// the attachments of their vulnerabilities. A nil artifacts collects nothing.
+type artifacts struct {
+	dir string
+	// mount mounts the directories in the check containers, only possible
+	// when they run in this machine.
+	mount bool
+	// rd masks the secrets of the text artifacts.
+	rd  *redact.Redactor
+	log agentlog.Logger
+}
+
+// newArtifacts returns the artifacts collected in the directory, nil if the
+// directory is empty.
+func newArtifacts(dir string, mount bool, rd *redact.Redactor, log agentlog.Logger) (*artifacts, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &artifacts{dir: dir, mount: mount, rd: rd, log: log}, nil
+}
+
+// checkDir returns the directory of the artifacts of the check.
+func (a *artifacts) checkDir(checkID string) string {
+	return filepath.Join(a.dir, checkID)
+}
+
+// apply mounts the directory of the artifacts of the check in its container.
+func (a *artifacts) apply(rc *docker.RunConfig, checkID string) {
+	if a == nil || !a.mount {
+		return
+	}
+	dir, err := filepath.Abs(a.checkDir(checkID))
+	if err != nil {
+		a.log.Errorf("Unable to mount the artifacts of the check %s: %v", checkID, err)
+		return
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		a.log.Errorf("Unable to mount the artifacts of the check %s: %v", checkID, err)
+		return
+	}
+	// The checks can run as any user.
+	if err := os.Chmod(dir, 0o777); err != nil {
+		a.log.Errorf("Unable to mount the artifacts of the check %s: %v", checkID, err)
+		return
+	}
+	rc.HostConfig.Binds = append(rc.HostConfig.Binds, dir+":"+checkArtifactsDir)
+	rc.ContainerConfig.Env = upsertEnv(rc.ContainerConfig.Env, artifactsVar, checkArtifactsDir)
+}
+
+// saveOutput writes the raw output of the check.
+func (a *artifacts) saveOutput(checkID string, output []byte) {
+	if a == nil || len(output) == 0 {
+		return
+	}
+	if err := a.write(checkID, outputArtifact, a.rd.Bytes(output)); err != nil {
+		a.log.Errorf("Unable to save the output of the check %s: %v", checkID, err)
+	}
+}
+
+func (a *artifacts) write(checkID, name string, data []byte) error {
+	path := filepath.Join(a.checkDir(checkID), name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// collect writes the attachments of the vulnerabilities of the reports and
+// references the artifacts of every check from its vulnerabilities.
+func (a *artifacts) collect(reports map[string]*report.Report) {
+	if a == nil {
+		return
+	}
+	for id, r := range reports {
+		for _, v := range r.Vulnerabilities {
+			for _, at := range v.Attachments {
+				name := filepath.Base(filepath.Clean("/" + at.Name))
+				if name == string(filepath.Separator) || len(at.Data) == 0 {
+					continue
+				}
+				if err := a.write(id, filepath.Join(attachmentsDir, name), at.Data); err != nil {
+					a.log.Errorf("Unable to save the attachment %s of the check %s: %v", at.Name, id, err)
+				}
+			}
+		}
+		files := a.files(id)
+		if len(files) == 0 {
+			continue
+		}
+		for _, f := range files {
+			if err := a.redact(f); err != nil {
+				a.log.Errorf("Unable to mask the secrets of the artifact %s: %v", f, err)
+			}
+		}
+		group := report.ResourcesGroup{Name: artifactsGroup, Header: []string{"Path"}}
+		for _, f := range files {
+			group.Rows = append(group.Rows, map[string]string{"Path": f})
+		}
+		for i := range r.Vulnerabilities {
+			r.Vulnerabilities[i].Resources = append(r.Vulnerabilities[i].Resources, group)
+		}
+		a.log.Debugf("Collected artifacts of the check %s files=%v", id, files)
+	}
+}
+
+// redact masks the secrets of the artifact if it's a text file.
+func (a *artifacts) redact(path string) error {
+	if a.rd == nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	masked := a.rd.Bytes(data)
+	if bytes.Equal(masked, data) {
+		return nil
+	}
+	return os.WriteFile(path, masked, 0o644)
+}
+
+// files returns the paths of the artifacts of the check.
+func (a *artifacts) files(checkID string) []string {
+	files := []string{}
+	filepath.WalkDir(a.checkDir(checkID), func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
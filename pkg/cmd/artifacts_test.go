@@ -0,0 +1,101 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adevinta/vulcan-agent/backend/docker"
+	"github.com/adevinta/vulcan-local/pkg/redact"
+	report "github.com/adevinta/vulcan-report"
+	"github.com/docker/docker/api/types/container"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestArtifacts(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "artifacts")
+	rd, err := redact.New(nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd.Add("s3cr3t-token")
+	art, err := newArtifacts(dir, true, rd, loggerUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc := &docker.RunConfig{ContainerConfig: &container.Config{}, HostConfig: &container.HostConfig{}}
+	art.apply(rc, "check-1")
+	wantBinds := []string{filepath.Join(dir, "check-1") + ":" + checkArtifactsDir}
+	if diff := cmp.Diff(wantBinds, rc.HostConfig.Binds); diff != "" {
+		t.Errorf("unexpected binds (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{artifactsVar + "=" + checkArtifactsDir}, rc.ContainerConfig.Env); diff != "" {
+		t.Errorf("unexpected env (-want +got):\n%s", diff)
+	}
+
+	// The check writes a screenshot in the mounted directory.
+	if err := os.WriteFile(filepath.Join(dir, "check-1", "login.png"), []byte("png"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "check-1", "token.txt"), []byte("token=s3cr3t-token"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	art.saveOutput("check-1", []byte("scanning with s3cr3t-token"))
+	reports := map[string]*report.Report{
+		"check-1": {ResultData: report.ResultData{Vulnerabilities: []report.Vulnerability{
+			{Summary: "XSS", Attachments: []report.Attachment{{Name: "../request.txt", Data: []byte("GET /")}}},
+			{Summary: "Open redirect"},
+		}}},
+		"check-2": {ResultData: report.ResultData{Vulnerabilities: []report.Vulnerability{{Summary: "Secret"}}}},
+	}
+	art.collect(reports)
+
+	want := []string{
+		filepath.Join(dir, "check-1", attachmentsDir, "request.txt"),
+		filepath.Join(dir, "check-1", "login.png"),
+		filepath.Join(dir, "check-1", outputArtifact),
+		filepath.Join(dir, "check-1", "token.txt"),
+	}
+	for _, v := range reports["check-1"].Vulnerabilities {
+		if len(v.Resources) != 1 || v.Resources[0].Name != artifactsGroup {
+			t.Fatalf("artifacts not referenced from %s: %+v", v.Summary, v.Resources)
+		}
+		got := []string{}
+		for _, row := range v.Resources[0].Rows {
+			got = append(got, row["Path"])
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("unexpected artifacts of %s (-want +got):\n%s", v.Summary, diff)
+		}
+	}
+	if content, err := os.ReadFile(want[0]); err != nil || string(content) != "GET /" {
+		t.Errorf("unexpected attachment content=%s err=%v", content, err)
+	}
+	for path, content := range map[string]string{want[2]: "scanning with *****", want[3]: "token=*****"} {
+		if got, err := os.ReadFile(path); err != nil || string(got) != content {
+			t.Errorf("unexpected content of %s content=%s err=%v", path, got, err)
+		}
+	}
+	if r := reports["check-2"].Vulnerabilities[0].Resources; len(r) != 0 {
+		t.Errorf("unexpected artifacts of the check without them: %+v", r)
+	}
+}
+
+func TestArtifactsDisabled(t *testing.T) {
+	art, err := newArtifacts("", true, nil, loggerUser)
+	if err != nil || art != nil {
+		t.Fatalf("unexpected artifacts %v %v", art, err)
+	}
+	rc := &docker.RunConfig{ContainerConfig: &container.Config{}, HostConfig: &container.HostConfig{}}
+	art.apply(rc, "check-1")
+	art.saveOutput("check-1", []byte("output"))
+	art.collect(map[string]*report.Report{"check-1": {}})
+	if len(rc.HostConfig.Binds) != 0 || len(rc.ContainerConfig.Env) != 0 {
+		t.Errorf("unexpected run config %+v %+v", rc.HostConfig.Binds, rc.ContainerConfig.Env)
+	}
+}
@@ -0,0 +1,301 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/adevinta/vulcan-agent/jobrunner"
+	agentlog "github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-agent/stateupdater"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/events"
+	"github.com/adevinta/vulcan-local/pkg/generator"
+	"github.com/adevinta/vulcan-local/pkg/redact"
+	"github.com/adevinta/vulcan-local/pkg/reporting"
+	"github.com/adevinta/vulcan-local/pkg/results"
+	report "github.com/adevinta/vulcan-report"
+)
+
+const (
+	// runsDir is the directory, relative to the cache dir, with the state
+	// of the runs that can be resumed.
+	runsDir = "runs"
+	// runsMaxAge is the time the state of the runs not resumed is kept.
+	runsMaxAge = 7 * 24 * time.Hour
+	// stateFile is the file of a run with the state of its checks.
+	stateFile = "state.json"
+	// reportsDir is the directory of a run with the reports of the checks
+	// done.
+	reportsDir = "reports"
+)
+
+// The states of the checks of a run.
+const (
+	checkPending = "pending"
+	checkRunning = "running"
+	checkDone    = "done"
+)
+
+// checkpointCheck is the state of a check in a run.
+type checkpointCheck struct {
+	Checktype string `json:"checktype"`
+	Target    string `json:"target"`
+	State     string `json:"state"`
+}
+
+// checkpoint persists the state of the checks of a run in a directory, so an
+// interrupted scan can be resumed skipping the checks already done. The
+// checks are identified by their checktype image, target and options, as
+// their ids change in every run. A nil checkpoint persists nothing.
+type checkpoint struct {
+	id  string
+	dir string
+	rd  *redact.Redactor
+	log agentlog.Logger
+
+	mu sync.Mutex
+	// states are the states of the checks indexed by key.
+	states map[string]*checkpointCheck
+	// keys are the keys of the checks of the current run indexed by check
+	// id.
+	keys map[string]string
+	// checks are the checks of the current run. The targets served to the
+	// checks are set when they start.
+	checks []config.Check
+}
+
+// openCheckpoint returns the checkpoint of the run to resume, or of a new run
+// if resume is empty. The runs are stored in the dir.
+func openCheckpoint(dir, resume string, rd *redact.Redactor, log agentlog.Logger) (*checkpoint, error) {
+	cp := &checkpoint{
+		rd:     rd,
+		log:    log,
+		states: map[string]*checkpointCheck{},
+		keys:   map[string]string{},
+	}
+	if resume != "" {
+		if filepath.Base(resume) != resume || resume == "." || resume == ".." {
+			return nil, fmt.Errorf("invalid run %s", resume)
+		}
+		cp.id = resume
+		cp.dir = filepath.Join(dir, resume)
+		content, err := os.ReadFile(filepath.Join(cp.dir, stateFile))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("run %s not found in %s", resume, dir)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(content, &cp.states); err != nil {
+			return nil, fmt.Errorf("invalid state of the run %s: %w", resume, err)
+		}
+		return cp, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	removeOldRuns(dir, runsMaxAge, log)
+	id, err := reporting.NewRunID(time.Now(), func(id string) error {
+		return os.Mkdir(filepath.Join(dir, id), 0o755)
+	})
+	if err != nil {
+		return nil, err
+	}
+	cp.id = id
+	cp.dir = filepath.Join(dir, id)
+	return cp, nil
+}
+
+// removeOldRuns removes the state of the runs in the dir not updated for
+// longer than maxAge, i.e. the runs killed and never resumed.
+func removeOldRuns(dir string, maxAge time.Duration, log agentlog.Logger) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Errorf("Unable to read the runs in %s: %v", dir, err)
+		return
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		info, err := os.Stat(filepath.Join(path, stateFile))
+		if err != nil {
+			info, err = e.Info()
+		}
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		log.Debugf("Removing the run %s not resumed since %s", e.Name(), info.ModTime())
+		if err := os.RemoveAll(path); err != nil {
+			log.Errorf("Unable to remove the run %s: %v", e.Name(), err)
+		}
+	}
+}
+
+// checkKey returns the key of the check of the job, that identifies the check
+// in all the runs of the same config.
+func checkKey(j jobrunner.Job, c config.Check) string {
+	return generator.ComputeFingerprint(j.Image, j.Target, j.AssetType, j.Options, c.Ref)
+}
+
+// resume sets in the results server the reports of the checks of the jobs
+// done in the previous runs, and returns the jobs of the checks pending. The
+// checks are saved as pending.
+func (cp *checkpoint) resume(cfg *config.Config, jobs []jobrunner.Job, rs *results.ResultsServer, em *events.Emitter) ([]jobrunner.Job, error) {
+	if cp == nil {
+		return jobs, nil
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.checks = cfg.Checks
+	pending := []jobrunner.Job{}
+	for _, j := range jobs {
+		var c config.Check
+		if check := getCheckByID(cfg.Checks, j.CheckID); check != nil {
+			c = *check
+		}
+		key := checkKey(j, c)
+		cp.keys[j.CheckID] = key
+		if s, ok := cp.states[key]; ok && s.State == checkDone {
+			r, err := cp.report(key)
+			if err == nil {
+				cp.log.Infof("Using the results of %s on %s from the run %s", checktypeName(c), c.Target, cp.id)
+				r.CheckID = j.CheckID
+				rs.SetReport(j.CheckID, r)
+				ev := checkEvent(events.CheckFinished, c)
+				ev.CheckID = j.CheckID
+				ev.Status = r.Status
+				ev.Findings = events.Int(len(r.Vulnerabilities))
+				ev.Message = "resumed"
+				em.Emit(ev)
+				continue
+			}
+			cp.log.Errorf("Unable to read the results of check %s from the run %s, running it again: %v", j.CheckID, cp.id, err)
+		}
+		cp.states[key] = &checkpointCheck{Checktype: checktypeName(c), Target: c.Target, State: checkPending}
+		pending = append(pending, j)
+	}
+	return pending, cp.save()
+}
+
+// running saves the check as running.
+func (cp *checkpoint) running(checkID string) {
+	if cp == nil {
+		return
+	}
+	cp.setState(checkID, checkRunning, nil)
+}
+
+// finished saves the check as done with its report if it finished
+// successfully, or as pending to run it again when resumed.
+func (cp *checkpoint) finished(checkID string, r *report.Report) {
+	if cp == nil {
+		return
+	}
+	if r == nil || r.Status != stateupdater.StatusFinished {
+		cp.setState(checkID, checkPending, nil)
+		return
+	}
+	cp.setState(checkID, checkDone, r)
+}
+
+func (cp *checkpoint) setState(checkID, state string, r *report.Report) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	key, ok := cp.keys[checkID]
+	if !ok {
+		return
+	}
+	s, ok := cp.states[key]
+	if !ok {
+		return
+	}
+	if r != nil {
+		var c config.Check
+		if check := getCheckByID(cp.checks, checkID); check != nil {
+			c = *check
+		}
+		if err := cp.saveReport(key, c, r); err != nil {
+			cp.log.Errorf("Unable to save the results of check %s in the run %s: %v", checkID, cp.id, err)
+			return
+		}
+	}
+	s.State = state
+	if err := cp.save(); err != nil {
+		cp.log.Errorf("Unable to save the state of the run %s: %v", cp.id, err)
+	}
+}
+
+// remove deletes the state of the run, when it's complete or it can't be
+// resumed.
+func (cp *checkpoint) remove() {
+	if cp == nil {
+		return
+	}
+	if err := os.RemoveAll(cp.dir); err != nil {
+		cp.log.Errorf("Unable to remove the run %s: %v", cp.id, err)
+	}
+}
+
+func (cp *checkpoint) save() error {
+	content, err := json.MarshalIndent(cp.states, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(cp.dir, stateFile), content)
+}
+
+func (cp *checkpoint) reportPath(key string) string {
+	return filepath.Join(cp.dir, reportsDir, key+".json")
+}
+
+func (cp *checkpoint) report(key string) (*report.Report, error) {
+	content, err := os.ReadFile(cp.reportPath(key))
+	if err != nil {
+		return nil, err
+	}
+	var r report.Report
+	if err := json.Unmarshal(content, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// saveReport stores the report of the check with the target of the check
+// instead of the one served to the check, that changes in every run.
+func (cp *checkpoint) saveReport(key string, c config.Check, r *report.Report) error {
+	r, err := withTarget(r, c)
+	if err != nil {
+		return err
+	}
+	cp.rd.Report(r)
+	content, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(cp.dir, reportsDir), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(cp.reportPath(key), content)
+}
+
+// writeFileAtomic writes the file through a temporary file, so it's never
+// left half written when the process is killed.
+func writeFileAtomic(path string, content []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/reporting"
+	"github.com/sirupsen/logrus"
+)
+
+// Diff runs the diff subcommand in args, reporting the new, fixed and
+// persisting findings between two scans of the current directory stored in
+// the history.
+func Diff(args []string, history string, log *logrus.Logger) (int, error) {
+	return diff(args, history, os.Stdout, log)
+}
+
+func diff(args []string, history string, out io.Writer, log *logrus.Logger) (int, error) {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.StringVar(&history, "history", history, "directory of the history of the scans")
+	since := fs.String("since", "", "id of the run, or date (eg 2022-06-01), to compare with, the previous run by default")
+	to := fs.String("run", "", "id of the run compared, the last run by default")
+	severity := fs.String("s", "", "min severity of the findings compared, the threshold of the run by default")
+	list := fs.Bool("list", false, "list the runs in the history")
+	asJSON := fs.Bool("json", false, "write the changes as json")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: vulcan-local diff [flags]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return config.SuccessExitCode, nil
+		}
+		return config.ErrorExitCode, err
+	}
+	if fs.NArg() > 0 {
+		return config.ErrorExitCode, fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+	if history == "" {
+		return config.ErrorExitCode, fmt.Errorf("history directory not set")
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return config.ErrorExitCode, err
+	}
+	runs, err := reporting.LoadHistory(history, wd)
+	if err != nil {
+		return config.ErrorExitCode, err
+	}
+	if *list {
+		return config.SuccessExitCode, listRuns(out, runs)
+	}
+	if len(runs) < 2 {
+		return config.ErrorExitCode, fmt.Errorf("at least two runs of %s are required in the history %s, found %d", wd, history, len(runs))
+	}
+
+	toRun := &runs[len(runs)-1]
+	if *to != "" {
+		if toRun, err = reporting.FindRun(runs, *to); err != nil {
+			return config.ErrorExitCode, err
+		}
+	}
+	var fromRun *reporting.HistoryRun
+	if *since != "" {
+		if fromRun, err = reporting.FindRun(runs, *since); err != nil {
+			return config.ErrorExitCode, err
+		}
+	} else {
+		for i := range runs {
+			if runs[i].ID == toRun.ID {
+				break
+			}
+			fromRun = &runs[i]
+		}
+		if fromRun == nil {
+			return config.ErrorExitCode, fmt.Errorf("no runs before %s", toRun.ID)
+		}
+	}
+
+	var s config.Severity
+	if *severity == "" {
+		*severity = toRun.Severity
+	}
+	if err := s.UnmarshalText([]byte(*severity)); err != nil {
+		return config.ErrorExitCode, err
+	}
+	delta := reporting.DiffRuns(fromRun, toRun, s)
+	if *asJSON {
+		content, err := json.MarshalIndent(delta, "", "    ")
+		if err != nil {
+			return config.ErrorExitCode, err
+		}
+		_, err = fmt.Fprintln(out, string(content))
+		return config.SuccessExitCode, err
+	}
+	log.Debugf("Comparing runs from=%s to=%s severity=%s", fromRun.ID, toRun.ID, *severity)
+	_, err = fmt.Fprint(out, delta)
+	return config.SuccessExitCode, err
+}
+
+// listRuns writes the runs as a table.
+func listRuns(out io.Writer, runs []reporting.HistoryRun) error {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTIME\tFINDINGS\tEXIT CODE\tTARGETS")
+	for _, r := range runs {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%v\n", r.ID, r.Time.Local().Format("2006-01-02 15:04:05"), len(r.Findings), r.ExitCode, r.Targets)
+	}
+	return tw.Flush()
+}
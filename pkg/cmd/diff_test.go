@@ -0,0 +1,68 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/reporting"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiff(t *testing.T) {
+	history := t.TempDir()
+	cfg := &config.Config{
+		Targets:   []config.Target{{Target: "."}},
+		Reporting: config.Reporting{Severity: config.SeverityHigh},
+	}
+	var ids []string
+	for _, vs := range [][]reporting.ExtendedVulnerability{
+		{testVuln("vulcan-gitleaks", ".", "Kept", 8.0), testVuln("vulcan-gitleaks", ".", "Fixed", 8.0)},
+		{testVuln("vulcan-gitleaks", ".", "Kept", 8.0), testVuln("vulcan-gitleaks", ".", "New", 8.0)},
+	} {
+		run, err := reporting.SaveHistory(history, cfg, vs, 103)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, run.ID)
+	}
+
+	var out bytes.Buffer
+	if _, err := diff([]string{"-history", history, "-json"}, "", &out, loggerUser); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var delta reporting.HistoryDelta
+	if err := json.Unmarshal(out.Bytes(), &delta); err != nil {
+		t.Fatal(err)
+	}
+	got := []int{len(delta.New), len(delta.Fixed), len(delta.Persisting)}
+	if diff := cmp.Diff([]int{1, 1, 1}, got); diff != "" {
+		t.Errorf("unexpected new, fixed and persisting findings (-want +got):\n%s", diff)
+	}
+	if delta.From != ids[0] || delta.To != ids[1] {
+		t.Errorf("unexpected runs compared from=%s to=%s", delta.From, delta.To)
+	}
+
+	out.Reset()
+	if _, err := diff([]string{"-list"}, history, &out, loggerUser); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, id := range ids {
+		if !strings.Contains(out.String(), id) {
+			t.Errorf("run %s not listed %q", id, out.String())
+		}
+	}
+
+	if _, err := diff([]string{"-since", "unknown"}, history, &out, loggerUser); err == nil {
+		t.Errorf("expected error with an unknown run")
+	}
+	if _, err := diff(nil, t.TempDir(), &out, loggerUser); err == nil {
+		t.Errorf("expected error with an empty history")
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/adevinta/vulcan-agent/jobrunner"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/events"
+	"github.com/adevinta/vulcan-local/pkg/telemetry"
+	"github.com/sirupsen/logrus"
+)
+
+// metricsShutdownTimeout is the time given to the metrics server to finish
+// the requests in progress.
+const metricsShutdownTimeout = 5 * time.Second
+
+// openEmitter returns the emitter of the progress of the scans, writing to the
+// progress file and feeding the metrics server and the OTLP traces exporter
+// when configured, and the func stopping them.
+func openEmitter(cfg *config.Config, log *logrus.Logger) (*events.Emitter, func(), error) {
+	em, err := events.Open(cfg.Conf.ProgressFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to open progress file: %w", err)
+	}
+	tracer, err := telemetry.NewTracerFromEnv(log)
+	if err != nil {
+		em.Close()
+		return nil, nil, fmt.Errorf("unable to configure the traces: %w", err)
+	}
+	if tracer == nil && cfg.Conf.MetricsAddr == "" {
+		return em, func() { em.Close() }, nil
+	}
+	if em == nil {
+		em = events.New(nil)
+	}
+	var srv *http.Server
+	if cfg.Conf.MetricsAddr != "" {
+		ln, err := net.Listen("tcp", cfg.Conf.MetricsAddr)
+		if err != nil {
+			em.Close()
+			return nil, nil, fmt.Errorf("unable to serve the metrics: %w", err)
+		}
+		metrics := telemetry.NewMetrics()
+		em.Listen(metrics.Observe)
+		srv = &http.Server{Handler: metrics.Handler()}
+		go func() {
+			if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Errorf("Error serving the metrics: %v", err)
+			}
+		}()
+		log.Infof("Serving metrics in http://%s/metrics", ln.Addr())
+	}
+	if tracer != nil {
+		em.Listen(tracer.Observe)
+	}
+	return em, func() {
+		if srv != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+			defer cancel()
+			srv.Shutdown(ctx)
+		}
+		if tracer != nil {
+			tracer.Shutdown()
+		}
+		em.Close()
+	}, nil
+}
+
+// checkEvent returns an event of the given type for the check.
+func checkEvent(typ events.Type, c config.Check) events.Event {
+	ev := events.Event{
+		Type:      typ,
+		CheckID:   c.Id,
+		Checktype: string(c.Type),
+		Target:    c.Target,
+		AssetType: c.AssetType,
+	}
+	if c.Checktype != nil {
+		ev.Checktype = c.Checktype.Name
+	}
+	return ev
+}
+
+// emitScheduled emits a CheckScheduled event for every check of the jobs.
+func emitScheduled(em *events.Emitter, checks []config.Check, jobs []jobrunner.Job) {
+	byID := map[string]config.Check{}
+	for _, c := range checks {
+		byID[c.Id] = c
+	}
+	for _, j := range jobs {
+		c, ok := byID[j.CheckID]
+		if !ok {
+			c = config.Check{Id: j.CheckID, Target: j.Target, AssetType: j.AssetType}
+		}
+		ev := checkEvent(events.CheckScheduled, c)
+		ev.Image = j.Image
+		em.Emit(ev)
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// hookName is the git hook running the staged scan.
+	hookName = "pre-commit"
+	// hookMarker identifies the hooks installed by vulcan-local.
+	hookMarker = "# Installed by vulcan-local hook install."
+)
+
+// Hook runs the hook subcommand in args, install or uninstall, managing the
+// git pre-commit hook of the repository in the current directory that scans
+// the staged files.
+func Hook(args []string, log *logrus.Logger) (int, error) {
+	if len(args) == 0 {
+		return config.ErrorExitCode, fmt.Errorf("missing hook command [install uninstall]")
+	}
+	switch args[0] {
+	case "install":
+		return hookInstall(args[1:], log)
+	case "uninstall":
+		return hookUninstall(args[1:], log)
+	default:
+		return config.ErrorExitCode, fmt.Errorf("unknown hook command %s [install uninstall]", args[0])
+	}
+}
+
+func hookInstall(args []string, log *logrus.Logger) (int, error) {
+	bin, _ := os.Executable()
+	fs := flag.NewFlagSet("hook install", flag.ContinueOnError)
+	force := fs.Bool("force", false, "replace the existing pre-commit hook")
+	fs.StringVar(&bin, "bin", bin, "vulcan-local binary run by the hook")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: vulcan-local hook install [flags] [-- vulcan-local flags]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return config.SuccessExitCode, nil
+		}
+		return config.ErrorExitCode, err
+	}
+	path, err := hookPath()
+	if err != nil {
+		return config.ErrorExitCode, err
+	}
+	if content, err := os.ReadFile(path); err == nil && !bytes.Contains(content, []byte(hookMarker)) && !*force {
+		return config.ErrorExitCode, fmt.Errorf("hook %s already exists, use -force to replace it", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return config.ErrorExitCode, err
+	}
+	if err := os.WriteFile(path, []byte(hookScript(bin, fs.Args())), 0o755); err != nil {
+		return config.ErrorExitCode, fmt.Errorf("unable to write hook %s: %w", path, err)
+	}
+	log.Infof("Installed %s hook %s", hookName, path)
+	return config.SuccessExitCode, nil
+}
+
+func hookUninstall(args []string, log *logrus.Logger) (int, error) {
+	if len(args) > 0 {
+		return config.ErrorExitCode, fmt.Errorf("unexpected arguments %v", args)
+	}
+	path, err := hookPath()
+	if err != nil {
+		return config.ErrorExitCode, err
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Infof("Hook %s not installed", path)
+		return config.SuccessExitCode, nil
+	}
+	if err != nil {
+		return config.ErrorExitCode, err
+	}
+	if !bytes.Contains(content, []byte(hookMarker)) {
+		return config.ErrorExitCode, fmt.Errorf("hook %s not installed by vulcan-local", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return config.ErrorExitCode, err
+	}
+	log.Infof("Removed %s hook %s", hookName, path)
+	return config.SuccessExitCode, nil
+}
+
+// hookPath returns the path of the pre-commit hook of the repository in the
+// current directory, honoring core.hooksPath.
+func hookPath() (string, error) {
+	out, err := execCommand("git", "rev-parse", "--git-path", "hooks").Output()
+	if err != nil {
+		return "", fmt.Errorf("unable to find the hooks of the git repository: %w", err)
+	}
+	return filepath.Join(strings.TrimSpace(string(out)), hookName), nil
+}
+
+// hookScript returns the hook running the staged scan with the binary and
+// the extra flags.
+func hookScript(bin string, flags []string) string {
+	cmd := []string{shellQuote(bin), "-staged"}
+	for _, f := range flags {
+		cmd = append(cmd, shellQuote(f))
+	}
+	return fmt.Sprintf("#!/bin/sh\n%s\nexec %s \"$@\"\n", hookMarker, strings.Join(cmd, " "))
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
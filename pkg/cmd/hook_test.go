@@ -0,0 +1,67 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHook(t *testing.T) {
+	repo := t.TempDir()
+	if out, err := exec.Command("git", "-C", repo, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("unable to init repository: %v %s", err, out)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(repo); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	path := filepath.Join(repo, ".git", "hooks", hookName)
+
+	if _, err := Hook([]string{"install", "-bin", "/usr/local/bin/vulcan-local", "--", "-s", "MEDIUM"}, loggerUser); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "exec '/usr/local/bin/vulcan-local' -staged '-s' 'MEDIUM' \"$@\"\n"
+	if !strings.HasSuffix(string(content), want) {
+		t.Errorf("unexpected hook content %q", content)
+	}
+	// Reinstalling replaces the hooks installed by vulcan-local.
+	if _, err := Hook([]string{"install", "-bin", "vulcan-local"}, loggerUser); err != nil {
+		t.Errorf("unexpected error reinstalling the hook %v", err)
+	}
+	if _, err := Hook([]string{"uninstall"}, loggerUser); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("hook not removed %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("#!/bin/sh\nmake lint\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Hook([]string{"install"}, loggerUser); err == nil {
+		t.Error("expected error replacing an existing hook")
+	}
+	if _, err := Hook([]string{"uninstall"}, loggerUser); err == nil {
+		t.Error("expected error removing a hook not installed by vulcan-local")
+	}
+	if _, err := Hook([]string{"install", "-force"}, loggerUser); err != nil {
+		t.Errorf("unexpected error forcing the install %v", err)
+	}
+	if _, err := Hook([]string{"unknown"}, loggerUser); err == nil {
+		t.Error("expected error for an unknown command")
+	}
+}
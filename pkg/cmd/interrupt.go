@@ -0,0 +1,72 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/sirupsen/logrus"
+)
+
+// errInterrupted is returned by the scans stopped by a signal.
+var errInterrupted = errors.New("scan interrupted")
+
+// osExit allows to replace os.Exit in the tests.
+var osExit = os.Exit
+
+// interruptContext returns a context cancelled when the process receives an
+// interrupt or terminate signal, so the scan stops scheduling checks, aborts
+// the running ones and cleans up before returning. A second signal exits
+// without waiting for the cleanup. The returned func stops handling the
+// signals.
+func interruptContext(log *logrus.Logger) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case s := <-sig:
+			log.Warnf("Received %s, stopping the checks and cleaning up, repeat to exit now", s)
+			cancel()
+		case <-done:
+			return
+		}
+		select {
+		case <-sig:
+			log.Errorf("Exiting without cleaning up")
+			osExit(config.ErrorExitCode)
+		case <-done:
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sig)
+		close(done)
+		cancel()
+	}
+}
+
+// withInterrupt returns a context derived from ctx that is also cancelled
+// when the interrupt context is done.
+func withInterrupt(ctx, interrupt context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if interrupt.Err() != nil {
+		cancel()
+		return ctx, cancel
+	}
+	go func() {
+		select {
+		case <-interrupt.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
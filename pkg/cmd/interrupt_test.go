@@ -0,0 +1,112 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/adevinta/vulcan-agent/backend"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/results"
+)
+
+func TestInterruptContext(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("interrupt signals can't be sent on windows")
+	}
+	exited := make(chan int, 1)
+	old := osExit
+	defer func() { osExit = old }()
+	osExit = func(code int) { exited <- code }
+
+	ctx, stop := interruptContext(loggerUser)
+	defer stop()
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context not cancelled by the signal")
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case code := <-exited:
+		if code != config.ErrorExitCode {
+			t.Errorf("unexpected exit code %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("not exited by the second signal")
+	}
+}
+
+// blockingBackend runs the checks until their context is done.
+type blockingBackend struct {
+	started chan struct{}
+}
+
+func (b *blockingBackend) Run(ctx context.Context, params backend.RunParams) (<-chan backend.RunResult, error) {
+	res := make(chan backend.RunResult, 1)
+	go func() {
+		close(b.started)
+		<-ctx.Done()
+		res <- backend.RunResult{Error: ctx.Err()}
+	}()
+	return res, nil
+}
+
+func TestRetryBackendInterrupted(t *testing.T) {
+	rs, err := results.Start(loggerUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Shutdown()
+	cfg := &config.Config{
+		Conf:   config.Conf{Retries: 2},
+		Checks: []config.Check{{Id: "id"}},
+	}
+	interrupt, cancel := context.WithCancel(context.Background())
+	bb := &blockingBackend{started: make(chan struct{})}
+	b := newRetryBackend(interrupt, bb, rs, cfg, nil, loggerUser)
+	ch, err := b.Run(context.Background(), backend.RunParams{CheckID: "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-bb.started
+	cancel()
+	select {
+	case res := <-ch:
+		if !errors.Is(res.Error, context.Canceled) {
+			t.Errorf("unexpected error %v", res.Error)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("check not aborted")
+	}
+
+	// The checks aren't started after the interruption.
+	fb := &fakeBackend{}
+	b = newRetryBackend(interrupt, fb, rs, cfg, nil, loggerUser)
+	ch, err = b.Run(context.Background(), backend.RunParams{CheckID: "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := <-ch; !errors.Is(res.Error, context.Canceled) {
+		t.Errorf("unexpected error %v", res.Error)
+	}
+	if fb.runs != 0 {
+		t.Errorf("check started after the interruption runs=%d", fb.runs)
+	}
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	agentlog "github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-local/pkg/config"
+)
+
+// checkKubernetes fails if the config uses features that need a local
+// container runtime.
+func checkKubernetes(cfg *config.Config) error {
+	if cfg.Conf.DevCheck != "" {
+		return fmt.Errorf("the dev checks are not supported with the kubernetes runtime")
+	}
+	if cfg.Conf.LocalRegistry {
+		return fmt.Errorf("the local registry is not supported with the kubernetes runtime")
+	}
+	return nil
+}
+
+// kubernetesAgentIP returns the address the pods of the checks use to reach
+// the agent and the local services. Inside a cluster it's the ip of the pod
+// running vulcan-local, outside it must be advertised.
+func kubernetesAgentIP(cfg *config.Config, log agentlog.Logger) (string, error) {
+	if cfg.Conf.AdvertiseAddr != "" {
+		return cfg.Conf.AdvertiseAddr, nil
+	}
+	host := os.Getenv("KUBERNETES_SERVICE_HOST")
+	if host == "" {
+		return "", fmt.Errorf("the advertise address is required to run the checks in kubernetes from outside the cluster")
+	}
+	ip := getRouteIP(host, log)
+	if ip == "" {
+		return "", fmt.Errorf("unable to get the ip of the pod")
+	}
+	return ip, nil
+}
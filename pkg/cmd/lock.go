@@ -0,0 +1,85 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	agentlog "github.com/adevinta/vulcan-agent/log"
+
+	"github.com/adevinta/vulcan-local/pkg/checktypes"
+	"github.com/adevinta/vulcan-local/pkg/config"
+)
+
+// resolveDigest returns the digest of the image in its registry.
+var resolveDigest = func(cfg *config.Config, log agentlog.Logger) checktypes.DigestResolver {
+	auths := []checktypes.RegistryAuth{}
+	// The credentials of the docker config are resolved by the resolver.
+	for _, a := range registryAuths(cfg.Conf.Registries, nil, log) {
+		auths = append(auths, checktypes.RegistryAuth{Server: a.Server, Username: a.User, Password: a.Pass})
+	}
+	return checktypes.RemoteDigestResolver(auths)
+}
+
+// updateLock writes to the lock file the digests of the images of the
+// loaded checktypes.
+func updateLock(cfg *config.Config, log agentlog.Logger) (int, error) {
+	if cfg.Conf.LockFile == "" {
+		return config.ErrorExitCode, fmt.Errorf("missing lock file")
+	}
+	if cfg.Conf.Offline {
+		return config.ErrorExitCode, fmt.Errorf("unable to update the lock file in offline mode")
+	}
+	lock, err := checktypes.ResolveLock(cfg.CheckTypes, resolveDigest(cfg, log), log)
+	if err != nil {
+		return config.ErrorExitCode, err
+	}
+	if err := lock.Write(cfg.Conf.LockFile); err != nil {
+		return config.ErrorExitCode, fmt.Errorf("unable to write lock file: %w", err)
+	}
+	log.Infof("Locked %d checktypes in %s", len(lock.Checktypes), cfg.Conf.LockFile)
+	return config.SuccessExitCode, nil
+}
+
+// pinChecktypes replaces the images of the checktypes with the ones pinned in
+// the lock file, if it exists, and returns the images not pinned.
+func pinChecktypes(cfg *config.Config, log agentlog.Logger) ([]string, error) {
+	if cfg.Conf.LockFile == "" {
+		return nil, nil
+	}
+	lock, err := checktypes.ReadLock(cfg.Conf.LockFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Debugf("Lock file %s not found, using the images of the catalogs", cfg.Conf.LockFile)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Pinning checktype images with %s", cfg.Conf.LockFile)
+	return lock.Pin(cfg.CheckTypes, log)
+}
+
+// checkPinnedImages fails if any of the images is not pinned in the lock file.
+func checkPinnedImages(images, unpinned []string, lockFile string) error {
+	missing := map[string]bool{}
+	for _, image := range unpinned {
+		missing[image] = true
+	}
+	found := []string{}
+	for _, image := range images {
+		if missing[image] {
+			found = append(found, image)
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+	sort.Strings(found)
+	return fmt.Errorf("images not pinned in %s, run with -update: %s", lockFile, strings.Join(found, ", "))
+}
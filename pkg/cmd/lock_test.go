@@ -0,0 +1,42 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"testing"
+)
+
+func TestCheckPinnedImages(t *testing.T) {
+	tests := []struct {
+		name     string
+		images   []string
+		unpinned []string
+		wantErr  bool
+	}{
+		{
+			name:   "NoLock",
+			images: []string{"vulcansec/vulcan-trivy:edge"},
+		},
+		{
+			name:     "Pinned",
+			images:   []string{"vulcansec/vulcan-trivy@sha256:0001"},
+			unpinned: []string{"vulcansec/vulcan-tls:edge"},
+		},
+		{
+			name:     "Unpinned",
+			images:   []string{"vulcansec/vulcan-trivy@sha256:0001", "vulcansec/vulcan-tls:edge"},
+			unpinned: []string{"vulcansec/vulcan-tls:edge"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPinnedImages(tt.images, tt.unpinned, "vulcan.lock")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
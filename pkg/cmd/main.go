@@ -6,10 +6,12 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strconv"
@@ -20,29 +22,202 @@ import (
 	"github.com/adevinta/vulcan-agent/backend"
 	"github.com/adevinta/vulcan-agent/backend/docker"
 	agentconfig "github.com/adevinta/vulcan-agent/config"
+	"github.com/adevinta/vulcan-agent/jobrunner"
 	agentlog "github.com/adevinta/vulcan-agent/log"
 	"github.com/adevinta/vulcan-local/pkg/checktypes"
 	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/container"
+	"github.com/adevinta/vulcan-local/pkg/events"
 	"github.com/adevinta/vulcan-local/pkg/generator"
 	"github.com/adevinta/vulcan-local/pkg/gitservice"
+	"github.com/adevinta/vulcan-local/pkg/kubernetes"
+	"github.com/adevinta/vulcan-local/pkg/ports"
+	"github.com/adevinta/vulcan-local/pkg/redact"
+	"github.com/adevinta/vulcan-local/pkg/registryservice"
 	"github.com/adevinta/vulcan-local/pkg/reporting"
 	"github.com/adevinta/vulcan-local/pkg/results"
 	"github.com/adevinta/vulcan-local/pkg/sqsservice"
-	"github.com/phayes/freeport"
+	"github.com/adevinta/vulcan-local/pkg/tunnelservice"
+	report "github.com/adevinta/vulcan-report"
 	"github.com/sirupsen/logrus"
 )
 
-const defaultDockerHost = "host.docker.internal"
+// hostIPImage is the image used to infer the ip of the host.
+const hostIPImage = "busybox:1.34.1"
 
 var execCommand = exec.Command
 
+// goos allows to test the behaviour of the other operating systems.
+var goos = runtime.GOOS
+
 func Run(cfg *config.Config, log *logrus.Logger) (int, error) {
+	em, closeEmitter, err := openEmitter(cfg, log)
+	if err != nil {
+		return config.ErrorExitCode, err
+	}
+	defer closeEmitter()
+	ctx, stop := interruptContext(log)
+	defer stop()
+	return run(ctx, cfg, log, em, scanOptions{})
+}
+
+// Options are the dependencies of the scans injected by the programs
+// embedding vulcan-local.
+type Options struct {
+	// Runtime runs the checks instead of the runtime of the config. It's not
+	// closed when the scan finishes.
+	Runtime container.Runtime
+}
+
+// Result is the outcome of a scan.
+type Result struct {
+	// ExitCode is the exit code of the scan given by the findings.
+	ExitCode int
+	// Checks are the checks of the scan. The ones filtered have no id.
+	Checks []config.Check
+	// Reports are the reports of the finished checks indexed by check id.
+	Reports map[string]*report.Report
+	// Findings are the vulnerabilities of the reports.
+	Findings []reporting.ExtendedVulnerability
+}
+
+// Scan runs the scan until it finishes or the context is done. Unlike Run,
+// it doesn't handle the signals of the process.
+func Scan(ctx context.Context, cfg *config.Config, log *logrus.Logger, opts Options) (Result, error) {
+	em, closeEmitter, err := openEmitter(cfg, log)
+	if err != nil {
+		return Result{ExitCode: config.ErrorExitCode}, err
+	}
+	defer closeEmitter()
+	res := Result{}
+	code, err := run(ctx, cfg, log, em, scanOptions{
+		runtime: opts.Runtime,
+		onFindings: func(reports map[string]*report.Report, vs []reporting.ExtendedVulnerability) {
+			res.Reports = reports
+			res.Findings = vs
+		},
+	})
+	res.ExitCode = code
+	res.Checks = cfg.Checks
+	return res, err
+}
+
+// scanOptions are the optional dependencies and callbacks of a scan.
+type scanOptions struct {
+	// runtime runs the checks instead of the runtime of the config.
+	runtime container.Runtime
+	// onFindings, if not nil, is called with the reports of the checks and
+	// the vulnerabilities found.
+	onFindings func(map[string]*report.Report, []reporting.ExtendedVulnerability)
+}
+
+// run runs the scan emitting its progress to em until it finishes or the
+// context is done.
+func run(ctx context.Context, cfg *config.Config, log *logrus.Logger, em *events.Emitter, opts scanOptions) (int, error) {
+	rd, err := newRedactor(cfg)
+	if err != nil {
+		return config.ErrorExitCode, err
+	}
+	if rd != nil || em != nil {
+		// The secrets are masked before the other hooks receive the entries.
+		hooks := logrus.LevelHooks{}
+		if rd != nil {
+			hooks.Add(rd.Hook())
+		}
+		for _, hs := range log.Hooks {
+			for _, h := range hs {
+				hooks.Add(h)
+			}
+		}
+		if em != nil {
+			hooks.Add(em.Hook())
+		}
+		old := log.ReplaceHooks(hooks)
+		defer log.ReplaceHooks(old)
+	}
+	em.Emit(events.Event{Type: events.ScanStarted})
+	code, err := scan(ctx, cfg, log, em, rd, opts)
+	// The errors are logged by the caller, without the hooks.
+	err = rd.Error(err)
+	if err != nil {
+		em.Emit(events.Event{Type: events.Error, Message: err.Error()})
+	}
+	em.Emit(events.Event{Type: events.ScanFinished, ExitCode: events.Int(code)})
+	return code, err
+}
+
+// scan runs the scan. The deferred cleanups run when the context is done.
+func scan(ctx context.Context, cfg *config.Config, log *logrus.Logger, em *events.Emitter, rd *redact.Redactor, opts scanOptions) (int, error) {
 	var err error
 
 	log.SetLevel(agentlog.ParseLogLevel(cfg.Conf.LogLevel.String()))
 
-	if err = checkDependencies(cfg, log); err != nil {
-		return config.ErrorExitCode, fmt.Errorf("unmet dependencies: %w", err)
+	// The dry run only resolves the checks, without using the container
+	// runtime. The kubernetes runtime runs the checks as Jobs, without a
+	// docker compatible API.
+	rt := opts.runtime
+	k8s := rt == nil && cfg.Conf.Runtime == kubernetes.Runtime
+	if k8s {
+		if err := checkKubernetes(cfg); err != nil {
+			return config.ErrorExitCode, err
+		}
+	}
+	if !cfg.Conf.DryRun {
+		// The injected runtime is already connected.
+		if err = checkDependencies(cfg, rt == nil, log); err != nil {
+			return config.ErrorExitCode, fmt.Errorf("unmet dependencies: %w", err)
+		}
+	}
+	if !cfg.Conf.DryRun && !k8s {
+		if rt == nil {
+			rt, err = container.New(cfg.Conf.Runtime, runtimeBin(cfg), cfg.Conf.DockerContext, log)
+			if err != nil {
+				return config.ErrorExitCode, err
+			}
+			defer rt.Close()
+		}
+		if host := rt.Host(); host != "" {
+			log.Debugf("Using container runtime %s host=%s remote=%s", rt.Name(), host, rt.RemoteHost())
+		}
+		// The docker clients, used by the agent and to build the checks,
+		// connect to the runtime through the DOCKER_* env vars.
+		defer setenv(rt.Env())()
+	}
+
+	// The catalogs, the images and the uploads use the proxy and trust the
+	// custom CA certificates, as the checks.
+	var caBundle string
+	if cfg.Conf.Proxy.CABundle != "" {
+		if caBundle, err = writeCABundle(cfg.Conf.Proxy.CABundle); err != nil {
+			return config.ErrorExitCode, err
+		}
+		defer os.Remove(caBundle)
+	}
+	defer setenv(proxyEnv(cfg.Conf.Proxy, caBundle, "localhost", "127.0.0.1"))()
+
+	var cacheTTL time.Duration
+	if cfg.Conf.CacheTTL != "" {
+		if cacheTTL, err = time.ParseDuration(cfg.Conf.CacheTTL); err != nil {
+			return config.ErrorExitCode, fmt.Errorf("invalid cache ttl: %w", err)
+		}
+	}
+
+	if cfg.Conf.Concurrency < 1 {
+		return config.ErrorExitCode, fmt.Errorf("invalid concurrency %d", cfg.Conf.Concurrency)
+	}
+
+	if !validSnapshotStrategy(cfg.Conf.Snapshot) {
+		return config.ErrorExitCode, fmt.Errorf("invalid snapshot strategy %s %v", cfg.Conf.Snapshot, gitservice.SnapshotStrategies())
+	}
+
+	if cfg.Conf.Staged {
+		// Only the fast checks on the current repository by default.
+		if cfg.Conf.Include == "" {
+			cfg.Conf.Include = generator.StagedChecktypes
+		}
+		if len(cfg.Targets) == 0 {
+			cfg.Targets = []config.Target{{Target: "."}}
+		}
 	}
 
 	if cfg.Conf.Include != "" {
@@ -55,11 +230,50 @@ func Run(cfg *config.Config, log *logrus.Logger) (int, error) {
 			return config.ErrorExitCode, fmt.Errorf("invalid exclude regexp: %w", err)
 		}
 	}
-	checktypes, err := checktypes.Import(cfg.Conf.Repositories, log)
+	var cache *checktypes.Cache
+	if cfg.Conf.CacheDir != "" {
+		cache = &checktypes.Cache{Dir: cfg.Conf.CacheDir, Offline: cfg.Conf.Offline}
+	} else if cfg.Conf.Offline {
+		return config.ErrorExitCode, fmt.Errorf("offline mode requires a cache dir")
+	}
+	var devChecktypes checktypes.Checktypes
+	if cfg.Conf.DevCheck != "" {
+		ct, err := checktypes.DevChecktype(cfg.Conf.DevCheck, log)
+		if err != nil {
+			return config.ErrorExitCode, fmt.Errorf("unable to load dev check: %w", err)
+		}
+		devChecktypes = checktypes.Checktypes{checktypes.ChecktypeRef(ct.Name): ct}
+	}
+	checktypes, err := checktypes.ImportCached(cfg.Conf.Repositories, cache, log)
 	if err != nil {
 		return config.ErrorExitCode, fmt.Errorf("unable to load repositories: %w", err)
 	}
+	for ref, ct := range devChecktypes {
+		// Only run the checktype in development against the targets.
+		log.Infof("Running dev checktype %s from %s", ct.Name, cfg.Conf.DevCheck)
+		checktypes[ref] = ct
+		cfg.Conf.IncludeR = regexp.MustCompile("^" + regexp.QuoteMeta(ct.Name) + "$")
+		cfg.Conf.ExcludeR = nil
+	}
+	for ref, ct := range checktypes {
+		if tags, ok := cfg.Conf.ChecktypeTags[ct.Name]; ok {
+			ct.Tags = append(append([]string{}, ct.Tags...), tags...)
+			checktypes[ref] = ct
+		}
+	}
 	cfg.CheckTypes = checktypes
+	if cfg.Conf.UpdateLock {
+		return updateLock(cfg, log)
+	}
+	unpinned, err := pinChecktypes(cfg, log)
+	if err != nil {
+		return config.ErrorExitCode, err
+	}
+	if cfg.Discovery.Enabled {
+		if err = generator.DiscoverTargets(cfg, log); err != nil {
+			return config.ErrorExitCode, fmt.Errorf("unable to discover targets: %w", err)
+		}
+	}
 	if err = generator.ComputeTargets(cfg, log); err != nil {
 		return config.ErrorExitCode, err
 	}
@@ -78,19 +292,114 @@ func Run(cfg *config.Config, log *logrus.Logger) (int, error) {
 			return config.ErrorExitCode, err
 		}
 	}
+	if err := generator.AddIaCChecks(cfg, log); err != nil {
+		return config.ErrorExitCode, fmt.Errorf("unable to add the IaC checks: %w", err)
+	}
 
-	agentIP := getAgentIP(cfg.Conf.IfName, log)
-	if agentIP == "" {
-		return config.ErrorExitCode, fmt.Errorf("unable to get the agent ip %s", cfg.Conf.IfName)
+	if cfg.Conf.Diff != "" {
+		log.Debugf("Filtering checks without changes since %s", cfg.Conf.Diff)
+		if err := generator.FilterChangedChecks(cfg, log); err != nil {
+			return config.ErrorExitCode, err
+		}
+	}
+
+	if cfg.Conf.Staged {
+		log.Debug("Filtering checks without staged files")
+		if err := generator.FilterStagedChecks(cfg, log); err != nil {
+			return config.ErrorExitCode, err
+		}
 	}
 
-	hostIP := getHostIP(log)
-	if hostIP == "" {
-		return config.ErrorExitCode, fmt.Errorf("unable to infer host ip")
+	if cfg.Conf.DryRun {
+		return dryRun(cfg, os.Stdout)
+	}
+
+	var agentIP, hostIP string
+	if k8s {
+		agentIP, err = kubernetesAgentIP(cfg, log)
+		if err != nil {
+			return config.ErrorExitCode, err
+		}
+		// The pods reach the services of this machine through the same
+		// address.
+		hostIP = agentIP
+	} else {
+		remote := rt.RemoteHost()
+		agentIP = cfg.Conf.AdvertiseAddr
+		if agentIP == "" && remote != "" {
+			// The services must be reachable from the remote machine running
+			// the containers.
+			agentIP = getRouteIP(remote, log)
+		}
+		if agentIP == "" {
+			agentIP = getAgentIP(cfg.Conf.IfName, rt.HostGateway(), log)
+		}
+		if agentIP == "" {
+			return config.ErrorExitCode, fmt.Errorf("unable to get the agent ip %s", cfg.Conf.IfName)
+		}
+
+		// The localhost targets are reached through the host ip. With a remote
+		// runtime they are in this machine, instead of the one running the
+		// containers.
+		hostIP = agentIP
+		switch {
+		case remote != "":
+		case goos == "windows":
+			// The default route of the containers in Docker Desktop is the
+			// VM, not the host.
+			hostIP = rt.HostGateway()
+		default:
+			if cfg.Conf.Offline {
+				if err := checkOfflineImages([]string{hostIPImage}, cache, log); err != nil {
+					return config.ErrorExitCode, err
+				}
+			}
+			hostIP = getHostIP(rt.Bin(), log)
+		}
+		if hostIP == "" {
+			return config.ErrorExitCode, fmt.Errorf("unable to infer host ip")
+		}
 	}
 
-	gs := gitservice.New(log)
+	portRange, err := ports.ParseRange(cfg.Conf.LocalServices.PortRange)
+	if err != nil {
+		return config.ErrorExitCode, err
+	}
+	lfsMaxSize, err := cfg.Conf.LFS.MaxSizeBytes()
+	if err != nil {
+		return config.ErrorExitCode, err
+	}
+	gitBind := cfg.Conf.GitBind
+	if gitBind == "" {
+		gitBind = cfg.Conf.LocalServices.Iface
+	}
+	if err := checkBindAddresses(agentIP, gitBind, cfg.Conf.LocalServices.Iface); err != nil {
+		return config.ErrorExitCode, err
+	}
+	gs := gitservice.New(log, gitservice.Config{
+		Host:           agentIP,
+		GitBin:         cfg.Conf.GitBin,
+		BindAddress:    gitBind,
+		Multiplexed:    cfg.Conf.MultiplexGit,
+		Exclude:        cfg.Exclude,
+		Strategy:       cfg.Conf.Snapshot,
+		SkipSubmodules: cfg.Conf.NoSubmodules,
+		Ports:          portRange,
+		SkipLFS:        cfg.Conf.LFS.Skip,
+		LFSMaxSize:     lfsMaxSize,
+	})
 	defer gs.Shutdown()
+	var rs registryservice.RegistryService
+	if cfg.Conf.LocalRegistry {
+		rs = registryservice.New(log, registryservice.Config{
+			Host:        agentIP,
+			BindAddress: cfg.Conf.LocalServices.Iface,
+			Ports:       portRange,
+		})
+		defer rs.Shutdown()
+	}
+	ts := tunnelservice.New(log, tunnelservice.Config{Host: agentIP, Ports: portRange})
+	defer ts.Shutdown()
 	log.Debug("Generating jobs")
 	jobs, err := generator.GenerateJobs(cfg, agentIP, hostIP, gs, log)
 	if err != nil {
@@ -101,11 +410,66 @@ func Run(cfg *config.Config, log *logrus.Logger) (int, error) {
 		log.Infof("Empty list of checks")
 		return config.SuccessExitCode, nil
 	}
+	// The checktypes package is shadowed by the checktypes of the scan.
+	var durations map[string]time.Duration
+	if cache != nil {
+		if durations, err = cache.Durations(); err != nil {
+			log.Errorf("Unable to read the durations of the checks, ignoring them: %v", err)
+		}
+	}
+	sched := scheduleJobs(jobs, cfg.Checks, durations, log)
+	jobs = sched.jobs
+	if ctx.Err() != nil {
+		return config.ErrorExitCode, errInterrupted
+	}
+	emitScheduled(em, cfg.Checks, jobs)
 
-	// AWS Credentials are required for sqs
-	os.Setenv("AWS_REGION", "local")
-	os.Setenv("AWS_SECRET_ACCESS_KEY", "TBD")
-	os.Setenv("AWS_ACCESS_KEY_ID", "TBD")
+	if err := checkPinnedImages(jobImages(jobs), unpinned, cfg.Conf.LockFile); err != nil {
+		return config.ErrorExitCode, err
+	}
+
+	// The images of the Jobs are pulled by the cluster.
+	if cfg.Conf.Offline && !k8s {
+		if err := checkOfflineImages(jobImages(jobs), cache, log); err != nil {
+			return config.ErrorExitCode, err
+		}
+	}
+
+	if !k8s {
+		if err := loadImageArchives(cfg.Checks, log); err != nil {
+			return config.ErrorExitCode, err
+		}
+	}
+
+	auths := []agentconfig.Auth{}
+	pullPolicy := cfg.Conf.PullPolicy
+	if cfg.Conf.Offline {
+		// Don't pull or login in the registries.
+		pullPolicy = agentconfig.PullPolicyNever
+	} else {
+		auths = registryAuths(cfg.Conf.Registries, append(jobImages(jobs), imageTargets(cfg.Checks)...), log)
+		for _, a := range auths {
+			rd.Add(a.Pass)
+		}
+	}
+	if !cfg.Conf.Offline && !k8s {
+		prePullImages(ctx, jobImages(jobs), pullPolicy, auths, cfg.Conf.Concurrency, em, log)
+		if pullPolicy == agentconfig.PullPolicyAlways {
+			// The images were just pulled.
+			pullPolicy = agentconfig.PullPolicyIfNotPresent
+		}
+	}
+	if ctx.Err() != nil {
+		return config.ErrorExitCode, errInterrupted
+	}
+
+	// AWS Credentials are required for sqs. The agent reads them from the
+	// env, so they are restored when the scan finishes.
+	defer setenv(map[string]string{
+		"AWS_REGION":            "local",
+		"AWS_SECRET_ACCESS_KEY": "TBD",
+		"AWS_ACCESS_KEY_ID":     "TBD",
+	})()
 
 	sqs, err := sqsservice.Start(log)
 	if err != nil {
@@ -113,39 +477,68 @@ func Run(cfg *config.Config, log *logrus.Logger) (int, error) {
 	}
 	defer sqs.Shutdown()
 
+	var resultsCache *results.Cache
+	if cfg.Conf.CacheDir != "" && !cfg.Conf.NoCache {
+		resultsCache = &results.Cache{Dir: filepath.Join(cfg.Conf.CacheDir, resultsCacheDir), TTL: cacheTTL}
+	}
 	results, err := results.Start(log)
 	if err != nil {
 		return config.ErrorExitCode, fmt.Errorf("unable to start results server %+v", err)
 	}
 	defer results.Shutdown()
-	log.Debug("Sending jobs to run")
-	err = generator.SendJobs(jobs, sqs.ArnChecks, sqs.Endpoint, log)
+	art, err := newArtifacts(cfg.Conf.ArtifactsDir, !k8s && rt.RemoteHost() == "", rd, log)
 	if err != nil {
-		return config.ErrorExitCode, fmt.Errorf("unable to send jobs to queue %+v", err)
+		return config.ErrorExitCode, fmt.Errorf("unable to create the artifacts directory: %w", err)
+	}
+	if art != nil {
+		results.OnLogs = art.saveOutput
+	}
+	results.OnReport = func(checkID string, d time.Duration) {
+		em.Emit(events.Event{Type: events.ReportReceived, CheckID: checkID, Duration: d.Seconds()})
+	}
+
+	// The state of the checks is persisted to resume the scan if it's
+	// interrupted. The state is removed when the scan completes or fails
+	// for other reasons, except for the resumed runs that fail before
+	// running their checks.
+	var cp *checkpoint
+	if cfg.Conf.Resume != "" && cfg.Conf.CacheDir == "" {
+		return config.ErrorExitCode, fmt.Errorf("a cache dir is required to resume the run %s", cfg.Conf.Resume)
+	}
+	resumable := cfg.Conf.Resume != ""
+	if cfg.Conf.CacheDir != "" && !cfg.Conf.Watch {
+		cp, err = openCheckpoint(filepath.Join(cfg.Conf.CacheDir, runsDir), cfg.Conf.Resume, rd, log)
+		if err != nil {
+			return config.ErrorExitCode, fmt.Errorf("unable to open the state of the run: %w", err)
+		}
+		defer func() {
+			if resumable {
+				log.Warnf("Run the pending checks with -resume %s", cp.id)
+				return
+			}
+			cp.remove()
+		}()
+		if jobs, err = cp.resume(cfg, jobs, results, em); err != nil {
+			return config.ErrorExitCode, fmt.Errorf("unable to save the state of the run %s: %w", cp.id, err)
+		}
+		log.Infof("Starting run %s", cp.id)
+	}
+
+	cacheKeys := map[string]string{}
+	if resultsCache != nil {
+		jobs, cacheKeys = useCachedResults(cfg, jobs, resultsCache, results, em, log)
 	}
 
-	apiPort, err := freeport.GetFreePort()
+	apiPort, err := portRange.Port("")
 	if err != nil {
 		return config.ErrorExitCode, fmt.Errorf("unable to find a port for agent api %+v", err)
 	}
 	log.Debugf("Setting agent server on http://%s:%d/", agentIP, apiPort)
 
-	auths := []agentconfig.Auth{}
-	for _, r := range cfg.Conf.Registries {
-		if r.Server == "" || r.Username == "" || r.Password == "" {
-			log.Debugf("Skipping empty registry")
-			continue
-		}
-		auths = append(auths, agentconfig.Auth{
-			Server: r.Server,
-			User:   r.Username,
-			Pass:   r.Password,
-		})
-	}
 	agentConfig := agentconfig.Config{
 		Agent: agentconfig.AgentConfig{
 			ConcurrentJobs:         cfg.Conf.Concurrency,
-			MaxNoMsgsInterval:      5, // Low as all the messages will be in the queue before starting the agent.
+			MaxNoMsgsInterval:      5, // Low as the messages are sent before starting the agent or while their dependencies run.
 			MaxProcessMessageTimes: 1, // No retry
 			Timeout:                180,
 		},
@@ -172,7 +565,7 @@ func Run(cfg *config.Config, log *logrus.Logger) (int, error) {
 		Runtime: agentconfig.RuntimeConfig{
 			Docker: agentconfig.DockerConfig{
 				Registry: agentconfig.RegistryConfig{
-					PullPolicy:          cfg.Conf.PullPolicy,
+					PullPolicy:          pullPolicy,
 					BackoffMaxRetries:   5,
 					BackoffInterval:     5,
 					BackoffJitterFactor: 0.5,
@@ -181,12 +574,42 @@ func Run(cfg *config.Config, log *logrus.Logger) (int, error) {
 			},
 		},
 	}
+	proxy := newCheckProxy(cfg.Conf.Proxy, caBundle, agentIP, hostIP)
 	beforeRun := func(params backend.RunParams, rc *docker.RunConfig) error {
-		return beforeCheckRun(params, rc, agentIP, gs, hostIP, cfg.Checks, log)
+		art.apply(rc, params.CheckID)
+		return beforeCheckRun(params, rc, gs, rs, ts, rt, hostIP, proxy, auths, cfg.Checks, log)
 	}
-	backend, err := docker.NewBackend(log, agentConfig, beforeRun)
-	if err != nil {
-		return config.ErrorExitCode, err
+	var checkBackend backend.Backend
+	if k8s {
+		kb := kubernetes.New(log, cfg.Conf.Kubernetes, agentConfig, beforeRun)
+		if err := kb.CheckAccess(ctx); err != nil {
+			return config.ErrorExitCode, err
+		}
+		checkBackend = kb
+	} else {
+		checkBackend, err = docker.NewBackend(log, agentConfig, beforeRun)
+		if err != nil {
+			return config.ErrorExitCode, err
+		}
+	}
+	backend := newRetryBackend(ctx, checkBackend, results, cfg, em, log)
+	// The jobs depending on other checks are sent when they finish.
+	sendJobs := func(jobs []jobrunner.Job) error {
+		return generator.SendJobs(jobs, sqs.ArnChecks, sqs.Endpoint, log)
+	}
+	log.Debug("Sending jobs to run")
+	if err := sendJobs(backend.setDependencies(sched.dependsOn, jobs, sendJobs)); err != nil {
+		return config.ErrorExitCode, fmt.Errorf("unable to send jobs to queue %+v", err)
+	}
+	backend.checkpoint = cp
+
+	var tui *reporting.TUI
+	logOut := log.Out
+	if cfg.Conf.TUI {
+		// The logs are printed above the table of the checks.
+		tui = reporting.NewTUI(cfg, results, logOut)
+		log.SetOutput(tui)
+		tui.Start()
 	}
 
 	// Show progress to prevent CI/CD complaining of no output for long time.
@@ -197,7 +620,9 @@ func Run(cfg *config.Config, log *logrus.Logger) (int, error) {
 			case <-quitProgress:
 				return
 			case <-time.After(30 * time.Second):
-				reporting.ShowProgress(cfg, results, log)
+				if tui == nil {
+					reporting.ShowProgress(cfg, results, log)
+				}
 			}
 		}
 	}()
@@ -207,25 +632,124 @@ func Run(cfg *config.Config, log *logrus.Logger) (int, error) {
 	if log.Level != logrus.DebugLevel {
 		logAgent = logrus.New()
 		logAgent.SetFormatter(log.Formatter)
+		logAgent.SetOutput(log.Out)
 		logAgent.SetLevel(logrus.ErrorLevel)
+		if rd != nil {
+			logAgent.AddHook(rd.Hook())
+		}
+		if em != nil {
+			logAgent.AddHook(em.Hook())
+		}
+	}
+	exit := 0
+	if len(jobs) > 0 {
+		exit = agent.Run(agentConfig, backend, logAgent.WithField("comp", "agent"))
+	}
+	if tui != nil {
+		tui.Stop()
+		// The report is printed below the last state of the table.
+		log.SetOutput(logOut)
 	}
-	exit := agent.Run(agentConfig, backend, logAgent.WithField("comp", "agent"))
 	if exit != 0 {
+		resumable = true
 		return config.ErrorExitCode, fmt.Errorf("error running the agent exit=%d", exit)
 	}
 
 	quitProgress <- true
 
-	reporting.ShowProgress(cfg, results, log)
+	interrupted := ctx.Err() != nil
+	if interrupted {
+		log.Warnf("Scan interrupted, reporting the results of the finished checks")
+	}
+	// The checks of the run are done unless it was interrupted.
+	resumable = interrupted
+
+	// The reports are masked before they are cached, stored or reported.
+	for _, r := range results.Checks {
+		rd.Report(r)
+	}
+	if cache != nil && !cfg.Conf.Offline {
+		recordImages(jobImages(jobs), cache, log)
+	}
+	if cache != nil {
+		recordDurations(backend.runDurations(), cfg.Checks, cache, log)
+	}
+	if resultsCache != nil {
+		storeResults(cfg, cacheKeys, resultsCache, results, log)
+	}
+	art.collect(results.Checks)
+
+	if tui == nil {
+		reporting.ShowProgress(cfg, results, log)
+	}
 	reporting.ShowSummary(cfg, results, log)
+	reportStart := time.Now()
 	reportCode, err := reporting.Generate(cfg, results, log)
+	reportEv := events.Event{Type: events.ReportGenerated, Duration: time.Since(reportStart).Seconds()}
+	if err != nil {
+		reportEv.Message = err.Error()
+	}
+	em.Emit(reportEv)
 	if err != nil {
 		return config.ErrorExitCode, fmt.Errorf("error generating report %+v", err)
 	}
+	if opts.onFindings != nil {
+		vs, err := reporting.Findings(cfg, results)
+		if err != nil {
+			return config.ErrorExitCode, err
+		}
+		opts.onFindings(results.Checks, vs)
+	}
+
+	// Only the complete scans are stored to compare them.
+	if cfg.Reporting.History != "" && !interrupted && !cfg.Conf.Watch && !cfg.Conf.Staged && cfg.Conf.Diff == "" {
+		saveHistory(cfg, results, reportCode, log)
+	}
 
+	if interrupted {
+		return config.ErrorExitCode, errInterrupted
+	}
 	return reportCode, nil
 }
 
+// newRedactor returns the redactor masking the secrets of the config: the
+// passwords of the registries, the upload token and the vars of the checks.
+// It returns nil if the redaction is disabled.
+func newRedactor(cfg *config.Config) (*redact.Redactor, error) {
+	if cfg.Conf.Redaction.Disabled {
+		return nil, nil
+	}
+	rd, err := redact.New(cfg.Conf.Redaction.Patterns, cfg.Conf.Redaction.Reveal)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range cfg.Conf.Registries {
+		rd.Add(r.Password)
+		if r.PasswordEnv != "" {
+			rd.Add(os.Getenv(r.PasswordEnv))
+		}
+	}
+	rd.Add(cfg.Reporting.Upload.Token)
+	for _, v := range cfg.Conf.Vars {
+		rd.Add(v)
+	}
+	return rd, nil
+}
+
+// saveHistory stores the findings of the scan in the history. The failures
+// are only logged.
+func saveHistory(cfg *config.Config, rs *results.ResultsServer, exitCode int, log *logrus.Logger) {
+	vs, err := reporting.Findings(cfg, rs)
+	if err == nil {
+		var run *reporting.HistoryRun
+		if run, err = reporting.SaveHistory(cfg.Reporting.History, cfg, vs, exitCode); err == nil {
+			log.Debugf("Stored run %s in the history %s", run.ID, cfg.Reporting.History)
+			return
+		}
+	}
+	log.Errorf("Unable to store the scan in the history: %v", err)
+}
+
 func upsertEnv(envs []string, name, newValue string) []string {
 	for i, e := range envs {
 		if strings.HasPrefix(e, name+"=") {
@@ -237,19 +761,26 @@ func upsertEnv(envs []string, name, newValue string) []string {
 }
 
 // checkDependencies checks that all the dependencies are present and run
-// normally.
-func checkDependencies(cfg *config.Config, log agentlog.Logger) error {
+// normally. The container runtime is only checked if checkRuntime is true.
+func checkDependencies(cfg *config.Config, checkRuntime bool, log agentlog.Logger) error {
 	var cmdOut bytes.Buffer
 
-	log.Debugf("Checking dependency docker=%s", cfg.Conf.DockerBin)
-	cmd := execCommand(cfg.Conf.DockerBin, "ps", "-q")
-	cmd.Stderr = &cmdOut
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("checking docker dependency bin=%s %w %s", cfg.Conf.DockerBin, err, cmdOut.String())
+	if checkRuntime {
+		bin := runtimeBin(cfg)
+		args := []string{"ps", "-q"}
+		if cfg.Conf.Runtime == kubernetes.Runtime {
+			args = []string{"version", "--client"}
+		}
+		log.Debugf("Checking dependency container runtime=%s", bin)
+		cmd := execCommand(bin, args...)
+		cmd.Stderr = &cmdOut
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("checking container runtime dependency bin=%s %w %s", bin, err, cmdOut.String())
+		}
 	}
 
 	log.Debugf("Checking dependency git=%s", cfg.Conf.GitBin)
-	cmd = execCommand(cfg.Conf.GitBin, "version")
+	cmd := execCommand(cfg.Conf.GitBin, "version")
 	cmd.Stderr = &cmdOut
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("checking git dependency bin=%s %w %s", cfg.Conf.GitBin, err, cmdOut.String())
@@ -257,6 +788,80 @@ func checkDependencies(cfg *config.Config, log agentlog.Logger) error {
 	return nil
 }
 
+// jobImages returns the unique images of the jobs.
+func jobImages(jobs []jobrunner.Job) []string {
+	images := []string{}
+	uniq := map[string]bool{}
+	for _, j := range jobs {
+		if !uniq[j.Image] {
+			uniq[j.Image] = true
+			images = append(images, j.Image)
+		}
+	}
+	return images
+}
+
+// imageTargets returns the image targets of the checks.
+func imageTargets(checks []config.Check) []string {
+	images := []string{}
+	uniq := map[string]bool{}
+	for _, c := range checks {
+		if c.Id == "" || c.AssetType != "DockerImage" || uniq[c.Target] {
+			continue
+		}
+		uniq[c.Target] = true
+		images = append(images, c.Target)
+	}
+	return images
+}
+
+// checkOfflineImages fails if some of the images is not available locally,
+// and warns about the images that changed since their digest was recorded.
+func checkOfflineImages(images []string, cache *checktypes.Cache, log agentlog.Logger) error {
+	digests, missing, err := checktypes.LocalImageDigests(images, log)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("images not available in offline mode: %s", strings.Join(missing, ", "))
+	}
+	recorded, err := cache.Images()
+	if err != nil {
+		return err
+	}
+	for image, digest := range digests {
+		if r, ok := recorded[image]; ok && r != digest {
+			log.Infof("Image %s changed since it was recorded digest=%s recorded=%s", image, digest, r)
+		}
+	}
+	return nil
+}
+
+// recordImages stores in the cache the digests of the images used.
+func recordImages(images []string, cache *checktypes.Cache, log agentlog.Logger) {
+	digests, _, err := checktypes.LocalImageDigests(images, log)
+	if err == nil {
+		err = cache.RecordImages(digests)
+	}
+	if err != nil {
+		log.Errorf("Unable to record image digests %v", err)
+	}
+}
+
+// runtimeBin returns the cli binary of the configured container runtime.
+func runtimeBin(cfg *config.Config) string {
+	switch cfg.Conf.Runtime {
+	case container.Podman:
+		return cfg.Conf.PodmanBin
+	case kubernetes.Runtime:
+		if cfg.Conf.Kubernetes.Bin != "" {
+			return cfg.Conf.Kubernetes.Bin
+		}
+		return "kubectl"
+	}
+	return cfg.Conf.DockerBin
+}
+
 func GetInterfaceAddr(ifaceName string) (string, error) {
 	iface, err := net.InterfaceByName(ifaceName)
 	if err != nil {
@@ -282,18 +887,43 @@ func GetInterfaceAddr(ifaceName string) (string, error) {
 	return "", fmt.Errorf("failed to determine Docker agent IP address")
 }
 
-func getAgentIP(ifacename string, log agentlog.Logger) string {
+// checkBindAddresses fails if some local service listens in a loopback
+// address while the checks reach them through a non loopback one.
+func checkBindAddresses(advertised string, binds ...string) error {
+	if isLoopback(advertised) {
+		return nil
+	}
+	for _, b := range binds {
+		if isLoopback(b) {
+			return fmt.Errorf("the local services listening in the loopback address %s are not reachable by the checks through %s", b, advertised)
+		}
+	}
+	return nil
+}
+
+// isLoopback returns true if the host is a loopback address.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func getAgentIP(ifacename, hostGateway string, log agentlog.Logger) string {
 	ip, err := GetInterfaceAddr(ifacename)
 	if err == nil {
 		log.Debugf("Agent address iface=%s ip=%s", ifacename, ip)
 		return ip
 	}
 
-	os := runtime.GOOS
+	os := goos
 	switch os {
-	case "darwin":
-		log.Debugf("Agent address os=%s ip=%s", os, defaultDockerHost)
-		return defaultDockerHost
+	case "darwin", "windows":
+		// Docker Desktop runs the containers in a VM reaching the host
+		// through the gateway.
+		log.Debugf("Agent address os=%s ip=%s", os, hostGateway)
+		return hostGateway
 	case "linux":
 		// Perhaps the agent is running in a container...
 		ip, err = GetInterfaceAddr("eth0")
@@ -306,8 +936,45 @@ func getAgentIP(ifacename string, log agentlog.Logger) string {
 	return ""
 }
 
-func getHostIP(l agentlog.Logger) string {
-	cmd := exec.Command("docker", "run", "--rm", "busybox:1.34.1", "sh", "-c", "ip route|awk '/default/ { print $3 }'")
+// getRouteIP returns the ip of this machine used to reach the host.
+func getRouteIP(host string, log agentlog.Logger) string {
+	// Dialing udp doesn't send any packet, it only selects the route.
+	conn, err := net.Dial("udp", net.JoinHostPort(host, "9"))
+	if err != nil {
+		log.Errorf("Unable to get the address to reach %s: %v", host, err)
+		return ""
+	}
+	defer conn.Close()
+	ip := conn.LocalAddr().(*net.UDPAddr).IP.String()
+	log.Debugf("Agent address remote=%s ip=%s", host, ip)
+	return ip
+}
+
+// setenv sets the env vars and returns a function restoring their previous
+// values.
+func setenv(vars map[string]string) func() {
+	prev := map[string]*string{}
+	for k, v := range vars {
+		if old, ok := os.LookupEnv(k); ok {
+			prev[k] = &old
+		} else {
+			prev[k] = nil
+		}
+		os.Setenv(k, v)
+	}
+	return func() {
+		for k, v := range prev {
+			if v == nil {
+				os.Unsetenv(k)
+			} else {
+				os.Setenv(k, *v)
+			}
+		}
+	}
+}
+
+func getHostIP(bin string, l agentlog.Logger) string {
+	cmd := exec.Command(bin, "run", "--rm", hostIPImage, "sh", "-c", "ip route|awk '/default/ { print $3 }'")
 	var cmdOut bytes.Buffer
 	cmd.Stdout = &cmdOut
 	err := cmd.Run()
@@ -324,34 +991,80 @@ func getHostIP(l agentlog.Logger) string {
 // in. it's used to do some extra configuration needed for some checks to run
 // properly when they are executed locally.
 func beforeCheckRun(params backend.RunParams, rc *docker.RunConfig,
-	agentIP string, gs gitservice.GitService, hostIP string,
+	gs gitservice.GitService, rs registryservice.RegistryService, ts tunnelservice.TunnelService,
+	rt container.Runtime, hostIP string, proxy checkProxy, auths []agentconfig.Auth,
 	checks []config.Check, log *logrus.Logger) error {
 	newTarget := params.Target
 	// If the asset type is a DockerImage mount the docker socket in case the image is already there,
 	// and the check can access it.
 	if params.AssetType == "DockerImage" {
-		rc.HostConfig.Binds = append(rc.HostConfig.Binds, "/var/run/docker.sock:/var/run/docker.sock")
+		// Image archives are loaded in the runtime before running the checks.
+		if check := getCheckByID(checks, params.CheckID); check != nil && check.NewTarget != "" {
+			newTarget = check.NewTarget
+		}
+
+		url := ""
+		if rs != nil {
+			var err error
+			if url, err = rs.AddImage(newTarget); err != nil {
+				log.Debugf("Image not served by the local registry, mounting the runtime socket: %v", err)
+			}
+		}
+		if url != "" {
+			newTarget = url
+		} else {
+			// The checks pull the images not served by the local registry
+			// with the credentials of their registry.
+			rc.ContainerConfig.Env = imageTargetEnv(rc.ContainerConfig.Env, newTarget, auths)
+			if rt != nil {
+				rc.HostConfig.Binds = append(rc.HostConfig.Binds, rt.SocketBind())
+			}
+		}
 
 		// Some checks will fail because the reachability check as they
 		// expect remote urls. This will bypass the check
 		// (https://github.com/adevinta/vulcan-check-sdk/blob/master/helpers/target.go#L294)
 		// TODO: Find a propper way to do this either by updating
 		// IsDockerImgReachable or custom whitelisting in the check.
-		rc.ContainerConfig.Env = upsertEnv(rc.ContainerConfig.Env, backend.CheckAssetTypeVar, "LocalDockerImage")
+		// The Jobs of the kubernetes runtime only reach the images in
+		// registries.
+		if url != "" || rt != nil {
+			rc.ContainerConfig.Env = upsertEnv(rc.ContainerConfig.Env, backend.CheckAssetTypeVar, "LocalDockerImage")
+		}
 	} else if params.AssetType == "GitRepository" {
 
-		if path, err := generator.GetValidDirectory(params.Target); err == nil {
-			port, err := gs.AddGit(path)
+		path, err := generator.GetValidDirectory(params.Target)
+		if _, _, ok := gitservice.ParseRemote(params.Target); ok {
+			// The remote repositories are cloned by the git service.
+			path, err = params.Target, nil
+		}
+		if err == nil {
+			ref := ""
+			if check := getCheckByID(checks, params.CheckID); check != nil {
+				ref = check.Ref
+			}
+			url, err := gs.AddGitRef(path, ref)
 			if err != nil {
 				log.Errorf("Unable to create local git server check %v", err)
 				return nil
 			}
-			newTarget = fmt.Sprintf("http://%s:%d/", agentIP, port)
+			newTarget = url
 		}
 
 	}
 
-	newTarget = regexp.MustCompile(`(?i)\b(localhost|127.0.0.1)\b`).ReplaceAllString(newTarget, hostIP)
+	if params.AssetType == "WebAddress" {
+		// The services listening only in the loopback interface of the host
+		// are not reachable from the checks.
+		url, err := ts.Expose(newTarget)
+		if err != nil {
+			log.Errorf("Unable to expose %s to the check %v", newTarget, err)
+		} else {
+			newTarget = url
+		}
+	}
+
+	newTarget = loopbackR.ReplaceAllString(newTarget, hostIP)
 
 	if params.Target != newTarget {
 		check := getCheckByID(checks, params.CheckID)
@@ -365,6 +1078,12 @@ func beforeCheckRun(params backend.RunParams, rc *docker.RunConfig,
 		rc.ContainerConfig.Env = upsertEnv(rc.ContainerConfig.Env, backend.CheckTargetVar, newTarget)
 	}
 
+	if check := getCheckByID(checks, params.CheckID); check != nil {
+		setResources(rc, check.Resources, log)
+	}
+
+	proxy.apply(rc)
+
 	// We allow all the checks to scan local assets. This could be tunned
 	// depending on the target/assettype.
 	rc.ContainerConfig.Env = upsertEnv(rc.ContainerConfig.Env, "VULCAN_ALLOW_PRIVATE_IPS", strconv.FormatBool(true))
@@ -372,6 +1091,17 @@ func beforeCheckRun(params backend.RunParams, rc *docker.RunConfig,
 	return nil
 }
 
+// setResources limits the resources of the check container.
+func setResources(rc *docker.RunConfig, r config.Resources, log *logrus.Logger) {
+	rc.HostConfig.Resources.NanoCPUs = r.NanoCPUs()
+	memory, err := r.MemoryBytes()
+	if err != nil {
+		log.Errorf("Ignoring memory limit %v", err)
+		return
+	}
+	rc.HostConfig.Resources.Memory = memory
+}
+
 func getCheckByID(checks []config.Check, id string) *config.Check {
 	for i, c := range checks {
 		if c.Id == id {
@@ -380,3 +1110,15 @@ func getCheckByID(checks []config.Check, id string) *config.Check {
 	}
 	return nil
 }
+
+func validSnapshotStrategy(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, v := range gitservice.SnapshotStrategies() {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
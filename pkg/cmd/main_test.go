@@ -13,6 +13,8 @@ import (
 	"time"
 
 	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/reporting"
+	report "github.com/adevinta/vulcan-report"
 	"github.com/google/go-cmp/cmp"
 	"github.com/sirupsen/logrus"
 )
@@ -33,6 +35,22 @@ func init() {
 	}
 }
 
+// testVuln returns a finding of the checktype in the target with the summary
+// and the severity of the score, like the one of the reporting tests.
+func testVuln(checktype, target, summary string, score float32) reporting.ExtendedVulnerability {
+	return reporting.ExtendedVulnerability{
+		CheckData: &report.CheckData{
+			ChecktypeName: checktype,
+			Target:        target,
+		},
+		Vulnerability: &report.Vulnerability{
+			Summary: summary,
+			Score:   score,
+		},
+		Severity: config.FindSeverityByScore(score).Data(),
+	}
+}
+
 type TestCommandRunner struct{}
 
 // newExecCase returns a function for creating a command to execute the current test binary
@@ -84,6 +102,10 @@ func TestHelperProcess(*testing.T) {
 			"othergit": {exit: 0},
 			"docker":   {exit: 0},
 		},
+		"podman-git": {
+			"git":    {exit: 0},
+			"podman": {exit: 0},
+		},
 	}
 	c := args[0]
 	uc, ok := cases[c]
@@ -185,12 +207,46 @@ func TestCheckDependencies(t *testing.T) {
 			state:   "other-git",
 			wantErr: "",
 		},
+		{
+			name: "podman-ok",
+			cfg: &config.Config{
+				Conf: config.Conf{
+					Runtime:     "podman",
+					DockerBin:   "docker",
+					PodmanBin:   "podman",
+					GitBin:      "git",
+					LogLevel:    logrus.InfoLevel,
+					Concurrency: 3,
+					IfName:      "docker0",
+					Vars:        map[string]string{},
+				},
+			},
+			state:   "podman-git",
+			wantErr: "",
+		},
+		{
+			name: "podman-missing",
+			cfg: &config.Config{
+				Conf: config.Conf{
+					Runtime:     "podman",
+					DockerBin:   "docker",
+					PodmanBin:   "podman",
+					GitBin:      "git",
+					LogLevel:    logrus.InfoLevel,
+					Concurrency: 3,
+					IfName:      "docker0",
+					Vars:        map[string]string{},
+				},
+			},
+			state:   "docker-git",
+			wantErr: "podman",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			execCommand = newExecCase("TestHelperProcess", tt.state)
-			err := checkDependencies(tt.cfg, loggerUser)
+			err := checkDependencies(tt.cfg, true, loggerUser)
 			if err == nil {
 				if tt.wantErr != "" {
 					t.Errorf("Wanted error")
@@ -249,3 +305,61 @@ func TestUpsertEnv(t *testing.T) {
 	}
 
 }
+
+func TestGetAgentIPDockerDesktop(t *testing.T) {
+	oldGOOS := goos
+	defer func() { goos = oldGOOS }()
+	for _, os := range []string{"darwin", "windows"} {
+		goos = os
+		if got := getAgentIP("missing0", "host.docker.internal", loggerUser); got != "host.docker.internal" {
+			t.Errorf("unexpected agent ip in %s got=%s", os, got)
+		}
+	}
+}
+
+func TestNewRedactor(t *testing.T) {
+	cfg := &config.Config{
+		Conf: config.Conf{
+			Registries: []config.Registry{{Server: "registry.example.com", Username: "user", Password: "registry-pass"}},
+			Vars:       map[string]string{"GITHUB_TOKEN": "ghp_0123456789", "REGION": "eu"},
+			Redaction:  config.Redaction{Patterns: []string{`key=(\S+)`}},
+		},
+		Reporting: config.Reporting{Upload: config.Upload{Token: "upload-token"}},
+	}
+	rd, err := newRedactor(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := rd.String("registry-pass upload-token ghp_0123456789 eu key=value")
+	if want := "***** ***** ***** eu key=*****"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	cfg.Conf.Redaction.Disabled = true
+	if rd, err := newRedactor(cfg); err != nil || rd != nil {
+		t.Errorf("unexpected redactor with the redaction disabled %v %v", rd, err)
+	}
+}
+
+func TestCheckBindAddresses(t *testing.T) {
+	tests := []struct {
+		name       string
+		advertised string
+		binds      []string
+		wantErr    bool
+	}{
+		{name: "AllInterfaces", advertised: "172.17.0.1", binds: []string{"", ""}},
+		{name: "Iface", advertised: "172.17.0.1", binds: []string{"172.17.0.1", "0.0.0.0"}},
+		{name: "Loopback", advertised: "172.17.0.1", binds: []string{"", "127.0.0.1"}, wantErr: true},
+		{name: "Localhost", advertised: "172.17.0.1", binds: []string{"localhost", ""}, wantErr: true},
+		{name: "LoopbackAdvertised", advertised: "127.0.0.1", binds: []string{"127.0.0.1", "127.0.0.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkBindAddresses(tt.advertised, tt.binds...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/generator"
+)
+
+// executionPlan is the json of the plan written by the dry run.
+type executionPlan struct {
+	Targets []plannedTarget          `json:"targets"`
+	Checks  []generator.PlannedCheck `json:"checks"`
+}
+
+type plannedTarget struct {
+	Target    string `json:"target"`
+	AssetType string `json:"assetType"`
+	Ref       string `json:"ref,omitempty"`
+}
+
+// dryRun prints the execution plan of the checks and, if the results file is
+// set, writes it as json.
+func dryRun(cfg *config.Config, out io.Writer) (int, error) {
+	plan := generator.Plan(cfg)
+	if err := printPlan(out, plan); err != nil {
+		return config.ErrorExitCode, err
+	}
+	if cfg.Reporting.OutputFile == "" {
+		return config.SuccessExitCode, nil
+	}
+	targets := []plannedTarget{}
+	for _, t := range cfg.Targets {
+		targets = append(targets, plannedTarget{Target: t.Target, AssetType: t.AssetType, Ref: t.Ref})
+	}
+	content, err := json.MarshalIndent(executionPlan{Targets: targets, Checks: plan}, "", "    ")
+	if err != nil {
+		return config.ErrorExitCode, err
+	}
+	if cfg.Reporting.OutputFile == "-" {
+		_, err = fmt.Fprintln(out, string(content))
+	} else {
+		err = os.WriteFile(cfg.Reporting.OutputFile, content, 0o644)
+	}
+	if err != nil {
+		return config.ErrorExitCode, fmt.Errorf("unable to write the plan: %w", err)
+	}
+	return config.SuccessExitCode, nil
+}
+
+// printPlan writes the plan as a table. The options are only in the json
+// plan.
+func printPlan(out io.Writer, plan []generator.PlannedCheck) error {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN\tCHECKTYPE\tTARGET\tASSET TYPE\tIMAGE\tREASON")
+	run := 0
+	for _, p := range plan {
+		status := "no"
+		reason := p.Reason
+		if p.Run {
+			run++
+			status = "yes"
+			if len(p.MissingVars) > 0 {
+				reason = fmt.Sprintf("missing vars %s", strings.Join(p.MissingVars, ","))
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", status, p.Checktype, p.Target, p.AssetType, p.Image, reason)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(out, "\n%d checks to run, %d skipped\n", run, len(plan)-run)
+	return err
+}
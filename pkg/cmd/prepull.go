@@ -0,0 +1,236 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	agentconfig "github.com/adevinta/vulcan-agent/config"
+	agentlog "github.com/adevinta/vulcan-agent/log"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-units"
+
+	"github.com/adevinta/vulcan-local/pkg/checktypes"
+	"github.com/adevinta/vulcan-local/pkg/events"
+)
+
+// pullProgressInterval is the interval between the reports of the progress of
+// the pulls.
+var pullProgressInterval = 10 * time.Second
+
+// imageStatus returns if the image exists in the runtime and if it's only
+// available locally, i.e. built or loaded from an archive. The var allows to
+// replace it in the tests.
+var imageStatus = func(image string) (exists, localOnly bool, err error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return false, false, err
+	}
+	defer cli.Close()
+	info, _, err := cli.ImageInspectWithRaw(context.Background(), image)
+	if client.IsErrNotFound(err) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return true, len(info.RepoDigests) == 0, nil
+}
+
+// pullImage pulls the image calling progress with the bytes downloaded and
+// the total bytes of the layers. The var allows to replace it in the tests.
+var pullImage = func(ctx context.Context, image, auth string, progress func(current, total int64)) error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	r, err := cli.ImagePull(ctx, image, types.ImagePullOptions{RegistryAuth: auth})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return readPullProgress(r, progress)
+}
+
+// readPullProgress reads the output of the pull of an image.
+func readPullProgress(r io.Reader, progress func(current, total int64)) error {
+	type layer struct{ current, total int64 }
+	layers := map[string]layer{}
+	dec := json.NewDecoder(r)
+	for {
+		var msg struct {
+			ID             string `json:"id"`
+			Status         string `json:"status"`
+			Error          string `json:"error"`
+			ProgressDetail struct {
+				Current int64 `json:"current"`
+				Total   int64 `json:"total"`
+			} `json:"progressDetail"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if msg.Error != "" {
+			return errors.New(msg.Error)
+		}
+		if msg.ID == "" {
+			continue
+		}
+		l := layers[msg.ID]
+		switch {
+		case msg.Status == "Downloading" && msg.ProgressDetail.Total > 0:
+			l = layer{current: msg.ProgressDetail.Current, total: msg.ProgressDetail.Total}
+		case msg.Status == "Download complete" || msg.Status == "Already exists" || msg.Status == "Pull complete":
+			l.current = l.total
+		default:
+			continue
+		}
+		layers[msg.ID] = l
+		var current, total int64
+		for _, l := range layers {
+			current += l.current
+			total += l.total
+		}
+		progress(current, total)
+	}
+}
+
+// registryAuth returns the encoded credentials for the registry of the
+// image, empty if there are no credentials for it.
+func registryAuth(image string, auths []agentconfig.Auth) string {
+	registry, err := checktypes.ImageRegistry(image)
+	if err != nil {
+		return ""
+	}
+	for _, a := range auths {
+		if !checktypes.SameRegistry(a.Server, registry) {
+			continue
+		}
+		content, err := json.Marshal(types.AuthConfig{Username: a.User, Password: a.Pass, ServerAddress: a.Server})
+		if err != nil {
+			return ""
+		}
+		return base64.URLEncoding.EncodeToString(content)
+	}
+	return ""
+}
+
+// pullStatus is the progress of the pull of an image.
+type pullStatus struct {
+	current, total int64
+	done           bool
+}
+
+// prePullImages pulls concurrently the images of the checks following the
+// pull policy, so slow pulls are not mistaken by hung checks. The images
+// failing to pull are reported and left to be pulled by the agent. The pulls
+// stop when the context is done. The pulls are emitted to em.
+func prePullImages(ctx context.Context, images []string, policy agentconfig.PullPolicy, auths []agentconfig.Auth, concurrency int, em *events.Emitter, log agentlog.Logger) {
+	if policy == agentconfig.PullPolicyNever {
+		return
+	}
+	pending := []string{}
+	for _, image := range images {
+		exists, localOnly, err := imageStatus(image)
+		if err != nil {
+			log.Errorf("Unable to inspect image %s: %v", image, err)
+			continue
+		}
+		if localOnly || (exists && policy == agentconfig.PullPolicyIfNotPresent) {
+			log.Debugf("Skipping pull of image %s exists=%v localOnly=%v", image, exists, localOnly)
+			continue
+		}
+		pending = append(pending, image)
+	}
+	if len(pending) == 0 {
+		return
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	log.Infof("Pulling %d images", len(pending))
+	var (
+		mu     sync.Mutex
+		status = map[string]*pullStatus{}
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, concurrency)
+		quit   = make(chan struct{})
+	)
+	for _, image := range pending {
+		status[image] = &pullStatus{}
+	}
+	go func() {
+		for {
+			select {
+			case <-quit:
+				return
+			case <-time.After(pullProgressInterval):
+				mu.Lock()
+				log.Infof("Pulling images %s", pullSummary(status))
+				mu.Unlock()
+			}
+		}
+	}()
+	for _, image := range pending {
+		wg.Add(1)
+		go func(image string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if ctx.Err() != nil {
+				return
+			}
+			log.Infof("Pulling image %s", image)
+			start := time.Now()
+			err := pullImage(ctx, image, registryAuth(image, auths), func(current, total int64) {
+				mu.Lock()
+				defer mu.Unlock()
+				status[image].current, status[image].total = current, total
+			})
+			mu.Lock()
+			status[image].done = true
+			mu.Unlock()
+			ev := events.Event{Type: events.ImagePulled, Image: image, Duration: time.Since(start).Seconds()}
+			if err != nil {
+				ev.Message = err.Error()
+			}
+			em.Emit(ev)
+			if err != nil {
+				log.Errorf("Unable to pull image %s: %v", image, err)
+				return
+			}
+			log.Infof("Pulled image %s in %s", image, time.Since(start).Round(time.Second))
+		}(image)
+	}
+	wg.Wait()
+	close(quit)
+	log.Infof("Pulled images %s", pullSummary(status))
+}
+
+// pullSummary returns the number of images pulled and the bytes downloaded.
+func pullSummary(status map[string]*pullStatus) string {
+	var done int
+	var current, total int64
+	for _, s := range status {
+		if s.done {
+			done++
+		}
+		current += s.current
+		total += s.total
+	}
+	return fmt.Sprintf("%d/%d %s/%s", done, len(status), units.HumanSize(float64(current)), units.HumanSize(float64(total)))
+}
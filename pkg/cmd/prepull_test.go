@@ -0,0 +1,124 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	agentconfig "github.com/adevinta/vulcan-agent/config"
+	"github.com/docker/docker/api/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadPullProgress(t *testing.T) {
+	stream := `{"status":"Pulling from library/alpine","id":"latest"}
+{"status":"Pulling fs layer","id":"a"}
+{"status":"Downloading","progressDetail":{"current":50,"total":100},"id":"a"}
+{"status":"Downloading","progressDetail":{"current":10,"total":200},"id":"b"}
+{"status":"Download complete","id":"a"}
+{"status":"Pull complete","id":"b"}
+{"status":"Digest: sha256:0001"}
+`
+	type point struct{ current, total int64 }
+	got := []point{}
+	err := readPullProgress(strings.NewReader(stream), func(current, total int64) {
+		got = append(got, point{current, total})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []point{{50, 100}, {60, 300}, {110, 300}, {300, 300}}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(point{})); diff != "" {
+		t.Errorf("unexpected progress (-want +got):\n%s", diff)
+	}
+
+	err = readPullProgress(strings.NewReader(`{"error":"manifest unknown"}`), func(current, total int64) {})
+	if err == nil || err.Error() != "manifest unknown" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestRegistryAuth(t *testing.T) {
+	auths := []agentconfig.Auth{
+		{Server: "docker.io", User: "hub", Pass: "hubpass"},
+		{Server: "https://registry.example.com", User: "example", Pass: "examplepass"},
+	}
+	tests := []struct {
+		image    string
+		wantUser string
+	}{
+		{image: "vulcansec/vulcan-trivy:edge", wantUser: "hub"},
+		{image: "registry.example.com/vulcan-tls:1", wantUser: "example"},
+		{image: "ghcr.io/org/check:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			auth := registryAuth(tt.image, auths)
+			if tt.wantUser == "" {
+				if auth != "" {
+					t.Errorf("unexpected auth %s", auth)
+				}
+				return
+			}
+			content, err := base64.URLEncoding.DecodeString(auth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var cfg types.AuthConfig
+			if err := json.Unmarshal(content, &cfg); err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Username != tt.wantUser {
+				t.Errorf("unexpected user got=%s want=%s", cfg.Username, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestPrePullImages(t *testing.T) {
+	images := map[string]struct{ exists, localOnly bool }{
+		"remote:missing": {},
+		"remote:present": {exists: true},
+		"local:built":    {exists: true, localOnly: true},
+	}
+	tests := []struct {
+		name   string
+		policy agentconfig.PullPolicy
+		want   []string
+	}{
+		{name: "IfNotPresent", policy: agentconfig.PullPolicyIfNotPresent, want: []string{"remote:missing"}},
+		{name: "Always", policy: agentconfig.PullPolicyAlways, want: []string{"remote:missing", "remote:present"}},
+		{name: "Never", policy: agentconfig.PullPolicyNever, want: []string{}},
+	}
+	oldStatus, oldPull := imageStatus, pullImage
+	defer func() { imageStatus, pullImage = oldStatus, oldPull }()
+	imageStatus = func(image string) (bool, bool, error) {
+		return images[image].exists, images[image].localOnly, nil
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			pulled := []string{}
+			pullImage = func(ctx context.Context, image, auth string, progress func(current, total int64)) error {
+				progress(1, 1)
+				mu.Lock()
+				defer mu.Unlock()
+				pulled = append(pulled, image)
+				return nil
+			}
+			prePullImages(context.Background(), []string{"remote:missing", "remote:present", "local:built"}, tt.policy, nil, 2, nil, loggerUser)
+			sort.Strings(pulled)
+			if diff := cmp.Diff(tt.want, pulled); diff != "" {
+				t.Errorf("unexpected pulled images (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/adevinta/vulcan-agent/backend/docker"
+	"github.com/adevinta/vulcan-local/pkg/config"
+)
+
+// checkCABundle is the path where the CA bundle is mounted in the check
+// containers.
+const checkCABundle = "/etc/ssl/certs/vulcan-local-ca-bundle.pem"
+
+// systemCABundles are the usual paths of the CA bundle of the host, extended
+// with the custom CA certificates so the defaults are still trusted.
+var systemCABundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// caBundleVars are the env vars pointing to the CA bundle for the most common
+// tools and languages.
+var caBundleVars = []string{
+	"SSL_CERT_FILE",
+	"REQUESTS_CA_BUNDLE",
+	"CURL_CA_BUNDLE",
+	"GIT_SSL_CAINFO",
+	"NODE_EXTRA_CA_CERTS",
+}
+
+var loopbackR = regexp.MustCompile(`(?i)\b(localhost|127.0.0.1)\b`)
+
+// checkProxy contains the proxy config applied to the check containers.
+type checkProxy struct {
+	env map[string]string
+	// bundle is the path in the host of the CA bundle mounted in the checks.
+	bundle string
+}
+
+// apply adds the proxy env vars and the CA bundle to the check container.
+func (p checkProxy) apply(rc *docker.RunConfig) {
+	for k, v := range p.env {
+		rc.ContainerConfig.Env = upsertEnv(rc.ContainerConfig.Env, k, v)
+	}
+	if p.bundle != "" {
+		rc.HostConfig.Binds = append(rc.HostConfig.Binds, p.bundle+":"+checkCABundle+":ro")
+	}
+}
+
+// newCheckProxy returns the proxy config of the checks. The proxies in the
+// loopback of the host are reached through the host ip, and the services
+// exposed by vulcan-local are never proxied.
+func newCheckProxy(p config.Proxy, bundle, agentIP, hostIP string) checkProxy {
+	p.HTTPProxy = loopbackR.ReplaceAllString(p.HTTPProxy, hostIP)
+	p.HTTPSProxy = loopbackR.ReplaceAllString(p.HTTPSProxy, hostIP)
+	cp := checkProxy{bundle: bundle}
+	if bundle != "" {
+		bundle = checkCABundle
+	}
+	cp.env = proxyEnv(p, bundle, agentIP, hostIP, "localhost", "127.0.0.1")
+	return cp
+}
+
+// proxyEnv returns the env vars, in upper and lower case, of the proxy and
+// the CA bundle. The extra hosts are added to the ones not proxied.
+func proxyEnv(p config.Proxy, bundle string, noProxy ...string) map[string]string {
+	env := map[string]string{}
+	set := func(name, value string) {
+		env[name] = value
+		env[strings.ToLower(name)] = value
+	}
+	if p.HTTPProxy != "" {
+		set("HTTP_PROXY", p.HTTPProxy)
+	}
+	if p.HTTPSProxy != "" {
+		set("HTTPS_PROXY", p.HTTPSProxy)
+	}
+	if p.HTTPProxy != "" || p.HTTPSProxy != "" || len(p.NoProxy) > 0 {
+		hosts := []string{}
+		seen := map[string]bool{}
+		for _, h := range append(append([]string{}, p.NoProxy...), noProxy...) {
+			if h != "" && !seen[h] {
+				seen[h] = true
+				hosts = append(hosts, h)
+			}
+		}
+		set("NO_PROXY", strings.Join(hosts, ","))
+	}
+	if bundle != "" {
+		for _, v := range caBundleVars {
+			env[v] = bundle
+		}
+	}
+	return env
+}
+
+// writeCABundle writes in a temporary file the CA bundle of the host
+// extended with the custom CA certificates, and returns its path.
+func writeCABundle(path string) (string, error) {
+	custom, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read the CA bundle: %w", err)
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(custom) {
+		return "", fmt.Errorf("no PEM certificates found in the CA bundle %s", path)
+	}
+	bundle := []byte{}
+	for _, p := range systemCABundles {
+		if content, err := os.ReadFile(p); err == nil {
+			bundle = append(content, '\n')
+			break
+		}
+	}
+	bundle = append(bundle, custom...)
+	f, err := os.CreateTemp("", "vulcan-ca-bundle-*.pem")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	// The file is mounted in the checks, that can run as any user.
+	if err := f.Chmod(0o644); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	if _, err := f.Write(bundle); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
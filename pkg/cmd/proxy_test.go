@@ -0,0 +1,140 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adevinta/vulcan-agent/backend/docker"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/docker/docker/api/types/container"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestCheckProxy(t *testing.T) {
+	tests := []struct {
+		name      string
+		proxy     config.Proxy
+		bundle    string
+		wantEnv   []string
+		wantBinds []string
+	}{
+		{
+			name:    "Empty",
+			wantEnv: []string{"A=B"},
+		},
+		{
+			name: "Proxy",
+			proxy: config.Proxy{
+				HTTPProxy:  "http://localhost:3128",
+				HTTPSProxy: "http://proxy.corp:3128",
+				NoProxy:    []string{".corp", "localhost"},
+			},
+			wantEnv: []string{
+				"A=B",
+				"HTTP_PROXY=http://172.17.0.1:3128",
+				"http_proxy=http://172.17.0.1:3128",
+				"HTTPS_PROXY=http://proxy.corp:3128",
+				"https_proxy=http://proxy.corp:3128",
+				"NO_PROXY=.corp,localhost,10.0.0.5,172.17.0.1,127.0.0.1",
+				"no_proxy=.corp,localhost,10.0.0.5,172.17.0.1,127.0.0.1",
+			},
+		},
+		{
+			name:   "CABundle",
+			bundle: "/tmp/bundle.pem",
+			wantEnv: []string{
+				"A=B",
+				"SSL_CERT_FILE=" + checkCABundle,
+				"REQUESTS_CA_BUNDLE=" + checkCABundle,
+				"CURL_CA_BUNDLE=" + checkCABundle,
+				"GIT_SSL_CAINFO=" + checkCABundle,
+				"NODE_EXTRA_CA_CERTS=" + checkCABundle,
+			},
+			wantBinds: []string{"/tmp/bundle.pem:" + checkCABundle + ":ro"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &docker.RunConfig{
+				ContainerConfig: &container.Config{Env: []string{"A=B"}},
+				HostConfig:      &container.HostConfig{},
+			}
+			newCheckProxy(tt.proxy, tt.bundle, "10.0.0.5", "172.17.0.1").apply(rc)
+			sortStrings := cmpopts.SortSlices(func(a, b string) bool { return a < b })
+			if diff := cmp.Diff(tt.wantEnv, rc.ContainerConfig.Env, sortStrings); diff != "" {
+				t.Errorf("unexpected env (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantBinds, rc.HostConfig.Binds); diff != "" {
+				t.Errorf("unexpected binds (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriteCABundle(t *testing.T) {
+	dir := t.TempDir()
+	cert := testCertificate(t)
+	ca := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(ca, cert, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.pem")
+	if err := os.WriteFile(invalid, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, err := writeCABundle(ca)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Remove(bundle)
+	content, err := os.ReadFile(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(content, cert) {
+		t.Errorf("CA certificate not in the bundle")
+	}
+
+	if _, err := writeCABundle(invalid); err == nil {
+		t.Errorf("expected error with an invalid CA bundle")
+	}
+	if _, err := writeCABundle(filepath.Join(dir, "missing.pem")); err == nil {
+		t.Errorf("expected error with a missing CA bundle")
+	}
+}
+
+func testCertificate(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	agentconfig "github.com/adevinta/vulcan-agent/config"
+	agentlog "github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-local/pkg/checktypes"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/docker/docker-credential-helpers/client"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// The vars with the credentials of the registry of the image targets read by
+// the checks.
+const (
+	registryDomainVar   = "REGISTRY_DOMAIN"
+	registryUsernameVar = "REGISTRY_USERNAME"
+	registryPasswordVar = "REGISTRY_PASSWORD"
+)
+
+// helperCredentials returns the username and the password of the server
+// returned by the docker credential helper.
+var helperCredentials = func(helper, server string) (string, string, error) {
+	creds, err := client.Get(client.NewShellProgramFunc("docker-credential-"+helper), server)
+	if err != nil {
+		return "", "", err
+	}
+	return creds.Username, creds.Secret, nil
+}
+
+// dockerConfigKeychain resolves the credentials stored by docker login, its
+// credsStore or its credHelpers.
+var dockerConfigKeychain = authn.DefaultKeychain
+
+// registryCredentials returns the credentials of the registry of the config,
+// from its password, the environment variable of the password or its
+// credential helper.
+func registryCredentials(r config.Registry) (agentconfig.Auth, error) {
+	a := agentconfig.Auth{Server: r.Address(), User: r.Username, Pass: r.Password}
+	switch {
+	case a.Pass != "":
+	case r.PasswordEnv != "":
+		a.Pass = os.Getenv(r.PasswordEnv)
+		if a.Pass == "" {
+			return a, fmt.Errorf("empty environment variable %s", r.PasswordEnv)
+		}
+	case r.CredentialHelper != "":
+		user, pass, err := helperCredentials(r.CredentialHelper, a.Server)
+		if err != nil {
+			return a, fmt.Errorf("credential helper %s: %w", r.CredentialHelper, err)
+		}
+		if a.User == "" {
+			a.User = user
+		}
+		a.Pass = pass
+	}
+	return a, nil
+}
+
+// registryAuths returns the credentials of the registries of the config, and
+// the ones in the docker config of the registries of the images not in the
+// config. The registries without credentials are skipped.
+func registryAuths(registries []config.Registry, images []string, log agentlog.Logger) []agentconfig.Auth {
+	auths := []agentconfig.Auth{}
+	for _, r := range registries {
+		a, err := registryCredentials(r)
+		if err != nil {
+			log.Errorf("Unable to get the credentials of the registry %s: %v", a.Server, err)
+			continue
+		}
+		if a.Server == "" || a.User == "" || a.Pass == "" {
+			log.Debugf("Skipping empty registry")
+			continue
+		}
+		auths = append(auths, a)
+	}
+	for _, image := range images {
+		registry, err := checktypes.ImageRegistry(image)
+		if err != nil || findAuth(auths, registry) != nil {
+			continue
+		}
+		a, err := dockerConfigCredentials(registry)
+		if err != nil {
+			log.Errorf("Unable to get the credentials of the registry %s from the docker config: %v", registry, err)
+			continue
+		}
+		if a.User == "" || a.Pass == "" {
+			continue
+		}
+		log.Debugf("Using the credentials of the registry %s from the docker config", registry)
+		auths = append(auths, a)
+	}
+	return auths
+}
+
+// dockerConfigCredentials returns the credentials of the registry in the
+// docker config, empty if there are none.
+func dockerConfigCredentials(registry string) (agentconfig.Auth, error) {
+	a := agentconfig.Auth{Server: registry}
+	reg, err := name.NewRegistry(registry)
+	if err != nil {
+		return a, err
+	}
+	auth, err := dockerConfigKeychain.Resolve(reg)
+	if err != nil {
+		return a, err
+	}
+	cfg, err := auth.Authorization()
+	if err != nil {
+		return a, err
+	}
+	a.User, a.Pass = cfg.Username, cfg.Password
+	return a, nil
+}
+
+// findAuth returns the credentials of the registry, nil if there are none.
+func findAuth(auths []agentconfig.Auth, registry string) *agentconfig.Auth {
+	for i, a := range auths {
+		if checktypes.SameRegistry(a.Server, registry) {
+			return &auths[i]
+		}
+	}
+	return nil
+}
+
+// imageTargetEnv sets the vars with the credentials of the registry of the
+// image target read by the checks, if there are credentials for it.
+func imageTargetEnv(env []string, image string, auths []agentconfig.Auth) []string {
+	registry, err := checktypes.ImageRegistry(image)
+	if err != nil {
+		return env
+	}
+	a := findAuth(auths, registry)
+	if a == nil {
+		return env
+	}
+	env = upsertEnv(env, registryDomainVar, a.Server)
+	env = upsertEnv(env, registryUsernameVar, a.User)
+	return upsertEnv(env, registryPasswordVar, a.Pass)
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	agentconfig "github.com/adevinta/vulcan-agent/config"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/authn"
+)
+
+// fakeKeychain returns the credentials of the registries in the map.
+type fakeKeychain map[string]authn.AuthConfig
+
+func (k fakeKeychain) Resolve(r authn.Resource) (authn.Authenticator, error) {
+	if cfg, ok := k[r.RegistryStr()]; ok {
+		return authn.FromConfig(cfg), nil
+	}
+	return authn.Anonymous, nil
+}
+
+func TestRegistryCredentials(t *testing.T) {
+	t.Setenv("TEST_REGISTRY_PASSWORD", "env-pass")
+	oldHelper := helperCredentials
+	defer func() { helperCredentials = oldHelper }()
+	helperCredentials = func(helper, server string) (string, string, error) {
+		if helper != "ecr-login" {
+			return "", "", errors.New("credentials not found in native keychain")
+		}
+		return "AWS", "helper-pass-" + server, nil
+	}
+
+	tests := []struct {
+		name     string
+		registry config.Registry
+		want     agentconfig.Auth
+		wantErr  bool
+	}{
+		{
+			name:     "Password",
+			registry: config.Registry{Server: "registry.example.com", Username: "user", Password: "pass"},
+			want:     agentconfig.Auth{Server: "registry.example.com", User: "user", Pass: "pass"},
+		},
+		{
+			name:     "PasswordEnv",
+			registry: config.Registry{Host: "registry.example.com", Username: "user", PasswordEnv: "TEST_REGISTRY_PASSWORD"},
+			want:     agentconfig.Auth{Server: "registry.example.com", User: "user", Pass: "env-pass"},
+		},
+		{
+			name:     "EmptyPasswordEnv",
+			registry: config.Registry{Host: "registry.example.com", Username: "user", PasswordEnv: "TEST_REGISTRY_UNSET"},
+			wantErr:  true,
+		},
+		{
+			name:     "CredentialHelper",
+			registry: config.Registry{Host: "1234.dkr.ecr.eu-west-1.amazonaws.com", CredentialHelper: "ecr-login"},
+			want:     agentconfig.Auth{Server: "1234.dkr.ecr.eu-west-1.amazonaws.com", User: "AWS", Pass: "helper-pass-1234.dkr.ecr.eu-west-1.amazonaws.com"},
+		},
+		{
+			name:     "CredentialHelperError",
+			registry: config.Registry{Host: "gcr.io", CredentialHelper: "gcr"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := registryCredentials(tt.registry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected credentials (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRegistryAuths(t *testing.T) {
+	oldKeychain := dockerConfigKeychain
+	defer func() { dockerConfigKeychain = oldKeychain }()
+	dockerConfigKeychain = fakeKeychain{
+		"artifactory.example.com": {Username: "docker-user", Password: "docker-pass"},
+		"registry.example.com":    {Username: "docker-user", Password: "docker-pass"},
+	}
+
+	registries := []config.Registry{
+		{Server: "https://registry.example.com", Username: "user", Password: "pass"},
+		{Server: "other.example.com", Username: "user"},
+	}
+	images := []string{
+		"registry.example.com/vulcan-checks/vulcan-trivy:1",
+		"artifactory.example.com/vulcan-checks/vulcan-nuclei:1",
+		"artifactory.example.com/app:latest",
+		"vulcansec/vulcan-zap:1",
+	}
+	got := registryAuths(registries, images, loggerUser)
+	want := []agentconfig.Auth{
+		{Server: "https://registry.example.com", User: "user", Pass: "pass"},
+		{Server: "artifactory.example.com", User: "docker-user", Pass: "docker-pass"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected auths (-want +got):\n%s", diff)
+	}
+}
+
+func TestImageTargetEnv(t *testing.T) {
+	auths := []agentconfig.Auth{{Server: "registry.example.com", User: "user", Pass: "pass"}}
+	got := imageTargetEnv([]string{"VULCAN_CHECK_TARGET=registry.example.com/app:1"}, "registry.example.com/app:1", auths)
+	want := []string{
+		"VULCAN_CHECK_TARGET=registry.example.com/app:1",
+		"REGISTRY_DOMAIN=registry.example.com",
+		"REGISTRY_USERNAME=user",
+		"REGISTRY_PASSWORD=pass",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected env (-want +got):\n%s", diff)
+	}
+
+	env := []string{"REGISTRY_USERNAME=other"}
+	if diff := cmp.Diff(env, imageTargetEnv(env, "app:1", auths)); diff != "" {
+		t.Errorf("unexpected env of an image of another registry (-want +got):\n%s", diff)
+	}
+}
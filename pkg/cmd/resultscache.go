@@ -0,0 +1,235 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adevinta/vulcan-agent/jobrunner"
+	agentlog "github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-agent/stateupdater"
+	"github.com/adevinta/vulcan-local/pkg/checktypes"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/events"
+	"github.com/adevinta/vulcan-local/pkg/generator"
+	"github.com/adevinta/vulcan-local/pkg/gitservice"
+	"github.com/adevinta/vulcan-local/pkg/results"
+	report "github.com/adevinta/vulcan-report"
+)
+
+// resultsCacheDir is the directory, relative to the cache dir, where the
+// reports of the checks are cached.
+const resultsCacheDir = "results"
+
+// contentHash returns the digest of the content of the local file or
+// directory in path. For directories it's the tree of the ref if set, the
+// digest of the index if the ref is the staged one, or the digest of the
+// relative paths and contents of the files served by the git service in the
+// snapshots of the directory.
+func contentHash(cfg *config.Config, path, ref string, log agentlog.Logger) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if ref == gitservice.StagedRef && info.IsDir() {
+		out, err := execCommand(cfg.Conf.GitBin, "-C", path, "ls-files", "--stage", "-z").Output()
+		if err != nil {
+			return "", fmt.Errorf("unable to list the staged files in %s: %w", path, err)
+		}
+		return fmt.Sprintf("index:%x", sha256.Sum256(out)), nil
+	}
+	if ref != "" && info.IsDir() {
+		out, err := execCommand(cfg.Conf.GitBin, "-C", path, "rev-parse", "--verify", "--quiet", ref+"^{tree}").Output()
+		if err == nil {
+			return "tree:" + strings.TrimSpace(string(out)), nil
+		}
+	}
+	root, files := filepath.Dir(path), []string{filepath.Base(path)}
+	if info.IsDir() {
+		root = path
+		files, err = gitservice.SnapshotFiles(log, gitservice.Config{
+			Exclude:        cfg.Exclude,
+			SkipSubmodules: cfg.Conf.NoSubmodules,
+		}, path)
+		if err != nil {
+			return "", err
+		}
+	}
+	h := sha256.New()
+	for _, name := range files {
+		if err := hashFile(h, root, name); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+// hashFile writes to the hash the name of the file, slash separated and
+// relative to the root, and its content.
+func hashFile(h io.Writer, root, name string) error {
+	f, err := os.Open(filepath.Join(root, filepath.FromSlash(name)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fmt.Fprintf(h, "%s\x00", name)
+	_, err = io.Copy(h, f)
+	return err
+}
+
+// localPath returns the path of the target of the check if it's a local file
+// or directory.
+func localPath(target string) (string, bool) {
+	if path, err := generator.GetValidDirectory(target); err == nil {
+		return path, true
+	}
+	info, err := os.Stat(target)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	path, err := filepath.Abs(target)
+	return path, err == nil
+}
+
+// snapshotSettings are the settings shaping the snapshots of the local
+// directories served to the checks.
+type snapshotSettings struct {
+	Exclude        []string
+	Strategy       string
+	SkipSubmodules bool
+	SkipLFS        bool
+	LFSMaxSize     string
+}
+
+// resultsKey returns the key of the report of the check in the results
+// cache. It's empty if the check can't be cached because its target is not
+// local.
+func resultsKey(cfg *config.Config, c config.Check, digest string, log agentlog.Logger) (string, error) {
+	path, ok := localPath(c.Target)
+	if !ok || c.Checktype == nil || digest == "" {
+		return "", nil
+	}
+	content, err := contentHash(cfg, path, c.Ref, log)
+	if err != nil {
+		return "", err
+	}
+	requiredVars := map[string]string{}
+	for _, v := range c.Checktype.RequiredVars {
+		requiredVars[v] = cfg.Conf.Vars[v]
+	}
+	snapshot := snapshotSettings{
+		Exclude:        cfg.Exclude,
+		Strategy:       cfg.Conf.Snapshot,
+		SkipSubmodules: cfg.Conf.NoSubmodules,
+		SkipLFS:        cfg.Conf.LFS.Skip,
+		LFSMaxSize:     cfg.Conf.LFS.MaxSize,
+	}
+	key, err := json.Marshal(struct {
+		Checktype string
+		Digest    string
+		AssetType string
+		Options   map[string]interface{}
+		Vars      map[string]string
+		Snapshot  snapshotSettings
+		Content   string
+	}{c.Checktype.Name, digest, c.AssetType, c.Options, requiredVars, snapshot, content})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(key)), nil
+}
+
+// useCachedResults sets in the results server the cached reports of the
+// jobs. It returns the jobs not cached and the keys of the ones that must be
+// cached when finished, indexed by check id.
+func useCachedResults(cfg *config.Config, jobs []jobrunner.Job, cache *results.Cache, rs *results.ResultsServer, em *events.Emitter, log agentlog.Logger) ([]jobrunner.Job, map[string]string) {
+	keys := map[string]string{}
+	digests, _, err := checktypes.LocalImageDigests(jobImages(jobs), log)
+	if err != nil {
+		log.Errorf("Unable to get the digests of the images, ignoring the results cache: %v", err)
+		return jobs, keys
+	}
+	checks := map[string]config.Check{}
+	for _, c := range cfg.Checks {
+		checks[c.Id] = c
+	}
+	pending := []jobrunner.Job{}
+	for _, j := range jobs {
+		c := checks[j.CheckID]
+		key, err := resultsKey(cfg, c, digests[j.Image], log)
+		if err != nil {
+			log.Errorf("Unable to compute the results cache key of check %s: %v", j.CheckID, err)
+		}
+		if key == "" {
+			pending = append(pending, j)
+			continue
+		}
+		r, err := cache.Get(key)
+		if err != nil {
+			log.Errorf("Unable to read the cached results of check %s: %v", j.CheckID, err)
+		}
+		if r == nil {
+			keys[j.CheckID] = key
+			pending = append(pending, j)
+			continue
+		}
+		log.Infof("Using the cached results of %s on %s", c.Checktype.Name, c.Target)
+		r.CheckID = j.CheckID
+		rs.SetReport(j.CheckID, r)
+		ev := checkEvent(events.CheckFinished, c)
+		ev.Status = r.Status
+		ev.Findings = events.Int(len(r.Vulnerabilities))
+		ev.Message = "cached"
+		em.Emit(ev)
+	}
+	return pending, keys
+}
+
+// storeResults caches the reports of the finished checks with the keys.
+func storeResults(cfg *config.Config, keys map[string]string, cache *results.Cache, rs *results.ResultsServer, log agentlog.Logger) {
+	checks := map[string]config.Check{}
+	for _, c := range cfg.Checks {
+		checks[c.Id] = c
+	}
+	for id, key := range keys {
+		r := rs.Report(id)
+		if r == nil || r.Status != stateupdater.StatusFinished {
+			continue
+		}
+		r, err := withTarget(r, checks[id])
+		if err == nil {
+			err = cache.Put(key, r)
+		}
+		if err != nil {
+			log.Errorf("Unable to cache the results of check %s: %v", id, err)
+		}
+	}
+}
+
+// withTarget returns a copy of the report replacing the target served to the
+// check, that changes in every run, with the target of the check.
+func withTarget(r *report.Report, c config.Check) (*report.Report, error) {
+	content, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	if c.NewTarget != "" && c.NewTarget != c.Target {
+		old, _ := json.Marshal(c.NewTarget)
+		target, _ := json.Marshal(c.Target)
+		content = bytes.ReplaceAll(content, bytes.Trim(old, `"`), bytes.Trim(target, `"`))
+	}
+	var cp report.Report
+	if err := json.Unmarshal(content, &cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
@@ -0,0 +1,287 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/adevinta/vulcan-agent/backend"
+	"github.com/adevinta/vulcan-agent/jobrunner"
+	agentlog "github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-agent/stateupdater"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/events"
+	"github.com/adevinta/vulcan-local/pkg/results"
+)
+
+// defaultRetryInterval is the time to wait before the first retry of a check.
+// It's doubled for every next retry.
+const defaultRetryInterval = 5 * time.Second
+
+// retryBackend decorates a backend retrying the checks that failed for
+// transient reasons, and marking as INCONCLUSIVE the ones that timed out. It
+// also emits the events of the runs of the checks, records their durations
+// and holds the jobs of the checks depending on others until they finish.
+type retryBackend struct {
+	// interrupt is cancelled when the scan is interrupted, aborting the
+	// running checks.
+	interrupt context.Context
+	backend   backend.Backend
+	results   *results.ResultsServer
+	retries   map[string]int
+	checks    map[string]config.Check
+	interval  time.Duration
+	events    *events.Emitter
+	log       agentlog.Logger
+
+	// dependsOn are the checks that must finish successfully before running
+	// the check, indexed by check id.
+	dependsOn map[string][]string
+	// send sends the jobs released when the checks they depend on finish
+	// to the queue of the agent.
+	send func(jobs []jobrunner.Job) error
+	mu   sync.Mutex
+	// pending are the checks that didn't finish yet.
+	pending map[string]bool
+	// held are the jobs waiting for the checks they depend on, in the order
+	// of the schedule.
+	held []jobrunner.Job
+	// durations are the durations of the runs of the checks.
+	durations map[string]time.Duration
+	// checkpoint persists the state of the checks, if not nil.
+	checkpoint *checkpoint
+}
+
+// newRetryBackend returns a retryBackend with the retries of the checks.
+func newRetryBackend(interrupt context.Context, b backend.Backend, r *results.ResultsServer, cfg *config.Config, em *events.Emitter, l agentlog.Logger) *retryBackend {
+	retries := map[string]int{}
+	checks := map[string]config.Check{}
+	for _, c := range cfg.Checks {
+		if c.Id == "" {
+			continue
+		}
+		checks[c.Id] = c
+		retries[c.Id] = cfg.Conf.Retries
+		if c.Retries != nil {
+			retries[c.Id] = *c.Retries
+		}
+	}
+	return &retryBackend{
+		interrupt: interrupt,
+		backend:   b,
+		results:   r,
+		retries:   retries,
+		checks:    checks,
+		interval:  defaultRetryInterval,
+		events:    em,
+		log:       l,
+		pending:   map[string]bool{},
+		durations: map[string]time.Duration{},
+	}
+}
+
+// setDependencies sets the dependencies between the checks of the pending
+// jobs and returns the jobs ready to be sent to the queue. The rest are held
+// and sent with send when the checks they depend on finish, so their
+// timeouts don't start and they don't take a slot of the agent while they
+// wait. The dependencies on checks not pending, i.e. with cached results,
+// are already finished.
+func (b *retryBackend) setDependencies(dependsOn map[string][]string, pending []jobrunner.Job, send func(jobs []jobrunner.Job) error) []jobrunner.Job {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dependsOn = dependsOn
+	b.send = send
+	for _, j := range pending {
+		b.pending[j.CheckID] = true
+	}
+	b.held = pending
+	return b.release()
+}
+
+// release removes from the held jobs the ones whose dependencies finished
+// and returns them. It must be called with the lock held.
+func (b *retryBackend) release() []jobrunner.Job {
+	ready := []jobrunner.Job{}
+	held := []jobrunner.Job{}
+	for _, j := range b.held {
+		waiting := false
+		for _, dep := range b.dependsOn[j.CheckID] {
+			if b.pending[dep] {
+				waiting = true
+				break
+			}
+		}
+		if waiting {
+			held = append(held, j)
+		} else {
+			ready = append(ready, j)
+		}
+	}
+	b.held = held
+	return ready
+}
+
+// runDurations returns the durations of the checks run to completion.
+func (b *retryBackend) runDurations() map[string]time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	durations := map[string]time.Duration{}
+	for id, d := range b.durations {
+		durations[id] = d
+	}
+	return durations
+}
+
+func (b *retryBackend) Run(ctx context.Context, params backend.RunParams) (<-chan backend.RunResult, error) {
+	res := make(chan backend.RunResult, 1)
+	go func() {
+		res <- b.run(ctx, params)
+	}()
+	return res, nil
+}
+
+func (b *retryBackend) run(ctx context.Context, params backend.RunParams) backend.RunResult {
+	defer b.finish(params.CheckID)
+	if err := b.checkDependencies(params.CheckID); err != nil {
+		b.log.Infof("Skipping check %s, %v", params.CheckID, err)
+		b.results.SetStatus(params.CheckID, stateupdater.StatusInconclusive)
+		ev := b.event(events.CheckFinished, params.CheckID)
+		ev.Status = stateupdater.StatusInconclusive
+		ev.Message = "skipped, " + err.Error()
+		b.events.Emit(ev)
+		return backend.RunResult{}
+	}
+	start := time.Now()
+	ev := b.event(events.CheckStarted, params.CheckID)
+	ev.Attempt = 1
+	b.events.Emit(ev)
+	b.checkpoint.running(params.CheckID)
+	res := b.runAttempts(ctx, params)
+	if b.interrupt.Err() == nil && !errors.Is(res.Error, context.Canceled) {
+		b.mu.Lock()
+		b.durations[params.CheckID] = time.Since(start)
+		b.mu.Unlock()
+	}
+	b.checkpoint.finished(params.CheckID, b.results.Report(params.CheckID))
+	b.events.Emit(b.finishedEvent(params.CheckID, res))
+	return res
+}
+
+// checkDependencies returns an error if some of the checks the check depends
+// on didn't finish successfully.
+func (b *retryBackend) checkDependencies(checkID string) error {
+	for _, dep := range b.dependsOn[checkID] {
+		status := ""
+		if r := b.results.Report(dep); r != nil {
+			status = r.Status
+		}
+		if status != stateupdater.StatusFinished {
+			return fmt.Errorf("the check %s of %s it depends on finished with status %q", dep, checktypeName(b.checks[dep]), status)
+		}
+	}
+	return nil
+}
+
+// finish sends to the queue the jobs of the checks depending on the check
+// whose dependencies finished. It's called before the agent stops
+// processing the check, so the agent doesn't stop reading from the queue
+// before the jobs are sent.
+func (b *retryBackend) finish(checkID string) {
+	b.mu.Lock()
+	delete(b.pending, checkID)
+	ready := b.release()
+	b.mu.Unlock()
+	if len(ready) == 0 {
+		return
+	}
+	for _, j := range ready {
+		b.log.Debugf("Sending check %s after the checks it depends on %v", j.CheckID, b.dependsOn[j.CheckID])
+	}
+	if err := b.send(ready); err != nil {
+		b.log.Errorf("Unable to send the checks depending on check %s: %v", checkID, err)
+		for _, j := range ready {
+			b.results.SetStatus(j.CheckID, stateupdater.StatusInconclusive)
+		}
+	}
+}
+
+func (b *retryBackend) runAttempts(ctx context.Context, params backend.RunParams) backend.RunResult {
+	ctx, cancel := withInterrupt(ctx, b.interrupt)
+	defer cancel()
+	retries := b.retries[params.CheckID]
+	for attempt := 0; ; attempt++ {
+		res := b.runOnce(ctx, params)
+		if errors.Is(res.Error, context.DeadlineExceeded) {
+			b.log.Errorf("Check %s timed out", params.CheckID)
+			b.results.SetStatus(params.CheckID, stateupdater.StatusInconclusive)
+			return res
+		}
+		if attempt >= retries || !b.isTransient(params.CheckID, res) {
+			return res
+		}
+		delay := b.interval * time.Duration(1<<attempt)
+		b.log.Infof("Retrying check %s in %s attempt=%d/%d error=%v", params.CheckID, delay, attempt+1, retries, res.Error)
+		ev := b.event(events.CheckRetried, params.CheckID)
+		ev.Attempt = attempt + 2
+		ev.Message = res.Error.Error()
+		b.events.Emit(ev)
+		select {
+		case <-ctx.Done():
+			return res
+		case <-time.After(delay):
+		}
+	}
+}
+
+// event returns an event of the given type for the check.
+func (b *retryBackend) event(typ events.Type, checkID string) events.Event {
+	ev := checkEvent(typ, b.checks[checkID])
+	ev.CheckID = checkID
+	return ev
+}
+
+// finishedEvent returns the event of the check finished with the result,
+// including the status and the findings of its report.
+func (b *retryBackend) finishedEvent(checkID string, res backend.RunResult) events.Event {
+	ev := b.event(events.CheckFinished, checkID)
+	if r := b.results.Report(checkID); r != nil {
+		ev.Status = r.Status
+		ev.Findings = events.Int(len(r.Vulnerabilities))
+	}
+	if res.Error != nil {
+		ev.Message = res.Error.Error()
+	}
+	return ev
+}
+
+func (b *retryBackend) runOnce(ctx context.Context, params backend.RunParams) backend.RunResult {
+	if ctx.Err() != nil {
+		// Don't start the checks read by the agent after the interruption.
+		return backend.RunResult{Error: ctx.Err()}
+	}
+	res, err := b.backend.Run(ctx, params)
+	if err != nil {
+		// i.e. unable to pull the image.
+		return backend.RunResult{Error: err}
+	}
+	return <-res
+}
+
+// isTransient returns true if the check failed for a reason that could
+// disappear running it again: it was unable to start, or it finished
+// unexpectedly without sending a report.
+func (b *retryBackend) isTransient(checkID string, res backend.RunResult) bool {
+	switch {
+	case res.Error == nil, errors.Is(res.Error, context.Canceled):
+		return false
+	case errors.Is(res.Error, backend.ErrNonZeroExitCode):
+		return b.results.Report(checkID) == nil
+	}
+	return true
+}
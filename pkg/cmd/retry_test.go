@@ -0,0 +1,359 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adevinta/vulcan-agent/backend"
+	"github.com/adevinta/vulcan-agent/jobrunner"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/events"
+	"github.com/adevinta/vulcan-local/pkg/results"
+	report "github.com/adevinta/vulcan-report"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeBackend returns the results in order, one for every run.
+type fakeBackend struct {
+	results []backend.RunResult
+	errs    []error
+	runs    int
+}
+
+func (f *fakeBackend) Run(ctx context.Context, params backend.RunParams) (<-chan backend.RunResult, error) {
+	i := f.runs
+	f.runs++
+	if i < len(f.errs) && f.errs[i] != nil {
+		return nil, f.errs[i]
+	}
+	res := make(chan backend.RunResult, 1)
+	res <- f.results[i]
+	return res, nil
+}
+
+func TestRetryBackend(t *testing.T) {
+	nonZero := backend.RunResult{Error: fmt.Errorf("%w exit: 1", backend.ErrNonZeroExitCode)}
+	tests := []struct {
+		name       string
+		retries    int
+		backend    *fakeBackend
+		report     *report.Report
+		wantRuns   int
+		wantErr    error
+		wantStatus string
+	}{
+		{
+			name:     "Finished",
+			retries:  2,
+			backend:  &fakeBackend{results: []backend.RunResult{{}}},
+			wantRuns: 1,
+		},
+		{
+			name:    "RetryPullError",
+			retries: 2,
+			backend: &fakeBackend{
+				errs:    []error{errors.New("pull error"), nil},
+				results: []backend.RunResult{{}, {}},
+			},
+			wantRuns: 2,
+		},
+		{
+			name:    "RetryEmptyReport",
+			retries: 2,
+			backend: &fakeBackend{
+				results: []backend.RunResult{nonZero, nonZero, nonZero},
+			},
+			wantRuns: 3,
+			wantErr:  backend.ErrNonZeroExitCode,
+		},
+		{
+			name:    "NoRetryWithReport",
+			retries: 2,
+			backend: &fakeBackend{
+				results: []backend.RunResult{nonZero},
+			},
+			report:   &report.Report{CheckData: report.CheckData{Status: "FAILED"}},
+			wantRuns: 1,
+			wantErr:  backend.ErrNonZeroExitCode,
+		},
+		{
+			name:    "NoRetries",
+			retries: 0,
+			backend: &fakeBackend{
+				results: []backend.RunResult{nonZero},
+			},
+			wantRuns: 1,
+			wantErr:  backend.ErrNonZeroExitCode,
+		},
+		{
+			name:    "Timeout",
+			retries: 2,
+			backend: &fakeBackend{
+				results: []backend.RunResult{{Error: context.DeadlineExceeded}},
+			},
+			wantRuns:   1,
+			wantErr:    context.DeadlineExceeded,
+			wantStatus: "INCONCLUSIVE",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := results.Start(loggerUser)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Shutdown()
+			if tt.report != nil {
+				rs.Checks["id"] = tt.report
+			}
+			cfg := &config.Config{
+				Conf:   config.Conf{Retries: tt.retries},
+				Checks: []config.Check{{Id: "id"}},
+			}
+			b := newRetryBackend(context.Background(), tt.backend, rs, cfg, nil, loggerUser)
+			b.interval = time.Millisecond
+
+			ch, err := b.Run(context.Background(), backend.RunParams{CheckID: "id"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			res := <-ch
+			if !errors.Is(res.Error, tt.wantErr) || (tt.wantErr == nil && res.Error != nil) {
+				t.Errorf("unexpected error got=%v want=%v", res.Error, tt.wantErr)
+			}
+			if tt.backend.runs != tt.wantRuns {
+				t.Errorf("unexpected runs got=%d want=%d", tt.backend.runs, tt.wantRuns)
+			}
+			if tt.wantStatus != "" {
+				if r := rs.Report("id"); r == nil || r.Status != tt.wantStatus {
+					t.Errorf("unexpected status %+v want=%s", r, tt.wantStatus)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryBackendEvents(t *testing.T) {
+	rs, err := results.Start(loggerUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Shutdown()
+	rs.Checks["id"] = &report.Report{
+		CheckData: report.CheckData{Status: "FINISHED"},
+		ResultData: report.ResultData{
+			Vulnerabilities: []report.Vulnerability{{Summary: "v1"}, {Summary: "v2"}},
+		},
+	}
+	cfg := &config.Config{
+		Conf: config.Conf{Retries: 1},
+		Checks: []config.Check{{
+			Id:        "id",
+			Type:      "vulcan-trivy",
+			Target:    ".",
+			AssetType: "GitRepository",
+		}},
+	}
+	var buf bytes.Buffer
+	em := events.New(&buf)
+	b := newRetryBackend(context.Background(), &fakeBackend{
+		errs:    []error{errors.New("pull error"), nil},
+		results: []backend.RunResult{{}, {}},
+	}, rs, cfg, em, loggerUser)
+	b.interval = time.Millisecond
+
+	ch, err := b.Run(context.Background(), backend.RunParams{CheckID: "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-ch
+
+	got := []events.Event{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var ev events.Event
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatal(err)
+		}
+		ev.Time = time.Time{}
+		got = append(got, ev)
+	}
+	check := events.Event{CheckID: "id", Checktype: "vulcan-trivy", Target: ".", AssetType: "GitRepository"}
+	started, retried, finished := check, check, check
+	started.Type, started.Attempt = events.CheckStarted, 1
+	retried.Type, retried.Attempt, retried.Message = events.CheckRetried, 2, "pull error"
+	finished.Type, finished.Status, finished.Findings = events.CheckFinished, "FINISHED", events.Int(2)
+	want := []events.Event{started, retried, finished}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected events (-want +got):\n%s", diff)
+	}
+}
+
+func TestRetryBackendDependencies(t *testing.T) {
+	tests := []struct {
+		name       string
+		depStatus  string
+		wantRuns   int
+		wantStatus string
+	}{
+		{
+			name:       "DependencyFinished",
+			depStatus:  "FINISHED",
+			wantRuns:   2,
+			wantStatus: "FINISHED",
+		},
+		{
+			name:       "DependencyInconclusive",
+			depStatus:  "INCONCLUSIVE",
+			wantRuns:   1,
+			wantStatus: "INCONCLUSIVE",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := results.Start(loggerUser)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rs.Shutdown()
+			cfg := &config.Config{
+				Checks: []config.Check{
+					{Id: "reach", Type: "vulcan-reachability"},
+					{Id: "dast", Type: "vulcan-zap", DependsOn: []string{"vulcan-reachability"}},
+				},
+			}
+			fb := &fakeBackend{results: []backend.RunResult{{}, {}}}
+			b := newRetryBackend(context.Background(), fb, rs, cfg, nil, loggerUser)
+			var sent []jobrunner.Job
+			send := func(jobs []jobrunner.Job) error {
+				sent = append(sent, jobs...)
+				return nil
+			}
+			ready := b.setDependencies(map[string][]string{"dast": {"reach"}}, []jobrunner.Job{{CheckID: "reach"}, {CheckID: "dast"}}, send)
+			if diff := cmp.Diff([]jobrunner.Job{{CheckID: "reach"}}, ready); diff != "" {
+				t.Fatalf("unexpected ready jobs (-want +got):\n%s", diff)
+			}
+			// The report the check would send if it runs.
+			rs.SetStatus("dast", "FINISHED")
+
+			rs.SetStatus("reach", tt.depStatus)
+			reach, err := b.Run(context.Background(), backend.RunParams{CheckID: "reach"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			<-reach
+			if diff := cmp.Diff([]jobrunner.Job{{CheckID: "dast"}}, sent); diff != "" {
+				t.Fatalf("unexpected jobs sent (-want +got):\n%s", diff)
+			}
+			dast, err := b.Run(context.Background(), backend.RunParams{CheckID: "dast"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res := <-dast; res.Error != nil {
+				t.Errorf("unexpected error %v", res.Error)
+			}
+			if fb.runs != tt.wantRuns {
+				t.Errorf("unexpected runs got=%d want=%d", fb.runs, tt.wantRuns)
+			}
+			if r := rs.Report("dast"); r == nil || r.Status != tt.wantStatus {
+				t.Errorf("unexpected status %+v want=%s", r, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// slowBackend runs the checks for their delay, or until the context is done,
+// and records the starts and the ends of the runs.
+type slowBackend struct {
+	delays map[string]time.Duration
+	mu     sync.Mutex
+	runs   []string
+}
+
+func (s *slowBackend) record(run string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs = append(s.runs, run)
+}
+
+func (s *slowBackend) Run(ctx context.Context, params backend.RunParams) (<-chan backend.RunResult, error) {
+	s.record("start " + params.CheckID)
+	res := make(chan backend.RunResult, 1)
+	go func() {
+		var r backend.RunResult
+		select {
+		case <-time.After(s.delays[params.CheckID]):
+		case <-ctx.Done():
+			r.Error = ctx.Err()
+		}
+		s.record("end " + params.CheckID)
+		res <- r
+	}()
+	return res, nil
+}
+
+func TestRetryBackendDependencyTimeout(t *testing.T) {
+	rs, err := results.Start(loggerUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Shutdown()
+	cfg := &config.Config{
+		Checks: []config.Check{
+			{Id: "reach", Type: "vulcan-reachability"},
+			{Id: "dast", Type: "vulcan-zap", DependsOn: []string{"vulcan-reachability"}},
+		},
+	}
+	// The dependency runs for longer than the timeout of the check.
+	sb := &slowBackend{delays: map[string]time.Duration{"reach": 200 * time.Millisecond}}
+	timeouts := map[string]time.Duration{"reach": time.Second, "dast": 100 * time.Millisecond}
+	b := newRetryBackend(context.Background(), sb, rs, cfg, nil, loggerUser)
+
+	// The agent starts the timeout of the jobs when it reads them from the
+	// queue.
+	finished := make(chan backend.RunResult, 2)
+	var send func(jobs []jobrunner.Job) error
+	send = func(jobs []jobrunner.Job) error {
+		for _, j := range jobs {
+			ctx, cancel := context.WithTimeout(context.Background(), timeouts[j.CheckID])
+			res, err := b.Run(ctx, backend.RunParams{CheckID: j.CheckID})
+			if err != nil {
+				cancel()
+				return err
+			}
+			go func() {
+				defer cancel()
+				finished <- <-res
+			}()
+		}
+		return nil
+	}
+	// The reports the checks would send if they run.
+	rs.SetStatus("reach", "FINISHED")
+	rs.SetStatus("dast", "FINISHED")
+	if err := send(b.setDependencies(map[string][]string{"dast": {"reach"}}, []jobrunner.Job{{CheckID: "reach"}, {CheckID: "dast"}}, send)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if res := <-finished; res.Error != nil {
+			t.Errorf("unexpected error %v", res.Error)
+		}
+	}
+	if r := rs.Report("dast"); r == nil || r.Status != "FINISHED" {
+		t.Errorf("unexpected status %+v want=FINISHED", r)
+	}
+	want := []string{"start reach", "end reach", "start dast", "end dast"}
+	if diff := cmp.Diff(want, sb.runs); diff != "" {
+		t.Errorf("unexpected runs (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"sort"
+	"time"
+
+	"github.com/adevinta/vulcan-agent/jobrunner"
+	agentlog "github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-local/pkg/checktypes"
+	"github.com/adevinta/vulcan-local/pkg/config"
+)
+
+// interleaveTargets orders the jobs taking one job of every target in turns,
+// so the checks of all the targets progress in parallel instead of running
+// the checks of one target after the other.
+func interleaveTargets(jobs []jobrunner.Job) []jobrunner.Job {
+	queues := [][]jobrunner.Job{}
+	index := map[string]int{}
+	for _, j := range jobs {
+		i, ok := index[j.Target]
+		if !ok {
+			i = len(queues)
+			index[j.Target] = i
+			queues = append(queues, nil)
+		}
+		queues[i] = append(queues[i], j)
+	}
+	ordered := make([]jobrunner.Job, 0, len(jobs))
+	for len(ordered) < len(jobs) {
+		for i := range queues {
+			if len(queues[i]) > 0 {
+				ordered = append(ordered, queues[i][0])
+				queues[i] = queues[i][1:]
+			}
+		}
+	}
+	return ordered
+}
+
+// schedule is the order of the jobs and the dependencies between them.
+type schedule struct {
+	jobs []jobrunner.Job
+	// dependsOn are the ids of the checks that must finish before running
+	// the check, indexed by check id.
+	dependsOn map[string][]string
+}
+
+// scheduleJobs orders the jobs to minimize the duration of the scan: the
+// jobs with the longest estimated time until all the checks depending on
+// them finish run first, using the durations recorded for their checktypes,
+// and the jobs run after the checks they depend on. The ties keep the order
+// of interleaveTargets.
+func scheduleJobs(jobs []jobrunner.Job, checks []config.Check, durations checktypes.Durations, log agentlog.Logger) schedule {
+	jobs = interleaveTargets(jobs)
+	byID := map[string]config.Check{}
+	for _, c := range checks {
+		byID[c.Id] = c
+	}
+	deps := jobDependencies(jobs, byID, log)
+	estimates := estimateDurations(jobs, byID, durations)
+
+	// rank is the estimated time from the start of the job until all the
+	// jobs depending on it finish.
+	dependents := map[string][]string{}
+	for id, ds := range deps {
+		for _, d := range ds {
+			dependents[d] = append(dependents[d], id)
+		}
+	}
+	rank := map[string]time.Duration{}
+	var rankOf func(id string) time.Duration
+	rankOf = func(id string) time.Duration {
+		if r, ok := rank[id]; ok {
+			return r
+		}
+		var longest time.Duration
+		for _, d := range dependents[id] {
+			if r := rankOf(d); r > longest {
+				longest = r
+			}
+		}
+		rank[id] = estimates[id] + longest
+		return rank[id]
+	}
+	sorted := append([]jobrunner.Job{}, jobs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return rankOf(sorted[i].CheckID) > rankOf(sorted[j].CheckID)
+	})
+
+	// Take the first job whose dependencies are already scheduled.
+	ordered := make([]jobrunner.Job, 0, len(jobs))
+	scheduled := map[string]bool{}
+	for len(ordered) < len(jobs) {
+		for i, j := range sorted {
+			if !allScheduled(deps[j.CheckID], scheduled) {
+				continue
+			}
+			scheduled[j.CheckID] = true
+			ordered = append(ordered, j)
+			log.Debugf("Scheduled check %s position=%d type=%s target=%s estimated=%s rank=%s dependsOn=%v",
+				j.CheckID, len(ordered), checktypeName(byID[j.CheckID]), j.Target, estimates[j.CheckID], rank[j.CheckID], deps[j.CheckID])
+			sorted = append(sorted[:i:i], sorted[i+1:]...)
+			break
+		}
+	}
+	return schedule{jobs: ordered, dependsOn: deps}
+}
+
+func allScheduled(ids []string, scheduled map[string]bool) bool {
+	for _, id := range ids {
+		if !scheduled[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// jobDependencies returns the ids of the jobs every job depends on: the jobs
+// of the same target with the checktypes in the DependsOn of the check. The
+// dependencies closing a cycle are ignored.
+func jobDependencies(jobs []jobrunner.Job, checks map[string]config.Check, log agentlog.Logger) map[string][]string {
+	deps := map[string][]string{}
+	for _, j := range jobs {
+		added := map[string]bool{}
+		for _, want := range checks[j.CheckID].DependsOn {
+			found := false
+			for _, other := range jobs {
+				if other.CheckID == j.CheckID || other.Target != j.Target || !isChecktype(checks[other.CheckID], want) {
+					continue
+				}
+				found = true
+				if !added[other.CheckID] {
+					added[other.CheckID] = true
+					deps[j.CheckID] = append(deps[j.CheckID], other.CheckID)
+				}
+			}
+			if !found {
+				log.Debugf("Ignoring the dependency of check %s on %s, not scheduled on target %s", j.CheckID, want, j.Target)
+			}
+		}
+	}
+
+	// Remove the cycles with a depth first search, dropping the dependencies
+	// on the jobs being visited.
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = visiting
+		kept := []string{}
+		for _, d := range deps[id] {
+			switch state[d] {
+			case visiting:
+				log.Errorf("Ignoring the dependency of check %s on check %s, it's circular", id, d)
+				continue
+			case 0:
+				visit(d)
+			}
+			kept = append(kept, d)
+		}
+		if len(kept) > 0 {
+			deps[id] = kept
+		} else {
+			delete(deps, id)
+		}
+		state[id] = visited
+	}
+	for _, j := range jobs {
+		if state[j.CheckID] == 0 {
+			visit(j.CheckID)
+		}
+	}
+	return deps
+}
+
+// isChecktype returns true if the check is of the checktype, referenced by
+// name or by the ref used in the config.
+func isChecktype(c config.Check, ref string) bool {
+	return string(c.Type) == ref || checktypeName(c) == ref
+}
+
+func checktypeName(c config.Check) string {
+	if c.Checktype != nil {
+		return c.Checktype.Name
+	}
+	return string(c.Type)
+}
+
+// estimateDurations returns the estimated duration of every job, the one
+// recorded for its checktype. The jobs of checktypes without durations are
+// estimated with the average of the recorded ones.
+func estimateDurations(jobs []jobrunner.Job, checks map[string]config.Check, durations checktypes.Durations) map[string]time.Duration {
+	estimates := map[string]time.Duration{}
+	unknown := []string{}
+	var total time.Duration
+	for _, j := range jobs {
+		d, ok := durations[checktypeName(checks[j.CheckID])]
+		if !ok {
+			unknown = append(unknown, j.CheckID)
+			continue
+		}
+		estimates[j.CheckID] = d
+		total += d
+	}
+	var avg time.Duration
+	if known := len(jobs) - len(unknown); known > 0 {
+		avg = total / time.Duration(known)
+	}
+	for _, id := range unknown {
+		estimates[id] = avg
+	}
+	return estimates
+}
+
+// checkDurations returns the average duration of the runs of the checks of
+// every checktype.
+func checkDurations(runs map[string]time.Duration, checks []config.Check) checktypes.Durations {
+	byID := map[string]config.Check{}
+	for _, c := range checks {
+		byID[c.Id] = c
+	}
+	totals := checktypes.Durations{}
+	counts := map[string]int{}
+	for id, d := range runs {
+		c, ok := byID[id]
+		if !ok {
+			continue
+		}
+		name := checktypeName(c)
+		totals[name] += d
+		counts[name]++
+	}
+	for name := range totals {
+		totals[name] /= time.Duration(counts[name])
+	}
+	return totals
+}
+
+// recordDurations stores in the cache the durations of the checks run.
+func recordDurations(runs map[string]time.Duration, checks []config.Check, cache *checktypes.Cache, log agentlog.Logger) {
+	durations := checkDurations(runs, checks)
+	if len(durations) == 0 {
+		return
+	}
+	if err := cache.RecordDurations(durations); err != nil {
+		log.Errorf("Unable to record the durations of the checks %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adevinta/vulcan-agent/jobrunner"
+	"github.com/adevinta/vulcan-local/pkg/checktypes"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInterleaveTargets(t *testing.T) {
+	jobs := []jobrunner.Job{
+		{CheckID: "a1", Target: "a"},
+		{CheckID: "a2", Target: "a"},
+		{CheckID: "a3", Target: "a"},
+		{CheckID: "b1", Target: "b"},
+		{CheckID: "c1", Target: "c"},
+		{CheckID: "c2", Target: "c"},
+	}
+	ids := []string{}
+	for _, j := range interleaveTargets(jobs) {
+		ids = append(ids, j.CheckID)
+	}
+	want := []string{"a1", "b1", "c1", "a2", "c2", "a3"}
+	if diff := cmp.Diff(want, ids); diff != "" {
+		t.Errorf("unexpected order (-want +got):\n%s", diff)
+	}
+}
+
+func TestScheduleJobs(t *testing.T) {
+	tests := []struct {
+		name          string
+		jobs          []jobrunner.Job
+		checks        []config.Check
+		durations     checktypes.Durations
+		want          []string
+		wantDependsOn map[string][]string
+	}{
+		{
+			name: "NoDurations",
+			jobs: []jobrunner.Job{
+				{CheckID: "a1", Target: "a"},
+				{CheckID: "a2", Target: "a"},
+				{CheckID: "b1", Target: "b"},
+			},
+			checks: []config.Check{
+				{Id: "a1", Type: "fast"},
+				{Id: "a2", Type: "slow"},
+				{Id: "b1", Type: "fast"},
+			},
+			want:          []string{"a1", "b1", "a2"},
+			wantDependsOn: map[string][]string{},
+		},
+		{
+			name: "LongestFirst",
+			jobs: []jobrunner.Job{
+				{CheckID: "a1", Target: "a"},
+				{CheckID: "a2", Target: "a"},
+				{CheckID: "a3", Target: "a"},
+				{CheckID: "b1", Target: "b"},
+			},
+			checks: []config.Check{
+				{Id: "a1", Type: "fast"},
+				{Id: "a2", Type: "slow"},
+				{Id: "a3", Type: "unknown"},
+				{Id: "b1", Type: "fast"},
+			},
+			durations:     checktypes.Durations{"fast": time.Second, "slow": 5 * time.Minute},
+			want:          []string{"a2", "a3", "a1", "b1"},
+			wantDependsOn: map[string][]string{},
+		},
+		{
+			name: "DependsOn",
+			jobs: []jobrunner.Job{
+				{CheckID: "a1", Target: "a"},
+				{CheckID: "a2", Target: "a"},
+				{CheckID: "b1", Target: "b"},
+				{CheckID: "b2", Target: "b"},
+				{CheckID: "c1", Target: "c"},
+			},
+			checks: []config.Check{
+				{Id: "a1", Type: "dast", DependsOn: []string{"reachability"}},
+				{Id: "a2", Type: "reachability"},
+				{Id: "b1", Type: "dast", DependsOn: []string{"reachability"}},
+				{Id: "b2", Type: "reachability"},
+				{Id: "c1", Type: "other"},
+			},
+			durations: checktypes.Durations{
+				"dast":         time.Hour,
+				"reachability": time.Second,
+				"other":        time.Minute,
+			},
+			want: []string{"a2", "b2", "a1", "b1", "c1"},
+			wantDependsOn: map[string][]string{
+				"a1": {"a2"},
+				"b1": {"b2"},
+			},
+		},
+		{
+			name: "Cycle",
+			jobs: []jobrunner.Job{
+				{CheckID: "a1", Target: "a"},
+				{CheckID: "a2", Target: "a"},
+			},
+			checks: []config.Check{
+				{Id: "a1", Type: "one", DependsOn: []string{"two"}},
+				{Id: "a2", Type: "two", DependsOn: []string{"one"}},
+			},
+			want:          []string{"a2", "a1"},
+			wantDependsOn: map[string][]string{"a1": {"a2"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := scheduleJobs(tt.jobs, tt.checks, tt.durations, loggerUser)
+			ids := []string{}
+			for _, j := range s.jobs {
+				ids = append(ids, j.CheckID)
+			}
+			if diff := cmp.Diff(tt.want, ids); diff != "" {
+				t.Errorf("unexpected order (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantDependsOn, s.dependsOn); diff != "" {
+				t.Errorf("unexpected dependencies (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckDurations(t *testing.T) {
+	checks := []config.Check{
+		{Id: "a1", Type: "one"},
+		{Id: "b1", Type: "one"},
+		{Id: "a2", Type: "two"},
+	}
+	runs := map[string]time.Duration{
+		"a1":      time.Minute,
+		"b1":      3 * time.Minute,
+		"a2":      time.Second,
+		"unknown": time.Hour,
+	}
+	want := checktypes.Durations{"one": 2 * time.Minute, "two": time.Second}
+	if diff := cmp.Diff(want, checkDurations(runs, checks)); diff != "" {
+		t.Errorf("unexpected durations (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,233 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/events"
+	"github.com/adevinta/vulcan-local/pkg/generator"
+	"github.com/adevinta/vulcan-local/pkg/reporting"
+	report "github.com/adevinta/vulcan-report"
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// watchDebounce is the time without changes to wait before running the
+// checks again.
+var watchDebounce = 2 * time.Second
+
+// Watch runs the scan and, every time the files of the local targets change,
+// runs again the checks of the affected targets showing the new and fixed
+// vulnerabilities. It returns the exit code of the last scan when
+// interrupted.
+func Watch(cfg *config.Config, log *logrus.Logger) (int, error) {
+	dirs := localTargets(cfg.Targets)
+	if len(dirs) == 0 {
+		return config.ErrorExitCode, fmt.Errorf("watch mode requires local directory targets")
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return config.ErrorExitCode, err
+	}
+	defer watcher.Close()
+	em, closeEmitter, err := openEmitter(cfg, log)
+	if err != nil {
+		return config.ErrorExitCode, err
+	}
+	defer closeEmitter()
+	for _, d := range dirs {
+		if err := watchDir(watcher, d); err != nil {
+			return config.ErrorExitCode, err
+		}
+	}
+
+	var findings []reporting.ExtendedVulnerability
+	code, err := runInterruptible(watchConfig(cfg, nil), log, em, func(_ map[string]*report.Report, vs []reporting.ExtendedVulnerability) {
+		findings = vs
+	})
+	if err != nil {
+		return code, err
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	changed := map[string]bool{}
+	var debounce <-chan time.Time
+	log.Infof("Watching %s for changes", strings.Join(dirs, ", "))
+	for {
+		select {
+		case <-interrupt:
+			log.Infof("Stopped watching")
+			return code, nil
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return code, nil
+			}
+			log.Errorf("Error watching files: %v", err)
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return code, nil
+			}
+			if ignoredPath(ev.Name) {
+				continue
+			}
+			if ev.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					if err := watchDir(watcher, ev.Name); err != nil {
+						log.Errorf("Unable to watch %s: %v", ev.Name, err)
+					}
+				}
+			}
+			for _, d := range affectedTargets(dirs, ev.Name) {
+				changed[d] = true
+			}
+			debounce = time.After(watchDebounce)
+		case <-debounce:
+			debounce = nil
+			if len(changed) == 0 {
+				continue
+			}
+			affected := []string{}
+			for d := range changed {
+				affected = append(affected, d)
+			}
+			sort.Strings(affected)
+			changed = map[string]bool{}
+			log.Infof("Changes detected in %s, running the checks again", strings.Join(affected, ", "))
+
+			var current []reporting.ExtendedVulnerability
+			c, err := runInterruptible(watchConfig(cfg, affected), log, em, func(_ map[string]*report.Report, vs []reporting.ExtendedVulnerability) {
+				current = vs
+			})
+			if err != nil {
+				log.Errorf("Error running the checks: %v", err)
+				continue
+			}
+			code = c
+			previous, kept := splitFindings(findings, affected)
+			added, fixed := reporting.Delta(cfg, previous, current)
+			reporting.ShowDelta(added, fixed, log)
+			findings = append(kept, current...)
+		}
+	}
+}
+
+// runInterruptible runs a scan stopped by the interrupt and terminate signals,
+// calling onFindings with its results.
+func runInterruptible(cfg *config.Config, log *logrus.Logger, em *events.Emitter, onFindings func(map[string]*report.Report, []reporting.ExtendedVulnerability)) (int, error) {
+	ctx, stop := interruptContext(log)
+	defer stop()
+	return run(ctx, cfg, log, em, scanOptions{onFindings: onFindings})
+}
+
+// localTargets returns the absolute paths of the local directory targets.
+func localTargets(targets []config.Target) []string {
+	uniq := map[string]bool{}
+	dirs := []string{}
+	for _, t := range targets {
+		path, err := generator.GetValidDirectory(t.Target)
+		if err != nil || uniq[path] {
+			continue
+		}
+		uniq[path] = true
+		dirs = append(dirs, path)
+	}
+	return dirs
+}
+
+// watchConfig returns a copy of the config to run a scan. If dirs is not nil
+// only the targets and checks of those local directories are kept.
+func watchConfig(cfg *config.Config, dirs []string) *config.Config {
+	scan := *cfg
+	scan.Targets = []config.Target{}
+	for _, t := range cfg.Targets {
+		if dirs == nil || inDirs(t.Target, dirs) {
+			scan.Targets = append(scan.Targets, t)
+		}
+	}
+	scan.Checks = []config.Check{}
+	for _, c := range cfg.Checks {
+		if dirs == nil || inDirs(c.Target, dirs) {
+			scan.Checks = append(scan.Checks, c)
+		}
+	}
+	return &scan
+}
+
+// inDirs returns true if the target is one of the directories.
+func inDirs(target string, dirs []string) bool {
+	path, err := generator.GetValidDirectory(target)
+	if err != nil {
+		return false
+	}
+	for _, d := range dirs {
+		if d == path {
+			return true
+		}
+	}
+	return false
+}
+
+// splitFindings splits the vulnerabilities in the ones of the targets in dirs
+// and the rest.
+func splitFindings(vs []reporting.ExtendedVulnerability, dirs []string) (in, out []reporting.ExtendedVulnerability) {
+	for _, v := range vs {
+		if inDirs(v.Target, dirs) {
+			in = append(in, v)
+		} else {
+			out = append(out, v)
+		}
+	}
+	return in, out
+}
+
+// affectedTargets returns the directories containing the path.
+func affectedTargets(dirs []string, path string) []string {
+	affected := []string{}
+	for _, d := range dirs {
+		if rel, err := filepath.Rel(d, path); err == nil && !strings.HasPrefix(rel, "..") {
+			affected = append(affected, d)
+		}
+	}
+	return affected
+}
+
+// ignoredPath returns true for the paths whose changes don't affect the
+// checks, i.e. the git metadata.
+func ignoredPath(path string) bool {
+	for _, p := range strings.Split(filepath.ToSlash(path), "/") {
+		if p == ".git" {
+			return true
+		}
+	}
+	return false
+}
+
+// watchDir watches the directory and its subdirectories.
+func watchDir(w *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if ignoredPath(path) {
+			return filepath.SkipDir
+		}
+		return w.Add(path)
+	})
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/reporting"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWatchConfig(t *testing.T) {
+	root := t.TempDir()
+	app := filepath.Join(root, "app")
+	lib := filepath.Join(root, "lib")
+	for _, d := range []string{app, lib} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &config.Config{
+		Targets: []config.Target{
+			{Target: app},
+			{Target: lib},
+			{Target: app},
+			{Target: "alpine:latest"},
+		},
+		Checks: []config.Check{
+			{Type: "vulcan-gitleaks", Target: app},
+			{Type: "vulcan-trivy", Target: "alpine:latest"},
+		},
+	}
+	dirs := localTargets(cfg.Targets)
+	if diff := cmp.Diff([]string{app, lib}, dirs); diff != "" {
+		t.Fatalf("unexpected local targets (-want +got):\n%s", diff)
+	}
+
+	all := watchConfig(cfg, nil)
+	if len(all.Targets) != 4 || len(all.Checks) != 2 {
+		t.Errorf("unexpected full config targets=%v checks=%v", all.Targets, all.Checks)
+	}
+	scan := watchConfig(cfg, []string{app})
+	if diff := cmp.Diff([]config.Target{{Target: app}, {Target: app}}, scan.Targets); diff != "" {
+		t.Errorf("unexpected targets (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]config.Check{{Type: "vulcan-gitleaks", Target: app}}, scan.Checks); diff != "" {
+		t.Errorf("unexpected checks (-want +got):\n%s", diff)
+	}
+	scan.Checks[0].Id = "modified"
+	if cfg.Checks[0].Id != "" {
+		t.Error("the original checks were modified")
+	}
+
+	if diff := cmp.Diff([]string{app}, affectedTargets(dirs, filepath.Join(app, "src", "main.go"))); diff != "" {
+		t.Errorf("unexpected affected targets (-want +got):\n%s", diff)
+	}
+	if got := affectedTargets(dirs, filepath.Join(root, "other")); len(got) != 0 {
+		t.Errorf("unexpected affected targets %v", got)
+	}
+	if !ignoredPath(filepath.Join(app, ".git", "index")) || ignoredPath(filepath.Join(app, "main.go")) {
+		t.Error("unexpected ignored paths")
+	}
+
+	vs := []reporting.ExtendedVulnerability{
+		testVuln("", app, "", 0),
+		testVuln("", lib, "", 0),
+		testVuln("", "alpine:latest", "", 0),
+	}
+	in, out := splitFindings(vs, []string{app})
+	if len(in) != 1 || len(out) != 2 {
+		t.Errorf("unexpected split in=%d out=%d", len(in), len(out))
+	}
+}
@@ -6,20 +6,17 @@ package config
 
 import (
 	"fmt"
-	neturl "net/url"
 	"reflect"
 	"regexp"
 	"strings"
 
 	agentconfig "github.com/adevinta/vulcan-agent/config"
 	"github.com/adevinta/vulcan-agent/log"
-	"github.com/drone/envsubst"
+	"github.com/docker/go-units"
 	"github.com/imdario/mergo"
 	"github.com/sirupsen/logrus"
-	"gopkg.in/yaml.v3"
 
 	"github.com/adevinta/vulcan-local/pkg/checktypes"
-	"github.com/adevinta/vulcan-local/pkg/content"
 )
 
 type Check struct {
@@ -27,16 +24,68 @@ type Check struct {
 	Target    string                  `yaml:"target"`
 	Options   map[string]interface{}  `yaml:"options,omitempty"`
 	Timeout   *int                    `yaml:"timeout,omitempty"`
+	Retries   *int                    `yaml:"retries,omitempty"`
 	AssetType string                  `yaml:"assetType,omitempty"`
+	Ref       string                  `yaml:"ref,omitempty"`
+	Resources Resources               `yaml:"resources,omitempty"`
+	DependsOn []string                `yaml:"dependsOn,omitempty"`
 	NewTarget string
 	Id        string
 	Checktype *checktypes.Checktype
 }
 
+// Resources defines the limits of the container running a check.
+type Resources struct {
+	// CPUs is the number of cpus the check can use (eg 0.5).
+	CPUs float64 `yaml:"cpus,omitempty"`
+	// Memory is the memory limit of the check (eg 512m).
+	Memory string `yaml:"memory,omitempty"`
+}
+
+// WithDefaults returns the resources using the defaults for the unset limits.
+func (r Resources) WithDefaults(def Resources) Resources {
+	if r.CPUs == 0 {
+		r.CPUs = def.CPUs
+	}
+	if r.Memory == "" {
+		r.Memory = def.Memory
+	}
+	return r
+}
+
+// NanoCPUs returns the cpu limit in units of 1e-9 cpus.
+func (r Resources) NanoCPUs() int64 {
+	return int64(r.CPUs * 1e9)
+}
+
+// MemoryBytes returns the memory limit in bytes, 0 if not set.
+func (r Resources) MemoryBytes() (int64, error) {
+	if r.Memory == "" {
+		return 0, nil
+	}
+	m, err := units.RAMInBytes(r.Memory)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory limit %s: %w", r.Memory, err)
+	}
+	return m, nil
+}
+
+// Validate checks the limits are valid.
+func (r Resources) Validate() error {
+	if r.CPUs < 0 {
+		return fmt.Errorf("invalid cpus limit %v", r.CPUs)
+	}
+	_, err := r.MemoryBytes()
+	return err
+}
+
 type Target struct {
 	Target    string                 `yaml:"target"`
 	AssetType string                 `yaml:"assetType"`
 	Options   map[string]interface{} `yaml:"options,omitempty"`
+	// Ref is the branch, tag or commit to serve when the target is a local
+	// git repository. If empty a snapshot of the current content is served.
+	Ref string `yaml:"ref,omitempty"`
 }
 
 type Config struct {
@@ -46,6 +95,41 @@ type Config struct {
 	Targets    []Target              `yaml:"targets"`
 	CheckTypes checktypes.Checktypes `yaml:"checkTypes"`
 	Policies   []Policy              `yaml:"policies"`
+	// Exclude contains the patterns, with the .gitignore syntax, of the files
+	// of the local directories not served to the checks.
+	Exclude []string `yaml:"exclude,omitempty"`
+	// Include contains the urls of the base configs, relative to the config
+	// including them, that this config is layered over.
+	Include []string `yaml:"include,omitempty"`
+	// Profiles are named configs layered over this config when selected.
+	Profiles map[string]Config `yaml:"profiles,omitempty"`
+	// Discovery adds targets for the projects found in the local directories.
+	Discovery Discovery `yaml:"discovery,omitempty"`
+	// Hooks are the commands post-processing the findings and the report.
+	Hooks Hooks `yaml:"hooks,omitempty"`
+}
+
+// Hooks defines the shell commands receiving in their stdin the json of the
+// findings and the report when the scan finishes.
+type Hooks struct {
+	// OnFinding runs for every reported finding.
+	OnFinding string `yaml:"onFinding,omitempty"`
+	// OnComplete runs once with the json report.
+	OnComplete string `yaml:"onComplete,omitempty"`
+	// Timeout is the max time in seconds of every execution, 60 by default.
+	Timeout int `yaml:"timeout,omitempty"`
+	// NonFatal only logs the failures of the hooks, by default they fail the
+	// scan.
+	NonFatal bool `yaml:"nonFatal,omitempty"`
+}
+
+// Discovery defines how the projects of the local directory targets are
+// discovered.
+type Discovery struct {
+	Enabled bool `yaml:"enabled"`
+	// Exclude contains the patterns, with the .gitignore syntax, of the
+	// directories not discovered.
+	Exclude []string `yaml:"exclude,omitempty"`
 }
 
 type Policy struct {
@@ -56,29 +140,162 @@ type Policy struct {
 type PolicyCheck struct {
 	CheckType checktypes.ChecktypeRef `yaml:"type"`
 	Options   map[string]interface{}  `yaml:"options,omitempty"`
+	DependsOn []string                `yaml:"dependsOn,omitempty"`
 }
 
+// Registry defines the credentials of a registry used to pull the checktype
+// images and by the checks of the image targets.
 type Registry struct {
-	Server   string `yaml:"server"`
+	Server string `yaml:"server"`
+	// Host is an alias of Server.
+	Host     string `yaml:"host"`
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
+	// PasswordEnv is the environment variable with the password, used when
+	// Password is empty.
+	PasswordEnv string `yaml:"passwordEnv"`
+	// CredentialHelper is the docker credential helper returning the
+	// credentials, i.e. ecr-login runs docker-credential-ecr-login.
+	CredentialHelper string `yaml:"credentialHelper"`
+}
+
+// Address returns the server of the registry.
+func (r Registry) Address() string {
+	if r.Server != "" {
+		return r.Server
+	}
+	return r.Host
+}
+
+// Proxy defines the proxy and the CA bundle used to reach the network, by
+// vulcan-local and by the checks.
+type Proxy struct {
+	HTTPProxy  string `yaml:"httpProxy,omitempty"`
+	HTTPSProxy string `yaml:"httpsProxy,omitempty"`
+	// NoProxy contains the hosts, domains and networks not proxied.
+	NoProxy []string `yaml:"noProxy,omitempty"`
+	// CABundle is the path of the PEM file with the extra CA certificates
+	// trusted, usually the ones of the proxy intercepting the TLS traffic.
+	CABundle string `yaml:"caBundle,omitempty"`
+}
+
+// LocalServices defines where the services of vulcan-local reachable by the
+// checks (the git servers, the local registry, the proxies of the local web
+// services and the agent) listen.
+type LocalServices struct {
+	// Iface is the address where the services listen, all the interfaces by
+	// default. The agent always listens in all the interfaces.
+	Iface string `yaml:"iface,omitempty"`
+	// PortRange is the range of ports of the services (eg 42000-42100),
+	// random ports by default.
+	PortRange string `yaml:"portRange,omitempty"`
+}
+
+// LFS defines how the git LFS objects of the repositories are served to the
+// checks.
+type LFS struct {
+	// Skip serves the pointer files instead of the content of the objects.
+	Skip bool `yaml:"skip,omitempty"`
+	// MaxSize is the size of the biggest object served (eg 100MB), the
+	// bigger ones are served as pointers. No limit if empty.
+	MaxSize string `yaml:"maxSize,omitempty"`
+}
+
+// MaxSizeBytes returns the size limit in bytes, 0 if not set.
+func (l LFS) MaxSizeBytes() (int64, error) {
+	if l.MaxSize == "" {
+		return 0, nil
+	}
+	size, err := units.FromHumanSize(l.MaxSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid LFS max size %s: %w", l.MaxSize, err)
+	}
+	return size, nil
+}
+
+// Redaction defines how the secrets are masked in the logs, the reports and
+// the artifacts. The passwords of the registries, the upload token, the vars
+// of the checks and the credentials of the URLs are always masked.
+type Redaction struct {
+	// Disabled doesn't mask any secret.
+	Disabled bool `yaml:"disabled,omitempty"`
+	// Patterns are the regexps of the values masked. If a pattern has a
+	// capture group only the first group is masked.
+	Patterns []string `yaml:"patterns,omitempty"`
+	// Reveal is the number of characters kept at the start of the secrets
+	// longer than twice its value, none by default.
+	Reveal int `yaml:"reveal,omitempty"`
+}
+
+// Kubernetes defines how the checks are run as Jobs in a cluster with the
+// kubernetes runtime.
+type Kubernetes struct {
+	// Bin is the kubectl binary, kubectl by default.
+	Bin        string `yaml:"bin,omitempty"`
+	Kubeconfig string `yaml:"kubeconfig,omitempty"`
+	Context    string `yaml:"context,omitempty"`
+	// Namespace of the Jobs, the one of the context by default.
+	Namespace        string            `yaml:"namespace,omitempty"`
+	ServiceAccount   string            `yaml:"serviceAccount,omitempty"`
+	ImagePullSecrets []string          `yaml:"imagePullSecrets,omitempty"`
+	NodeSelector     map[string]string `yaml:"nodeSelector,omitempty"`
+	Labels           map[string]string `yaml:"labels,omitempty"`
 }
 
 type Conf struct {
-	DockerBin    string                 `yaml:"dockerBin"`
-	GitBin       string                 `yaml:"gitBin"`
-	PullPolicy   agentconfig.PullPolicy `yaml:"pullPolicy"`
-	Vars         map[string]string      `yaml:"vars"`
-	Repositories []string               `yaml:"repositories"`
-	Registries   []Registry             `yaml:"registries"`
-	LogLevel     logrus.Level           `yaml:"logLevel"`
-	Concurrency  int                    `yaml:"concurrency"`
-	IfName       string                 `yaml:"ifName"`
-	Exclude      string                 `yaml:"exclude"`
-	Include      string                 `yaml:"include"`
-	IncludeR     *regexp.Regexp
-	ExcludeR     *regexp.Regexp
-	Policy       string
+	Runtime       string                 `yaml:"runtime"`
+	DockerBin     string                 `yaml:"dockerBin"`
+	PodmanBin     string                 `yaml:"podmanBin"`
+	GitBin        string                 `yaml:"gitBin"`
+	PullPolicy    agentconfig.PullPolicy `yaml:"pullPolicy"`
+	Vars          map[string]string      `yaml:"vars"`
+	Repositories  []string               `yaml:"repositories"`
+	Registries    []Registry             `yaml:"registries"`
+	Proxy         Proxy                  `yaml:"proxy"`
+	Kubernetes    Kubernetes             `yaml:"kubernetes"`
+	LocalServices LocalServices          `yaml:"localServices"`
+	LogLevel      logrus.Level           `yaml:"logLevel"`
+	LogFormat     string                 `yaml:"logFormat"`
+	ProgressFile  string                 `yaml:"progressFile"`
+	MetricsAddr   string                 `yaml:"metricsAddress"`
+	ArtifactsDir  string                 `yaml:"artifactsDir"`
+	Concurrency   int                    `yaml:"concurrency"`
+	IfName        string                 `yaml:"ifName"`
+	AdvertiseAddr string                 `yaml:"advertiseAddress"`
+	DockerContext string                 `yaml:"dockerContext"`
+	MultiplexGit  bool                   `yaml:"multiplexGit"`
+	GitBind       string                 `yaml:"gitBindAddress"`
+	LocalRegistry bool                   `yaml:"localRegistry"`
+	Snapshot      string                 `yaml:"snapshotStrategy"`
+	NoSubmodules  bool                   `yaml:"skipSubmodules"`
+	LFS           LFS                    `yaml:"lfs"`
+	Redaction     Redaction              `yaml:"redaction"`
+	Resources     Resources              `yaml:"resources"`
+	Timeout       int                    `yaml:"timeout"`
+	CacheDir      string                 `yaml:"cacheDir"`
+	CacheTTL      string                 `yaml:"cacheTTL"`
+	LockFile      string                 `yaml:"lockFile"`
+	Offline       bool                   `yaml:"offline"`
+	Retries       int                    `yaml:"retries"`
+	Diff          string                 `yaml:"diff"`
+	Exclude       string                 `yaml:"exclude"`
+	Include       string                 `yaml:"include"`
+	IncludeTags   []string               `yaml:"includeTags"`
+	ExcludeTags   []string               `yaml:"excludeTags"`
+	ChecktypeTags map[string][]string    `yaml:"checktypeTags"`
+	AssetTypes    []string               `yaml:"assetTypes"`
+	IncludeR      *regexp.Regexp
+	ExcludeR      *regexp.Regexp
+	Policy        string
+	Profile       string
+	DevCheck      string
+	Resume        string
+	NoCache       bool
+	UpdateLock    bool
+	Staged        bool
+	DryRun        bool
+	Watch         bool
+	TUI           bool
 }
 
 type Exclusion struct {
@@ -89,11 +306,93 @@ type Exclusion struct {
 	Description      string `yaml:"description"`
 }
 
+// Override sets the severity of the vulnerabilities found by a check, or only
+// the ones matching the ID if set.
+type Override struct {
+	// Check is the name of the checktype (eg vulcan-zap).
+	Check string `yaml:"check"`
+	// ID matches the id, the fingerprint or the summary of the
+	// vulnerabilities.
+	ID       string    `yaml:"id,omitempty"`
+	Target   string    `yaml:"target,omitempty"`
+	Severity *Severity `yaml:"severity"`
+	Reason   string    `yaml:"reason"`
+}
+
 type Reporting struct {
-	Severity   Severity    `yaml:"severity"`
-	Format     string      `yaml:"format"`
-	OutputFile string      `yaml:"outputFile"`
+	Severity   Severity `yaml:"severity"`
+	Format     string   `yaml:"format"`
+	OutputFile string   `yaml:"outputFile"`
+	// SBOM is the file where the CycloneDX SBOM of the components found by
+	// the checks is written.
+	SBOM       string      `yaml:"sbom,omitempty"`
 	Exclusions []Exclusion `yaml:"exclusions"`
+	// Dedup merges the same vulnerability reported by several checks in
+	// the same target and resource.
+	Dedup bool `yaml:"dedup,omitempty"`
+	// Overrides change the severity of the vulnerabilities before evaluating
+	// the thresholds.
+	Overrides []Override `yaml:"overrides,omitempty"`
+	// Baseline is the file containing the accepted findings. They are
+	// reported as suppressed and don't affect the exit code.
+	Baseline       string `yaml:"baseline"`
+	UpdateBaseline bool
+	// History is the directory storing the findings of every scan, compared
+	// by the diff command.
+	History string `yaml:"history"`
+	// Policy decides the exit code. If not set the exit code is given by the
+	// max severity over the Severity threshold.
+	Policy ExitPolicy `yaml:"policy,omitempty"`
+	// Upload sends the reports to a remote endpoint when the URL is set.
+	Upload Upload `yaml:"upload,omitempty"`
+}
+
+// Upload defines the remote endpoint receiving the reports of the checks.
+type Upload struct {
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+	Team  string `yaml:"team"`
+	// BatchSize is the max number of reports sent in every request.
+	BatchSize int `yaml:"batchSize,omitempty"`
+}
+
+type ExitPolicy struct {
+	FailOn []FailOnRule `yaml:"failOn"`
+}
+
+// FailOnRule fails the scan when at least Count vulnerabilities with Severity
+// or higher are found, optionally only counting the ones reported by Check.
+type FailOnRule struct {
+	// Severity is the min severity to count, INFO if not set.
+	Severity *Severity `yaml:"severity,omitempty"`
+	// Count is the min number of vulnerabilities to fail, 1 if not set.
+	Count int `yaml:"count,omitempty"`
+	// Check is the name of the checktype (eg vulcan-trivy).
+	Check string `yaml:"check,omitempty"`
+}
+
+// MinSeverity returns the min severity counted by the rule.
+func (r FailOnRule) MinSeverity() Severity {
+	if r.Severity == nil {
+		return SeverityInfo
+	}
+	return *r.Severity
+}
+
+// MinCount returns the min number of vulnerabilities to fail.
+func (r FailOnRule) MinCount() int {
+	if r.Count <= 0 {
+		return 1
+	}
+	return r.Count
+}
+
+func (r FailOnRule) String() string {
+	s := fmt.Sprintf("severity=%s count=%d", r.MinSeverity().Data().Name, r.MinCount())
+	if r.Check != "" {
+		s = fmt.Sprintf("check=%s %s", r.Check, s)
+	}
+	return s
 }
 
 type Severity int
@@ -222,25 +521,10 @@ func ReadConfig(url string, cfg *Config, l log.Logger) error {
 		url = strings.TrimPrefix(url, "file://")
 	}
 
-	u, err := neturl.Parse(url)
+	newConfig, err := loadConfig(url, cfg.Conf.Profile, map[string]bool{}, l)
 	if err != nil {
 		return err
 	}
-	bytes, err := content.Download(u)
-	if err != nil {
-		return err
-	}
-
-	c, err := envsubst.EvalEnv(string(bytes))
-	if err != nil {
-		return fmt.Errorf("unable to eval envs in %s: %w", url, err)
-	}
-	bytes = []byte(c)
-	newConfig := Config{}
-	err = yaml.Unmarshal(bytes, &newConfig)
-	if err != nil {
-		return fmt.Errorf("unable to decode yaml %s: %w", url, err)
-	}
 	if err = mergo.Merge(cfg, newConfig, mergo.WithTransformers(sliceAppenderTransformer{})); err != nil {
 		return fmt.Errorf("unable to merge config %s: %w", url, err)
 	}
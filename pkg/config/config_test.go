@@ -5,7 +5,13 @@ Copyright 2021 Adevinta
 package config
 
 import (
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sirupsen/logrus"
 )
 
 func TestFindSeverityByScore(t *testing.T) {
@@ -73,3 +79,335 @@ func TestFindSeverityByScore(t *testing.T) {
 		}
 	}
 }
+
+func TestResources(t *testing.T) {
+	tests := []struct {
+		name        string
+		resources   Resources
+		defaults    Resources
+		wantCPUs    int64
+		wantMemory  int64
+		wantInvalid bool
+	}{
+		{
+			name:       "Defaults",
+			resources:  Resources{},
+			defaults:   Resources{CPUs: 1, Memory: "1g"},
+			wantCPUs:   1e9,
+			wantMemory: 1 << 30,
+		},
+		{
+			name:       "Override",
+			resources:  Resources{CPUs: 0.5, Memory: "512m"},
+			defaults:   Resources{CPUs: 1, Memory: "1g"},
+			wantCPUs:   5e8,
+			wantMemory: 512 << 20,
+		},
+		{
+			name: "Unlimited",
+		},
+		{
+			name:        "InvalidMemory",
+			resources:   Resources{Memory: "lots"},
+			wantInvalid: true,
+		},
+		{
+			name:        "InvalidCPUs",
+			resources:   Resources{CPUs: -1},
+			wantInvalid: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.resources.WithDefaults(tt.defaults)
+			err := r.Validate()
+			if (err != nil) != tt.wantInvalid {
+				t.Fatalf("unexpected validation error %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if got := r.NanoCPUs(); got != tt.wantCPUs {
+				t.Errorf("unexpected cpus got=%d want=%d", got, tt.wantCPUs)
+			}
+			if got, _ := r.MemoryBytes(); got != tt.wantMemory {
+				t.Errorf("unexpected memory got=%d want=%d", got, tt.wantMemory)
+			}
+		})
+	}
+}
+
+func TestLFSMaxSizeBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		lfs     LFS
+		want    int64
+		wantErr bool
+	}{
+		{name: "Unlimited", want: 0},
+		{name: "Decimal", lfs: LFS{MaxSize: "100MB"}, want: 100e6},
+		{name: "Invalid", lfs: LFS{MaxSize: "big"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.lfs.MaxSizeBytes()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("unexpected size got=%d want=%d", got, tt.want)
+			}
+		})
+	}
+}
+
+const baseConfig = `
+conf:
+  concurrency: 2
+  repositories:
+    - base.json
+  vars:
+    A: base
+    B: base
+targets:
+  - target: base
+    options:
+      depth: 1
+      auth:
+        user: base
+checks:
+  - type: base-check
+    target: base
+reporting:
+  format: json
+profiles:
+  quick:
+    conf:
+      concurrency: 1
+`
+
+func TestReadConfigInclude(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		profile string
+		want    Config
+		wantErr bool
+	}{
+		{
+			name: "Overlay",
+			files: map[string]string{
+				"base/base.yaml": baseConfig,
+				"vulcan.yaml": `
+include:
+  - base/base.yaml
+conf:
+  repositories:
+    - overlay.json
+  vars:
+    B: overlay
+reporting:
+  format: sarif
+`,
+			},
+			want: Config{
+				Conf: Conf{
+					Concurrency:  2,
+					Repositories: []string{"base.json", "overlay.json"},
+					Vars:         map[string]string{"A": "base", "B": "overlay"},
+				},
+				Targets: []Target{{Target: "base", Options: map[string]interface{}{"depth": 1, "auth": map[string]interface{}{"user": "base"}}}},
+				Checks:  []Check{{Type: "base-check", Target: "base"}},
+				Reporting: Reporting{
+					Format: "sarif",
+				},
+			},
+		},
+		{
+			name: "OverrideLists",
+			files: map[string]string{
+				"base/base.yaml": baseConfig,
+				"vulcan.yaml": `
+include:
+  - base/base.yaml
+conf:
+  repositories: !override
+    - overlay.json
+checks: !override []
+`,
+			},
+			want: Config{
+				Conf: Conf{
+					Concurrency:  2,
+					Repositories: []string{"overlay.json"},
+					Vars:         map[string]string{"A": "base", "B": "base"},
+				},
+				Targets:   []Target{{Target: "base", Options: map[string]interface{}{"depth": 1, "auth": map[string]interface{}{"user": "base"}}}},
+				Reporting: Reporting{Format: "json"},
+			},
+		},
+		{
+			name: "Profile",
+			files: map[string]string{
+				"base/base.yaml": baseConfig,
+				"vulcan.yaml": `
+include:
+  - base/base.yaml
+profiles:
+  quick:
+    checks: !override
+      - type: quick-check
+        target: .
+    targets:
+      - target: base
+        options:
+          auth:
+            token: quick
+`,
+			},
+			profile: "quick",
+			want: Config{
+				Conf: Conf{
+					Concurrency:  1,
+					Repositories: []string{"base.json"},
+					Vars:         map[string]string{"A": "base", "B": "base"},
+				},
+				Targets: []Target{
+					{Target: "base", Options: map[string]interface{}{"depth": 1, "auth": map[string]interface{}{"user": "base"}}},
+					{Target: "base", Options: map[string]interface{}{"auth": map[string]interface{}{"token": "quick"}}},
+				},
+				Checks:    []Check{{Type: "quick-check", Target: "."}},
+				Reporting: Reporting{Format: "json"},
+			},
+		},
+		{
+			name: "Cycle",
+			files: map[string]string{
+				"vulcan.yaml": "include: [other.yaml]",
+				"other.yaml":  "include: [vulcan.yaml]",
+			},
+			wantErr: true,
+		},
+		{
+			name: "MissingInclude",
+			files: map[string]string{
+				"vulcan.yaml": "include: [missing.yaml]",
+			},
+			wantErr: true,
+		},
+	}
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg := Config{Conf: Conf{Profile: tt.profile}}
+			err := ReadConfig(filepath.Join(dir, "vulcan.yaml"), &cfg, l)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err != nil {
+				return
+			}
+			cfg.Profiles = nil
+			tt.want.Conf.Profile = tt.profile
+			if diff := cmp.Diff(tt.want, cfg); diff != "" {
+				t.Errorf("unexpected config (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReadConfigEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		config  string
+		want    Config
+		wantErr bool
+	}{
+		{
+			name: "Expand",
+			env: map[string]string{
+				"REGISTRY_PASSWORD": `p: "a'#b`,
+				"TARGET":            "http://localhost:1234",
+				"CONCURRENCY":       "4",
+			},
+			config: `
+conf:
+  concurrency: ${CONCURRENCY}
+  registries:
+    - server: ${REGISTRY_SERVER:-docker.io}
+      username: user
+      password: ${REGISTRY_PASSWORD}
+targets:
+  - target: ${TARGET}/path
+    options:
+      token: "${TOKEN:-none}"
+`,
+			want: Config{
+				Conf: Conf{
+					Concurrency: 4,
+					Registries:  []Registry{{Server: "docker.io", Username: "user", Password: `p: "a'#b`}},
+				},
+				Targets: []Target{{Target: "http://localhost:1234/path", Options: map[string]interface{}{"token": "none"}}},
+			},
+		},
+		{
+			name: "Escape",
+			env:  map[string]string{"TOKEN": "token"},
+			config: `
+targets:
+  - target: .
+    options:
+      literal: pa$$word$${TOKEN}
+      required: $${TOKEN:?unused}
+`,
+			want: Config{
+				Targets: []Target{{Target: ".", Options: map[string]interface{}{"literal": "pa$word${TOKEN}", "required": "${TOKEN:?unused}"}}},
+			},
+		},
+		{
+			name: "Required",
+			config: `
+conf:
+  registries:
+    - password: ${VULCAN_TEST_UNSET_PASSWORD:?the registry password is required}
+`,
+			wantErr: true,
+		},
+	}
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			path := filepath.Join(t.TempDir(), "vulcan.yaml")
+			if err := os.WriteFile(path, []byte(tt.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cfg := Config{}
+			err := ReadConfig(path, &cfg, l)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, cfg); diff != "" {
+				t.Errorf("unexpected config (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
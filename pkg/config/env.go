@@ -0,0 +1,59 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/drone/envsubst"
+	"gopkg.in/yaml.v3"
+)
+
+// requiredEnvRegexp matches the ${VAR:?message} and ${VAR?message}
+// expressions, not escaped with $$.
+var requiredEnvRegexp = regexp.MustCompile(`(^|[^$])\$\{(\w+)(:?)\?([^}]*)\}`)
+
+// expandEnv replaces the environment variables in the values and keys of the
+// yaml nodes. As it's done after parsing the yaml, the values of the variables
+// can contain any character. A $$ is replaced by a literal $.
+func expandEnv(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		return expandScalar(n)
+	}
+	for _, c := range n.Content {
+		if err := expandEnv(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func expandScalar(n *yaml.Node) error {
+	for _, m := range requiredEnvRegexp.FindAllStringSubmatch(n.Value, -1) {
+		v, ok := os.LookupEnv(m[2])
+		if !ok || (m[3] == ":" && v == "") {
+			msg := m[4]
+			if msg == "" {
+				msg = "not set"
+			}
+			return fmt.Errorf("line %d: %s: %s", n.Line, m[2], msg)
+		}
+	}
+	v, err := envsubst.EvalEnv(n.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", n.Line, err)
+	}
+	if v == n.Value {
+		return nil
+	}
+	n.Value = v
+	if n.Style == 0 {
+		// Resolve the type of the expanded plain value (eg ints, bools).
+		n.Tag = ""
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package config
+
+import (
+	"fmt"
+	neturl "net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/adevinta/vulcan-agent/log"
+	"gopkg.in/yaml.v3"
+
+	"github.com/adevinta/vulcan-local/pkg/content"
+)
+
+// overrideTag marks the lists replacing, instead of extending, the lists of
+// the included configs (eg checks: !override [...]).
+const overrideTag = "!override"
+
+// loadConfig reads the config in the url layered over the configs it
+// includes, and applies the profile if the config defines it.
+func loadConfig(url, profile string, visited map[string]bool, l log.Logger) (Config, error) {
+	if visited[url] {
+		return Config{}, fmt.Errorf("include cycle in %s", url)
+	}
+	visited[url] = true
+	defer delete(visited, url)
+
+	c, overrides, err := decodeConfig(url)
+	if err != nil {
+		return Config{}, err
+	}
+	layered := Config{}
+	for _, inc := range c.Include {
+		incURL, err := resolveInclude(url, inc)
+		if err != nil {
+			return Config{}, err
+		}
+		ic, err := loadConfig(incURL, profile, visited, l)
+		if err != nil {
+			return Config{}, fmt.Errorf("unable to include %s from %s: %w", inc, url, err)
+		}
+		mergeConfig(&layered, ic, nil)
+		l.Debugf("Included config %s from %s", incURL, url)
+	}
+	mergeConfig(&layered, c, overrides)
+	if p, ok := c.Profiles[profile]; ok && profile != "" {
+		mergeConfig(&layered, p, subPaths(overrides, "profiles."+profile))
+		l.Debugf("Applied profile %s from %s", profile, url)
+	}
+	layered.Include = nil
+	return layered, nil
+}
+
+// decodeConfig reads the config in the url and returns it with the paths of
+// the lists tagged with overrideTag.
+func decodeConfig(url string) (Config, map[string]bool, error) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return Config{}, nil, err
+	}
+	bytes, err := content.Download(u)
+	if err != nil {
+		return Config{}, nil, err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(bytes, &node); err != nil {
+		return Config{}, nil, fmt.Errorf("unable to decode yaml %s: %w", url, err)
+	}
+	if err := expandEnv(&node); err != nil {
+		return Config{}, nil, fmt.Errorf("unable to eval envs in %s: %w", url, err)
+	}
+	overrides := map[string]bool{}
+	findOverrides(&node, "", overrides)
+	c := Config{}
+	if err := node.Decode(&c); err != nil {
+		return Config{}, nil, fmt.Errorf("unable to decode yaml %s: %w", url, err)
+	}
+	return c, overrides, nil
+}
+
+// findOverrides adds to overrides the paths of the lists tagged with
+// overrideTag, removing the tag.
+func findOverrides(n *yaml.Node, path string, overrides map[string]bool) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			findOverrides(c, path, overrides)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			findOverrides(n.Content[i+1], joinPath(path, n.Content[i].Value), overrides)
+		}
+	case yaml.SequenceNode:
+		if n.Tag == overrideTag {
+			overrides[path] = true
+			n.Tag = "!!seq"
+		}
+	}
+}
+
+// resolveInclude returns the url of the include relative to the url of the
+// config including it.
+func resolveInclude(url, inc string) (string, error) {
+	u, err := neturl.Parse(inc)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "" || filepath.IsAbs(inc) {
+		return inc, nil
+	}
+	base, err := neturl.Parse(url)
+	if err != nil {
+		return "", err
+	}
+	if base.Scheme == "" {
+		return filepath.Join(filepath.Dir(url), inc), nil
+	}
+	return base.ResolveReference(u).String(), nil
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// subPaths returns the paths under the prefix, relative to it.
+func subPaths(paths map[string]bool, prefix string) map[string]bool {
+	sub := map[string]bool{}
+	for p := range paths {
+		if strings.HasPrefix(p, prefix+".") {
+			sub[strings.TrimPrefix(p, prefix+".")] = true
+		}
+	}
+	return sub
+}
+
+// mergeConfig merges src over dst. The values set in src replace the ones in
+// dst, the maps are merged recursively and the lists are appended, unless
+// their path is in overrides.
+func mergeConfig(dst *Config, src Config, overrides map[string]bool) {
+	mergeValue(reflect.ValueOf(dst).Elem(), reflect.ValueOf(src), "", overrides)
+}
+
+func mergeValue(dst, src reflect.Value, path string, overrides map[string]bool) {
+	switch dst.Kind() {
+	case reflect.Struct:
+		t := dst.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if !dst.Field(i).CanSet() {
+				continue
+			}
+			mergeValue(dst.Field(i), src.Field(i), joinPath(path, yamlName(t.Field(i))), overrides)
+		}
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		merged := reflect.MakeMapWithSize(dst.Type(), dst.Len()+src.Len())
+		iter := dst.MapRange()
+		for iter.Next() {
+			merged.SetMapIndex(iter.Key(), iter.Value())
+		}
+		iter = src.MapRange()
+		for iter.Next() {
+			v := reflect.New(dst.Type().Elem()).Elem()
+			if old := merged.MapIndex(iter.Key()); old.IsValid() {
+				v.Set(old)
+			}
+			mergeValue(v, iter.Value(), joinPath(path, fmt.Sprint(iter.Key().Interface())), overrides)
+			merged.SetMapIndex(iter.Key(), v)
+		}
+		dst.Set(merged)
+	case reflect.Slice:
+		if overrides[path] {
+			dst.Set(src)
+			return
+		}
+		if src.Len() > 0 {
+			dst.Set(reflect.AppendSlice(reflect.MakeSlice(dst.Type(), 0, dst.Len()+src.Len()), dst))
+			dst.Set(reflect.AppendSlice(dst, src))
+		}
+	case reflect.Interface:
+		if src.IsNil() {
+			return
+		}
+		// Nested maps of the options.
+		dm, dok := dst.Interface().(map[string]interface{})
+		sm, sok := src.Interface().(map[string]interface{})
+		if dok && sok {
+			v := reflect.New(reflect.TypeOf(dm)).Elem()
+			v.Set(reflect.ValueOf(dm))
+			mergeValue(v, reflect.ValueOf(sm), path, overrides)
+			dst.Set(v)
+			return
+		}
+		dst.Set(src)
+	default:
+		if !src.IsZero() {
+			dst.Set(src)
+		}
+	}
+}
+
+// yamlName returns the key of the field in the yaml config.
+func yamlName(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("yaml"), ","); name != "" {
+		return name
+	}
+	return strings.ToLower(f.Name)
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package container
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/adevinta/vulcan-agent/log"
+)
+
+const (
+	// Docker is the name of the docker runtime.
+	Docker = "docker"
+	// Podman is the name of the podman runtime.
+	Podman = "podman"
+
+	// dockerSocket is the path of the docker socket, in the host and in the
+	// check containers.
+	dockerSocket = "/var/run/docker.sock"
+)
+
+// Runtime defines the container engine used to run the checks. The checks
+// are run by the docker backend of the agent, so the runtime must provide a
+// docker compatible API.
+type Runtime interface {
+	// Name returns the name of the runtime.
+	Name() string
+	// Bin returns the cli binary of the runtime.
+	Bin() string
+	// Host returns the address of the API in DOCKER_HOST format. If empty
+	// the default of the docker clients is used.
+	Host() string
+	// Env returns the env vars the docker clients need to connect to the
+	// API (DOCKER_HOST and the TLS settings).
+	Env() map[string]string
+	// RemoteHost returns the hostname of the machine running the containers
+	// when it's not the local one, empty otherwise.
+	RemoteHost() string
+	// Close releases the resources used to connect to the API.
+	Close()
+	// SocketBind returns the bind mount exposing the API socket to the
+	// checks in the path of the docker socket.
+	SocketBind() string
+	// HostGateway returns the hostname the containers use to reach the host.
+	HostGateway() string
+}
+
+// Names returns the names of the supported runtimes.
+func Names() []string {
+	return []string{Docker, Podman}
+}
+
+// New returns the runtime with the given name using the cli binary. For
+// docker the API is the one of DOCKER_HOST if set, or the one of the given
+// docker context, DOCKER_CONTEXT or the current context.
+func New(name, bin, dockerContext string, l log.Logger) (Runtime, error) {
+	switch name {
+	case "", Docker:
+		return newDocker(bin, dockerContext, l)
+	case Podman:
+		socket, err := podmanSocket(bin)
+		if err != nil {
+			return nil, err
+		}
+		l.Debugf("Using podman socket %s", socket)
+		return &podman{bin: bin, socket: socket}, nil
+	}
+	return nil, fmt.Errorf("unknown container runtime %s", name)
+}
+
+type docker struct {
+	bin       string
+	host      string
+	certPath  string
+	tlsVerify bool
+	remote    string
+	forward   *sshForward
+}
+
+func (d *docker) Name() string {
+	return Docker
+}
+
+func (d *docker) Bin() string {
+	return d.bin
+}
+
+func (d *docker) Host() string {
+	return d.host
+}
+
+func (d *docker) Env() map[string]string {
+	env := map[string]string{}
+	if d.host != "" {
+		env["DOCKER_HOST"] = d.host
+	}
+	if d.certPath != "" {
+		env["DOCKER_CERT_PATH"] = d.certPath
+		env["DOCKER_TLS_VERIFY"] = ""
+		if d.tlsVerify {
+			env["DOCKER_TLS_VERIFY"] = "1"
+		}
+	}
+	return env
+}
+
+func (d *docker) RemoteHost() string {
+	return d.remote
+}
+
+func (d *docker) Close() {
+	if d.forward != nil {
+		d.forward.Close()
+	}
+}
+
+func (d *docker) SocketBind() string {
+	return fmt.Sprintf("%s:%s", dockerSocket, dockerSocket)
+}
+
+func (d *docker) HostGateway() string {
+	return "host.docker.internal"
+}
+
+type podman struct {
+	bin    string
+	socket string
+}
+
+func (p *podman) Name() string {
+	return Podman
+}
+
+func (p *podman) Bin() string {
+	return p.bin
+}
+
+func (p *podman) Host() string {
+	return "unix://" + p.socket
+}
+
+func (p *podman) Env() map[string]string {
+	return map[string]string{"DOCKER_HOST": p.Host()}
+}
+
+func (p *podman) RemoteHost() string {
+	return ""
+}
+
+func (p *podman) Close() {}
+
+func (p *podman) SocketBind() string {
+	return fmt.Sprintf("%s:%s", p.socket, dockerSocket)
+}
+
+func (p *podman) HostGateway() string {
+	return "host.containers.internal"
+}
+
+var (
+	getenv = os.Getenv
+	getuid = os.Getuid
+
+	// podmanInfoSocket returns the path of the API socket reported by podman.
+	podmanInfoSocket = func(bin string) string {
+		out, err := exec.Command(bin, "info", "--format", "{{.Host.RemoteSocket.Path}}").Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(out))
+	}
+)
+
+// podmanSocket finds the podman API socket. The CONTAINER_HOST env var has
+// precedence over the socket reported by podman and the default rootless and
+// rootful locations.
+func podmanSocket(bin string) (string, error) {
+	if host := getenv("CONTAINER_HOST"); host != "" {
+		if !strings.HasPrefix(host, "unix://") {
+			return "", fmt.Errorf("unsupported podman CONTAINER_HOST %s", host)
+		}
+		return strings.TrimPrefix(host, "unix://"), nil
+	}
+	candidates := []string{strings.TrimPrefix(podmanInfoSocket(bin), "unix://")}
+	if dir := getenv("XDG_RUNTIME_DIR"); dir != "" {
+		candidates = append(candidates, filepath.Join(dir, "podman", "podman.sock"))
+	}
+	candidates = append(candidates,
+		filepath.Join("/run/user", strconv.Itoa(getuid()), "podman", "podman.sock"),
+		"/run/podman/podman.sock",
+	)
+	for _, c := range candidates {
+		if c == "" {
+			continue
+		}
+		if _, err := os.Stat(c); err == nil {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("podman socket not found, enable it with 'systemctl --user enable --now podman.socket'")
+}
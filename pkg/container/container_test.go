@@ -0,0 +1,241 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package container
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	loggerUser *logrus.Logger
+)
+
+func init() {
+	if len(os.Args) > 1 && os.Args[1][:5] == "-test" {
+		loggerUser = logrus.New()
+		loggerUser.SetFormatter(&logrus.TextFormatter{
+			DisableColors:   false,
+			FullTimestamp:   true,
+			TimestampFormat: time.RFC3339,
+			ForceColors:     true,
+		})
+	}
+}
+
+func TestPodmanSocket(t *testing.T) {
+	runtimeDir := t.TempDir()
+	xdgSocket := filepath.Join(runtimeDir, "podman", "podman.sock")
+	if err := os.MkdirAll(filepath.Dir(xdgSocket), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(xdgSocket, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	infoSocket := filepath.Join(t.TempDir(), "info.sock")
+	if err := os.WriteFile(infoSocket, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		env        map[string]string
+		infoSocket string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "ContainerHost",
+			env:        map[string]string{"CONTAINER_HOST": "unix:///tmp/custom.sock", "XDG_RUNTIME_DIR": runtimeDir},
+			infoSocket: infoSocket,
+			want:       "/tmp/custom.sock",
+		},
+		{
+			name:    "RemoteContainerHost",
+			env:     map[string]string{"CONTAINER_HOST": "ssh://core@localhost:22/run/podman/podman.sock"},
+			wantErr: true,
+		},
+		{
+			name:       "PodmanInfo",
+			env:        map[string]string{"XDG_RUNTIME_DIR": runtimeDir},
+			infoSocket: "unix://" + infoSocket,
+			want:       infoSocket,
+		},
+		{
+			name: "Rootless",
+			env:  map[string]string{"XDG_RUNTIME_DIR": runtimeDir},
+			want: xdgSocket,
+		},
+		{
+			name:    "NotFound",
+			env:     map[string]string{"XDG_RUNTIME_DIR": t.TempDir()},
+			wantErr: true,
+		},
+	}
+	defer func(e func(string) string, u func() int, i func(string) string) {
+		getenv, getuid, podmanInfoSocket = e, u, i
+	}(getenv, getuid, podmanInfoSocket)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv = func(k string) string { return tt.env[k] }
+			// An uid without podman socket in the test environment.
+			getuid = func() int { return -1 }
+			podmanInfoSocket = func(string) string { return tt.infoSocket }
+
+			got, err := podmanSocket("podman")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("unexpected socket got=%s want=%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	defer func(e func(string) string) { getenv = e }(getenv)
+	getenv = func(k string) string {
+		if k == "CONTAINER_HOST" {
+			return "unix:///run/user/1000/podman/podman.sock"
+		}
+		return ""
+	}
+
+	defer func(c func(string) string) { dockerCurrentContext = c }(dockerCurrentContext)
+	dockerCurrentContext = func(string) string { return "" }
+	d, err := New("", "docker", "", loggerUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name() != Docker || d.Host() != "" || d.SocketBind() != "/var/run/docker.sock:/var/run/docker.sock" {
+		t.Errorf("unexpected docker runtime name=%s host=%s bind=%s", d.Name(), d.Host(), d.SocketBind())
+	}
+
+	p, err := New(Podman, "podman", "", loggerUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Host() != "unix:///run/user/1000/podman/podman.sock" ||
+		p.SocketBind() != "/run/user/1000/podman/podman.sock:/var/run/docker.sock" ||
+		p.HostGateway() != "host.containers.internal" {
+		t.Errorf("unexpected podman runtime host=%s bind=%s gateway=%s", p.Host(), p.SocketBind(), p.HostGateway())
+	}
+
+	if _, err := New("unknown", "", "", loggerUser); err == nil {
+		t.Error("expected error for an unknown runtime")
+	}
+}
+
+func TestDockerContext(t *testing.T) {
+	tlsPath := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tlsPath, "docker"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	contexts := map[string]string{
+		"remote":   `[{"Name":"remote","Endpoints":{"docker":{"Host":"tcp://10.0.0.2:2376","SkipTLSVerify":false}},"Storage":{"TLSPath":"` + tlsPath + `"}}]`,
+		"insecure": `[{"Name":"insecure","Endpoints":{"docker":{"Host":"tcp://build.example.com:2376","SkipTLSVerify":true}},"Storage":{"TLSPath":"` + tlsPath + `"}}]`,
+		"local":    `[{"Name":"local","Endpoints":{"docker":{"Host":"unix:///var/run/docker.sock"}},"Storage":{"TLSPath":"` + filepath.Join(tlsPath, "missing") + `"}}]`,
+	}
+	tests := []struct {
+		name       string
+		env        map[string]string
+		context    string
+		current    string
+		wantEnv    map[string]string
+		wantRemote string
+		wantErr    bool
+	}{
+		{
+			name:    "DefaultContext",
+			current: "default",
+			wantEnv: map[string]string{},
+		},
+		{
+			name:       "DockerHost",
+			env:        map[string]string{"DOCKER_HOST": "tcp://10.0.0.3:2376", "DOCKER_CERT_PATH": "/certs", "DOCKER_TLS_VERIFY": "1"},
+			context:    "remote",
+			wantEnv:    map[string]string{"DOCKER_HOST": "tcp://10.0.0.3:2376", "DOCKER_CERT_PATH": "/certs", "DOCKER_TLS_VERIFY": "1"},
+			wantRemote: "10.0.0.3",
+		},
+		{
+			name:       "Context",
+			context:    "remote",
+			current:    "local",
+			wantEnv:    map[string]string{"DOCKER_HOST": "tcp://10.0.0.2:2376", "DOCKER_CERT_PATH": filepath.Join(tlsPath, "docker"), "DOCKER_TLS_VERIFY": "1"},
+			wantRemote: "10.0.0.2",
+		},
+		{
+			name:       "EnvContext",
+			env:        map[string]string{"DOCKER_CONTEXT": "insecure"},
+			wantEnv:    map[string]string{"DOCKER_HOST": "tcp://build.example.com:2376", "DOCKER_CERT_PATH": filepath.Join(tlsPath, "docker"), "DOCKER_TLS_VERIFY": ""},
+			wantRemote: "build.example.com",
+		},
+		{
+			name:    "CurrentLocalContext",
+			current: "local",
+			wantEnv: map[string]string{"DOCKER_HOST": "unix:///var/run/docker.sock"},
+		},
+		{
+			name:    "UnknownContext",
+			context: "unknown",
+			wantErr: true,
+		},
+	}
+	defer func(e func(string) string, c func(string) string, i func(string, string) ([]byte, error)) {
+		getenv, dockerCurrentContext, dockerInspectContext = e, c, i
+	}(getenv, dockerCurrentContext, dockerInspectContext)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv = func(k string) string { return tt.env[k] }
+			dockerCurrentContext = func(string) string { return tt.current }
+			dockerInspectContext = func(_, name string) ([]byte, error) {
+				c, ok := contexts[name]
+				if !ok {
+					return nil, errors.New("context not found")
+				}
+				return []byte(c), nil
+			}
+			rt, err := New(Docker, "docker", tt.context, loggerUser)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err != nil {
+				return
+			}
+			defer rt.Close()
+			if diff := cmp.Diff(tt.wantEnv, rt.Env()); diff != "" {
+				t.Errorf("unexpected env (-want +got):\n%s", diff)
+			}
+			if got := rt.RemoteHost(); got != tt.wantRemote {
+				t.Errorf("unexpected remote host got=%s want=%s", got, tt.wantRemote)
+			}
+		})
+	}
+}
+
+func TestRemoteHost(t *testing.T) {
+	tests := map[string]string{
+		"":                                "",
+		"unix:///var/run/docker.sock":     "",
+		"npipe:////./pipe/docker_engine":  "",
+		"tcp://127.0.0.1:2375":            "",
+		"tcp://localhost:2375":            "",
+		"tcp://[::1]:2375":                "",
+		"tcp://10.0.0.2:2376":             "10.0.0.2",
+		"ssh://user@build.example.com:22": "build.example.com",
+	}
+	for host, want := range tests {
+		if got := remoteHost(host); got != want {
+			t.Errorf("unexpected remote host of %s got=%s want=%s", host, got, want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/adevinta/vulcan-agent/log"
+)
+
+// defaultContext is the docker context using the local daemon, or the
+// DOCKER_* env vars.
+const defaultContext = "default"
+
+var (
+	// dockerCurrentContext returns the name of the context selected in the
+	// docker cli config.
+	dockerCurrentContext = func(bin string) string {
+		out, err := exec.Command(bin, "context", "show").Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	// dockerInspectContext returns the output of docker context inspect.
+	dockerInspectContext = func(bin, name string) ([]byte, error) {
+		out, err := exec.Command(bin, "context", "inspect", name).Output()
+		if err != nil {
+			return nil, fmt.Errorf("unable to inspect docker context %s: %w", name, err)
+		}
+		return out, nil
+	}
+)
+
+// dockerContext is the part of the output of docker context inspect
+// describing how to connect to the API.
+type dockerContext struct {
+	Endpoints struct {
+		Docker struct {
+			Host          string
+			SkipTLSVerify bool
+		} `json:"docker"`
+	}
+	Storage struct {
+		TLSPath string
+	}
+}
+
+func newDocker(bin, name string, l log.Logger) (*docker, error) {
+	d := &docker{bin: bin}
+	if host := getenv("DOCKER_HOST"); host != "" {
+		d.host = host
+		d.certPath = getenv("DOCKER_CERT_PATH")
+		d.tlsVerify = getenv("DOCKER_TLS_VERIFY") != ""
+	} else {
+		if name == "" {
+			name = getenv("DOCKER_CONTEXT")
+		}
+		if name == "" {
+			name = dockerCurrentContext(bin)
+		}
+		if name != "" && name != defaultContext {
+			if err := d.useContext(name); err != nil {
+				return nil, err
+			}
+			l.Debugf("Using docker context %s host=%s", name, d.host)
+		}
+	}
+	d.remote = remoteHost(d.host)
+	if strings.HasPrefix(d.host, "ssh://") {
+		fw, err := forwardSSH(d.host, l)
+		if err != nil {
+			return nil, err
+		}
+		d.forward = fw
+		d.host = "unix://" + fw.socket
+	}
+	return d, nil
+}
+
+// useContext sets the API address and TLS settings of the docker context.
+func (d *docker) useContext(name string) error {
+	out, err := dockerInspectContext(d.bin, name)
+	if err != nil {
+		return err
+	}
+	var contexts []dockerContext
+	if err := json.Unmarshal(out, &contexts); err != nil || len(contexts) != 1 {
+		return fmt.Errorf("invalid docker context %s: %v", name, err)
+	}
+	c := contexts[0]
+	d.host = c.Endpoints.Docker.Host
+	if c.Storage.TLSPath == "" {
+		return nil
+	}
+	certPath := filepath.Join(c.Storage.TLSPath, Docker)
+	if _, err := os.Stat(certPath); err == nil {
+		d.certPath = certPath
+		d.tlsVerify = !c.Endpoints.Docker.SkipTLSVerify
+	}
+	return nil
+}
+
+// remoteHost returns the hostname of the docker API address if it's a
+// network address of another machine.
+func remoteHost(host string) string {
+	u, err := url.Parse(host)
+	if err != nil {
+		return ""
+	}
+	switch u.Scheme {
+	case "tcp", "http", "https", "ssh":
+	default:
+		return ""
+	}
+	name := u.Hostname()
+	if name == "" || name == "localhost" {
+		return ""
+	}
+	if ip := net.ParseIP(name); ip != nil && ip.IsLoopback() {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/adevinta/vulcan-agent/log"
+)
+
+// sshForwardTimeout is the max time to wait for the ssh forward to be ready.
+var sshForwardTimeout = 15 * time.Second
+
+// sshForward forwards a local unix socket to the docker socket of a host
+// through ssh, as the docker clients used by the agent only support unix and
+// tcp addresses.
+type sshForward struct {
+	socket string
+	dir    string
+	cmd    *exec.Cmd
+}
+
+func forwardSSH(host string, l log.Logger) (*sshForward, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %s: %w", host, err)
+	}
+	remote := u.Path
+	if remote == "" {
+		remote = dockerSocket
+	}
+	dir, err := os.MkdirTemp("", "vulcan-ssh")
+	if err != nil {
+		return nil, err
+	}
+	socket := filepath.Join(dir, "docker.sock")
+	args := []string{"-nNT", "-o", "ExitOnForwardFailure=yes", "-L", socket + ":" + remote}
+	if p := u.Port(); p != "" {
+		args = append(args, "-p", p)
+	}
+	dest := u.Hostname()
+	if u.User != nil {
+		dest = u.User.Username() + "@" + dest
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("ssh", append(args, dest)...)
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("unable to forward docker socket of %s: %w", host, err)
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	deadline := time.After(sshForwardTimeout)
+	for {
+		if _, err := os.Stat(socket); err == nil {
+			l.Debugf("Forwarding docker socket of %s to %s", host, socket)
+			return &sshForward{socket: socket, dir: dir, cmd: cmd}, nil
+		}
+		select {
+		case err := <-exited:
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("unable to forward docker socket of %s: %v %s", host, err, stderr.String())
+		case <-deadline:
+			cmd.Process.Kill()
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("timeout forwarding docker socket of %s", host)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// Close stops the forward.
+func (f *sshForward) Close() {
+	f.cmd.Process.Kill()
+	os.RemoveAll(f.dir)
+}
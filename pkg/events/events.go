@@ -0,0 +1,155 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+// Package events streams the progress of the scans as newline delimited json
+// so other tools can follow them.
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Type is the kind of an event.
+type Type string
+
+const (
+	ScanStarted    Type = "scan_started"
+	CheckScheduled Type = "check_scheduled"
+	CheckStarted   Type = "check_started"
+	CheckRetried   Type = "check_retried"
+	CheckFinished  Type = "check_finished"
+	Error          Type = "error"
+	ScanFinished   Type = "scan_finished"
+	// ImagePulled is emitted when the pre-pull of an image finishes.
+	ImagePulled Type = "image_pulled"
+	// ReportReceived is emitted when the report of a check is received
+	// and parsed.
+	ReportReceived Type = "report_received"
+	// ReportGenerated is emitted when the results of the checks are
+	// reported.
+	ReportGenerated Type = "report_generated"
+)
+
+// Event is a change in the state of the scan or of one of its checks.
+type Event struct {
+	Time      time.Time `json:"time"`
+	Type      Type      `json:"type"`
+	CheckID   string    `json:"checkId,omitempty"`
+	Checktype string    `json:"checktype,omitempty"`
+	Target    string    `json:"target,omitempty"`
+	AssetType string    `json:"assetType,omitempty"`
+	Status    string    `json:"status,omitempty"`
+	Attempt   int       `json:"attempt,omitempty"`
+	// Findings is the number of vulnerabilities reported by the check.
+	Findings *int `json:"findings,omitempty"`
+	// ExitCode is the exit code of the finished scan.
+	ExitCode *int `json:"exitCode,omitempty"`
+	// Image is the image pulled, or the image of the check scheduled.
+	Image string `json:"image,omitempty"`
+	// Duration is the duration in seconds of the pull or the report,
+	// finished at the time of the event.
+	Duration float64 `json:"duration,omitempty"`
+	Message  string  `json:"message,omitempty"`
+}
+
+// Listener receives the events emitted.
+type Listener func(ev Event)
+
+// Emitter writes the events, one json object per line, and notifies them to
+// its listeners. A nil Emitter discards them.
+type Emitter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	c         io.Closer
+	now       func() time.Time
+	listeners []Listener
+}
+
+// New returns an Emitter writing the events to w, if not nil.
+func New(w io.Writer) *Emitter {
+	return &Emitter{w: w, now: time.Now}
+}
+
+// Listen adds a listener called, in order, with every event emitted. The
+// listeners must not emit events.
+func (e *Emitter) Listen(l Listener) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.listeners = append(e.listeners, l)
+}
+
+// Open returns an Emitter writing the events to the file in the path. It
+// returns a nil Emitter if the path is empty.
+func Open(path string) (*Emitter, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	e := New(f)
+	e.c = f
+	return e, nil
+}
+
+// Emit writes the event setting its time if not set.
+func (e *Emitter) Emit(ev Event) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if ev.Time.IsZero() {
+		ev.Time = e.now().UTC()
+	}
+	for _, l := range e.listeners {
+		l(ev)
+	}
+	if e.w == nil {
+		return
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	e.w.Write(append(b, '\n'))
+}
+
+// Close closes the underlying file, if any.
+func (e *Emitter) Close() error {
+	if e == nil || e.c == nil {
+		return nil
+	}
+	return e.c.Close()
+}
+
+// Hook returns a logrus hook emitting an Error event for every error logged.
+func (e *Emitter) Hook() logrus.Hook {
+	return &logHook{e: e}
+}
+
+type logHook struct {
+	e *Emitter
+}
+
+func (h *logHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel}
+}
+
+func (h *logHook) Fire(entry *logrus.Entry) error {
+	h.e.Emit(Event{Type: Error, Message: entry.Message})
+	return nil
+}
+
+// Int returns a pointer to the int, to set the optional fields.
+func Int(i int) *int {
+	return &i
+}
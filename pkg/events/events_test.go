@@ -0,0 +1,127 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package events
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestEmitter(t *testing.T) {
+	now := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name   string
+		events []Event
+		log    func(l *logrus.Logger)
+		want   string
+	}{
+		{
+			name: "Check",
+			events: []Event{
+				{Type: CheckScheduled, CheckID: "id", Checktype: "vulcan-trivy", Target: "."},
+				{Type: CheckFinished, CheckID: "id", Status: "FINISHED", Findings: Int(0)},
+			},
+			want: `{"time":"2022-01-02T03:04:05Z","type":"check_scheduled","checkId":"id","checktype":"vulcan-trivy","target":"."}
+{"time":"2022-01-02T03:04:05Z","type":"check_finished","checkId":"id","status":"FINISHED","findings":0}
+`,
+		},
+		{
+			name:   "ScanFinished",
+			events: []Event{{Type: ScanFinished, ExitCode: Int(103)}},
+			want: `{"time":"2022-01-02T03:04:05Z","type":"scan_finished","exitCode":103}
+`,
+		},
+		{
+			name: "LoggedErrors",
+			log: func(l *logrus.Logger) {
+				l.Info("ignored")
+				l.Errorf("unable to run %s", "check")
+			},
+			want: `{"time":"2022-01-02T03:04:05Z","type":"error","message":"unable to run check"}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			e := New(&buf)
+			e.now = func() time.Time { return now }
+			for _, ev := range tt.events {
+				e.Emit(ev)
+			}
+			if tt.log != nil {
+				l := logrus.New()
+				l.SetOutput(io.Discard)
+				l.AddHook(e.Hook())
+				tt.log(l)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("unexpected events got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	e, err := Open("")
+	if err != nil || e != nil {
+		t.Fatalf("unexpected emitter for empty path %v %v", e, err)
+	}
+	// A nil emitter discards the events.
+	e.Emit(Event{Type: ScanStarted})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "progress.ndjson")
+	if err := os.WriteFile(path, []byte("stale\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Emit(Event{Type: ScanStarted, Time: time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"time":"2022-01-02T03:04:05Z","type":"scan_started"}` + "\n"
+	if string(b) != want {
+		t.Errorf("unexpected file content got=%s want=%s", b, want)
+	}
+}
+
+func TestListen(t *testing.T) {
+	var got []Type
+	e := New(nil)
+	e.Listen(func(ev Event) {
+		if ev.Time.IsZero() {
+			t.Error("the time of the event is not set")
+		}
+		got = append(got, ev.Type)
+	})
+	e.Emit(Event{Type: ScanStarted})
+	e.Emit(Event{Type: ImagePulled, Image: "vulcansec/vulcan-trivy:edge", Duration: 1.5})
+	e.Emit(Event{Type: ScanFinished, ExitCode: Int(0)})
+	want := []Type{ScanStarted, ImagePulled, ScanFinished}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected events got=%v want=%v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("unexpected events got=%v want=%v", got, want)
+		}
+	}
+}
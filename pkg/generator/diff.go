@@ -0,0 +1,161 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/gitservice"
+)
+
+// ChangedFilesOption is the check option containing the files changed in the
+// target since the diff ref.
+const ChangedFilesOption = "changed_files"
+
+// StagedChecktypes matches the checktypes run by default in the staged mode,
+// fast enough to run in a pre-commit hook: the secrets and the static
+// analysis of the code.
+const StagedChecktypes = `^vulcan-(gitleaks|semgrep)$`
+
+var (
+	// dependencyChecktypes matches the checktypes that only analyze the
+	// dependencies of the projects.
+	dependencyChecktypes = regexp.MustCompile(`(?i)(trivy|retirejs|dependency|nodejs)`)
+
+	// manifestFiles contains the files declaring the dependencies of the
+	// projects.
+	manifestFiles = regexp.MustCompile(`(?i)^(go\.(mod|sum)|package(-lock)?\.json|yarn\.lock|pnpm-lock\.yaml|` +
+		`requirements.*\.txt|pipfile(\.lock)?|poetry\.lock|pyproject\.toml|setup\.py|gemfile(\.lock)?|` +
+		`pom\.xml|build\.gradle(\.kts)?|gradle\.lockfile|composer\.(json|lock)|cargo\.(toml|lock)|` +
+		`dockerfile.*|.*\.csproj|packages\.lock\.json)$`)
+)
+
+// changedFiles returns the files of the directory that changed since the ref,
+// including the untracked ones. The paths are relative to the directory.
+func changedFiles(bin, path, ref string) ([]string, error) {
+	cmds := [][]string{
+		{"diff", "--name-only", "--relative", ref, "--", "."},
+		{"ls-files", "--others", "--exclude-standard"},
+	}
+	uniq := map[string]bool{}
+	for _, args := range cmds {
+		var cmdOut, cmdErr bytes.Buffer
+		cmd := gitservice.GitCommand(bin, path, args...)
+		cmd.Stdout = &cmdOut
+		cmd.Stderr = &cmdErr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("unable to get changed files in %s since %s: %w %s", path, ref, err, cmdErr.String())
+		}
+		for _, f := range strings.Split(cmdOut.String(), "\n") {
+			if f = strings.TrimSpace(f); f != "" {
+				uniq[filepath.ToSlash(f)] = true
+			}
+		}
+	}
+	files := []string{}
+	for f := range uniq {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// IsDependencyChecktype returns true if the checktype only analyzes the
+// dependencies of the projects.
+func IsDependencyChecktype(name string) bool {
+	return dependencyChecktypes.MatchString(name)
+}
+
+// hasManifestChanges returns true if some of the files declares dependencies.
+func hasManifestChanges(files []string) bool {
+	for _, f := range files {
+		if manifestFiles.MatchString(filepath.Base(f)) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterChangedChecks removes the checks targeting local directories without
+// changes since the diff ref set in the config, and the dependency checks
+// when no manifest changed. The rest of the checks receive the list of
+// changed files in the ChangedFilesOption option.
+func FilterChangedChecks(cfg *config.Config, l log.Logger) error {
+	ref := cfg.Conf.Diff
+	return filterLocalChecks(cfg, "since "+ref, false, func(path string) ([]string, error) {
+		return changedFiles(cfg.Conf.GitBin, path, ref)
+	}, l)
+}
+
+// FilterStagedChecks keeps only the checks targeting local directories with
+// files staged in the index of their repository, except the dependency
+// checks when no manifest is staged. The checks serve the staged content of
+// the directories and receive the list of staged files in the
+// ChangedFilesOption option.
+func FilterStagedChecks(cfg *config.Config, l log.Logger) error {
+	err := filterLocalChecks(cfg, "in the index", true, func(path string) ([]string, error) {
+		return gitservice.StagedFiles(cfg.Conf.GitBin, path)
+	}, l)
+	if err != nil {
+		return err
+	}
+	for i := range cfg.Checks {
+		cfg.Checks[i].Ref = gitservice.StagedRef
+	}
+	return nil
+}
+
+// filterLocalChecks removes the checks targeting local directories where
+// the files func returns no files, and the dependency checks when none of
+// the files is a manifest. The checks not targeting local directories are
+// removed if onlyLocal is true.
+func filterLocalChecks(cfg *config.Config, desc string, onlyLocal bool, files func(path string) ([]string, error), l log.Logger) error {
+	changes := map[string][]string{}
+	checks := []config.Check{}
+	for _, c := range cfg.Checks {
+		path, err := GetValidDirectory(c.Target)
+		if c.AssetType != "GitRepository" || err != nil {
+			// Not a local target.
+			if onlyLocal {
+				l.Debugf("Skipping check %s on %s not targeting a local directory", c.Type, c.Target)
+			} else {
+				checks = append(checks, c)
+			}
+			continue
+		}
+		changed, ok := changes[path]
+		if !ok {
+			changed, err = files(path)
+			if err != nil {
+				return err
+			}
+			l.Debugf("Changed files target=%s %s files=%v", c.Target, desc, changed)
+			changes[path] = changed
+		}
+		if len(changed) == 0 {
+			l.Infof("Skipping check %s on %s without changes %s", c.Type, c.Target, desc)
+			continue
+		}
+		name := string(c.Type)
+		if ct, err := cfg.CheckTypes.Checktype(c.Type); err == nil {
+			name = ct.Name
+		}
+		if IsDependencyChecktype(name) && !hasManifestChanges(changed) {
+			l.Infof("Skipping dependency check %s on %s without manifest changes %s", c.Type, c.Target, desc)
+			continue
+		}
+		c.Options = mergeOptions(c.Options, map[string]interface{}{ChangedFilesOption: changed})
+		checks = append(checks, c)
+	}
+	cfg.Checks = checks
+	return nil
+}
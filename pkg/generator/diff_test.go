@@ -0,0 +1,135 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package generator
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/checktypes"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/gitservice"
+	"github.com/google/go-cmp/cmp"
+)
+
+// runGit runs a git command in the given directory.
+func runGit(t *testing.T, dir string, args ...string) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v %s", args, err, out)
+	}
+}
+
+// writeFile writes the content to the file in the directory.
+func writeFile(t *testing.T, dir, name, content string) {
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFilterChangedChecks(t *testing.T) {
+	repo := t.TempDir()
+	writeFile(t, repo, "docs/README.md", "docs")
+	writeFile(t, repo, "app/go.mod", "module app")
+	writeFile(t, repo, "app/main.go", "package main")
+	writeFile(t, repo, "lib/lib.go", "package lib")
+	runGit(t, repo, "init", "-q")
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-q", "-m", "first")
+	runGit(t, repo, "tag", "base")
+	writeFile(t, repo, "docs/README.md", "changed docs")
+	writeFile(t, repo, "docs/new.md", "untracked")
+	writeFile(t, repo, "app/go.mod", "module app\n\ngo 1.19")
+
+	docs := filepath.Join(repo, "docs")
+	app := filepath.Join(repo, "app")
+	lib := filepath.Join(repo, "lib")
+	check := func(ct checktypes.ChecktypeRef, target string, options map[string]interface{}) config.Check {
+		return config.Check{Type: ct, Target: target, AssetType: "GitRepository", Options: options}
+	}
+	cfg := &config.Config{
+		Conf: config.Conf{Diff: "base"},
+		CheckTypes: checktypes.Checktypes{
+			"vulcan-gitleaks": {Name: "vulcan-gitleaks"},
+			"vulcan-trivy":    {Name: "vulcan-trivy"},
+		},
+		Checks: []config.Check{
+			check("vulcan-gitleaks", docs, nil),
+			check("vulcan-trivy", docs, nil),
+			check("vulcan-gitleaks", app, map[string]interface{}{"depth": 1}),
+			check("vulcan-trivy", app, nil),
+			check("vulcan-gitleaks", lib, nil),
+			{Type: "vulcan-zap", Target: "http://localhost:1234", AssetType: "WebAddress"},
+		},
+	}
+	if err := FilterChangedChecks(cfg, loggerUser); err != nil {
+		t.Fatal(err)
+	}
+	want := []config.Check{
+		check("vulcan-gitleaks", docs, map[string]interface{}{ChangedFilesOption: []string{"README.md", "new.md"}}),
+		check("vulcan-gitleaks", app, map[string]interface{}{"depth": 1, ChangedFilesOption: []string{"go.mod"}}),
+		check("vulcan-trivy", app, map[string]interface{}{ChangedFilesOption: []string{"go.mod"}}),
+		{Type: "vulcan-zap", Target: "http://localhost:1234", AssetType: "WebAddress"},
+	}
+	if diff := cmp.Diff(want, cfg.Checks); diff != "" {
+		t.Errorf("unexpected checks (-want +got):\n%s", diff)
+	}
+
+	cfg.Conf.Diff = "unknown"
+	if err := FilterChangedChecks(cfg, loggerUser); err == nil {
+		t.Error("expected error for an unknown ref")
+	}
+}
+
+func TestFilterStagedChecks(t *testing.T) {
+	repo := t.TempDir()
+	writeFile(t, repo, "app/go.mod", "module app")
+	writeFile(t, repo, "app/main.go", "package main")
+	writeFile(t, repo, "lib/lib.go", "package lib")
+	runGit(t, repo, "init", "-q")
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-q", "-m", "first")
+	writeFile(t, repo, "app/main.go", "package main // staged")
+	writeFile(t, repo, "app/new.go", "package main")
+	writeFile(t, repo, "lib/lib.go", "package lib // not staged")
+	runGit(t, repo, "add", "app")
+
+	app := filepath.Join(repo, "app")
+	lib := filepath.Join(repo, "lib")
+	cfg := &config.Config{
+		CheckTypes: checktypes.Checktypes{
+			"vulcan-gitleaks": {Name: "vulcan-gitleaks"},
+			"vulcan-trivy":    {Name: "vulcan-trivy"},
+		},
+		Checks: []config.Check{
+			{Type: "vulcan-gitleaks", Target: app, AssetType: "GitRepository"},
+			{Type: "vulcan-trivy", Target: app, AssetType: "GitRepository"},
+			{Type: "vulcan-gitleaks", Target: lib, AssetType: "GitRepository"},
+			{Type: "vulcan-zap", Target: "http://localhost:1234", AssetType: "WebAddress"},
+		},
+	}
+	if err := FilterStagedChecks(cfg, loggerUser); err != nil {
+		t.Fatal(err)
+	}
+	want := []config.Check{
+		{
+			Type: "vulcan-gitleaks", Target: app, AssetType: "GitRepository", Ref: gitservice.StagedRef,
+			Options: map[string]interface{}{ChangedFilesOption: []string{"main.go", "new.go"}},
+		},
+	}
+	if diff := cmp.Diff(want, cfg.Checks); diff != "" {
+		t.Errorf("unexpected checks (-want +got):\n%s", diff)
+	}
+}
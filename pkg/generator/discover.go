@@ -0,0 +1,136 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package generator
+
+import (
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/adevinta/vulcan-agent/log"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+)
+
+// projectMarkers matches the files identifying the root of a project.
+var projectMarkers = []struct {
+	kind  string
+	files *regexp.Regexp
+}{
+	{kind: "go", files: regexp.MustCompile(`^go\.mod$`)},
+	{kind: "node", files: regexp.MustCompile(`^package\.json$`)},
+	{kind: "maven", files: regexp.MustCompile(`^pom\.xml$`)},
+	{kind: "gradle", files: regexp.MustCompile(`^build\.gradle(\.kts)?$`)},
+	{kind: "python", files: regexp.MustCompile(`^(pyproject\.toml|setup\.py|requirements.*\.txt)$`)},
+	{kind: "docker", files: regexp.MustCompile(`(?i)^dockerfile(\..*)?$`)},
+	{kind: "terraform", files: regexp.MustCompile(`\.tf$`)},
+}
+
+// discoveryIgnored contains the directories never walked by the discovery.
+var discoveryIgnored = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+	"vendor":       true,
+	".terraform":   true,
+}
+
+// DiscoverTargets adds a target for every project found in the local
+// directory targets, i.e. the subprojects of a monorepo. The projects are
+// detected by their files (go.mod, package.json, pom.xml, Dockerfile, *.tf,
+// ...) and scanned as GitRepository targets with the options of the parent
+// target. The directories matching the discovery exclude patterns, with the
+// .gitignore syntax, are skipped.
+func DiscoverTargets(cfg *config.Config, l log.Logger) error {
+	excludes := []gitignore.Pattern{}
+	for _, e := range cfg.Discovery.Exclude {
+		if e = strings.TrimSpace(e); e != "" && !strings.HasPrefix(e, "#") {
+			excludes = append(excludes, gitignore.ParsePattern(e, nil))
+		}
+	}
+	matcher := gitignore.NewMatcher(excludes)
+	targets := []config.Target{}
+	for _, t := range cfg.Targets {
+		targets = append(targets, t)
+		if t.AssetType != "" && t.AssetType != "GitRepository" {
+			continue
+		}
+		path, err := GetValidDirectory(t.Target)
+		if err != nil {
+			continue
+		}
+		projects, err := discoverProjects(path, matcher)
+		if err != nil {
+			return err
+		}
+		for _, p := range projects {
+			target := filepath.Join(t.Target, p.dir)
+			l.Infof("Discovered %s project target=%s", strings.Join(p.kinds, ","), target)
+			targets = append(targets, config.Target{
+				Target:    target,
+				AssetType: "GitRepository",
+				Options:   t.Options,
+			})
+		}
+	}
+	cfg.Targets = targets
+	return nil
+}
+
+type project struct {
+	dir   string
+	kinds []string
+}
+
+// discoverProjects returns the subdirectories of the path containing a
+// project, relative to the path. The path itself is not included.
+func discoverProjects(path string, matcher gitignore.Matcher) ([]project, error) {
+	found := map[string]map[string]bool{}
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if d.IsDir() {
+			if discoveryIgnored[d.Name()] || matcher.Match(parts, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		dir := filepath.Dir(rel)
+		if dir == "." || matcher.Match(parts, false) {
+			return nil
+		}
+		for _, m := range projectMarkers {
+			if m.files.MatchString(d.Name()) {
+				if found[dir] == nil {
+					found[dir] = map[string]bool{}
+				}
+				found[dir][m.kind] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	projects := []project{}
+	for dir, kinds := range found {
+		p := project{dir: dir}
+		for k := range kinds {
+			p.kinds = append(p.kinds, k)
+		}
+		sort.Strings(p.kinds)
+		projects = append(projects, p)
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].dir < projects[j].dir })
+	return projects, nil
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package generator
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiscoverTargets(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{
+		"go.mod",
+		"services/api/go.mod",
+		"services/api/Dockerfile",
+		"services/web/package.json",
+		"services/web/node_modules/lib/package.json",
+		"services/legacy/pom.xml",
+		"infra/main.tf",
+		"examples/demo/go.mod",
+		"docs/README.md",
+	} {
+		writeFile(t, dir, f, "")
+	}
+	options := map[string]interface{}{"depth": 1}
+	cfg := &config.Config{
+		Targets: []config.Target{
+			{Target: dir, Options: options},
+			{Target: "example.com", AssetType: "Hostname"},
+		},
+		Discovery: config.Discovery{
+			Enabled: true,
+			Exclude: []string{"examples/", "services/legacy"},
+		},
+	}
+	if err := DiscoverTargets(cfg, loggerUser); err != nil {
+		t.Fatal(err)
+	}
+	want := []config.Target{
+		{Target: dir, Options: options},
+		{Target: filepath.Join(dir, "infra"), AssetType: "GitRepository", Options: options},
+		{Target: filepath.Join(dir, "services", "api"), AssetType: "GitRepository", Options: options},
+		{Target: filepath.Join(dir, "services", "web"), AssetType: "GitRepository", Options: options},
+		{Target: "example.com", AssetType: "Hostname"},
+	}
+	if diff := cmp.Diff(want, cfg.Targets); diff != "" {
+		t.Errorf("unexpected targets (-want +got):\n%s", diff)
+	}
+}
@@ -65,8 +65,8 @@ func GenerateJobs(cfg *config.Config, agentIp, hostIp string, gs gitservice.GitS
 			continue
 		}
 
-		if !filterChecktype(ch.Name, cfg.Conf.IncludeR, cfg.Conf.ExcludeR) {
-			l.Debugf("Skipping filtered check=%s", ch.Name)
+		if reason := filterReason(cfg, ch, c.AssetType); reason != "" {
+			l.Debugf("Skipping filtered check=%s target=%s: %s", ch.Name, c.Target, reason)
 			continue
 		}
 		if code, ok := checktypes.ParseCode(ch.Image); ok {
@@ -78,15 +78,26 @@ func GenerateJobs(cfg *config.Config, agentIp, hostIp string, gs gitservice.GitS
 			ch.Image = image
 		}
 
-		ops, err := buildOptions(c.Options)
+		options, err := resolveOptions(c, gs, cfg.Conf.GitBin)
 		if err != nil {
 			l.Errorf("Skipping check - %s", err)
 			continue
 		}
+		ops, err := buildOptions(options)
+		if err != nil {
+			l.Errorf("Skipping check - %s", err)
+			continue
+		}
+
+		c.Resources = c.Resources.WithDefaults(cfg.Conf.Resources)
+		if err := c.Resources.Validate(); err != nil {
+			l.Errorf("Skipping check - %s", err)
+			continue
+		}
 
 		c.Id = uuid.New().String()
 
-		fingerprint := ComputeFingerprint(ch.Image, c.Target, c.AssetType, ops)
+		fingerprint := ComputeFingerprint(ch.Image, c.Target, c.AssetType, ops, c.Ref)
 		if dup, ok := unique[fingerprint]; ok {
 			l.Debugf("Filtering duplicated check name=%s image=%s target=%s id=%s id=%s", ch.Name, ch.Image, c.Target, c.Id, dup.Id)
 			continue
@@ -99,6 +110,9 @@ func GenerateJobs(cfg *config.Config, agentIp, hostIp string, gs gitservice.GitS
 		c.Checktype = ch
 
 		timeout := ch.Timeout
+		if timeout == 0 {
+			timeout = cfg.Conf.Timeout
+		}
 		if c.Timeout != nil {
 			timeout = *c.Timeout
 		}
@@ -133,6 +147,7 @@ func getTypesFromIdentifier(target config.Target) ([]config.Target, error) {
 	a := config.Target{
 		Target:  identifier,
 		Options: target.Options,
+		Ref:     target.Ref,
 	}
 
 	if types.IsAWSARN(identifier) {
@@ -140,11 +155,21 @@ func getTypesFromIdentifier(target config.Target) ([]config.Target, error) {
 		return []config.Target{a}, nil
 	}
 
+	if _, err := GetValidImageArchive(identifier); err == nil {
+		a.AssetType = "DockerImage"
+		return []config.Target{a}, nil
+	}
+
 	if types.IsDockerImage(identifier) {
 		a.AssetType = "DockerImage"
 		return []config.Target{a}, nil
 	}
 
+	if _, _, ok := gitservice.ParseRemote(identifier); ok {
+		a.AssetType = "GitRepository"
+		return []config.Target{a}, nil
+	}
+
 	if types.IsGitRepository(identifier) {
 		a.AssetType = "GitRepository"
 		return []config.Target{a}, nil
@@ -300,6 +325,8 @@ func AddPolicyChecks(cfg *config.Config, l log.Logger) error {
 					Target:    t.Target,
 					AssetType: t.AssetType,
 					Options:   options,
+					Ref:       t.Ref,
+					DependsOn: pct.DependsOn,
 				})
 			}
 		}
@@ -321,6 +348,7 @@ func AddAllChecks(cfg *config.Config, l log.Logger) error {
 					Target:    t.Target,
 					AssetType: t.AssetType,
 					Options:   options,
+					Ref:       t.Ref,
 				})
 			}
 		}
@@ -365,6 +393,43 @@ func filterChecktype(name string, include, exclude *regexp.Regexp) bool {
 	return true
 }
 
+// filterReason returns why the check of the checktype on a target of the
+// asset type is filtered by the config, or empty if it must run.
+func filterReason(cfg *config.Config, ch *checktypes.Checktype, assetType string) string {
+	if !filterChecktype(ch.Name, cfg.Conf.IncludeR, cfg.Conf.ExcludeR) {
+		return "filtered by the include and exclude regexps"
+	}
+	if len(cfg.Conf.AssetTypes) > 0 && !containsFold(cfg.Conf.AssetTypes, assetType) {
+		return fmt.Sprintf("asset type %s not selected %v", assetType, cfg.Conf.AssetTypes)
+	}
+	if len(cfg.Conf.IncludeTags) > 0 && !hasTag(ch.Tags, cfg.Conf.IncludeTags) {
+		return fmt.Sprintf("without the included tags %v", cfg.Conf.IncludeTags)
+	}
+	if hasTag(ch.Tags, cfg.Conf.ExcludeTags) {
+		return fmt.Sprintf("with the excluded tags %v", cfg.Conf.ExcludeTags)
+	}
+	return ""
+}
+
+// hasTag returns true if some of the tags is in the list.
+func hasTag(tags, list []string) bool {
+	for _, t := range tags {
+		if containsFold(list, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
 func GetValidDirectory(path string) (string, error) {
 	path, err := filepath.Abs(path)
 	if err != nil {
@@ -380,6 +445,27 @@ func GetValidDirectory(path string) (string, error) {
 	return path, nil
 }
 
+// GetValidImageArchive returns the absolute path of an image archive
+// generated by docker save or in the OCI layout (eg image.tar).
+func GetValidImageArchive(path string) (string, error) {
+	lower := strings.ToLower(path)
+	if !strings.HasSuffix(lower, ".tar") && !strings.HasSuffix(lower, ".tar.gz") && !strings.HasSuffix(lower, ".tgz") {
+		return "", fmt.Errorf("not an image archive %s", path)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("could not get absolute path %v", err)
+	}
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !fileInfo.Mode().IsRegular() {
+		return "", fmt.Errorf("not a file %s", path)
+	}
+	return path, nil
+}
+
 func GetPolicy(cfg *config.Config) (config.Policy, error) {
 	for _, p := range cfg.Policies {
 		if p.Name == cfg.Conf.Policy {
@@ -7,6 +7,7 @@ package generator
 import (
 	"errors"
 	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
 	"time"
@@ -152,7 +153,7 @@ func TestMergeOptions(t *testing.T) {
 
 func TestGenerateJobs(t *testing.T) {
 
-	gs := gitservice.New(loggerUser)
+	gs := gitservice.New(loggerUser, gitservice.Config{})
 	defer gs.Shutdown()
 
 	tests := []struct {
@@ -208,6 +209,26 @@ func TestGenerateJobs(t *testing.T) {
 			want:    []jobrunner.Job{},
 			wantErr: nil,
 		},
+		{
+			name: "Invalid resources",
+			cfg: &config.Config{
+				CheckTypes: map[checktypes.ChecktypeRef]checktypes.Checktype{
+					"vulcan-trivy": {
+						Name: "vulcan-trivy",
+					},
+				},
+				Checks: []config.Check{
+					{
+						Type:      "vulcan-trivy",
+						Target:    "git@github.com:adevinta/vulcan-local.git",
+						AssetType: "GitRepository",
+						Resources: config.Resources{Memory: "lots"},
+					},
+				},
+			},
+			want:    []jobrunner.Job{},
+			wantErr: nil,
+		},
 		{
 			name: "Duplicated check",
 			cfg: &config.Config{
@@ -353,6 +374,63 @@ func TestFilterCheckType(t *testing.T) {
 	}
 }
 
+func TestFilterReason(t *testing.T) {
+	ch := &checktypes.Checktype{Name: "vulcan-zap", Tags: []string{"web", "slow"}}
+	tests := []struct {
+		name      string
+		conf      config.Conf
+		assetType string
+		filtered  bool
+	}{
+		{
+			name:      "NoFilters",
+			assetType: "WebAddress",
+		},
+		{
+			name:      "Regexp",
+			conf:      config.Conf{ExcludeR: regexp.MustCompile("zap")},
+			assetType: "WebAddress",
+			filtered:  true,
+		},
+		{
+			name:      "AssetType",
+			conf:      config.Conf{AssetTypes: []string{"gitrepository"}},
+			assetType: "WebAddress",
+			filtered:  true,
+		},
+		{
+			name:      "SelectedAssetType",
+			conf:      config.Conf{AssetTypes: []string{"GitRepository", "WebAddress"}},
+			assetType: "WebAddress",
+		},
+		{
+			name:      "IncludedTag",
+			conf:      config.Conf{IncludeTags: []string{"web"}},
+			assetType: "WebAddress",
+		},
+		{
+			name:      "NotIncludedTag",
+			conf:      config.Conf{IncludeTags: []string{"fast"}},
+			assetType: "WebAddress",
+			filtered:  true,
+		},
+		{
+			name:      "ExcludedTag",
+			conf:      config.Conf{IncludeTags: []string{"web"}, ExcludeTags: []string{"slow"}},
+			assetType: "WebAddress",
+			filtered:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := filterReason(&config.Config{Conf: tt.conf}, ch, tt.assetType)
+			if (reason != "") != tt.filtered {
+				t.Errorf("unexpected filter reason %q", reason)
+			}
+		})
+	}
+}
+
 func TestGetTypesFromIdentifier(t *testing.T) {
 
 	tests := []struct {
@@ -471,6 +549,19 @@ func TestGetTypesFromIdentifier(t *testing.T) {
 			},
 			wantErr: nil,
 		},
+		{
+			name: "Resolve to remote GitRepository",
+			target: config.Target{
+				Target: "git+https://github.com/adevinta/vulcan-local.git#main",
+			},
+			want: []config.Target{
+				{
+					Target:    "git+https://github.com/adevinta/vulcan-local.git#main",
+					AssetType: "GitRepository",
+				},
+			},
+			wantErr: nil,
+		},
 		{
 			name: "Resolve to local GitRepository",
 			target: config.Target{
@@ -704,3 +795,33 @@ func TestAddAllChecks(t *testing.T) {
 		})
 	}
 }
+
+func TestGetValidImageArchive(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"image.tar", "image.tar.gz", "image.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte{}, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "dir.tar"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path      string
+		wantValid bool
+	}{
+		{path: "image.tar", wantValid: true},
+		{path: "image.tar.gz", wantValid: true},
+		{path: "image.txt"},
+		{path: "dir.tar"},
+		{path: "missing.tar"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			path, err := GetValidImageArchive(filepath.Join(dir, tt.path))
+			if (err == nil) != tt.wantValid {
+				t.Fatalf("unexpected validation path=%s err=%v", path, err)
+			}
+		})
+	}
+}
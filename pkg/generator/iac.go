@@ -0,0 +1,339 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package generator
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/adevinta/vulcan-agent/log"
+
+	"github.com/adevinta/vulcan-local/pkg/checktypes"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/gitservice"
+)
+
+// IaCAssetType is the asset type of the directories with infrastructure as
+// code. They are scanned as GitRepository targets by the checktypes in
+// iacChecks.
+const IaCAssetType = "IaC"
+
+// The kinds of infrastructure as code detected.
+const (
+	iacTerraform      = "terraform"
+	iacCloudFormation = "cloudformation"
+	iacKubernetes     = "kubernetes"
+)
+
+// iacMaxFileSize is the size of the biggest manifest inspected to detect its
+// kind.
+const iacMaxFileSize = 1 << 20
+
+// iacCheck is a checktype scanning infrastructure as code, with the options
+// for the kinds it supports.
+type iacCheck struct {
+	checktype string
+	// options returns the options of the check for the IaC found, nil if the
+	// check doesn't support any of its kinds.
+	options func(iac iacFiles) []map[string]interface{}
+}
+
+// iacChecks are the checktypes scanning the IaC targets. vulcan-trivy only
+// looks for misconfigurations, with the terraform var files found, and
+// vulcan-semgrep runs once per ruleset of the kinds found.
+var iacChecks = []iacCheck{
+	{
+		checktype: "vulcan-trivy",
+		options: func(iac iacFiles) []map[string]interface{} {
+			opts := map[string]interface{}{
+				"git_checks": map[string]interface{}{"vuln": false, "secret": false, "config": true},
+			}
+			if len(iac.tfVars) > 0 {
+				opts["tf_vars"] = iac.tfVars
+			}
+			return []map[string]interface{}{opts}
+		},
+	},
+	{
+		checktype: "vulcan-semgrep",
+		options: func(iac iacFiles) []map[string]interface{} {
+			rulesets := map[string]string{
+				iacTerraform:  "p/terraform",
+				iacKubernetes: "p/kubernetes",
+			}
+			opts := []map[string]interface{}{}
+			for _, kind := range iac.kinds {
+				if ruleset, ok := rulesets[kind]; ok {
+					opts = append(opts, map[string]interface{}{"ruleset": ruleset})
+				}
+			}
+			return opts
+		},
+	},
+}
+
+var (
+	// cloudFormationR matches the templates of CloudFormation.
+	cloudFormationR = regexp.MustCompile(`(?m)^\s*"?AWSTemplateFormatVersion"?\s*:|"?Type"?\s*:\s*"?AWS::`)
+	// kubernetesR matches the kubernetes manifests, with an apiVersion and a
+	// kind at the top level.
+	kubernetesR = regexp.MustCompile(`(?m)^apiVersion\s*:`)
+	kindR       = regexp.MustCompile(`(?m)^kind\s*:`)
+	// tfModuleSourceR matches the sources of the terraform modules.
+	tfModuleSourceR = regexp.MustCompile(`(?m)^\s*source\s*=\s*"([^"]+)"`)
+)
+
+// iacFiles is the IaC found in a directory.
+type iacFiles struct {
+	kinds []string
+	// tfVars are the terraform var files, relative to the directory.
+	tfVars []string
+	// modules are the local directories of the terraform modules,
+	// absolute.
+	modules []string
+}
+
+// AddIaCChecks adds the checks of the targets with the IaC asset type and
+// converts them to GitRepository targets, so the local directories are served
+// by the git service to the checks. If a policy is set only the checktypes of
+// the policy are used. The local terraform modules outside the directory are
+// resolved scanning the directory containing all of them, within the git
+// repository of the directory.
+func AddIaCChecks(cfg *config.Config, l log.Logger) error {
+	var policy *config.Policy
+	if cfg.Conf.Policy != "" {
+		p, err := GetPolicy(cfg)
+		if err != nil {
+			return err
+		}
+		policy = &p
+	}
+	for i := range cfg.Targets {
+		t := &cfg.Targets[i]
+		if !strings.EqualFold(t.AssetType, IaCAssetType) {
+			continue
+		}
+		root := t.Target
+		var iac iacFiles
+		if _, _, ok := gitservice.ParseRemote(t.Target); ok {
+			l.Debugf("Unable to detect the IaC kinds of the remote repository %s", t.Target)
+		} else {
+			path, err := GetValidDirectory(t.Target)
+			if err != nil {
+				l.Errorf("Skipping IaC target %s: %v", t.Target, err)
+				continue
+			}
+			if iac, err = detectIaC(path); err != nil {
+				return err
+			}
+			if len(iac.kinds) == 0 {
+				l.Infof("No IaC found in %s", t.Target)
+			}
+			// The modules outside the git repository of the target are not
+			// served, so a module source can't widen the directory served
+			// to the checks beyond it.
+			limit := repositoryRoot(cfg.Conf.GitBin, path)
+			modules := []string{}
+			for _, m := range iac.modules {
+				if !isSubpath(limit, m) {
+					l.Errorf("Skipping the terraform module %s of %s outside of %s", m, t.Target, limit)
+					continue
+				}
+				modules = append(modules, m)
+			}
+			if dir := commonDir(path, modules); dir != path {
+				rel, err := filepath.Rel(path, dir)
+				if err != nil {
+					return err
+				}
+				root = filepath.Join(t.Target, rel)
+				l.Infof("Scanning %s to resolve the terraform modules of %s", root, t.Target)
+				// The var files are relative to the root served.
+				prefix, err := filepath.Rel(dir, path)
+				if err != nil {
+					return err
+				}
+				for j, v := range iac.tfVars {
+					iac.tfVars[j] = filepath.ToSlash(filepath.Join(prefix, v))
+				}
+			}
+			l.Debugf("Detected IaC target=%s kinds=%v tfVars=%v", t.Target, iac.kinds, iac.tfVars)
+		}
+		for _, ic := range iacChecks {
+			ref, pct, ok := iacChecktype(cfg.CheckTypes, policy, ic.checktype)
+			if !ok {
+				l.Debugf("Skipping IaC checktype %s not available", ic.checktype)
+				continue
+			}
+			for _, opts := range ic.options(iac) {
+				options := mergeOptions(cfg.CheckTypes[ref].Options, opts)
+				options = mergeOptions(options, pct.Options)
+				options = mergeOptions(options, t.Options)
+				cfg.Checks = append(cfg.Checks, config.Check{
+					Type:      ref,
+					Target:    root,
+					AssetType: "GitRepository",
+					Options:   options,
+					Ref:       t.Ref,
+					DependsOn: pct.DependsOn,
+				})
+			}
+		}
+		t.Target = root
+		t.AssetType = "GitRepository"
+	}
+	return nil
+}
+
+// iacChecktype returns the ref of the checktype with the name, and its check
+// in the policy if not nil.
+func iacChecktype(cts checktypes.Checktypes, policy *config.Policy, name string) (checktypes.ChecktypeRef, config.PolicyCheck, bool) {
+	if policy != nil {
+		for _, pct := range policy.CheckTypes {
+			if ct, ok := cts[pct.CheckType]; ok && ct.Name == name {
+				return pct.CheckType, pct, true
+			}
+		}
+		return "", config.PolicyCheck{}, false
+	}
+	refs := []checktypes.ChecktypeRef{}
+	for ref, ct := range cts {
+		if ct.Name == name {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == 0 {
+		return "", config.PolicyCheck{}, false
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i] < refs[j] })
+	return refs[0], config.PolicyCheck{CheckType: refs[0]}, true
+}
+
+// detectIaC returns the kinds of IaC in the directory, the terraform var
+// files and the local terraform modules.
+func detectIaC(path string) (iacFiles, error) {
+	kinds := map[string]bool{}
+	modules := map[string]bool{}
+	iac := iacFiles{}
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != path && discoveryIgnored[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := strings.ToLower(d.Name())
+		switch {
+		case strings.HasSuffix(name, ".tfvars"), strings.HasSuffix(name, ".tfvars.json"):
+			rel, err := filepath.Rel(path, p)
+			if err != nil {
+				return err
+			}
+			iac.tfVars = append(iac.tfVars, filepath.ToSlash(rel))
+			return nil
+		case strings.HasSuffix(name, ".tf"), strings.HasSuffix(name, ".tf.json"):
+			kinds[iacTerraform] = true
+			content, err := readManifest(p, d)
+			if err != nil {
+				return err
+			}
+			for _, m := range tfModuleSourceR.FindAllSubmatch(content, -1) {
+				source := string(m[1])
+				if strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") {
+					modules[filepath.Join(filepath.Dir(p), filepath.FromSlash(source))] = true
+				}
+			}
+			return nil
+		case strings.HasSuffix(name, ".yaml"), strings.HasSuffix(name, ".yml"),
+			strings.HasSuffix(name, ".json"), strings.HasSuffix(name, ".template"):
+			content, err := readManifest(p, d)
+			if err != nil {
+				return err
+			}
+			if cloudFormationR.Match(content) {
+				kinds[iacCloudFormation] = true
+			} else if kubernetesR.Match(content) && kindR.Match(content) {
+				kinds[iacKubernetes] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return iacFiles{}, err
+	}
+	for k := range kinds {
+		iac.kinds = append(iac.kinds, k)
+	}
+	for m := range modules {
+		iac.modules = append(iac.modules, m)
+	}
+	sort.Strings(iac.kinds)
+	sort.Strings(iac.modules)
+	sort.Strings(iac.tfVars)
+	return iac, nil
+}
+
+// readManifest returns the content of the file, empty if it's too big to be
+// a manifest.
+func readManifest(path string, d fs.DirEntry) ([]byte, error) {
+	info, err := d.Info()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > iacMaxFileSize {
+		return nil, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")), nil
+}
+
+// repositoryRoot returns the top level directory of the git working tree
+// containing the path, or the path if it's not in a git working tree. The
+// bin is the git binary.
+func repositoryRoot(bin, path string) string {
+	out, err := gitservice.GitCommand(bin, path, "rev-parse", "--show-cdup").Output()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(path, filepath.FromSlash(strings.TrimSpace(string(out))))
+}
+
+// isSubpath returns true if the path is the dir or is inside it.
+func isSubpath(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// commonDir returns the closest directory containing the path and the dirs.
+func commonDir(path string, dirs []string) string {
+	common := path
+	for _, d := range dirs {
+		for {
+			if isSubpath(common, d) {
+				break
+			}
+			parent := filepath.Dir(common)
+			if parent == common {
+				break
+			}
+			common = parent
+		}
+	}
+	return common
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package generator
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/checktypes"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestAddIaCChecks(t *testing.T) {
+	dir := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v %s", err, out)
+	}
+	writeFile(t, dir, "infra/main.tf", "module \"vpc\" {\n  source = \"../modules/vpc\"\n}\n"+
+		"module \"outside\" {\n  source = \"../../../../../../../../modules\"\n}\n")
+	writeFile(t, dir, "infra/prod.tfvars", "region = \"eu-west-1\"\n")
+	writeFile(t, dir, "modules/vpc/main.tf", "resource \"aws_vpc\" \"main\" {}\n")
+	writeFile(t, dir, "k8s/deploy.yaml", "apiVersion: apps/v1\nkind: Deployment\n")
+	writeFile(t, dir, "cfn/stack.yaml", "AWSTemplateFormatVersion: \"2010-09-09\"\n")
+	cfg := &config.Config{
+		CheckTypes: map[checktypes.ChecktypeRef]checktypes.Checktype{
+			"vulcan-trivy": {
+				Name:    "vulcan-trivy",
+				Assets:  []string{"GitRepository"},
+				Options: map[string]interface{}{"depth": 1},
+			},
+			"vulcan-semgrep": {
+				Name:   "vulcan-semgrep",
+				Assets: []string{"GitRepository"},
+			},
+		},
+		Targets: []config.Target{
+			{Target: filepath.Join(dir, "infra"), AssetType: "IaC"},
+			{Target: filepath.Join(dir, "k8s"), AssetType: "iac", Options: map[string]interface{}{"depth": 2}},
+			{Target: filepath.Join(dir, "cfn"), AssetType: "IaC"},
+			{Target: "example.com", AssetType: "Hostname"},
+		},
+	}
+	if err := AddIaCChecks(cfg, loggerUser); err != nil {
+		t.Fatal(err)
+	}
+	configOnly := map[string]interface{}{"vuln": false, "secret": false, "config": true}
+	want := []config.Check{
+		{
+			Type:      "vulcan-trivy",
+			Target:    dir,
+			AssetType: "GitRepository",
+			Options:   map[string]interface{}{"depth": 1, "git_checks": configOnly, "tf_vars": []string{"infra/prod.tfvars"}},
+		},
+		{
+			Type:      "vulcan-semgrep",
+			Target:    dir,
+			AssetType: "GitRepository",
+			Options:   map[string]interface{}{"ruleset": "p/terraform"},
+		},
+		{
+			Type:      "vulcan-trivy",
+			Target:    filepath.Join(dir, "k8s"),
+			AssetType: "GitRepository",
+			Options:   map[string]interface{}{"depth": 2, "git_checks": configOnly},
+		},
+		{
+			Type:      "vulcan-semgrep",
+			Target:    filepath.Join(dir, "k8s"),
+			AssetType: "GitRepository",
+			Options:   map[string]interface{}{"depth": 2, "ruleset": "p/kubernetes"},
+		},
+		{
+			Type:      "vulcan-trivy",
+			Target:    filepath.Join(dir, "cfn"),
+			AssetType: "GitRepository",
+			Options:   map[string]interface{}{"depth": 1, "git_checks": configOnly},
+		},
+	}
+	if diff := cmp.Diff(want, cfg.Checks, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("unexpected checks (-want +got):\n%s", diff)
+	}
+	wantTargets := []config.Target{
+		{Target: dir, AssetType: "GitRepository"},
+		{Target: filepath.Join(dir, "k8s"), AssetType: "GitRepository", Options: map[string]interface{}{"depth": 2}},
+		{Target: filepath.Join(dir, "cfn"), AssetType: "GitRepository"},
+		{Target: "example.com", AssetType: "Hostname"},
+	}
+	if diff := cmp.Diff(wantTargets, cfg.Targets); diff != "" {
+		t.Errorf("unexpected targets (-want +got):\n%s", diff)
+	}
+}
+
+func TestAddIaCChecksOutsideRepository(t *testing.T) {
+	// The modules outside a directory not in a git repository are skipped.
+	dir := t.TempDir()
+	writeFile(t, dir, "infra/main.tf", "module \"vpc\" {\n  source = \"../modules/vpc\"\n}\n")
+	writeFile(t, dir, "modules/vpc/main.tf", "resource \"aws_vpc\" \"main\" {}\n")
+	target := filepath.Join(dir, "infra")
+	cfg := &config.Config{
+		CheckTypes: map[checktypes.ChecktypeRef]checktypes.Checktype{
+			"vulcan-trivy": {Name: "vulcan-trivy", Assets: []string{"GitRepository"}},
+		},
+		Targets: []config.Target{{Target: target, AssetType: "IaC"}},
+	}
+	if err := AddIaCChecks(cfg, loggerUser); err != nil {
+		t.Fatal(err)
+	}
+	want := []config.Target{{Target: target, AssetType: "GitRepository"}}
+	if diff := cmp.Diff(want, cfg.Targets); diff != "" {
+		t.Errorf("unexpected targets (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package generator
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/adevinta/vulcan-local/pkg/checktypes"
+	"github.com/adevinta/vulcan-local/pkg/config"
+)
+
+// PlannedCheck is a check of the execution plan, with the reason when it's
+// not run.
+type PlannedCheck struct {
+	Checktype   string                 `json:"checktype"`
+	Image       string                 `json:"image,omitempty"`
+	Target      string                 `json:"target"`
+	AssetType   string                 `json:"assetType"`
+	Ref         string                 `json:"ref,omitempty"`
+	Options     map[string]interface{} `json:"options,omitempty"`
+	Timeout     int                    `json:"timeout,omitempty"`
+	MissingVars []string               `json:"missingVars,omitempty"`
+	Run         bool                   `json:"run"`
+	Reason      string                 `json:"reason,omitempty"`
+}
+
+// Plan returns the checks that GenerateJobs would run, and the ones it
+// would skip, without building images or modifying the config. It also
+// includes the checktypes not supporting the asset types of the targets.
+func Plan(cfg *config.Config) []PlannedCheck {
+	plan := []PlannedCheck{}
+	unique := map[string]bool{}
+	for _, c := range cfg.Checks {
+		p := PlannedCheck{
+			Checktype: string(c.Type),
+			Target:    c.Target,
+			AssetType: c.AssetType,
+			Ref:       c.Ref,
+			Options:   c.Options,
+		}
+		ch, err := cfg.CheckTypes.Checktype(c.Type)
+		if err != nil {
+			p.Reason = err.Error()
+			plan = append(plan, p)
+			continue
+		}
+		p.Checktype = ch.Name
+		p.Image = ch.Image
+		if reason := filterReason(cfg, ch, c.AssetType); reason != "" {
+			p.Reason = reason
+			plan = append(plan, p)
+			continue
+		}
+		ops, err := buildOptions(c.Options)
+		if err != nil {
+			p.Reason = err.Error()
+			plan = append(plan, p)
+			continue
+		}
+		if err := c.Resources.WithDefaults(cfg.Conf.Resources).Validate(); err != nil {
+			p.Reason = err.Error()
+			plan = append(plan, p)
+			continue
+		}
+		fingerprint := ComputeFingerprint(ch.Image, c.Target, c.AssetType, ops, c.Ref)
+		if unique[fingerprint] {
+			p.Reason = "duplicated"
+			plan = append(plan, p)
+			continue
+		}
+		unique[fingerprint] = true
+		p.Timeout = ch.Timeout
+		if p.Timeout == 0 {
+			p.Timeout = cfg.Conf.Timeout
+		}
+		if c.Timeout != nil {
+			p.Timeout = *c.Timeout
+		}
+		for _, v := range ch.RequiredVars {
+			if cfg.Conf.Vars[v] == "" {
+				p.MissingVars = append(p.MissingVars, v)
+			}
+		}
+		p.Run = true
+		plan = append(plan, p)
+	}
+	return append(plan, unsupported(cfg)...)
+}
+
+// unsupported returns the checktypes that would apply to the targets, all or
+// the ones of the policy, but don't support their asset types.
+func unsupported(cfg *config.Config) []PlannedCheck {
+	refs := []checktypes.ChecktypeRef{}
+	if cfg.Conf.Policy != "" {
+		if policy, err := GetPolicy(cfg); err == nil {
+			for _, pct := range policy.CheckTypes {
+				refs = append(refs, pct.CheckType)
+			}
+		}
+	} else {
+		for ref := range cfg.CheckTypes {
+			refs = append(refs, ref)
+		}
+		sort.Slice(refs, func(i, j int) bool { return refs[i] < refs[j] })
+	}
+	plan := []PlannedCheck{}
+	for _, t := range cfg.Targets {
+		for _, ref := range refs {
+			ct, ok := cfg.CheckTypes[ref]
+			if !ok || stringInSlice(t.AssetType, ct.Assets) {
+				continue
+			}
+			plan = append(plan, PlannedCheck{
+				Checktype: ct.Name,
+				Image:     ct.Image,
+				Target:    t.Target,
+				AssetType: t.AssetType,
+				Reason:    fmt.Sprintf("asset type %s not supported %v", t.AssetType, ct.Assets),
+			})
+		}
+	}
+	return plan
+}
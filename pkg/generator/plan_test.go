@@ -0,0 +1,63 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package generator
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/checktypes"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPlan(t *testing.T) {
+	timeout := 30
+	cfg := &config.Config{
+		Conf: config.Conf{
+			Timeout:  600,
+			ExcludeR: regexp.MustCompile("semgrep"),
+			Vars:     map[string]string{"TOKEN": "secret"},
+		},
+		CheckTypes: checktypes.Checktypes{
+			"vulcan-gitleaks": {Name: "vulcan-gitleaks", Image: "vulcan-gitleaks:1", Assets: []string{"GitRepository"}, RequiredVars: []string{"TOKEN", "ENDPOINT"}},
+			"vulcan-semgrep":  {Name: "vulcan-semgrep", Image: "vulcan-semgrep:1", Assets: []string{"GitRepository"}},
+			"vulcan-zap":      {Name: "vulcan-zap", Image: "vulcan-zap:1", Assets: []string{"WebAddress"}, Timeout: 300},
+		},
+		Targets: []config.Target{{Target: ".", AssetType: "GitRepository"}},
+		Checks: []config.Check{
+			{Type: "vulcan-gitleaks", Target: ".", AssetType: "GitRepository"},
+			{Type: "vulcan-gitleaks", Target: ".", AssetType: "GitRepository"},
+			{Type: "vulcan-semgrep", Target: ".", AssetType: "GitRepository"},
+			{Type: "vulcan-zap", Target: "http://localhost", AssetType: "WebAddress", Timeout: &timeout},
+			{Type: "vulcan-zap", Target: "http://localhost:8080", AssetType: "WebAddress", Resources: config.Resources{Memory: "lots"}},
+			{Type: "vulcan-unknown", Target: ".", AssetType: "GitRepository"},
+		},
+	}
+	plan := Plan(cfg)
+	got := []PlannedCheck{}
+	for _, p := range plan {
+		// Only compare the reason of the skipped checks.
+		if p.Reason != "" && !p.Run {
+			p.Reason = "skipped"
+		}
+		got = append(got, p)
+	}
+	want := []PlannedCheck{
+		{Checktype: "vulcan-gitleaks", Image: "vulcan-gitleaks:1", Target: ".", AssetType: "GitRepository", Timeout: 600, MissingVars: []string{"ENDPOINT"}, Run: true},
+		{Checktype: "vulcan-gitleaks", Image: "vulcan-gitleaks:1", Target: ".", AssetType: "GitRepository", Reason: "skipped"},
+		{Checktype: "vulcan-semgrep", Image: "vulcan-semgrep:1", Target: ".", AssetType: "GitRepository", Reason: "skipped"},
+		{Checktype: "vulcan-zap", Image: "vulcan-zap:1", Target: "http://localhost", AssetType: "WebAddress", Timeout: 30, Run: true},
+		{Checktype: "vulcan-zap", Image: "vulcan-zap:1", Target: "http://localhost:8080", AssetType: "WebAddress", Reason: "skipped"},
+		{Checktype: "vulcan-unknown", Target: ".", AssetType: "GitRepository", Reason: "skipped"},
+		{Checktype: "vulcan-zap", Image: "vulcan-zap:1", Target: ".", AssetType: "GitRepository", Reason: "skipped"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected plan (-want +got):\n%s", diff)
+	}
+	if cfg.Checks[0].Id != "" || cfg.Checks[0].Checktype != nil {
+		t.Errorf("plan modified the checks %+v", cfg.Checks[0])
+	}
+}
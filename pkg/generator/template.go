@@ -0,0 +1,171 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/gitservice"
+)
+
+// OptionsData contains the variables available in the templates of the
+// string options of the checks, resolved for the target of every check, i.e.
+// {{.Target.Path}}.
+type OptionsData struct {
+	Target OptionsTarget
+
+	check *config.Check
+	gs    gitservice.GitService
+}
+
+// OptionsTarget describes the target of the check.
+type OptionsTarget struct {
+	// Identifier is the target as written in the config.
+	Identifier string
+	AssetType  string
+	// Path is the slash separated path of a local directory relative to the
+	// root of its git repository, "." if it's the root or it's not in a
+	// repository. Empty for the non local targets.
+	Path string
+	// Branch is the ref of the check, the fragment of a remote repository or
+	// the current branch of a local repository.
+	Branch string
+}
+
+// GitPort returns the port of the git server serving the local or remote
+// repository of the target to the check.
+func (d OptionsData) GitPort() (int, error) {
+	path, err := GetValidDirectory(d.check.Target)
+	if _, _, ok := gitservice.ParseRemote(d.check.Target); ok {
+		path, err = d.check.Target, nil
+	}
+	if err != nil || d.gs == nil {
+		return 0, fmt.Errorf("the target %s is not served by a git server", d.check.Target)
+	}
+	// The git service returns the same url when the check is run.
+	rawURL, err := d.gs.AddGitRef(path, d.check.Ref)
+	if err != nil {
+		return 0, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(u.Port())
+}
+
+// newOptionsData returns the variables of the templates for the check. The
+// local repositories are inspected with the git binary gitBin.
+func newOptionsData(c *config.Check, gs gitservice.GitService, gitBin string) OptionsData {
+	d := OptionsData{
+		Target: OptionsTarget{Identifier: c.Target, AssetType: c.AssetType},
+		check:  c,
+		gs:     gs,
+	}
+	if c.Ref != gitservice.StagedRef {
+		d.Target.Branch = c.Ref
+	}
+	if _, ref, ok := gitservice.ParseRemote(c.Target); ok && ref != "" {
+		d.Target.Branch = ref
+	}
+	path, err := GetValidDirectory(c.Target)
+	if err != nil {
+		return d
+	}
+	d.Target.Path = "."
+	if out, err := gitservice.GitCommand(gitBin, path, "rev-parse", "--show-prefix").Output(); err == nil {
+		if prefix := strings.TrimSuffix(strings.TrimSpace(string(out)), "/"); prefix != "" {
+			d.Target.Path = filepath.ToSlash(prefix)
+		}
+	}
+	if d.Target.Branch == "" {
+		out, err := gitservice.GitCommand(gitBin, path, "symbolic-ref", "--short", "-q", "HEAD").Output()
+		if err == nil {
+			d.Target.Branch = strings.TrimSpace(string(out))
+		}
+	}
+	return d
+}
+
+// isTemplated returns true if any string in the options contains a template.
+func isTemplated(v interface{}) bool {
+	switch v := v.(type) {
+	case string:
+		return strings.Contains(v, "{{")
+	case map[string]interface{}:
+		for _, e := range v {
+			if isTemplated(e) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, e := range v {
+			if isTemplated(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveOptions returns a copy of the options of the check with their
+// templates executed for its target, using the git binary gitBin.
+func resolveOptions(c *config.Check, gs gitservice.GitService, gitBin string) (map[string]interface{}, error) {
+	if !isTemplated(c.Options) {
+		return c.Options, nil
+	}
+	data := newOptionsData(c, gs, gitBin)
+	resolved, err := resolveOption(c.Options, data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid options of the check %s: %w", c.Type, err)
+	}
+	return resolved.(map[string]interface{}), nil
+}
+
+func resolveOption(v interface{}, data OptionsData) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		tmpl, err := template.New("option").Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		return b.String(), nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			r, err := resolveOption(e, data)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = r
+		}
+		return m, nil
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			r, err := resolveOption(e, data)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = r
+		}
+		return l, nil
+	}
+	return v, nil
+}
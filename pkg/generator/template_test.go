@@ -0,0 +1,129 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package generator
+
+import (
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/gitservice"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResolveOptions(t *testing.T) {
+	repo := t.TempDir()
+	sub := filepath.Join(repo, "services", "api")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"checkout", "-q", "-b", "develop"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+
+	gs := gitservice.New(loggerUser, gitservice.Config{Host: "localhost", Multiplexed: true})
+	defer gs.Shutdown()
+	gitURL, err := gs.AddGit(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(gitURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		check   config.Check
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "NotTemplated",
+			check: config.Check{
+				Target:  "example.com",
+				Options: map[string]interface{}{"depth": 2},
+			},
+			want: map[string]interface{}{"depth": 2},
+		},
+		{
+			name: "LocalTarget",
+			check: config.Check{
+				Target:    sub,
+				AssetType: "GitRepository",
+				Options: map[string]interface{}{
+					"path":    "{{.Target.Path}}",
+					"branch":  "{{.Target.Branch}}",
+					"url":     "http://localhost:{{.GitPort}}",
+					"nested":  map[string]interface{}{"paths": []interface{}{"{{.Target.Path}}/cmd", 1}},
+					"literal": "plain",
+				},
+			},
+			want: map[string]interface{}{
+				"path":    "services/api",
+				"branch":  "develop",
+				"url":     "http://localhost:" + u.Port(),
+				"nested":  map[string]interface{}{"paths": []interface{}{"services/api/cmd", 1}},
+				"literal": "plain",
+			},
+		},
+		{
+			name: "Ref",
+			check: config.Check{
+				Target:  repo,
+				Ref:     "main",
+				Options: map[string]interface{}{"scope": "{{.Target.Path}}@{{.Target.Branch}}"},
+			},
+			want: map[string]interface{}{"scope": ".@main"},
+		},
+		{
+			name: "RemoteTarget",
+			check: config.Check{
+				Target:    "git+https://github.com/adevinta/vulcan-local.git#feature",
+				AssetType: "GitRepository",
+				Options:   map[string]interface{}{"target": "{{.Target.AssetType}} {{.Target.Branch}} {{.Target.Path}}"},
+			},
+			want: map[string]interface{}{"target": "GitRepository feature "},
+		},
+		{
+			name: "NotServed",
+			check: config.Check{
+				Target:  "example.com",
+				Options: map[string]interface{}{"port": "{{.GitPort}}"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "UnknownVariable",
+			check: config.Check{
+				Target:  "example.com",
+				Options: map[string]interface{}{"port": "{{.Target.Port}}"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveOptions(&tt.check, gs, "git")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected options (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
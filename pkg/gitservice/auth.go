@@ -0,0 +1,77 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package gitservice
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// gitUser is the user of the basic auth credentials of the repositories.
+const gitUser = "vulcan"
+
+// newToken returns a random password for the credentials of a repository.
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// authHandler rejects the requests without the basic auth credentials of the
+// repository they are addressed to.
+type authHandler struct {
+	next   http.Handler
+	mu     sync.RWMutex
+	tokens map[string]string // url path prefix -> token
+}
+
+func newAuthHandler(next http.Handler) *authHandler {
+	return &authHandler{
+		next:   next,
+		tokens: map[string]string{},
+	}
+}
+
+// add requires the token for the requests to the url path prefix. An empty
+// prefix applies to every request.
+func (h *authHandler) add(prefix, token string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tokens[prefix] = token
+}
+
+// token returns the token of the longest prefix matching the url path.
+func (h *authHandler) token(path string) (string, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var token, prefix string
+	found := false
+	for p, t := range h.tokens {
+		if p != "" && path != p && !strings.HasPrefix(path, p+"/") {
+			continue
+		}
+		if !found || len(p) > len(prefix) {
+			token, prefix, found = t, p, true
+		}
+	}
+	return token, found
+}
+
+func (h *authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user, pass, ok := r.BasicAuth()
+	token, found := h.token(r.URL.Path)
+	if !ok || !found || user != gitUser || subtle.ConstantTimeCompare([]byte(pass), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="vulcan-local"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
@@ -7,137 +7,440 @@ package gitservice
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io/fs"
+	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
 
 	"github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-local/pkg/ports"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/jesusfcr/gittp"
-	"github.com/otiai10/copy"
-	"github.com/phayes/freeport"
 )
 
+// muxReposDir is the directory, relative to the root of the multiplexed
+// server, where the repositories are stored. It's also the url path prefix
+// used to route the requests to them.
+const muxReposDir = "repo"
+
+// GitService serves local directories as git repositories through http.
 type GitService interface {
-	AddGit(path string) (int, error)
+	// AddGit starts serving the given path and returns the url the checks
+	// must use to clone it.
+	AddGit(path string) (string, error)
+	// AddGitRef serves the history of the git repository in the path up to
+	// the given ref (branch, tag or commit). If the path is not the root of a
+	// git repository it behaves like AddGit. The path can also be a bare
+	// repository or a remote repository target (see ParseRemote), that is
+	// shallow cloned with the ref in its fragment, if any.
+	AddGitRef(path, ref string) (string, error)
 	Shutdown()
 }
 
+// Config defines how the git service exposes the repositories.
+type Config struct {
+	// Host is the address the checks use to reach the git servers.
+	Host string
+
+	// GitBin is the git binary, git by default.
+	GitBin string
+
+	// BindAddress is the address where the git servers listen, all the
+	// interfaces by default.
+	BindAddress string
+
+	// Multiplexed serves all the repositories through a single http server
+	// routing them by url path, instead of starting one server per repository.
+	Multiplexed bool
+
+	// Exclude contains the patterns, with the .gitignore syntax, of the files
+	// not copied to the snapshots of the directories.
+	Exclude []string
+
+	// Strategy is the strategy used to create the snapshots of the
+	// directories, SnapshotCopy by default.
+	Strategy string
+
+	// SkipSubmodules doesn't serve the content of the git submodules, by
+	// default it's included in the served repositories.
+	SkipSubmodules bool
+
+	// Ports is the range of ports where the git servers listen, random
+	// ports if nil.
+	Ports *ports.Range
+
+	// SkipLFS serves the git LFS pointer files as they are. By default they
+	// are replaced with the content of the objects stored in the local
+	// repositories or, for the remote ones, fetched with git-lfs.
+	SkipLFS bool
+
+	// LFSMaxSize is the size in bytes of the biggest git LFS object served,
+	// the bigger ones are served as pointers. No limit if 0.
+	LFSMaxSize int64
+}
+
 type gitMapping struct {
-	port   int
+	url    string
 	server *http.Server
 	tmpDir string
 }
 
 type gitService struct {
 	log      log.Logger
+	cfg      Config
 	mappings map[string]*gitMapping
+	mux      *muxServer
 	wg       sync.WaitGroup
 	mu       sync.Mutex
 }
 
-func New(l log.Logger) GitService {
+// muxServer is the single http server used in multiplexed mode.
+type muxServer struct {
+	port    int
+	server  *http.Server
+	auth    *authHandler
+	rootDir string
+}
+
+func New(l log.Logger, cfg Config) GitService {
 	return &gitService{
 		mappings: make(map[string]*gitMapping),
 		log:      l,
+		cfg:      cfg,
 	}
 }
 
-func (gs *gitService) AddGit(path string) (int, error) {
-	// Prevent creating multiple gitservices for the same folder.
+func (gs *gitService) AddGit(path string) (string, error) {
+	return gs.AddGitRef(path, "")
+}
+
+func (gs *gitService) AddGitRef(path, ref string) (string, error) {
+	// Prevent creating multiple gitservices for the same folder and ref.
 	gs.mu.Lock()
 	defer gs.mu.Unlock()
 
-	if mapping, ok := gs.mappings[path]; ok {
-		return mapping.port, nil
+	key := path
+	if ref != "" {
+		key = fmt.Sprintf("%s#%s", path, ref)
+	}
+	if mapping, ok := gs.mappings[key]; ok {
+		return mapping.url, nil
+	}
+	if gs.cfg.Multiplexed {
+		return gs.addMuxGit(key, path, ref)
 	}
-	tmpDir, err := gs.createTmpRepository(path)
+	tmpDir, err := os.MkdirTemp("", "")
 	if err != nil {
-		return 0, err
+		return "", err
 	}
-	config := gittp.ServerConfig{
-		Path:       tmpDir,
-		Debug:      false,
-		PreCreate:  gittp.UseGithubRepoNames,
-		PreReceive: gittp.MasterOnly,
+	if err := gs.createRepository(path, ref, tmpDir); err != nil {
+		removeAll(tmpDir)
+		return "", err
 	}
-	handle, err := gittp.NewGitServer(config)
+	handle, err := newGitHandler(tmpDir)
 	if err != nil {
-		return 0, err
+		removeAll(tmpDir)
+		return "", err
 	}
-	port, err := freeport.GetFreePort()
+	token, err := newToken()
 	if err != nil {
-		return 0, err
+		removeAll(tmpDir)
+		return "", err
 	}
+	auth := newAuthHandler(handle)
+	auth.add("", token)
+	ln, err := gs.cfg.Ports.Listen(gs.bindHost())
+	if err != nil {
+		removeAll(tmpDir)
+		return "", err
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
 
 	r := gitMapping{
-		port:   port,
-		server: &http.Server{Addr: fmt.Sprintf("0.0.0.0:%d", port), Handler: handle},
+		url:    fmt.Sprintf("http://%s:%s@%s:%d/", gitUser, token, gs.cfg.Host, port),
+		server: &http.Server{Handler: auth},
 		tmpDir: tmpDir,
 	}
-	gs.mappings[path] = &r
+	gs.mappings[key] = &r
+	gs.log.Debugf("Starting git server path=%s ref=%s port=%d", path, ref, port)
+	gs.serve(r.server, ln)
+	return r.url, nil
+}
+
+// addMuxGit creates the repository for the path under the root directory of
+// the multiplexed server, starting the server if it's not already running.
+func (gs *gitService) addMuxGit(key, path, ref string) (string, error) {
+	if gs.mux == nil {
+		if err := gs.startMux(); err != nil {
+			return "", err
+		}
+	}
+	name := fmt.Sprintf("%x.git", sha256.Sum256([]byte(key)))
+	repoDir := filepath.Join(gs.mux.rootDir, muxReposDir, name)
+	if err := os.MkdirAll(repoDir, 0o755); err != nil {
+		return "", err
+	}
+	if err := gs.createRepository(path, ref, repoDir); err != nil {
+		removeAll(repoDir)
+		return "", err
+	}
+	token, err := newToken()
+	if err != nil {
+		removeAll(repoDir)
+		return "", err
+	}
+	gs.mux.auth.add(fmt.Sprintf("/%s/%s", muxReposDir, name), token)
+	r := gitMapping{
+		url: fmt.Sprintf("http://%s:%s@%s:%d/%s/%s", gitUser, token, gs.cfg.Host, gs.mux.port, muxReposDir, name),
+	}
+	gs.mappings[key] = &r
+	gs.log.Debugf("Serving git repository path=%s ref=%s url=%s", path, ref, r.url)
+	return r.url, nil
+}
+
+func (gs *gitService) startMux() error {
+	rootDir, err := os.MkdirTemp("", "")
+	if err != nil {
+		return err
+	}
+	handle, err := newGitHandler(rootDir)
+	if err != nil {
+		removeAll(rootDir)
+		return err
+	}
+	ln, err := gs.cfg.Ports.Listen(gs.bindHost())
+	if err != nil {
+		removeAll(rootDir)
+		return err
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	auth := newAuthHandler(handle)
+	gs.mux = &muxServer{
+		port:    port,
+		server:  &http.Server{Handler: auth},
+		auth:    auth,
+		rootDir: rootDir,
+	}
+	gs.log.Debugf("Starting multiplexed git server port=%d", port)
+	gs.serve(gs.mux.server, ln)
+	return nil
+}
+
+// bindHost returns the address where the servers listen.
+func (gs *gitService) bindHost() string {
+	if gs.cfg.BindAddress == "" {
+		return "0.0.0.0"
+	}
+	return gs.cfg.BindAddress
+}
+
+func (gs *gitService) serve(srv *http.Server, ln net.Listener) {
 	gs.wg.Add(1)
-	gs.log.Debugf("Starting git server path=%s port=%d", path, port)
 	go func() {
-		r.server.ListenAndServe()
 		defer gs.wg.Done()
+		srv.Serve(ln)
 	}()
-	return port, nil
 }
 
 func (gs *gitService) Shutdown() {
 	for _, m := range gs.mappings {
+		if m.server == nil {
+			continue
+		}
 		m.server.Shutdown(context.Background())
-		os.RemoveAll(m.tmpDir)
+		removeAll(m.tmpDir)
+	}
+	if gs.mux != nil {
+		gs.mux.server.Shutdown(context.Background())
+		removeAll(gs.mux.rootDir)
 	}
 	gs.wg.Wait()
 }
 
-func (gs *gitService) createTmpRepository(path string) (string, error) {
-	tmpRepositoryPath, err := os.MkdirTemp("", "")
+// newGitHandler returns a git http handler serving the repositories stored in
+// the given directory.
+func newGitHandler(path string) (http.Handler, error) {
+	config := gittp.ServerConfig{
+		Path:       path,
+		Debug:      false,
+		PreCreate:  gittp.UseGithubRepoNames,
+		PreReceive: gittp.MasterOnly,
+	}
+	return gittp.NewGitServer(config)
+}
+
+// createRepository creates in dest the repository to serve for the path. When
+// a ref is given and the path is the root of a git repository, the history up
+// to the ref is fetched, if it's StagedRef the staged files are used, otherwise
+// a snapshot of the current content is used. The remote repositories are
+// cloned and the bare repositories are fetched up to the ref or their HEAD.
+func (gs *gitService) createRepository(path, ref, dest string) error {
+	if remote, fragment, ok := ParseRemote(path); ok {
+		if fragment != "" {
+			ref = fragment
+		}
+		return gs.fetchRemote(remote, ref, dest)
+	}
+	if gs.isBareRepository(path) {
+		if ref == "" || ref == StagedRef {
+			ref = gs.headBranch(path)
+		}
+		return gs.fetchRef(path, ref, dest)
+	}
+	if ref == StagedRef {
+		return gs.createStagedRepository(path, dest)
+	}
+	if ref == "" {
+		return gs.createTmpRepository(path, dest)
+	}
+	if !gs.isRepositoryRoot(path) {
+		gs.log.Infof("Path %s is not the root of a git repository, ignoring ref %s", path, ref)
+		return gs.createTmpRepository(path, dest)
+	}
+	return gs.fetchRef(path, ref, dest)
+}
+
+// isRepositoryRoot returns true if the path is the top level directory of a
+// git working tree.
+func (gs *gitService) isRepositoryRoot(path string) bool {
+	out, err := gs.gitCommand(path, "rev-parse", "--show-toplevel").Output()
 	if err != nil {
-		return "", err
+		return false
 	}
+	top, err := filepath.EvalSymlinks(gitPath(string(out)))
+	if err != nil {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	abs, err = filepath.EvalSymlinks(abs)
+	if err != nil {
+		return false
+	}
+	return samePath(top, abs)
+}
 
-	var cmdOut, cmdErr bytes.Buffer
+// snapshotSkip returns the function skipping the files of the directory in
+// path not included in its snapshots: the ones ignored by git, the git
+// metadata, the excluded ones and the submodules if they are skipped.
+func (gs *gitService) snapshotSkip(path string) skipFunc {
 	ignore := map[string]bool{}
-	cmd := exec.Command("git", "-C", path, "ls-files", "--exclude-standard", "-oi", "--directory")
-	cmd.Stdout = &cmdOut
-	cmd.Stderr = &cmdErr
-	if err := cmd.Run(); err != nil {
-		// The path is not part of a git repo... it's ok
-		gs.log.Debugf("find .gitignored files error: %s.", cmdErr.String())
+	gs.gitIgnored(path, ignore)
+	// The content of the initialized submodules is included in the snapshot,
+	// so the .gitmodules files are stale.
+	if subs := gs.submodules(path); len(subs) > 0 && !gs.cfg.SkipSubmodules {
+		ignore[pathKey(filepath.Join(path, gitmodulesFile))] = true
+		for _, sub := range subs {
+			sub = filepath.Join(path, sub)
+			gs.gitIgnored(sub, ignore)
+			ignore[pathKey(filepath.Join(sub, gitmodulesFile))] = true
+		}
 	} else {
-		if cmdOut.Len() > 0 {
-			for _, f := range strings.Split(cmdOut.String(), "\n") {
-				f := strings.TrimSuffix(f, "/") // store directories without trailing slash
-				f = filepath.Join(path, f)
-				ignore[f] = true
-			}
+		for _, sub := range subs {
+			ignore[pathKey(filepath.Join(path, sub))] = true
 		}
 	}
 
-	err = copy.Copy(path, tmpRepositoryPath, copy.Options{Skip: func(srcinfo fs.FileInfo, src string, dest string) (bool, error) {
-		_, ok := ignore[src]
-		return ok || filepath.Base(src) == ".git", nil
-	}})
+	matcher := newIgnoreMatcher(path, gs.cfg.Exclude)
+	return func(srcinfo fs.FileInfo, src string) bool {
+		_, ok := ignore[pathKey(src)]
+		return ok || filepath.Base(src) == ".git" || matcher.Match(src, srcinfo.IsDir())
+	}
+}
+
+// SnapshotFiles returns the regular files of the directory in path included
+// in the snapshots served with the config, relative to the path and slash
+// separated, in lexical order.
+func SnapshotFiles(l log.Logger, cfg Config, path string) ([]string, error) {
+	gs := &gitService{log: l, cfg: cfg}
+	skip := gs.snapshotSkip(path)
+	files := []string{}
+	err := filepath.Walk(path, func(src string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, src)
+		if err != nil {
+			return err
+		}
+		if rel != "." && skip(info, src) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return files, err
+}
 
-	gs.log.Debugf("Copied %s to %s", path, tmpRepositoryPath)
+// fetchRef creates a repository in dest containing the history of the
+// repository in path up to the given ref. If the ref is a branch the served
+// repository uses the same branch name, if not it uses master.
+func (gs *gitService) fetchRef(path, ref, dest string) error {
+	out, err := gs.gitCommand(path, "rev-parse", "--verify", "--quiet", ref+"^{commit}").Output()
+	if err != nil {
+		return fmt.Errorf("unable to resolve ref %s in %s: %w", ref, path, err)
+	}
+	commit := strings.TrimSpace(string(out))
+	// The path is fetched from the directory of the new repository.
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	branch := "master"
+	if gs.gitCommand(path, "show-ref", "--verify", "--quiet", "refs/heads/"+ref).Run() == nil {
+		branch = ref
+	}
+	cmds := [][]string{
+		{"init", "-q"},
+		{"symbolic-ref", "HEAD", "refs/heads/" + branch},
+		{"fetch", "-q", "--update-head-ok", path, fmt.Sprintf("%s:refs/heads/%s", commit, branch)},
+		{"reset", "-q", "--hard"},
+	}
+	for _, args := range cmds {
+		var cmdErr bytes.Buffer
+		cmd := gs.gitCommand(dest, args...)
+		cmd.Stderr = &cmdErr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("unable to fetch ref %s from %s: %w %s", ref, path, err, cmdErr.String())
+		}
+	}
+	gs.log.Debugf("Fetched %s ref=%s commit=%s into %s", path, ref, commit, dest)
+	if err := gs.includeRefLFS(path, dest, []string{gs.lfsObjectsDir(path)}, nil); err != nil {
+		return err
+	}
+	if gs.cfg.SkipSubmodules {
+		return nil
+	}
+	return gs.vendorSubmodules(path, commit, dest)
+}
+
+func (gs *gitService) createTmpRepository(path, tmpRepositoryPath string) error {
+	err := snapshot(gs.cfg.Strategy, path, tmpRepositoryPath, gs.snapshotSkip(path))
+	gs.log.Debugf("Copied %s to %s strategy=%s", path, tmpRepositoryPath, gs.cfg.Strategy)
 	if err != nil {
 		gs.log.Errorf("Error coping tmp file: %s", err)
-		return "", err
+		return err
+	}
+	if err := gs.includeLFS(path, tmpRepositoryPath); err != nil {
+		return err
 	}
 	r, _ := git.PlainInit(tmpRepositoryPath, false)
 	w, err := r.Worktree()
 	if err != nil {
 		gs.log.Errorf("Error opening worktree: %s", err)
-		return "", err
+		return err
 	}
 	w.AddGlob(".")
 	_, err = w.Commit("", &git.CommitOptions{
@@ -148,7 +451,7 @@ func (gs *gitService) createTmpRepository(path string) (string, error) {
 	})
 	if err != nil {
 		gs.log.Errorf("Error committing: %s", err)
-		return "", err
+		return err
 	}
-	return tmpRepositoryPath, nil
+	return nil
 }
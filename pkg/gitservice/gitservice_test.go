@@ -0,0 +1,913 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package gitservice
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adevinta/vulcan-local/pkg/ports"
+	"github.com/google/go-cmp/cmp"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	loggerUser *logrus.Logger
+)
+
+func init() {
+	if len(os.Args) > 1 && os.Args[1][:5] == "-test" {
+		loggerUser = logrus.New()
+		loggerUser.SetFormatter(&logrus.TextFormatter{
+			DisableColors:   false,
+			FullTimestamp:   true,
+			TimestampFormat: time.RFC3339,
+			ForceColors:     true,
+		})
+	}
+}
+
+// writeFiles creates the files in a new temporary directory and returns its path.
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// clone clones the repository in the url and returns the path of the clone.
+func clone(t *testing.T, url string) string {
+	dir := filepath.Join(t.TempDir(), "clone")
+	out, err := exec.Command("git", "clone", "-q", url, dir).CombinedOutput()
+	if err != nil {
+		t.Fatalf("unable to clone %s: %v %s", url, err, out)
+	}
+	return dir
+}
+
+// host returns the host and port of the url.
+func host(t *testing.T, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}
+
+func TestAddGit(t *testing.T) {
+	tests := []struct {
+		name        string
+		multiplexed bool
+		strategy    string
+	}{
+		{
+			name:        "OneServerPerRepository",
+			multiplexed: false,
+		},
+		{
+			name:        "Multiplexed",
+			multiplexed: true,
+		},
+		{
+			name:        "Hardlink",
+			multiplexed: false,
+			strategy:    SnapshotHardlink,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoA := writeFiles(t, map[string]string{"a.txt": "a"})
+			repoB := writeFiles(t, map[string]string{"b/b.txt": "b"})
+
+			gs := New(loggerUser, Config{Host: "localhost", Multiplexed: tt.multiplexed, Strategy: tt.strategy})
+			defer gs.Shutdown()
+
+			urlA, err := gs.AddGit(repoA)
+			if err != nil {
+				t.Fatal(err)
+			}
+			urlB, err := gs.AddGit(repoB)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if urlA == urlB {
+				t.Fatalf("same url for different repositories %s", urlA)
+			}
+			again, err := gs.AddGit(repoA)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != urlA {
+				t.Errorf("different url for the same repository got=%s want=%s", again, urlA)
+			}
+
+			samePort := host(t, urlA) == host(t, urlB)
+			if samePort != tt.multiplexed {
+				t.Errorf("unexpected server address urlA=%s urlB=%s", urlA, urlB)
+			}
+
+			if _, err := os.Stat(filepath.Join(clone(t, urlA), "a.txt")); err != nil {
+				t.Errorf("missing file in repository A: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(clone(t, urlB), "b", "b.txt")); err != nil {
+				t.Errorf("missing file in repository B: %v", err)
+			}
+		})
+	}
+}
+
+// runGit runs a git command in the given directory.
+func runGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v %s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestAddGitRef(t *testing.T) {
+	repo := writeFiles(t, map[string]string{"a.txt": "1"})
+	runGit(t, repo, "init", "-q")
+	runGit(t, repo, "checkout", "-q", "-b", "main")
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-q", "-m", "first")
+	first := runGit(t, repo, "rev-parse", "HEAD")
+	runGit(t, repo, "checkout", "-q", "-b", "feature")
+	if err := os.WriteFile(filepath.Join(repo, "a.txt"), []byte("2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, repo, "commit", "-q", "-am", "second")
+	second := runGit(t, repo, "rev-parse", "HEAD")
+	runGit(t, repo, "checkout", "-q", "main")
+
+	notRepo := writeFiles(t, map[string]string{"b.txt": "b"})
+
+	tests := []struct {
+		name        string
+		path        string
+		ref         string
+		wantHead    string
+		wantBranch  string
+		wantCommits string
+		wantErr     bool
+	}{
+		{
+			name:        "Branch",
+			path:        repo,
+			ref:         "feature",
+			wantHead:    second,
+			wantBranch:  "feature",
+			wantCommits: "2",
+		},
+		{
+			name:        "Commit",
+			path:        repo,
+			ref:         first,
+			wantHead:    first,
+			wantBranch:  "master",
+			wantCommits: "1",
+		},
+		{
+			name:        "NotARepository",
+			path:        notRepo,
+			ref:         "main",
+			wantBranch:  "master",
+			wantCommits: "1",
+		},
+		{
+			name:    "UnknownRef",
+			path:    repo,
+			ref:     "unknown",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs := New(loggerUser, Config{Host: "localhost", Multiplexed: true})
+			defer gs.Shutdown()
+
+			url, err := gs.AddGitRef(tt.path, tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err != nil {
+				return
+			}
+			dir := clone(t, url)
+			if tt.wantHead != "" {
+				if head := runGit(t, dir, "rev-parse", "HEAD"); head != tt.wantHead {
+					t.Errorf("unexpected head got=%s want=%s", head, tt.wantHead)
+				}
+			}
+			if branch := runGit(t, dir, "rev-parse", "--abbrev-ref", "HEAD"); branch != tt.wantBranch {
+				t.Errorf("unexpected branch got=%s want=%s", branch, tt.wantBranch)
+			}
+			if commits := runGit(t, dir, "rev-list", "--count", "HEAD"); commits != tt.wantCommits {
+				t.Errorf("unexpected number of commits got=%s want=%s", commits, tt.wantCommits)
+			}
+		})
+	}
+}
+
+func TestAddGitIgnored(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.go":                     "package main",
+		"debug.log":                   "log",
+		"build/out.bin":               "bin",
+		"web/.gitignore":              "node_modules/\n# comment\n*.tmp\n!keep.tmp\n",
+		"web/index.js":                "js",
+		"web/cache.tmp":               "tmp",
+		"web/keep.tmp":                "tmp",
+		"web/node_modules/lib/lib.js": "lib",
+		"web/app/node_modules/a.js":   "a",
+		"other/cache.tmp":             "tmp",
+		"..env":                       "secret",
+		"...web/cache.tmp":            "tmp",
+		"...web/.gitignore":           "*.tmp\n",
+	})
+	gs := New(loggerUser, Config{Host: "localhost", Exclude: []string{"build/", "*.log", "*.env"}})
+	defer gs.Shutdown()
+	url, err := gs.AddGit(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := listFiles(t, clone(t, url))
+	want := []string{"...web/.gitignore", "main.go", "other/cache.tmp", "web/.gitignore", "web/index.js", "web/keep.tmp"}
+	if diff := cmp.Diff(want, files); diff != "" {
+		t.Errorf("unexpected files in the repository (-want +got):\n%s", diff)
+	}
+}
+
+func TestAddGitStaged(t *testing.T) {
+	repo := writeFiles(t, map[string]string{
+		"app/main.go":    "package main",
+		"app/removed.go": "package main",
+		"README.md":      "readme",
+	})
+	runGit(t, repo, "init", "-q")
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-q", "-m", "first")
+	for name, content := range map[string]string{
+		"app/main.go":   "package main // staged",
+		"app/config.go": "package main",
+		"README.md":     "not staged",
+	} {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runGit(t, repo, "add", "app")
+	runGit(t, repo, "rm", "-q", "app/removed.go")
+	if err := os.WriteFile(filepath.Join(repo, "app/main.go"), []byte("package main // not staged"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		want  []string
+		files map[string]string
+	}{
+		{
+			name:  "Root",
+			path:  repo,
+			want:  []string{"app/config.go", "app/main.go"},
+			files: map[string]string{"app/main.go": "package main // staged"},
+		},
+		{
+			name:  "Subdirectory",
+			path:  filepath.Join(repo, "app"),
+			want:  []string{"config.go", "main.go"},
+			files: map[string]string{"main.go": "package main // staged"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := StagedFiles("", tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, files); diff != "" {
+				t.Errorf("unexpected staged files (-want +got):\n%s", diff)
+			}
+
+			gs := New(loggerUser, Config{Host: "localhost"})
+			defer gs.Shutdown()
+			url, err := gs.AddGitRef(tt.path, StagedRef)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir := clone(t, url)
+			if diff := cmp.Diff(tt.want, listFiles(t, dir)); diff != "" {
+				t.Errorf("unexpected files in the repository (-want +got):\n%s", diff)
+			}
+			for name, want := range tt.files {
+				content, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(content) != want {
+					t.Errorf("unexpected content of %s got=%q want=%q", name, content, want)
+				}
+			}
+		})
+	}
+}
+
+// listFiles returns the files of the directory, skipping the .git directory.
+func listFiles(t *testing.T, dir string) []string {
+	files := []string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestAddGitAuth(t *testing.T) {
+	tests := []struct {
+		name        string
+		multiplexed bool
+	}{
+		{
+			name:        "OneServerPerRepository",
+			multiplexed: false,
+		},
+		{
+			name:        "Multiplexed",
+			multiplexed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs := New(loggerUser, Config{Host: "localhost", BindAddress: "127.0.0.1", Multiplexed: tt.multiplexed})
+			defer gs.Shutdown()
+			urlA, err := gs.AddGit(writeFiles(t, map[string]string{"a.txt": "a"}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			urlB, err := gs.AddGit(writeFiles(t, map[string]string{"b.txt": "b"}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			a, _ := url.Parse(urlA)
+			b, _ := url.Parse(urlB)
+			anonymous := *a
+			anonymous.User = nil
+			wrongToken := *a
+			wrongToken.User = b.User
+
+			for _, u := range []*url.URL{&anonymous, &wrongToken} {
+				resp, err := http.Get(strings.TrimSuffix(u.String(), "/") + "/info/refs?service=git-upload-pack")
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusUnauthorized {
+					t.Errorf("unexpected status for %s got=%d want=%d", u.Redacted(), resp.StatusCode, http.StatusUnauthorized)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(clone(t, urlA), "a.txt")); err != nil {
+				t.Errorf("missing file in repository: %v", err)
+			}
+		})
+	}
+}
+
+func TestAddGitSubmodules(t *testing.T) {
+	sub := writeFiles(t, map[string]string{"sub.txt": "sub", ".gitignore": "*.tmp\n"})
+	runGit(t, sub, "init", "-q")
+	runGit(t, sub, "add", ".")
+	runGit(t, sub, "commit", "-q", "-m", "sub")
+
+	repo := writeFiles(t, map[string]string{"main.txt": "main"})
+	runGit(t, repo, "init", "-q")
+	runGit(t, repo, "checkout", "-q", "-b", "main")
+	runGit(t, repo, "-c", "protocol.file.allow=always", "submodule", "add", "-q", sub, "lib")
+	if err := os.WriteFile(filepath.Join(repo, "lib", "cache.tmp"), []byte("tmp"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-q", "-m", "main")
+
+	tests := []struct {
+		name string
+		ref  string
+		skip bool
+		want []string
+	}{
+		{
+			name: "Snapshot",
+			want: []string{"lib/.gitignore", "lib/sub.txt", "main.txt"},
+		},
+		{
+			name: "Ref",
+			ref:  "main",
+			want: []string{"lib/.gitignore", "lib/sub.txt", "main.txt"},
+		},
+		{
+			name: "SnapshotSkipSubmodules",
+			skip: true,
+			want: []string{".gitmodules", "main.txt"},
+		},
+		{
+			name: "RefSkipSubmodules",
+			ref:  "main",
+			skip: true,
+			want: []string{".gitmodules", "main.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs := New(loggerUser, Config{Host: "localhost", SkipSubmodules: tt.skip})
+			defer gs.Shutdown()
+			url, err := gs.AddGitRef(repo, tt.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, listFiles(t, clone(t, url))); diff != "" {
+				t.Errorf("unexpected files in the repository (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSnapshotHardlink(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.txt": "a", "b/b.txt": "b", "b/skip.txt": "skip"})
+	if err := os.Symlink("a.txt", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	err := snapshot(SnapshotHardlink, dir, dest, func(info fs.FileInfo, src string) bool {
+		return info.Name() == "skip.txt"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b/b.txt"} {
+		src, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst, err := os.Stat(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatalf("missing file %s: %v", name, err)
+		}
+		if !os.SameFile(src, dst) {
+			t.Errorf("file %s is not a hard link", name)
+		}
+	}
+	if link, err := os.Readlink(filepath.Join(dest, "link")); err != nil || link != "a.txt" {
+		t.Errorf("unexpected symlink got=%s err=%v", link, err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "b", "skip.txt")); !os.IsNotExist(err) {
+		t.Errorf("skipped file in the snapshot: %v", err)
+	}
+}
+
+func TestSnapshotHardlinkWindows(t *testing.T) {
+	oldGOOS := goos
+	goos = "windows"
+	defer func() { goos = oldGOOS }()
+	dir := writeFiles(t, map[string]string{"rw.txt": "rw", "ro.txt": "ro"})
+	if err := os.Chmod(filepath.Join(dir, "ro.txt"), 0o444); err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	if err := snapshot(SnapshotHardlink, dir, dest, func(fs.FileInfo, string) bool { return false }); err != nil {
+		t.Fatal(err)
+	}
+	for name, wantLink := range map[string]bool{"rw.txt": true, "ro.txt": false} {
+		src, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst, err := os.Stat(filepath.Join(dest, name))
+		if err != nil {
+			t.Fatalf("missing file %s: %v", name, err)
+		}
+		if os.SameFile(src, dst) != wantLink {
+			t.Errorf("unexpected hard link of %s got=%v want=%v", name, !wantLink, wantLink)
+		}
+	}
+	if err := removeAll(dest); err != nil {
+		t.Errorf("unable to remove the snapshot: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "ro.txt")); err != nil || info.Mode().Perm() != 0o444 {
+		t.Errorf("the mode of the original file was modified: %v %v", info.Mode(), err)
+	}
+}
+
+func TestPathKey(t *testing.T) {
+	oldGOOS := goos
+	defer func() { goos = oldGOOS }()
+	tests := []struct {
+		goos string
+		a, b string
+		want bool
+	}{
+		{goos: "linux", a: "/repo/dir/", b: "/repo/dir", want: true},
+		{goos: "linux", a: "/Repo/dir", b: "/repo/dir", want: false},
+		{goos: "windows", a: "/Repo/Dir", b: "/repo/dir", want: true},
+		{goos: "windows", a: "/repo/a", b: "/repo/b", want: false},
+	}
+	for _, tt := range tests {
+		goos = tt.goos
+		if got := samePath(tt.a, tt.b); got != tt.want {
+			t.Errorf("unexpected samePath(%s, %s) in %s got=%v want=%v", tt.a, tt.b, tt.goos, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkSnapshot(b *testing.B) {
+	dir := b.TempDir()
+	for i := 0; i < 2000; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("dir%02d", i%50), fmt.Sprintf("file%04d.txt", i))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(path, bytes.Repeat([]byte("x"), 16*1024), 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	skip := func(info fs.FileInfo, src string) bool { return false }
+	for _, strategy := range SnapshotStrategies() {
+		b.Run(strategy, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := snapshot(strategy, dir, filepath.Join(b.TempDir(), "snapshot"), skip); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRemote(t *testing.T) {
+	tests := []struct {
+		target  string
+		wantURL string
+		wantRef string
+		wantOk  bool
+	}{
+		{target: "git+https://github.com/adevinta/vulcan-local.git#main", wantURL: "https://github.com/adevinta/vulcan-local.git", wantRef: "main", wantOk: true},
+		{target: "git+ssh://git@github.com/adevinta/vulcan-local.git", wantURL: "ssh://git@github.com/adevinta/vulcan-local.git", wantOk: true},
+		{target: "git+file:///srv/mirrors/app.git#v1.0", wantURL: "file:///srv/mirrors/app.git", wantRef: "v1.0", wantOk: true},
+		{target: "https://github.com/adevinta/vulcan-local.git"},
+		{target: "git@github.com:adevinta/vulcan-local.git"},
+		{target: "git+ftp://example.com/app.git"},
+		{target: "git+https:///app.git"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			url, ref, ok := ParseRemote(tt.target)
+			if url != tt.wantURL || ref != tt.wantRef || ok != tt.wantOk {
+				t.Errorf("unexpected remote got=(%s, %s, %v) want=(%s, %s, %v)", url, ref, ok, tt.wantURL, tt.wantRef, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestAddGitRemote(t *testing.T) {
+	repo := writeFiles(t, map[string]string{"a.txt": "1"})
+	runGit(t, repo, "init", "-q")
+	runGit(t, repo, "checkout", "-q", "-b", "main")
+	runGit(t, repo, "add", ".")
+	runGit(t, repo, "commit", "-q", "-m", "first")
+	first := runGit(t, repo, "rev-parse", "HEAD")
+	runGit(t, repo, "tag", "-a", "-m", "v1", "v1")
+	runGit(t, repo, "checkout", "-q", "-b", "feature")
+	if err := os.WriteFile(filepath.Join(repo, "a.txt"), []byte("2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, repo, "commit", "-q", "-am", "second")
+	second := runGit(t, repo, "rev-parse", "HEAD")
+	runGit(t, repo, "checkout", "-q", "main")
+
+	bare := filepath.Join(t.TempDir(), "mirror.git")
+	if out, err := exec.Command("git", "clone", "-q", "--mirror", repo, bare).CombinedOutput(); err != nil {
+		t.Fatalf("unable to create the mirror: %v %s", err, out)
+	}
+	remote := "git+file://" + filepath.ToSlash(bare)
+
+	tests := []struct {
+		name        string
+		path        string
+		ref         string
+		wantHead    string
+		wantBranch  string
+		wantCommits string
+		wantErr     bool
+	}{
+		{
+			name:        "Bare",
+			path:        bare,
+			wantHead:    first,
+			wantBranch:  "main",
+			wantCommits: "1",
+		},
+		{
+			name:        "BareBranch",
+			path:        bare,
+			ref:         "feature",
+			wantHead:    second,
+			wantBranch:  "feature",
+			wantCommits: "2",
+		},
+		{
+			name:        "Remote",
+			path:        remote,
+			wantHead:    first,
+			wantBranch:  "main",
+			wantCommits: "1",
+		},
+		{
+			name:        "RemoteBranch",
+			path:        remote + "#feature",
+			wantHead:    second,
+			wantBranch:  "feature",
+			wantCommits: "1",
+		},
+		{
+			name:        "RemoteRef",
+			path:        remote,
+			ref:         "feature",
+			wantHead:    second,
+			wantBranch:  "feature",
+			wantCommits: "1",
+		},
+		{
+			name:        "RemoteTag",
+			path:        remote + "#v1",
+			wantHead:    first,
+			wantBranch:  "master",
+			wantCommits: "1",
+		},
+		{
+			name:    "RemoteUnknownRef",
+			path:    remote + "#unknown",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs := New(loggerUser, Config{Host: "localhost", Multiplexed: true})
+			defer gs.Shutdown()
+
+			url, err := gs.AddGitRef(tt.path, tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err != nil {
+				return
+			}
+			dir := clone(t, url)
+			if head := runGit(t, dir, "rev-parse", "HEAD"); head != tt.wantHead {
+				t.Errorf("unexpected head got=%s want=%s", head, tt.wantHead)
+			}
+			if branch := runGit(t, dir, "rev-parse", "--abbrev-ref", "HEAD"); branch != tt.wantBranch {
+				t.Errorf("unexpected branch got=%s want=%s", branch, tt.wantBranch)
+			}
+			if commits := runGit(t, dir, "rev-list", "--count", "HEAD"); commits != tt.wantCommits {
+				t.Errorf("unexpected number of commits got=%s want=%s", commits, tt.wantCommits)
+			}
+		})
+	}
+}
+
+func TestAddGitPortRange(t *testing.T) {
+	r, err := ports.ParseRange("42000-42100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := New(loggerUser, Config{Host: "localhost", BindAddress: "127.0.0.1", Ports: r})
+	defer gs.Shutdown()
+
+	seen := map[string]bool{}
+	for _, files := range []map[string]string{{"a.txt": "a"}, {"b.txt": "b"}} {
+		url, err := gs.AddGit(writeFiles(t, files))
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		_, port, _ := strings.Cut(host(t, url), ":")
+		if p, _ := strconv.Atoi(port); p < 42000 || p > 42100 || seen[port] {
+			t.Errorf("unexpected port %s", port)
+		}
+		seen[port] = true
+		clone(t, url)
+	}
+}
+
+func TestAddGitPortRangeExhausted(t *testing.T) {
+	r, err := ports.ParseRange("42150-42150")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos := []string{writeFiles(t, map[string]string{"a.txt": "a"}), writeFiles(t, map[string]string{"b.txt": "b"})}
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	gs := New(loggerUser, Config{Host: "localhost", BindAddress: "127.0.0.1", Ports: r})
+	defer gs.Shutdown()
+
+	if _, err := gs.AddGit(repos[0]); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	before, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gs.AddGit(repos[1]); err == nil {
+		t.Fatalf("expected error with the port range exhausted")
+	}
+	after, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Errorf("the snapshot of the failed repository was not removed got=%d want=%d", len(after), len(before))
+	}
+}
+
+// lfsPointerFile returns the pointer of a git LFS object with the content and
+// stores the object in the repository, unless it's empty.
+func lfsPointerFile(t *testing.T, repo, content string) string {
+	oid := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	if repo != "" {
+		path := filepath.Join(repo, ".git", "lfs", "objects", oid[0:2], oid[2:4], oid)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fmt.Sprintf("%s\noid sha256:%s\nsize %d\n", lfsPointerVersion, oid, len(content))
+}
+
+func TestAddGitLFS(t *testing.T) {
+	repo := writeFiles(t, map[string]string{
+		".gitattributes": "*.bin filter=lfs diff=lfs merge=lfs -text\n",
+		"main.go":        "package main",
+	})
+	runGit(t, repo, append(noLFSFilter, "init", "-q")...)
+	runGit(t, repo, "checkout", "-q", "-b", "main")
+	big := strings.Repeat("b", 2048)
+	files := map[string]string{
+		"model.bin":   lfsPointerFile(t, repo, "model"),
+		"big.bin":     lfsPointerFile(t, repo, big),
+		"missing.bin": lfsPointerFile(t, "", "missing"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runGit(t, repo, append(noLFSFilter, "add", ".")...)
+	runGit(t, repo, append(noLFSFilter, "commit", "-q", "-m", "lfs")...)
+
+	tests := []struct {
+		name string
+		ref  string
+		cfg  Config
+		want map[string]string
+	}{
+		{
+			name: "Snapshot",
+			cfg:  Config{LFSMaxSize: 1024},
+			want: map[string]string{"model.bin": "model", "big.bin": files["big.bin"], "missing.bin": files["missing.bin"]},
+		},
+		{
+			name: "Hardlink",
+			cfg:  Config{Strategy: SnapshotHardlink},
+			want: map[string]string{"model.bin": "model", "big.bin": big, "missing.bin": files["missing.bin"]},
+		},
+		{
+			name: "Ref",
+			ref:  "main",
+			cfg:  Config{},
+			want: map[string]string{"model.bin": "model", "big.bin": big, "missing.bin": files["missing.bin"]},
+		},
+		{
+			name: "Skip",
+			cfg:  Config{SkipLFS: true},
+			want: map[string]string{"model.bin": files["model.bin"], "big.bin": files["big.bin"], "missing.bin": files["missing.bin"]},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Host = "localhost"
+			gs := New(loggerUser, tt.cfg)
+			defer gs.Shutdown()
+			url, err := gs.AddGitRef(repo, tt.ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir := clone(t, url)
+			for name, want := range tt.want {
+				got, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("unexpected content of %s got=%.80q want=%.80q", name, got, want)
+				}
+			}
+			// The pointers of the directory are not modified.
+			for name, want := range files {
+				got, err := os.ReadFile(filepath.Join(repo, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("modified pointer %s got=%.80q want=%.80q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseLFSPointer(t *testing.T) {
+	oid := strings.Repeat("a", 64)
+	tests := []struct {
+		name    string
+		content string
+		want    lfsPointer
+		wantOk  bool
+	}{
+		{
+			name:    "Pointer",
+			content: lfsPointerVersion + "\noid sha256:" + oid + "\nsize 12345\n",
+			want:    lfsPointer{oid: oid, size: 12345},
+			wantOk:  true,
+		},
+		{
+			name:    "CRLF",
+			content: lfsPointerVersion + "\r\noid sha256:" + oid + "\r\nsize 1\r\n",
+			want:    lfsPointer{oid: oid, size: 1},
+			wantOk:  true,
+		},
+		{
+			name:    "NotAPointer",
+			content: "package main\n",
+		},
+		{
+			name:    "InvalidOid",
+			content: lfsPointerVersion + "\noid sha256:abc\nsize 1\n",
+		},
+		{
+			name:    "PathTraversalOid",
+			content: lfsPointerVersion + "\noid sha256:" + strings.Repeat("/", 38) + "../../../../..//etc/passwd" + "\nsize 1\n",
+		},
+		{
+			name:    "UppercaseOid",
+			content: lfsPointerVersion + "\noid sha256:" + strings.Repeat("A", 64) + "\nsize 1\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseLFSPointer([]byte(tt.content))
+			if ok != tt.wantOk {
+				t.Fatalf("unexpected result got=%v want=%v", ok, tt.wantOk)
+			}
+			if ok && got != tt.want {
+				t.Errorf("unexpected pointer got=%+v want=%+v", got, tt.want)
+			}
+		})
+	}
+}
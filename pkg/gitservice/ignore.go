@@ -0,0 +1,85 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package gitservice
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+const gitignoreFile = ".gitignore"
+
+// ignoreMatcher applies the .gitignore files found in a directory while
+// walking it, even when it isn't a git repository, and the extra exclude
+// patterns. The directories must be walked top-down.
+type ignoreMatcher struct {
+	root     string
+	patterns []gitignore.Pattern
+	excludes []gitignore.Pattern
+	loaded   map[string]bool
+	// matcher matches the patterns loaded and the excludes, it's built
+	// again when a .gitignore file with patterns is loaded.
+	matcher gitignore.Matcher
+}
+
+// newIgnoreMatcher returns a matcher for the root directory. The exclude
+// patterns follow the .gitignore syntax and are relative to the root.
+func newIgnoreMatcher(root string, excludes []string) *ignoreMatcher {
+	m := &ignoreMatcher{
+		root:   root,
+		loaded: map[string]bool{},
+	}
+	for _, e := range excludes {
+		if e = strings.TrimSpace(e); e != "" && !strings.HasPrefix(e, "#") {
+			m.excludes = append(m.excludes, gitignore.ParsePattern(e, nil))
+		}
+	}
+	m.matcher = gitignore.NewMatcher(m.excludes)
+	return m
+}
+
+// Match returns true if the path must be ignored.
+func (m *ignoreMatcher) Match(path string, isDir bool) bool {
+	rel, err := filepath.Rel(m.root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range parts {
+		m.load(parts[:i])
+	}
+	return m.matcher.Match(parts, isDir)
+}
+
+// load reads the .gitignore file of the directory, if not already read.
+func (m *ignoreMatcher) load(dir []string) {
+	key := strings.Join(dir, "/")
+	if m.loaded[key] {
+		return
+	}
+	m.loaded[key] = true
+	content, err := os.ReadFile(filepath.Join(append(append([]string{m.root}, dir...), gitignoreFile)...))
+	if err != nil {
+		return
+	}
+	domain := append([]string{}, dir...)
+	n := len(m.patterns)
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m.patterns = append(m.patterns, gitignore.ParsePattern(line, domain))
+	}
+	if len(m.patterns) == n {
+		return
+	}
+	// The exclude patterns have the highest priority.
+	ps := append(append([]gitignore.Pattern{}, m.patterns...), m.excludes...)
+	m.matcher = gitignore.NewMatcher(ps)
+}
@@ -0,0 +1,257 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package gitservice
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// lfsPointerVersion is the first line of the git LFS pointer files.
+	lfsPointerVersion = "version https://git-lfs.github.com/spec/v1"
+	// lfsMaxPointerSize is the size of the biggest valid pointer file.
+	lfsMaxPointerSize = 1024
+)
+
+// lfsOidR matches the oids of the git LFS objects, the sha256 of their
+// content. They are used to build the paths of the objects in the store.
+var lfsOidR = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// noLFSFilter are the git options disabling the git LFS filters, so the
+// pointer files are checked out and committed as they are, even if git-lfs
+// is installed. The pointers are replaced with replaceLFSPointers.
+var noLFSFilter = []string{
+	"-c", "filter.lfs.smudge=",
+	"-c", "filter.lfs.clean=",
+	"-c", "filter.lfs.process=",
+	"-c", "filter.lfs.required=false",
+}
+
+// lfsPointer is the content of a git LFS pointer file.
+type lfsPointer struct {
+	oid  string
+	size int64
+}
+
+// parseLFSPointer parses the content of a git LFS pointer file, returning
+// false if it's not a pointer.
+func parseLFSPointer(content []byte) (lfsPointer, bool) {
+	var p lfsPointer
+	if len(content) > lfsMaxPointerSize {
+		return p, false
+	}
+	s := bufio.NewScanner(bytes.NewReader(content))
+	first := true
+	for s.Scan() {
+		line := strings.TrimSuffix(s.Text(), "\r")
+		if first {
+			if line != lfsPointerVersion {
+				return p, false
+			}
+			first = false
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "oid":
+			oid := strings.TrimPrefix(value, "sha256:")
+			if oid == value || !lfsOidR.MatchString(oid) {
+				return p, false
+			}
+			p.oid = oid
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return p, false
+			}
+			p.size = size
+		}
+	}
+	return p, p.oid != ""
+}
+
+// lfsFiles returns the files tracked by the repository in path with the
+// git LFS filter in its attributes, relative to the path.
+func (gs *gitService) lfsFiles(path string) []string {
+	out, err := gs.gitCommand(path, "ls-files", "-z", "--", ":(attr:filter=lfs)").Output()
+	if err != nil {
+		return nil
+	}
+	files := []string{}
+	for _, f := range strings.Split(string(out), "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// lfsObjectsDir returns the directory where the repository in path stores
+// its git LFS objects.
+func (gs *gitService) lfsObjectsDir(path string) string {
+	out, err := gs.gitCommand(path, "rev-parse", "--git-common-dir").Output()
+	if err != nil {
+		return ""
+	}
+	dir := gitPath(string(out))
+	if !filepath.IsAbs(dir) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(abs, dir)
+	}
+	return filepath.Join(dir, "lfs", "objects")
+}
+
+// replaceLFSPointers replaces the pointer files of the files, relative to
+// dest, with the content of their objects in the stores, the lfs/objects
+// directories of the repositories. It returns the files replaced and the ones
+// whose objects are not in the stores. The objects bigger than LFSMaxSize are
+// left as pointers.
+func (gs *gitService) replaceLFSPointers(dest string, files, stores []string) (replaced, missing []string, err error) {
+	for _, f := range files {
+		target := filepath.Join(dest, filepath.FromSlash(f))
+		info, err := os.Lstat(target)
+		if err != nil || !info.Mode().IsRegular() || info.Size() > lfsMaxPointerSize {
+			// Not copied to the snapshot or already smudged.
+			continue
+		}
+		content, err := os.ReadFile(target)
+		if err != nil {
+			return nil, nil, err
+		}
+		p, ok := parseLFSPointer(content)
+		if !ok {
+			continue
+		}
+		if gs.cfg.LFSMaxSize > 0 && p.size > gs.cfg.LFSMaxSize {
+			gs.log.Infof("Serving the LFS pointer of %s, the object is bigger than the limit size=%d", f, p.size)
+			continue
+		}
+		object := ""
+		for _, s := range stores {
+			candidate := filepath.Join(s, p.oid[0:2], p.oid[2:4], p.oid)
+			if _, err := os.Stat(candidate); err == nil {
+				object = candidate
+				break
+			}
+		}
+		if object == "" {
+			missing = append(missing, f)
+			continue
+		}
+		data, err := os.ReadFile(object)
+		if err != nil {
+			return nil, nil, err
+		}
+		// The pointer is removed before writing the object, as it can be a
+		// hard link to the file of the directory.
+		if err := os.Remove(target); err != nil {
+			return nil, nil, err
+		}
+		if err := os.WriteFile(target, data, info.Mode().Perm()); err != nil {
+			return nil, nil, err
+		}
+		replaced = append(replaced, f)
+	}
+	return replaced, missing, nil
+}
+
+// includeLFS replaces the LFS pointers in the snapshot in dest of the
+// directory in path with the objects stored in its repository.
+func (gs *gitService) includeLFS(path, dest string) error {
+	if gs.cfg.SkipLFS {
+		return nil
+	}
+	files := gs.lfsFiles(path)
+	if len(files) == 0 {
+		return nil
+	}
+	replaced, missing, err := gs.replaceLFSPointers(dest, files, []string{gs.lfsObjectsDir(path)})
+	if err != nil {
+		return fmt.Errorf("unable to include the LFS objects of %s: %w", path, err)
+	}
+	gs.logLFS(path, replaced, missing)
+	return nil
+}
+
+// includeRefLFS replaces the LFS pointers checked out in the repository in
+// dest with the objects stored in the repositories of the stores, or fetched
+// with fetch if not nil, and commits the result.
+func (gs *gitService) includeRefLFS(path, dest string, stores []string, fetch func(files []string) error) error {
+	if gs.cfg.SkipLFS {
+		return nil
+	}
+	files := gs.lfsFiles(dest)
+	if len(files) == 0 {
+		return nil
+	}
+	replaced, missing, err := gs.replaceLFSPointers(dest, files, stores)
+	if err != nil {
+		return fmt.Errorf("unable to include the LFS objects of %s: %w", path, err)
+	}
+	if len(missing) > 0 && fetch != nil {
+		if err := fetch(missing); err != nil {
+			gs.log.Infof("Unable to fetch the LFS objects of %s: %v", path, err)
+		} else {
+			var fetched []string
+			fetched, missing, err = gs.replaceLFSPointers(dest, missing, []string{gs.lfsObjectsDir(dest)})
+			if err != nil {
+				return fmt.Errorf("unable to include the LFS objects of %s: %w", path, err)
+			}
+			replaced = append(replaced, fetched...)
+		}
+	}
+	gs.logLFS(path, replaced, missing)
+	if len(replaced) == 0 {
+		return nil
+	}
+	cmds := [][]string{
+		{"add", "-A", "-f", "."},
+		{"-c", "user.name=vulcan", "-c", "user.email=vulcan@adevinta.com", "commit", "-q", "--no-verify", "-m", "Include LFS objects"},
+	}
+	for _, args := range cmds {
+		var cmdErr bytes.Buffer
+		cmd := gs.gitCommand(dest, args...)
+		cmd.Stderr = &cmdErr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("unable to include the LFS objects of %s: %w %s", path, err, cmdErr.String())
+		}
+	}
+	return nil
+}
+
+func (gs *gitService) logLFS(path string, replaced, missing []string) {
+	if len(replaced) > 0 {
+		gs.log.Debugf("Included the LFS objects of %s files=%v", path, replaced)
+	}
+	if len(missing) > 0 {
+		gs.log.Infof("Serving the LFS pointers of %d files of %s, the objects are not available locally (run git lfs fetch): %v", len(missing), path, missing)
+	}
+}
+
+// lfsFetch fetches with git-lfs into the repository in dest the objects of
+// the files of the branch of the remote repository.
+func (gs *gitService) lfsFetch(remote, branch, dest string, files []string) error {
+	if err := gs.gitCommand(dest, "lfs", "version").Run(); err != nil {
+		return fmt.Errorf("git-lfs is not installed")
+	}
+	var cmdErr bytes.Buffer
+	cmd := gs.gitCommand(dest, "lfs", "fetch", "--include", strings.Join(files, ","), remote, branch)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	cmd.Stderr = &cmdErr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w %s", err, cmdErr.String())
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package gitservice
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// goos allows to test the behaviour of the other operating systems.
+var goos = runtime.GOOS
+
+// GitCommand returns the command running the git binary, git if empty,
+// with the args in the directory. The directory is passed to -C as an
+// absolute path with the native separators, so relative and slash separated
+// paths in the config behave the same in Windows. The git LFS filters are
+// disabled.
+func GitCommand(bin, dir string, args ...string) *exec.Cmd {
+	if bin == "" {
+		bin = "git"
+	}
+	if abs, err := filepath.Abs(filepath.FromSlash(dir)); err == nil {
+		dir = abs
+	}
+	gitArgs := append(append([]string{}, noLFSFilter...), "-C", dir)
+	return exec.Command(bin, append(gitArgs, args...)...)
+}
+
+// gitCommand returns the command running the git binary of the config with
+// the args in the directory, see GitCommand.
+func (gs *gitService) gitCommand(dir string, args ...string) *exec.Cmd {
+	return GitCommand(gs.cfg.GitBin, dir, args...)
+}
+
+// gitPath converts a path printed by git, slash separated even in Windows, to
+// a native path.
+func gitPath(p string) string {
+	return filepath.Clean(filepath.FromSlash(strings.TrimSpace(p)))
+}
+
+// pathKey returns the key of the file in the maps of paths. The file systems
+// of Windows are case insensitive and git can report the drive letter with a
+// different case, so the keys are lower cased there.
+func pathKey(p string) string {
+	p = filepath.Clean(filepath.FromSlash(p))
+	if goos == "windows" {
+		p = strings.ToLower(p)
+	}
+	return p
+}
+
+// samePath returns true if both paths refer to the same file following the
+// rules of pathKey.
+func samePath(a, b string) bool {
+	return pathKey(a) == pathKey(b)
+}
+
+// removeAll removes the directory like os.RemoveAll. Windows doesn't allow
+// to remove read-only files, like the objects created by git and the copies
+// of read-only files in the snapshots, so if the removal fails the files are
+// made writable and it's retried.
+func removeAll(dir string) error {
+	if err := os.RemoveAll(dir); err == nil {
+		return nil
+	}
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		mode := fs.FileMode(0o666)
+		if d.IsDir() {
+			mode = 0o777
+		}
+		os.Chmod(p, mode)
+		return nil
+	})
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package gitservice
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// remotePrefix is the prefix of the targets that are remote repositories
+// cloned by vulcan-local, instead of by the checks, i.e.
+// git+https://github.com/adevinta/vulcan-local.git#main.
+const remotePrefix = "git+"
+
+// remoteSchemes are the schemes of the remote repositories.
+var remoteSchemes = map[string]bool{
+	"http":  true,
+	"https": true,
+	"ssh":   true,
+	"file":  true,
+}
+
+// ParseRemote returns the url and the ref, in the fragment, of a remote
+// repository target. It returns false if the target is not a remote
+// repository.
+func ParseRemote(target string) (string, string, bool) {
+	if !strings.HasPrefix(target, remotePrefix) {
+		return "", "", false
+	}
+	u, err := url.Parse(strings.TrimPrefix(target, remotePrefix))
+	if err != nil || !remoteSchemes[u.Scheme] || (u.Host == "" && u.Scheme != "file") {
+		return "", "", false
+	}
+	ref := u.Fragment
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String(), ref, true
+}
+
+// isBareRepository returns true if the path is the directory of a bare
+// repository.
+func (gs *gitService) isBareRepository(path string) bool {
+	out, err := gs.gitCommand(path, "rev-parse", "--is-bare-repository", "--absolute-git-dir").Output()
+	if err != nil {
+		return false
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 2 || lines[0] != "true" {
+		return false
+	}
+	gitDir, err := filepath.EvalSymlinks(gitPath(lines[1]))
+	if err != nil {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	abs, err = filepath.EvalSymlinks(abs)
+	if err != nil {
+		return false
+	}
+	return samePath(gitDir, abs)
+}
+
+// headBranch returns the branch of the HEAD of the repository in path, or
+// HEAD if it's detached.
+func (gs *gitService) headBranch(path string) string {
+	out, err := gs.gitCommand(path, "symbolic-ref", "--short", "-q", "HEAD").Output()
+	if err != nil || strings.TrimSpace(string(out)) == "" {
+		return "HEAD"
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// fetchRemote creates a repository in dest with a shallow clone of the ref
+// of the remote repository, its default branch if empty. As in fetchRef, if
+// the ref is a branch the served repository uses the same branch name, if
+// not it uses master.
+func (gs *gitService) fetchRemote(remote, ref, dest string) error {
+	branch := gs.remoteBranch(remote, ref)
+	if ref == "" {
+		ref = "HEAD"
+	}
+	cmds := [][]string{
+		{"init", "-q"},
+		{"symbolic-ref", "HEAD", "refs/heads/" + branch},
+		{"fetch", "-q", "--depth", "1", "--no-tags", remote, ref},
+		{"update-ref", "refs/heads/" + branch, "FETCH_HEAD^{commit}"},
+		{"reset", "-q", "--hard"},
+	}
+	for _, args := range cmds {
+		var cmdErr bytes.Buffer
+		cmd := gs.gitCommand(dest, args...)
+		// The credentials must be available without prompting, i.e. in
+		// a credential helper or an ssh agent.
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+		cmd.Stderr = &cmdErr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("unable to clone ref %s from %s: %w %s", ref, remote, err, cmdErr.String())
+		}
+	}
+	gs.log.Debugf("Cloned %s ref=%s branch=%s into %s", remote, ref, branch, dest)
+	return gs.includeRefLFS(remote, dest, nil, func(files []string) error {
+		return gs.lfsFetch(remote, branch, dest, files)
+	})
+}
+
+// remoteBranch returns the name of the branch of the ref in the remote
+// repository, master if it's not a branch.
+func (gs *gitService) remoteBranch(remote, ref string) string {
+	args := []string{"ls-remote", "--symref", remote, "HEAD"}
+	if ref != "" {
+		args = []string{"ls-remote", "--heads", remote, "refs/heads/" + ref}
+	}
+	cmd := gs.gitCommand(".", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	out, err := cmd.Output()
+	if err != nil {
+		return "master"
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if ref == "" {
+			// ref: refs/heads/main	HEAD
+			if strings.HasPrefix(line, "ref: refs/heads/") {
+				branch, _, _ := strings.Cut(strings.TrimPrefix(line, "ref: refs/heads/"), "\t")
+				return branch
+			}
+			continue
+		}
+		if strings.HasSuffix(line, "\trefs/heads/"+ref) {
+			return ref
+		}
+	}
+	return "master"
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package gitservice
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/otiai10/copy"
+)
+
+const (
+	// SnapshotCopy copies the files of the directory to the snapshot.
+	SnapshotCopy = "copy"
+	// SnapshotHardlink creates hard links to the files of the directory,
+	// copying the ones in a different filesystem than the snapshot.
+	SnapshotHardlink = "hardlink"
+)
+
+// SnapshotStrategies returns the supported snapshot strategies.
+func SnapshotStrategies() []string {
+	return []string{SnapshotCopy, SnapshotHardlink}
+}
+
+// skipFunc returns true if the file must not be included in the snapshot.
+type skipFunc func(info fs.FileInfo, src string) bool
+
+// snapshot writes to dest the files of the path not skipped using the
+// strategy.
+func snapshot(strategy, path, dest string, skip skipFunc) error {
+	switch strategy {
+	case "", SnapshotCopy:
+		return copy.Copy(path, dest, copy.Options{Skip: func(srcinfo fs.FileInfo, src string, _ string) (bool, error) {
+			return skip(srcinfo, src), nil
+		}})
+	case SnapshotHardlink:
+		return linkTree(path, dest, skip)
+	default:
+		return fmt.Errorf("unknown snapshot strategy %s", strategy)
+	}
+}
+
+// linkTree recreates the directories of the path in dest and links the files.
+func linkTree(path, dest string, skip skipFunc) error {
+	return filepath.Walk(path, func(src string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, src)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		if rel != "." && skip(info, src) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0o700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(src)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			// Windows doesn't allow to remove the links to read-only files
+			// without making writable the original, so they are copied.
+			if goos == "windows" && info.Mode().Perm()&0o200 == 0 {
+				return copy.Copy(src, target)
+			}
+			if err := os.Link(src, target); err == nil {
+				return nil
+			}
+			// Different filesystems or links not supported.
+			return copy.Copy(src, target)
+		}
+		// Ignore sockets, devices and pipes.
+		return nil
+	})
+}
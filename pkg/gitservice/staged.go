@@ -0,0 +1,87 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package gitservice
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// StagedRef is the ref that serves the content of the files staged in the
+// index of the repository, instead of the working tree or a commit. It's not
+// a valid git ref name so it doesn't collide with the refs of the repository.
+const StagedRef = ":staged"
+
+// StagedFiles returns the files of the directory added or modified in the
+// index of its repository, using the git binary bin. The paths are relative
+// to the directory.
+func StagedFiles(bin, path string) ([]string, error) {
+	var out, cmdErr bytes.Buffer
+	cmd := GitCommand(bin, path, "diff", "--cached", "--name-only", "--relative",
+		"--diff-filter=d", "--ignore-submodules", "-z", "--", ".")
+	cmd.Stdout = &out
+	cmd.Stderr = &cmdErr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("unable to get the staged files in %s: %w %s", path, err, cmdErr.String())
+	}
+	files := []string{}
+	for _, f := range strings.Split(out.String(), "\x00") {
+		if f != "" {
+			files = append(files, filepath.ToSlash(f))
+		}
+	}
+	return files, nil
+}
+
+// createStagedRepository creates in dest a repository with the staged
+// content of the files staged in the path.
+func (gs *gitService) createStagedRepository(path, dest string) error {
+	files, err := StagedFiles(gs.cfg.GitBin, path)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		var content, cmdErr bytes.Buffer
+		cmd := gs.gitCommand(path, "show", ":./"+f)
+		cmd.Stdout = &content
+		cmd.Stderr = &cmdErr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("unable to read the staged file %s in %s: %w %s", f, path, err, cmdErr.String())
+		}
+		target := filepath.Join(dest, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, content.Bytes(), 0o644); err != nil {
+			return err
+		}
+	}
+	gs.log.Debugf("Copied the staged files of %s to %s files=%v", path, dest, files)
+	if err := gs.includeLFS(path, dest); err != nil {
+		return err
+	}
+	r, err := git.PlainInit(dest, false)
+	if err != nil {
+		return err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	w.AddGlob(".")
+	_, err = w.Commit("", &git.CommitOptions{
+		Author: &object.Signature{
+			Name:  "vulcan",
+			Email: "vulcan@adevinta.com",
+		},
+	})
+	return err
+}
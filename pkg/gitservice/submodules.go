@@ -0,0 +1,190 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package gitservice
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const gitmodulesFile = ".gitmodules"
+
+// submodules returns the paths, relative to the path, of the initialized
+// submodules, including the nested ones.
+func (gs *gitService) submodules(path string) []string {
+	out, err := gs.gitCommand(path, "submodule", "status", "--recursive").Output()
+	if err != nil {
+		return nil
+	}
+	paths := []string{}
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		line := s.Text()
+		// Uninitialized submodules are prefixed with "-".
+		if line == "" || line[0] == '-' {
+			continue
+		}
+		fields := strings.Fields(line[1:])
+		if len(fields) < 2 {
+			continue
+		}
+		paths = append(paths, filepath.FromSlash(fields[1]))
+	}
+	return paths
+}
+
+// gitIgnored adds to ignore the files and directories ignored by git in the
+// path, if it's part of a git repository.
+func (gs *gitService) gitIgnored(path string, ignore map[string]bool) {
+	var cmdOut, cmdErr bytes.Buffer
+	cmd := gs.gitCommand(path, "ls-files", "--exclude-standard", "-oi", "--directory")
+	cmd.Stdout = &cmdOut
+	cmd.Stderr = &cmdErr
+	if err := cmd.Run(); err != nil {
+		// The path is not part of a git repo... it's ok
+		gs.log.Debugf("find .gitignored files error: %s.", cmdErr.String())
+		return
+	}
+	for _, f := range strings.Split(cmdOut.String(), "\n") {
+		f = strings.TrimSuffix(f, "\r")
+		if f == "" {
+			continue
+		}
+		f = strings.TrimSuffix(f, "/") // store directories without trailing slash
+		ignore[pathKey(filepath.Join(path, filepath.FromSlash(f)))] = true
+	}
+}
+
+// vendorSubmodules replaces the submodules of the commit of the repository in
+// path with their content, extracted to dest from the initialized submodules
+// of the path, and commits the result in dest.
+func (gs *gitService) vendorSubmodules(path, commit, dest string) error {
+	vendored, err := gs.extractSubmodules(path, commit, dest)
+	if err != nil {
+		return err
+	}
+	if len(vendored) == 0 {
+		return nil
+	}
+	cmds := [][]string{
+		append([]string{"rm", "-q", "--cached", "--"}, vendored...),
+		{"rm", "-q", "--cached", "--ignore-unmatch", gitmodulesFile},
+		{"add", "-A", "-f", "."},
+		{"-c", "user.name=vulcan", "-c", "user.email=vulcan@adevinta.com", "commit", "-q", "--no-verify", "-m", "Vendor submodules"},
+	}
+	os.Remove(filepath.Join(dest, gitmodulesFile))
+	for _, args := range cmds {
+		var cmdErr bytes.Buffer
+		cmd := gs.gitCommand(dest, args...)
+		cmd.Stderr = &cmdErr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("unable to vendor submodules of %s: %w %s", path, err, cmdErr.String())
+		}
+	}
+	gs.log.Debugf("Vendored submodules %v of %s", vendored, path)
+	return nil
+}
+
+// extractSubmodules extracts to dest the content of the submodules of the
+// commit and returns their paths, relative to dest.
+func (gs *gitService) extractSubmodules(path, commit, dest string) ([]string, error) {
+	out, err := gs.gitCommand(path, "ls-tree", "-r", "-z", commit).Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the tree of %s: %w", path, err)
+	}
+	vendored := []string{}
+	for _, entry := range strings.Split(string(out), "\x00") {
+		// <mode> SP <type> SP <object> TAB <file>
+		meta, file, ok := strings.Cut(entry, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 3 || fields[1] != "commit" {
+			continue
+		}
+		src := filepath.Join(path, filepath.FromSlash(file))
+		if _, err := os.Stat(filepath.Join(src, ".git")); err != nil {
+			gs.log.Infof("Submodule %s of %s is not initialized, ignoring it", file, path)
+			continue
+		}
+		subDest := filepath.Join(dest, filepath.FromSlash(file))
+		if err := gs.archive(src, fields[2], subDest); err != nil {
+			return nil, err
+		}
+		if _, err := gs.extractSubmodules(src, fields[2], subDest); err != nil {
+			return nil, err
+		}
+		vendored = append(vendored, file)
+	}
+	return vendored, nil
+}
+
+// archive extracts to dest the files of the commit of the repository in path.
+func (gs *gitService) archive(path, commit, dest string) error {
+	var cmdErr bytes.Buffer
+	cmd := gs.gitCommand(path, "archive", "--format=tar", commit)
+	cmd.Stderr = &cmdErr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	extractErr := untar(out, dest)
+	io.Copy(io.Discard, out)
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("unable to archive commit %s of %s: %w %s", commit, path, err, cmdErr.String())
+	}
+	return extractErr
+}
+
+func untar(r io.Reader, dest string) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, filepath.FromSlash(h.Name))
+		if rel, err := filepath.Rel(dest, target); err != nil || strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("invalid path in archive %s", h.Name)
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := os.Symlink(h.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(h.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
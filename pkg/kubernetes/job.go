@@ -0,0 +1,122 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package kubernetes
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/adevinta/vulcan-agent/backend"
+	"github.com/adevinta/vulcan-agent/backend/docker"
+)
+
+// The types below are the subset of the batch/v1 Job API used by the checks.
+
+type job struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   objectMeta `json:"metadata"`
+	Spec       jobSpec    `json:"spec"`
+}
+
+type objectMeta struct {
+	Name   string            `json:"name,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type jobSpec struct {
+	BackoffLimit int         `json:"backoffLimit"`
+	Template     podTemplate `json:"template"`
+}
+
+type podTemplate struct {
+	Metadata objectMeta `json:"metadata"`
+	Spec     podSpec    `json:"spec"`
+}
+
+type podSpec struct {
+	RestartPolicy      string            `json:"restartPolicy"`
+	ServiceAccountName string            `json:"serviceAccountName,omitempty"`
+	ImagePullSecrets   []localObjectRef  `json:"imagePullSecrets,omitempty"`
+	NodeSelector       map[string]string `json:"nodeSelector,omitempty"`
+	Containers         []podContainer    `json:"containers"`
+}
+
+type localObjectRef struct {
+	Name string `json:"name"`
+}
+
+type podContainer struct {
+	Name            string    `json:"name"`
+	Image           string    `json:"image"`
+	ImagePullPolicy string    `json:"imagePullPolicy,omitempty"`
+	Env             []envVar  `json:"env,omitempty"`
+	Resources       resources `json:"resources,omitempty"`
+}
+
+type envVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type resources struct {
+	Limits map[string]string `json:"limits,omitempty"`
+}
+
+// job returns the Job running the check with the container config.
+func (b *Backend) job(name string, params backend.RunParams, rc docker.RunConfig) job {
+	labels := map[string]string{}
+	for k, v := range b.cfg.Labels {
+		labels[k] = v
+	}
+	labels[managedByLabel] = "vulcan-local"
+	labels[checkIDLabel] = params.CheckID
+
+	c := podContainer{
+		Name:            "check",
+		Image:           rc.ContainerConfig.Image,
+		ImagePullPolicy: b.pullPolicy,
+	}
+	for _, e := range rc.ContainerConfig.Env {
+		k, v, _ := strings.Cut(e, "=")
+		c.Env = append(c.Env, envVar{Name: k, Value: v})
+	}
+	limits := map[string]string{}
+	if cpus := rc.HostConfig.Resources.NanoCPUs; cpus > 0 {
+		limits["cpu"] = strconv.FormatInt(cpus/1e6, 10) + "m"
+	}
+	if memory := rc.HostConfig.Resources.Memory; memory > 0 {
+		limits["memory"] = strconv.FormatInt(memory, 10)
+	}
+	if len(limits) > 0 {
+		c.Resources.Limits = limits
+	}
+	if len(rc.HostConfig.Binds) > 0 {
+		b.log.Debugf("Ignoring the binds of the check %s not supported in kubernetes binds=%v", params.CheckID, rc.HostConfig.Binds)
+	}
+
+	spec := podSpec{
+		RestartPolicy:      "Never",
+		ServiceAccountName: b.cfg.ServiceAccount,
+		NodeSelector:       b.cfg.NodeSelector,
+		Containers:         []podContainer{c},
+	}
+	for _, s := range b.cfg.ImagePullSecrets {
+		spec.ImagePullSecrets = append(spec.ImagePullSecrets, localObjectRef{Name: s})
+	}
+	return job{
+		APIVersion: "batch/v1",
+		Kind:       "Job",
+		Metadata:   objectMeta{Name: name, Labels: labels},
+		Spec: jobSpec{
+			// The retries are done by vulcan-local.
+			BackoffLimit: 0,
+			Template: podTemplate{
+				Metadata: objectMeta{Labels: labels},
+				Spec:     spec,
+			},
+		},
+	}
+}
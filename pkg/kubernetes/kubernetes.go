@@ -0,0 +1,275 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+// Package kubernetes implements an agent backend running the checks as
+// Kubernetes Jobs through kubectl, so vulcan-local can run in a cluster
+// without a docker daemon.
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adevinta/vulcan-agent/backend"
+	"github.com/adevinta/vulcan-agent/backend/docker"
+	agentconfig "github.com/adevinta/vulcan-agent/config"
+	"github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/docker/docker/api/types/container"
+)
+
+const (
+	// Runtime is the name of the runtime running the checks in Kubernetes.
+	Runtime = "kubernetes"
+
+	// checkIDLabel is the label of the Jobs with the id of their check.
+	checkIDLabel = "vulcan-local/check-id"
+	// managedByLabel identifies the Jobs created by vulcan-local.
+	managedByLabel = "app.kubernetes.io/managed-by"
+)
+
+var (
+	// pollInterval is the interval between the queries of the state of the
+	// Jobs.
+	pollInterval = 2 * time.Second
+
+	// execCommand allows to replace the kubectl commands in the tests.
+	execCommand = exec.CommandContext
+
+	// imagePullErrors are the reasons of the containers waiting for an image
+	// that can't be pulled.
+	imagePullErrors = map[string]bool{
+		"ErrImagePull":      true,
+		"ImagePullBackOff":  true,
+		"InvalidImageName":  true,
+		"ErrImageNeverPull": true,
+	}
+)
+
+// Backend runs the checks as Kubernetes Jobs. The checks send their results
+// to the agent, so it must be reachable from the pods.
+type Backend struct {
+	cfg        config.Kubernetes
+	agentAddr  string
+	vars       backend.CheckVars
+	pullPolicy string
+	updater    docker.ConfigUpdater
+	log        log.Logger
+}
+
+// New returns a Backend creating the Jobs with the agent config. The updater
+// modifies the config of the check containers, as in the docker backend, but
+// only the env vars and the resources are applied to the Jobs.
+func New(l log.Logger, cfg config.Kubernetes, agentCfg agentconfig.Config, updater docker.ConfigUpdater) *Backend {
+	if cfg.Bin == "" {
+		cfg.Bin = "kubectl"
+	}
+	pullPolicy, _ := agentCfg.Runtime.Docker.Registry.PullPolicy.String()
+	return &Backend{
+		cfg:        cfg,
+		agentAddr:  agentCfg.API.Host + agentCfg.API.Port,
+		vars:       agentCfg.Check.Vars,
+		pullPolicy: pullPolicy,
+		updater:    updater,
+		log:        l,
+	}
+}
+
+// CheckAccess returns an error if the Jobs can't be created in the cluster.
+func (b *Backend) CheckAccess(ctx context.Context) error {
+	out, err := b.kubectl(ctx, nil, "auth", "can-i", "create", "jobs.batch")
+	if err != nil {
+		return fmt.Errorf("unable to create jobs in the cluster: %w", err)
+	}
+	if strings.TrimSpace(string(out)) != "yes" {
+		return fmt.Errorf("unable to create jobs in the cluster: %s", out)
+	}
+	return nil
+}
+
+// Run creates the Job of the check and waits for it to finish, returning the
+// logs of its pod. The Job is deleted when it finishes or the context is
+// done.
+func (b *Backend) Run(ctx context.Context, params backend.RunParams) (<-chan backend.RunResult, error) {
+	rc := b.runConfig(params)
+	if b.updater != nil {
+		if err := b.updater(params, &rc); err != nil {
+			return nil, err
+		}
+	}
+	name, err := jobName(params.CheckID)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := json.Marshal(b.job(name, params, rc))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := b.kubectl(ctx, manifest, "create", "-f", "-"); err != nil {
+		return nil, fmt.Errorf("unable to create the job of the check %s: %w", params.CheckID, err)
+	}
+	b.log.Debugf("Created job %s for the check %s", name, params.CheckID)
+	res := make(chan backend.RunResult, 1)
+	go func() {
+		defer b.delete(name)
+		res <- b.wait(ctx, name)
+	}()
+	return res, nil
+}
+
+// runConfig returns the config of the check container, with the same env
+// vars as the docker backend.
+func (b *Backend) runConfig(params backend.RunParams) docker.RunConfig {
+	env := []string{
+		fmt.Sprintf("%s=%s", backend.CheckIDVar, params.CheckID),
+		fmt.Sprintf("%s=%s", backend.ChecktypeNameVar, params.CheckTypeName),
+		fmt.Sprintf("%s=%s", backend.ChecktypeVersionVar, params.ChecktypeVersion),
+		fmt.Sprintf("%s=%s", backend.CheckTargetVar, params.Target),
+		fmt.Sprintf("%s=%s", backend.CheckAssetTypeVar, params.AssetType),
+		fmt.Sprintf("%s=%s", backend.CheckOptionsVar, params.Options),
+		fmt.Sprintf("%s=%s", backend.AgentAddressVar, b.agentAddr),
+	}
+	for _, v := range params.RequiredVars {
+		env = append(env, fmt.Sprintf("%s=%s", v, b.vars[v]))
+	}
+	return docker.RunConfig{
+		ContainerConfig: &container.Config{
+			Image: params.Image,
+			Env:   env,
+		},
+		HostConfig: &container.HostConfig{},
+	}
+}
+
+// wait polls the state of the Job until it finishes, its image can't be
+// pulled or the context is done.
+func (b *Backend) wait(ctx context.Context, name string) backend.RunResult {
+	for {
+		status, err := b.status(ctx, name)
+		if err == nil {
+			switch {
+			case status.Succeeded > 0:
+				return backend.RunResult{Output: b.logs(name)}
+			case status.Failed > 0:
+				return backend.RunResult{Output: b.logs(name), Error: fmt.Errorf("%w job: %s", backend.ErrNonZeroExitCode, name)}
+			case status.PullError != "":
+				return backend.RunResult{Error: fmt.Errorf("unable to pull the image of the job %s: %s", name, status.PullError)}
+			}
+		} else if ctx.Err() == nil {
+			b.log.Errorf("Unable to get the status of the job %s: %v", name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return backend.RunResult{Output: b.logs(name), Error: ctx.Err()}
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// jobStatus is the state of a Job and its pod.
+type jobStatus struct {
+	Succeeded int
+	Failed    int
+	// PullError is the reason of the pod waiting for an image that can't
+	// be pulled.
+	PullError string
+}
+
+func (b *Backend) status(ctx context.Context, name string) (jobStatus, error) {
+	out, err := b.kubectl(ctx, nil, "get", "job", name, "-o", "jsonpath={.status.succeeded},{.status.failed}")
+	if err != nil {
+		return jobStatus{}, err
+	}
+	var s jobStatus
+	counts := strings.SplitN(strings.TrimSpace(string(out)), ",", 2)
+	s.Succeeded, _ = strconv.Atoi(counts[0])
+	if len(counts) > 1 {
+		s.Failed, _ = strconv.Atoi(counts[1])
+	}
+	if s.Succeeded > 0 || s.Failed > 0 {
+		return s, nil
+	}
+	out, err = b.kubectl(ctx, nil, "get", "pods", "-l", "job-name="+name,
+		"-o", "jsonpath={.items[*].status.containerStatuses[*].state.waiting.reason}")
+	if err != nil {
+		return jobStatus{}, err
+	}
+	for _, reason := range strings.Fields(string(out)) {
+		if imagePullErrors[reason] {
+			s.PullError = reason
+		}
+	}
+	return s, nil
+}
+
+// logs returns the logs of the pod of the Job.
+func (b *Backend) logs(name string) []byte {
+	out, err := b.kubectl(context.Background(), nil, "logs", "job/"+name, "--all-containers", "--tail=-1")
+	if err != nil {
+		b.log.Errorf("Unable to get the logs of the job %s: %v", name, err)
+		return nil
+	}
+	return out
+}
+
+// delete removes the Job and, in background, its pods.
+func (b *Backend) delete(name string) {
+	if _, err := b.kubectl(context.Background(), nil, "delete", "job", name,
+		"--ignore-not-found", "--wait=false", "--cascade=background"); err != nil {
+		b.log.Errorf("Unable to delete the job %s: %v", name, err)
+	}
+}
+
+// kubectl runs kubectl with the global flags of the config and the input in
+// the stdin, returning the stdout.
+func (b *Backend) kubectl(ctx context.Context, input []byte, args ...string) ([]byte, error) {
+	global := []string{}
+	if b.cfg.Kubeconfig != "" {
+		global = append(global, "--kubeconfig", b.cfg.Kubeconfig)
+	}
+	if b.cfg.Context != "" {
+		global = append(global, "--context", b.cfg.Context)
+	}
+	if b.cfg.Namespace != "" {
+		global = append(global, "--namespace", b.cfg.Namespace)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := execCommand(ctx, b.cfg.Bin, append(global, args...)...)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return stdout.Bytes(), fmt.Errorf("%w %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// jobName returns a unique name for a Job of the check, so the retries don't
+// collide with the Jobs being deleted.
+func jobName(checkID string) (string, error) {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	name := "vulcan-" + strings.ToLower(checkID)
+	if len(name) > 49 {
+		name = name[:49]
+	}
+	return strings.TrimRight(name, "-") + "-" + hex.EncodeToString(suffix), nil
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adevinta/vulcan-agent/backend"
+	"github.com/adevinta/vulcan-agent/backend/docker"
+	agentconfig "github.com/adevinta/vulcan-agent/config"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/google/go-cmp/cmp"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	loggerUser *logrus.Logger
+)
+
+func init() {
+	if len(os.Args) > 1 && os.Args[1][:5] == "-test" {
+		loggerUser = logrus.New()
+		loggerUser.SetFormatter(&logrus.TextFormatter{
+			DisableColors:   false,
+			FullTimestamp:   true,
+			TimestampFormat: time.RFC3339,
+			ForceColors:     true,
+		})
+	}
+}
+
+// newExecCase returns a function for creating a command to execute the
+// current test binary as a fake kubectl in the state.
+func newExecCase(state string) func(ctx context.Context, command string, args ...string) *exec.Cmd {
+	return func(ctx context.Context, command string, args ...string) *exec.Cmd {
+		cs := []string{"-test.run=TestHelperProcess", "--", state, command}
+		cs = append(cs, args...)
+		cmd := exec.CommandContext(ctx, os.Args[0], cs...)
+		cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
+		return cmd
+	}
+}
+
+func TestHelperProcess(*testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	defer os.Exit(0)
+
+	args := []string{}
+	for i := range os.Args {
+		if os.Args[i] == "--" {
+			args = os.Args[i+1:]
+			break
+		}
+	}
+	// The arguments are the case, the exec name and the global flags.
+	if len(args) < 5 || args[2] != "--namespace" || args[3] != "vulcan" {
+		fmt.Fprintf(os.Stderr, "unexpected args %v", args)
+		os.Exit(1)
+	}
+	state, args := args[0], args[4:]
+	cmd := args[0]
+	if cmd == "get" {
+		cmd = strings.Join(args[:2], " ")
+	}
+	cases := map[string]map[string]string{
+		"succeeded": {
+			"get job": "1,",
+			"logs":    "check output",
+		},
+		"failed": {
+			"get job": ",1",
+			"logs":    "check failed",
+		},
+		"pull-error": {
+			"get job":  ",",
+			"get pods": "ImagePullBackOff",
+		},
+		"running": {
+			"get job":  ",",
+			"get pods": "ContainerCreating",
+			"logs":     "partial output",
+		},
+	}
+	out, ok := cases[state][cmd]
+	if !ok && cmd != "create" && cmd != "delete" {
+		fmt.Fprintf(os.Stderr, "unexpected command %s", cmd)
+		os.Exit(1)
+	}
+	fmt.Print(out)
+}
+
+func TestRun(t *testing.T) {
+	defer func(d time.Duration) { pollInterval = d }(pollInterval)
+	pollInterval = 10 * time.Millisecond
+	defer func() { execCommand = exec.CommandContext }()
+
+	tests := []struct {
+		state      string
+		timeout    time.Duration
+		wantOutput string
+		wantErr    error
+	}{
+		{state: "succeeded", wantOutput: "check output"},
+		{state: "failed", wantOutput: "check failed", wantErr: backend.ErrNonZeroExitCode},
+		{state: "pull-error", wantErr: errors.New("unable to pull the image")},
+		{state: "running", timeout: 100 * time.Millisecond, wantOutput: "partial output", wantErr: context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.state, func(t *testing.T) {
+			execCommand = newExecCase(tt.state)
+			b := New(loggerUser, config.Kubernetes{Namespace: "vulcan"}, agentconfig.Config{}, nil)
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			res, err := b.Run(ctx, backend.RunParams{CheckID: "ID", Image: "vulcan-nessus:1"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			r := <-res
+			if string(r.Output) != tt.wantOutput {
+				t.Errorf("unexpected output want=%q got=%q", tt.wantOutput, r.Output)
+			}
+			switch {
+			case tt.wantErr == nil && r.Error != nil:
+				t.Errorf("unexpected error: %v", r.Error)
+			case tt.wantErr != nil && r.Error == nil:
+				t.Errorf("expected error %v", tt.wantErr)
+			case tt.wantErr != nil && !errors.Is(r.Error, tt.wantErr) && !strings.Contains(r.Error.Error(), tt.wantErr.Error()):
+				t.Errorf("unexpected error want=%v got=%v", tt.wantErr, r.Error)
+			}
+		})
+	}
+}
+
+func TestJob(t *testing.T) {
+	b := New(loggerUser, config.Kubernetes{
+		ServiceAccount:   "scanner",
+		ImagePullSecrets: []string{"registry"},
+		NodeSelector:     map[string]string{"pool": "scans"},
+		Labels:           map[string]string{"team": "security"},
+	}, agentconfig.Config{
+		API: agentconfig.APIConfig{Host: "10.0.0.1", Port: ":44144"},
+		Check: agentconfig.CheckConfig{
+			Vars: map[string]string{"TOKEN": "secret"},
+		},
+	}, nil)
+	params := backend.RunParams{
+		CheckID:       "ID",
+		CheckTypeName: "vulcan-nessus",
+		Image:         "vulcan-nessus:1",
+		Target:        "example.com",
+		AssetType:     "Hostname",
+		RequiredVars:  []string{"TOKEN"},
+	}
+	rc := b.runConfig(params)
+	rc.HostConfig.Resources.NanoCPUs = 1500000000
+	rc.HostConfig.Resources.Memory = 1 << 30
+	rc.HostConfig.Binds = []string{"/tmp:/tmp"}
+	got := b.job("vulcan-id-abcdef", params, rc)
+
+	labels := map[string]string{
+		"team":         "security",
+		managedByLabel: "vulcan-local",
+		checkIDLabel:   "ID",
+	}
+	want := job{
+		APIVersion: "batch/v1",
+		Kind:       "Job",
+		Metadata:   objectMeta{Name: "vulcan-id-abcdef", Labels: labels},
+		Spec: jobSpec{
+			Template: podTemplate{
+				Metadata: objectMeta{Labels: labels},
+				Spec: podSpec{
+					RestartPolicy:      "Never",
+					ServiceAccountName: "scanner",
+					ImagePullSecrets:   []localObjectRef{{Name: "registry"}},
+					NodeSelector:       map[string]string{"pool": "scans"},
+					Containers: []podContainer{{
+						Name:            "check",
+						Image:           "vulcan-nessus:1",
+						ImagePullPolicy: "IfNotPresent",
+						Env: []envVar{
+							{Name: backend.CheckIDVar, Value: "ID"},
+							{Name: backend.ChecktypeNameVar, Value: "vulcan-nessus"},
+							{Name: backend.ChecktypeVersionVar},
+							{Name: backend.CheckTargetVar, Value: "example.com"},
+							{Name: backend.CheckAssetTypeVar, Value: "Hostname"},
+							{Name: backend.CheckOptionsVar},
+							{Name: backend.AgentAddressVar, Value: "10.0.0.1:44144"},
+							{Name: "TOKEN", Value: "secret"},
+						},
+						Resources: resources{Limits: map[string]string{
+							"cpu":    "1500m",
+							"memory": "1073741824",
+						}},
+					}},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected job (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunUpdater(t *testing.T) {
+	defer func() { execCommand = exec.CommandContext }()
+	execCommand = newExecCase("succeeded")
+	b := New(loggerUser, config.Kubernetes{Namespace: "vulcan"}, agentconfig.Config{}, func(params backend.RunParams, rc *docker.RunConfig) error {
+		return errors.New("updater failed")
+	})
+	if _, err := b.Run(context.Background(), backend.RunParams{CheckID: "ID"}); err == nil || err.Error() != "updater failed" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestJobName(t *testing.T) {
+	valid := regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	for _, id := range []string{
+		"FE3A1D3A-5EC3-4F3A-9F8E-1234567890AB",
+		strings.Repeat("a", 100),
+		strings.Repeat("a", 41) + "-",
+	} {
+		name, err := jobName(id)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(name) > 56 || !valid.MatchString(name) || strings.Contains(name, "--") {
+			t.Errorf("invalid job name %s for the check %s", name, id)
+		}
+	}
+	a, _ := jobName("ID")
+	b, _ := jobName("ID")
+	if a == b {
+		t.Errorf("duplicated job name %s", a)
+	}
+}
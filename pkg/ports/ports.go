@@ -0,0 +1,91 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+// Package ports allocates the ports where the local services reachable by
+// the checks listen.
+package ports
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Range allocates ports in order from a fixed range, so the local services
+// can be allowed in the firewall rules of the machine. A nil Range allocates
+// random ports.
+type Range struct {
+	min, max int
+	next     int
+	mu       sync.Mutex
+}
+
+// ParseRange parses a range of ports in the format min-max (eg 42000-42100).
+// A single port is a range of one port. An empty range returns nil.
+func ParseRange(s string) (*Range, error) {
+	if s == "" {
+		return nil, nil
+	}
+	from, to, found := strings.Cut(s, "-")
+	if !found {
+		to = from
+	}
+	min, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil {
+		return nil, fmt.Errorf("invalid port range %s: %w", s, err)
+	}
+	max, err := strconv.Atoi(strings.TrimSpace(to))
+	if err != nil {
+		return nil, fmt.Errorf("invalid port range %s: %w", s, err)
+	}
+	if min < 1 || max > 65535 || min > max {
+		return nil, fmt.Errorf("invalid port range %s", s)
+	}
+	return &Range{min: min, max: max, next: min}, nil
+}
+
+// String returns the range in the format min-max.
+func (r *Range) String() string {
+	if r == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", r.min, r.max)
+}
+
+// Listen listens in the address host in the next free port of the range.
+// The ports already allocated are not reused, so every service gets a
+// different port even if a previous one was closed.
+func (r *Range) Listen(host string) (net.Listener, error) {
+	if r == nil {
+		return net.Listen("tcp", net.JoinHostPort(host, "0"))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var err error
+	for ; r.next <= r.max; r.next++ {
+		var ln net.Listener
+		ln, err = net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(r.next)))
+		if err == nil {
+			r.next++
+			return ln, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("no free ports in the range %s: %w", r, err)
+	}
+	return nil, fmt.Errorf("no free ports in the range %s", r)
+}
+
+// Port returns the next free port of the range in the address host, for the
+// services that create their own listener.
+func (r *Range) Port(host string) (int, error) {
+	ln, err := r.Listen(host)
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package ports
+
+import (
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    string
+		wantErr bool
+	}{
+		{s: "", want: ""},
+		{s: "42000-42100", want: "42000-42100"},
+		{s: "42000", want: "42000-42000"},
+		{s: " 42000 - 42001", want: "42000-42001"},
+		{s: "42100-42000", wantErr: true},
+		{s: "0-10", wantErr: true},
+		{s: "42000-70000", wantErr: true},
+		{s: "a-b", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			r, err := ParseRange(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got := r.String(); err == nil && got != tt.want {
+				t.Errorf("unexpected range got=%s want=%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRangeListen(t *testing.T) {
+	// The ports next to a random free port are usually free.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	min := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	if min > 65533 {
+		t.Skip("no consecutive ports available")
+	}
+	r := &Range{min: min, max: min + 2, next: min}
+
+	// The first port is in use by another service.
+	busy, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(min)))
+	if err != nil {
+		t.Skipf("port %d not available: %v", min, err)
+	}
+	defer busy.Close()
+
+	for _, want := range []int{min + 1, min + 2} {
+		ln, err := r.Listen("127.0.0.1")
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		defer ln.Close()
+		if got := ln.Addr().(*net.TCPAddr).Port; got != want {
+			t.Errorf("unexpected port got=%d want=%d", got, want)
+		}
+	}
+	if _, err := r.Listen("127.0.0.1"); err == nil {
+		t.Errorf("expected error with the range exhausted")
+	}
+}
+
+func TestNilRange(t *testing.T) {
+	var r *Range
+	port, err := r.Port("127.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if port == 0 {
+		t.Errorf("unexpected port %d", port)
+	}
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+// Package redact masks the secrets in the logs, the reports and the
+// artifacts of the scans.
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	report "github.com/adevinta/vulcan-report"
+	"github.com/sirupsen/logrus"
+)
+
+// mask replaces the hidden part of the secrets. It has a fixed length to not
+// reveal the length of the secrets.
+const mask = "*****"
+
+// minSecretLen is the length of the shortest literal secret masked, the
+// shorter ones would mask common words and numbers.
+const minSecretLen = 6
+
+// credentialsR matches the passwords of the credentials in the URLs, like the
+// ones of the repositories served to the checks or the proxies.
+var credentialsR = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^/:@\s]+:([^/@\s]+)@`)
+
+// Redactor masks the literal secrets and the values matching the patterns.
+// When a pattern has a capture group only the first group is masked (eg
+// `password=(\S+)`). A nil Redactor masks nothing.
+type Redactor struct {
+	patterns []*regexp.Regexp
+	// reveal is the number of characters kept at the start of the secrets.
+	reveal  int
+	mu      sync.RWMutex
+	secrets []string
+}
+
+// New returns a Redactor masking the values matching the patterns and the
+// passwords of the URLs, keeping the first reveal characters of the secrets
+// longer than twice the reveal length.
+func New(patterns []string, reveal int) (*Redactor, error) {
+	if reveal < 0 {
+		return nil, fmt.Errorf("invalid reveal length %d", reveal)
+	}
+	r := &Redactor{reveal: reveal, patterns: []*regexp.Regexp{credentialsR}}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %s: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// Add masks the literal secrets. The ones shorter than minSecretLen are
+// ignored.
+func (r *Redactor) Add(secrets ...string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range secrets {
+		if len(s) < minSecretLen {
+			continue
+		}
+		r.secrets = append(r.secrets, s)
+	}
+	// The longest first, so the secrets containing others are fully masked.
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+}
+
+// mask returns the secret with its hidden part masked.
+func (r *Redactor) mask(secret string) string {
+	if r.reveal == 0 || utf8.RuneCountInString(secret) <= 2*r.reveal {
+		return mask
+	}
+	return string([]rune(secret)[:r.reveal]) + mask
+}
+
+// String returns the string with the secrets masked.
+func (r *Redactor) String(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	r.mu.RLock()
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, r.mask(secret))
+	}
+	r.mu.RUnlock()
+	for _, re := range r.patterns {
+		s = r.replace(re, s)
+	}
+	return s
+}
+
+// replace masks the matches of the pattern in the string, or their first
+// group if the pattern has one.
+func (r *Redactor) replace(re *regexp.Regexp, s string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		if start == end {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(r.mask(s[start:end]))
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// Bytes returns the content with the secrets masked. The binary content is
+// returned unchanged.
+func (r *Redactor) Bytes(b []byte) []byte {
+	if r == nil || !utf8.Valid(b) {
+		return b
+	}
+	return []byte(r.String(string(b)))
+}
+
+// Error returns the error with the secrets of its message masked. It wraps
+// the original error.
+func (r *Redactor) Error(err error) error {
+	if r == nil || err == nil {
+		return err
+	}
+	msg := r.String(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// Report masks the secrets of the report, including its vulnerabilities and
+// their text attachments. The fingerprints are kept to track the
+// vulnerabilities.
+func (r *Redactor) Report(rep *report.Report) {
+	if r == nil || rep == nil {
+		return
+	}
+	rep.Target = r.String(rep.Target)
+	rep.Options = r.String(rep.Options)
+	rep.Notes = r.String(rep.Notes)
+	rep.Error = r.String(rep.Error)
+	r.vulnerabilities(rep.Vulnerabilities)
+}
+
+func (r *Redactor) vulnerabilities(vs []report.Vulnerability) {
+	for i := range vs {
+		v := &vs[i]
+		v.Summary = r.String(v.Summary)
+		v.AffectedResource = r.String(v.AffectedResource)
+		v.AffectedResourceString = r.String(v.AffectedResourceString)
+		v.Description = r.String(v.Description)
+		v.Details = r.String(v.Details)
+		v.ImpactDetails = r.String(v.ImpactDetails)
+		r.strings(v.Labels)
+		r.strings(v.Recommendations)
+		for _, g := range v.Resources {
+			for _, row := range g.Rows {
+				for k := range row {
+					row[k] = r.String(row[k])
+				}
+			}
+		}
+		for j := range v.Attachments {
+			v.Attachments[j].Data = r.Bytes(v.Attachments[j].Data)
+		}
+		r.vulnerabilities(v.Vulnerabilities)
+	}
+}
+
+func (r *Redactor) strings(ss []string) {
+	for i := range ss {
+		ss[i] = r.String(ss[i])
+	}
+}
+
+// Hook returns a logrus hook masking the secrets of the messages and the
+// fields of the entries. It must be the first hook of the logger, so the
+// other hooks and the formatter receive the entries masked.
+func (r *Redactor) Hook() logrus.Hook {
+	return &hook{r: r}
+}
+
+type hook struct {
+	r *Redactor
+}
+
+func (h *hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *hook) Fire(entry *logrus.Entry) error {
+	entry.Message = h.r.String(entry.Message)
+	for k, v := range entry.Data {
+		switch v := v.(type) {
+		case string:
+			entry.Data[k] = h.r.String(v)
+		case error:
+			entry.Data[k] = h.r.String(v.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package registryservice
+
+import (
+	"context"
+	"fmt"
+	"io"
+	stdlog "log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-local/pkg/ports"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// RegistryService serves local images through an ephemeral registry.
+type RegistryService interface {
+	// AddImage pushes the image, stored in the local container runtime, to
+	// the registry and returns the reference the checks must use to pull it.
+	AddImage(image string) (string, error)
+	Shutdown()
+}
+
+// Config defines how the registry service exposes the images.
+type Config struct {
+	// Host is the address the checks use to reach the registry.
+	Host string
+
+	// BindAddress is the address where the registry listens, all the
+	// interfaces by default.
+	BindAddress string
+
+	// Ports is the range of ports where the registry listens, a random port
+	// if nil.
+	Ports *ports.Range
+}
+
+type registryService struct {
+	log      log.Logger
+	cfg      Config
+	mappings map[string]string
+	server   *http.Server
+	port     int
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+
+	// localImage returns the image from the local container runtime.
+	localImage func(ref name.Reference) (v1.Image, error)
+}
+
+func New(l log.Logger, cfg Config) RegistryService {
+	return &registryService{
+		mappings: make(map[string]string),
+		log:      l,
+		cfg:      cfg,
+		localImage: func(ref name.Reference) (v1.Image, error) {
+			return daemon.Image(ref)
+		},
+	}
+}
+
+func (rs *registryService) AddImage(image string) (string, error) {
+	// Prevent pushing multiple times the same image.
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if url, ok := rs.mappings[image]; ok {
+		return url, nil
+	}
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", fmt.Errorf("invalid image %s: %w", image, err)
+	}
+	img, err := rs.localImage(ref)
+	if err != nil {
+		return "", fmt.Errorf("unable to read local image %s: %w", image, err)
+	}
+	if rs.server == nil {
+		if err := rs.start(); err != nil {
+			return "", err
+		}
+	}
+
+	// The image is pushed through the bind address and pulled by the checks
+	// through the host address.
+	path := ref.Context().RepositoryStr() + separator(ref) + ref.Identifier()
+	push := net.JoinHostPort(pushHost(rs.cfg.BindAddress), strconv.Itoa(rs.port))
+	dest, err := name.ParseReference(fmt.Sprintf("%s/%s", push, path), name.Insecure)
+	if err != nil {
+		return "", err
+	}
+	rs.log.Debugf("Pushing image %s to the local registry %s", image, dest)
+	if err := remote.Write(dest, img); err != nil {
+		return "", fmt.Errorf("unable to push image %s to the local registry: %w", image, err)
+	}
+	url := fmt.Sprintf("%s:%d/%s", rs.cfg.Host, rs.port, path)
+	rs.mappings[image] = url
+	rs.log.Debugf("Serving image %s url=%s", image, url)
+	return url, nil
+}
+
+// pushHost returns the address used to push the images to the registry
+// listening in the bind address: the loopback interface if it listens in all
+// the interfaces or in a loopback address.
+func pushHost(bind string) string {
+	ip := net.ParseIP(bind)
+	if bind == "" || ip == nil || ip.IsUnspecified() || ip.IsLoopback() {
+		return "127.0.0.1"
+	}
+	return bind
+}
+
+// separator returns the separator between the repository and the identifier
+// of the reference.
+func separator(ref name.Reference) string {
+	if _, ok := ref.(name.Digest); ok {
+		return "@"
+	}
+	return ":"
+}
+
+func (rs *registryService) start() error {
+	// Listen before returning so the images can be pushed right away.
+	host := rs.cfg.BindAddress
+	if host == "" {
+		host = "0.0.0.0"
+	}
+	ln, err := rs.cfg.Ports.Listen(host)
+	if err != nil {
+		return err
+	}
+	handler := registry.New(registry.Logger(stdlog.New(io.Discard, "", 0)))
+	rs.port = ln.Addr().(*net.TCPAddr).Port
+	rs.server = &http.Server{Handler: handler}
+	rs.log.Debugf("Starting registry port=%d", rs.port)
+	rs.wg.Add(1)
+	go func() {
+		defer rs.wg.Done()
+		rs.server.Serve(ln)
+	}()
+	return nil
+}
+
+func (rs *registryService) Shutdown() {
+	if rs.server != nil {
+		rs.server.Shutdown(context.Background())
+	}
+	rs.wg.Wait()
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package registryservice
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	loggerUser *logrus.Logger
+)
+
+func init() {
+	if len(os.Args) > 1 && os.Args[1][:5] == "-test" {
+		loggerUser = logrus.New()
+		loggerUser.SetFormatter(&logrus.TextFormatter{
+			DisableColors:   false,
+			FullTimestamp:   true,
+			TimestampFormat: time.RFC3339,
+			ForceColors:     true,
+		})
+	}
+}
+
+func TestAddImage(t *testing.T) {
+	img, err := random.Image(1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := New(loggerUser, Config{Host: "127.0.0.1"}).(*registryService)
+	defer rs.Shutdown()
+	reads := 0
+	rs.localImage = func(ref name.Reference) (v1.Image, error) {
+		reads++
+		if ref.Context().RepositoryStr() != "library/alpine" {
+			return nil, errors.New("image not found")
+		}
+		return img, nil
+	}
+
+	url, err := rs.AddImage("alpine:3.16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(url, "/library/alpine:3.16") {
+		t.Errorf("unexpected image url %s", url)
+	}
+	if again, err := rs.AddImage("alpine:3.16"); err != nil || again != url {
+		t.Errorf("unexpected url for an added image url=%s err=%v", again, err)
+	}
+	if reads != 1 {
+		t.Errorf("unexpected number of reads of the local image %d", reads)
+	}
+
+	ref, err := name.ParseReference(url, name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pulled, err := remote.Image(ref)
+	if err != nil {
+		t.Fatalf("unable to pull the image from the registry %v", err)
+	}
+	want, _ := img.Digest()
+	got, _ := pulled.Digest()
+	if want != got {
+		t.Errorf("unexpected digest got=%s want=%s", got, want)
+	}
+
+	if _, err := rs.AddImage("missing:latest"); err == nil {
+		t.Error("expected error for a missing local image")
+	}
+}
+
+func TestPushHost(t *testing.T) {
+	tests := map[string]string{
+		"":           "127.0.0.1",
+		"0.0.0.0":    "127.0.0.1",
+		"::":         "127.0.0.1",
+		"127.0.0.1":  "127.0.0.1",
+		"::1":        "127.0.0.1",
+		"172.17.0.1": "172.17.0.1",
+		"fd00::1":    "fd00::1",
+	}
+	for bind, want := range tests {
+		if got := pushHost(bind); got != want {
+			t.Errorf("unexpected push host of %q got=%s want=%s", bind, got, want)
+		}
+	}
+}
+
+func TestAddImageBindAddress(t *testing.T) {
+	bind := ""
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && n.IP.To4() != nil && !n.IP.IsLoopback() {
+			bind = n.IP.String()
+			break
+		}
+	}
+	if bind == "" {
+		t.Skip("no non loopback interface")
+	}
+	img, err := random.Image(1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := New(loggerUser, Config{Host: bind, BindAddress: bind}).(*registryService)
+	defer rs.Shutdown()
+	rs.localImage = func(ref name.Reference) (v1.Image, error) {
+		return img, nil
+	}
+	url, err := rs.AddImage("alpine:3.16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(url, bind+":") {
+		t.Errorf("unexpected image url %s", url)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package reporting
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Baseline contains the findings accepted by the team. They are reported as
+// suppressed and don't affect the exit code.
+type Baseline struct {
+	Findings []BaselineFinding `yaml:"findings"`
+}
+
+// BaselineFinding identifies an accepted finding.
+type BaselineFinding struct {
+	Checktype        string `yaml:"checktype" json:"checktype"`
+	Target           string `yaml:"target" json:"target"`
+	Summary          string `yaml:"summary" json:"summary"`
+	AffectedResource string `yaml:"affectedResource,omitempty" json:"affectedResource,omitempty"`
+	Fingerprint      string `yaml:"fingerprint,omitempty" json:"fingerprint,omitempty"`
+}
+
+func newBaselineFinding(v *ExtendedVulnerability) BaselineFinding {
+	resource := v.AffectedResource
+	if resource == "" {
+		resource = v.AffectedResourceString
+	}
+	return BaselineFinding{
+		Checktype:        v.ChecktypeName,
+		Target:           v.Target,
+		Summary:          v.Summary,
+		AffectedResource: resource,
+		Fingerprint:      v.Fingerprint,
+	}
+}
+
+// LoadBaseline reads the baseline file. A missing file is an empty baseline.
+func LoadBaseline(path string) (*Baseline, error) {
+	b := &Baseline{}
+	if path == "" {
+		return b, nil
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read baseline %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(content, b); err != nil {
+		return nil, fmt.Errorf("unable to parse baseline %s: %w", path, err)
+	}
+	return b, nil
+}
+
+// NewBaseline creates a baseline with the non excluded vulnerabilities.
+func NewBaseline(vs []ExtendedVulnerability) *Baseline {
+	b := &Baseline{Findings: []BaselineFinding{}}
+	uniq := map[BaselineFinding]bool{}
+	for i := range vs {
+		if vs[i].Excluded {
+			continue
+		}
+		f := newBaselineFinding(&vs[i])
+		if uniq[f] {
+			continue
+		}
+		uniq[f] = true
+		b.Findings = append(b.Findings, f)
+	}
+	sort.Slice(b.Findings, func(i, j int) bool {
+		fi, fj := b.Findings[i], b.Findings[j]
+		if fi.Target != fj.Target {
+			return fi.Target < fj.Target
+		}
+		if fi.Checktype != fj.Checktype {
+			return fi.Checktype < fj.Checktype
+		}
+		if fi.Summary != fj.Summary {
+			return fi.Summary < fj.Summary
+		}
+		if fi.AffectedResource != fj.AffectedResource {
+			return fi.AffectedResource < fj.AffectedResource
+		}
+		return fi.Fingerprint < fj.Fingerprint
+	})
+	return b
+}
+
+// Save writes the baseline to the file.
+func (b *Baseline) Save(path string) error {
+	content, err := yaml.Marshal(b)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return fmt.Errorf("unable to write baseline %s: %w", path, err)
+	}
+	return nil
+}
+
+// Contains returns true if the vulnerability was accepted in the baseline.
+func (b *Baseline) Contains(v *ExtendedVulnerability) bool {
+	f := newBaselineFinding(v)
+	for _, bf := range b.Findings {
+		if bf == f {
+			return true
+		}
+	}
+	return false
+}
+
+// suppress marks as suppressed the vulnerabilities contained in the baseline.
+func suppress(vs []ExtendedVulnerability, b *Baseline) {
+	for i := range vs {
+		vs[i].Suppressed = !vs[i].Excluded && b.Contains(&vs[i])
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2022 Adevinta
+*/
+package reporting
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBaseline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".vulcan-baseline.yml")
+
+	empty, err := LoadBaseline(path)
+	if err != nil {
+		t.Fatalf("unexpected error loading a missing baseline %v", err)
+	}
+	if len(empty.Findings) != 0 {
+		t.Fatalf("unexpected findings in a missing baseline %v", empty.Findings)
+	}
+
+	accepted := []ExtendedVulnerability{
+		testVuln("vulcan-trivy", "alpine:latest", "Vulnerable openssl", 8.9, withResource("openssl"), withFingerprint("fp1")),
+		testVuln("vulcan-trivy", "alpine:latest", "Vulnerable openssl", 8.9, withResource("openssl"), withFingerprint("fp1")),
+		testVuln("vulcan-trivy", "alpine:latest", "Excluded", 8.9, withResource("busybox"), withFingerprint("fp2"), withExcluded()),
+	}
+	if err := NewBaseline(accepted).Save(path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := LoadBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BaselineFinding{
+		{
+			Checktype:        "vulcan-trivy",
+			Target:           "alpine:latest",
+			Summary:          "Vulnerable openssl",
+			AffectedResource: "openssl",
+			Fingerprint:      "fp1",
+		},
+	}
+	if diff := cmp.Diff(want, b.Findings); diff != "" {
+		t.Fatalf("unexpected baseline (-want +got):\n%s", diff)
+	}
+
+	vs := []ExtendedVulnerability{
+		testVuln("vulcan-trivy", "alpine:latest", "Vulnerable openssl", 8.9, withResource("openssl"), withFingerprint("fp1")),
+		testVuln("vulcan-trivy", "alpine:latest", "Vulnerable openssl", 8.9, withResource("openssl"), withFingerprint("fp3")),
+		testVuln("vulcan-trivy", "alpine:latest", "Vulnerable curl", 8.9, withResource("curl"), withFingerprint("fp4")),
+	}
+	suppress(vs, b)
+	got := []bool{}
+	for _, v := range vs {
+		got = append(got, v.Suppressed)
+	}
+	if diff := cmp.Diff([]bool{true, false, false}, got); diff != "" {
+		t.Errorf("unexpected suppressed vulnerabilities (-want +got):\n%s", diff)
+	}
+}
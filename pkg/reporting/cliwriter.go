@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/adevinta/vulcan-agent/log"
 	"github.com/adevinta/vulcan-local/pkg/config"
@@ -27,6 +28,13 @@ type ExtendedVulnerability struct {
 	*report.Vulnerability
 	Severity *config.SeverityData
 	Excluded bool
+	// Suppressed is true when the vulnerability is in the baseline.
+	Suppressed bool
+	// Override is the override that changed the severity, if any.
+	Override *Override
+	// Duplicates are the same vulnerability reported by other checks, merged
+	// into this one.
+	Duplicates []ExtendedVulnerability
 }
 
 func summaryTable(s []ExtendedVulnerability, l log.Logger) {
@@ -36,9 +44,12 @@ func summaryTable(s []ExtendedVulnerability, l log.Logger) {
 	}
 	data := make(map[config.Severity]int)
 	excluded := 0
+	suppressed := 0
 	for _, v := range s {
 		if v.Excluded {
 			excluded++
+		} else if v.Suppressed {
+			suppressed++
 		} else {
 			data[config.FindSeverityByScore(v.Score)]++
 		}
@@ -56,10 +67,84 @@ func summaryTable(s []ExtendedVulnerability, l log.Logger) {
 	if excluded > 0 {
 		fmt.Fprintf(buf, "\nNumber of excluded vulnerabilities: %d\n", excluded)
 	}
+	if suppressed > 0 {
+		fmt.Fprintf(buf, "\nNumber of suppressed vulnerabilities by the baseline: %d\n", suppressed)
+	}
 	fmt.Fprint(buf, "\n")
 	l.Infof(buf.String())
 }
 
+// targetGroup contains the vulnerabilities found in a target.
+type targetGroup struct {
+	target string
+	vulns  []ExtendedVulnerability
+}
+
+// groupByTarget groups the vulnerabilities by target, in the order the
+// targets are found.
+func groupByTarget(vs []ExtendedVulnerability) []targetGroup {
+	groups := []targetGroup{}
+	index := map[string]int{}
+	for _, v := range vs {
+		i, ok := index[v.Target]
+		if !ok {
+			i = len(groups)
+			index[v.Target] = i
+			groups = append(groups, targetGroup{target: v.Target})
+		}
+		groups[i].vulns = append(groups[i].vulns, v)
+	}
+	return groups
+}
+
+// targetsTable returns the number of vulnerabilities of every severity found
+// in each target and in total, or empty if they were found in one target.
+func targetsTable(vs []ExtendedVulnerability) string {
+	groups := groupByTarget(vs)
+	if len(groups) < 2 {
+		return ""
+	}
+	buf := new(bytes.Buffer)
+	fmt.Fprint(buf, "\nSummary by target:\n")
+	tw := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	header := []string{"TARGET"}
+	for _, s := range config.Severities() {
+		header = append(header, s.Data().Name)
+	}
+	fmt.Fprintf(tw, "%s%s\tEXCLUDED\tSUPPRESSED\n", indentate(baseIndent), strings.Join(header, "\t"))
+	row := func(name string, vulns []ExtendedVulnerability) {
+		counts := map[config.Severity]int{}
+		excluded, suppressed := 0, 0
+		for _, v := range vulns {
+			switch {
+			case v.Excluded:
+				excluded++
+			case v.Suppressed:
+				suppressed++
+			default:
+				counts[config.FindSeverityByScore(v.Score)]++
+			}
+		}
+		cols := []string{name}
+		for _, s := range config.Severities() {
+			cols = append(cols, fmt.Sprint(counts[s]))
+		}
+		fmt.Fprintf(tw, "%s%s\t%d\t%d\n", indentate(baseIndent), strings.Join(cols, "\t"), excluded, suppressed)
+	}
+	for _, g := range groups {
+		row(g.target, g.vulns)
+	}
+	row("TOTAL", vs)
+	tw.Flush()
+	return buf.String()
+}
+
+// targetHeader returns the header of the section with the vulnerabilities of
+// the target.
+func targetHeader(target string) string {
+	return formatString(fmt.Sprintf("\n%s\nTARGET %s\n%s\n", strings.Repeat("#", Width), target, strings.Repeat("#", Width)), 0)
+}
+
 func printVulnerability(v *ExtendedVulnerability, l log.Logger) string {
 	severity := v.Severity.Name
 	color := v.Severity.Color
@@ -80,6 +165,12 @@ func printVulnerability(v *ExtendedVulnerability, l log.Logger) string {
 		fmt.Fprintf(buf, "%s %s\n", formatString("AFFECTED RESOURCE:", 0), affectedResource)
 	}
 	fmt.Fprintf(buf, "%s %s\n", formatString("SUMMARY:", 0), v.Vulnerability.Summary)
+	if v.Override != nil {
+		fmt.Fprintf(buf, "%s %s\n", formatString("SEVERITY OVERRIDDEN:", 0), v.Override)
+	}
+	if len(v.Duplicates) > 0 {
+		fmt.Fprintf(buf, "%s %s\n", formatString("REPORTED BY:", 0), strings.Join(v.checktypes(), ", "))
+	}
 	dlines := splitLines(v.Vulnerability.Description, baseIndent, Width)
 	fmt.Fprintf(buf, "\n%s\n%s%s", formatString("DESCRIPTION:", 0), indentate(baseIndent), strings.Join(dlines, "\n"+indentate(baseIndent)))
 	if len(v.Vulnerability.Details) != 0 {
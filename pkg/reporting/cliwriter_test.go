@@ -0,0 +1,47 @@
+/*
+Copyright 2022 Adevinta
+*/
+package reporting
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTargetsTable(t *testing.T) {
+	vs := []ExtendedVulnerability{
+		testVuln("", "app", "", 9.0),
+		testVuln("", "lib", "", 5.0),
+		testVuln("", "app", "", 0),
+		testVuln("", "app", "", 9.0, withExcluded()),
+	}
+
+	groups := []string{}
+	for _, g := range groupByTarget(vs) {
+		groups = append(groups, g.target)
+	}
+	if diff := cmp.Diff([]string{"app", "lib"}, groups); diff != "" {
+		t.Errorf("unexpected groups (-want +got):\n%s", diff)
+	}
+
+	lines := strings.Split(strings.TrimSpace(targetsTable(vs)), "\n")
+	got := [][]string{}
+	for _, l := range lines[1:] {
+		got = append(got, strings.Fields(l))
+	}
+	want := [][]string{
+		{"TARGET", "CRITICAL", "HIGH", "MEDIUM", "LOW", "INFO", "EXCLUDED", "SUPPRESSED"},
+		{"app", "1", "0", "0", "0", "1", "1", "0"},
+		{"lib", "0", "0", "1", "0", "0", "0", "0"},
+		{"TOTAL", "1", "0", "1", "0", "1", "1", "0"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected table (-want +got):\n%s", diff)
+	}
+
+	if table := targetsTable(vs[:1]); table != "" {
+		t.Errorf("unexpected table for a single target %q", table)
+	}
+}
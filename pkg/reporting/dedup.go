@@ -0,0 +1,98 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package reporting
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// duplicateLabel is added, with the name of the checktype, to the
+// vulnerabilities in the json report that were also reported by other
+// checks.
+const duplicateLabel = "also-reported-by:"
+
+// advisoryR matches the public identifiers of the vulnerabilities.
+var advisoryR = regexp.MustCompile(`(?i)\b(CVE-\d{4}-\d{4,}|GHSA(-[23456789cfghjmpqrvwx]{4}){3})\b`)
+
+// dedupKey identifies the same vulnerability reported by different checks.
+type dedupKey struct {
+	target   string
+	resource string
+	id       string
+}
+
+// newDedupKey returns the key of the vulnerability. Its id is the first
+// advisory found in the summary or the labels, or the summary if none.
+func newDedupKey(v *ExtendedVulnerability) dedupKey {
+	id := advisoryR.FindString(v.Summary)
+	for _, l := range v.Labels {
+		if id != "" {
+			break
+		}
+		id = advisoryR.FindString(l)
+	}
+	if id == "" {
+		id = v.Summary
+	}
+	// The human-readable resources are less consistent between checks.
+	resource := v.AffectedResource
+	if resource == "" {
+		resource = v.AffectedResourceString
+	}
+	return dedupKey{
+		target:   v.Target,
+		resource: strings.TrimSpace(resource),
+		id:       strings.ToUpper(strings.TrimSpace(id)),
+	}
+}
+
+// dedup merges the non excluded vulnerabilities with the same target,
+// affected resource and id, keeping the one with the highest score and
+// recording in it the checktypes reporting the others. The order of the
+// vulnerabilities is preserved.
+func dedup(vs []ExtendedVulnerability) []ExtendedVulnerability {
+	kept := map[dedupKey]int{}
+	merged := []ExtendedVulnerability{}
+	for _, v := range vs {
+		if v.Excluded {
+			merged = append(merged, v)
+			continue
+		}
+		key := newDedupKey(&v)
+		i, ok := kept[key]
+		if !ok {
+			kept[key] = len(merged)
+			merged = append(merged, v)
+			continue
+		}
+		prev := merged[i]
+		if v.Score > prev.Score {
+			v.Duplicates, prev.Duplicates = prev.Duplicates, nil
+			v.Duplicates = append(v.Duplicates, prev)
+			merged[i] = v
+		} else {
+			merged[i].Duplicates = append(merged[i].Duplicates, v)
+		}
+	}
+	return merged
+}
+
+// checktypes returns the names of the checktypes reporting the vulnerability
+// and its duplicates.
+func (v *ExtendedVulnerability) checktypes() []string {
+	names := []string{v.ChecktypeName}
+	seen := map[string]bool{v.ChecktypeName: true}
+	others := []string{}
+	for _, d := range v.Duplicates {
+		if !seen[d.ChecktypeName] {
+			seen[d.ChecktypeName] = true
+			others = append(others, d.ChecktypeName)
+		}
+	}
+	sort.Strings(others)
+	return append(names, others...)
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2022 Adevinta
+*/
+package reporting
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	report "github.com/adevinta/vulcan-report"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDedup(t *testing.T) {
+	vs := []ExtendedVulnerability{
+		testVuln("vulcan-trivy", ".", "CVE-2022-1234 in lodash", 7.0, withCheckID("1"), withResource("lodash-4.17.20")),
+		testVuln("vulcan-trivy", ".", "Outdated packages", 0, withCheckID("1")),
+		testVuln("vulcan-retirejs", ".", "Prototype pollution (cve-2022-1234)", 8.0, withCheckID("2"), withResource("lodash-4.17.20")),
+		testVuln("vulcan-retirejs", ".", "CVE-2022-1234 in lodash", 8.0, withCheckID("2"), withResource("lodash-4.17.21")),
+		testVuln("vulcan-gitleaks", ".", "Secret Leaked in Git Repository", 8.9, withCheckID("4"), withResource("config.yaml:3")),
+		testVuln("vulcan-trufflehog", ".", "Secret Leaked in Git Repository", 8.9, withCheckID("5"), withResource("config.yaml:3")),
+		testVuln("vulcan-semgrep", ".", "CVE-2022-1234 in lodash", 9.0, withCheckID("3"), withResource("lodash-4.17.20"), withExcluded()),
+	}
+	got := dedup(vs)
+
+	type merged struct {
+		Summary    string
+		Checktypes []string
+	}
+	summary := []merged{}
+	for i := range got {
+		summary = append(summary, merged{Summary: got[i].Summary, Checktypes: got[i].checktypes()})
+	}
+	want := []merged{
+		{Summary: "Prototype pollution (cve-2022-1234)", Checktypes: []string{"vulcan-retirejs", "vulcan-trivy"}},
+		{Summary: "Outdated packages", Checktypes: []string{"vulcan-trivy"}},
+		{Summary: "CVE-2022-1234 in lodash", Checktypes: []string{"vulcan-retirejs"}},
+		{Summary: "Secret Leaked in Git Repository", Checktypes: []string{"vulcan-gitleaks", "vulcan-trufflehog"}},
+		{Summary: "CVE-2022-1234 in lodash", Checktypes: []string{"vulcan-semgrep"}},
+	}
+	if diff := cmp.Diff(want, summary); diff != "" {
+		t.Errorf("unexpected findings (-want +got):\n%s", diff)
+	}
+	if got[0].Score != 8.0 {
+		t.Errorf("the highest score was not kept: %v", got[0].Score)
+	}
+}
+
+func TestJSONReportDuplicates(t *testing.T) {
+	cfg := &config.Config{Reporting: config.Reporting{Severity: config.SeverityInfo}}
+	v := testVuln("vulcan-trivy", "", "CVE-2022-1234", 0, withCheckID("1"))
+	v.Labels = []string{"issue"}
+	v.Duplicates = []ExtendedVulnerability{testVuln("vulcan-retirejs", "", "CVE-2022-1234", 0, withCheckID("2"))}
+	content, err := jsonReport(cfg, nil, []ExtendedVulnerability{v})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var reports []report.Report
+	if err := json.Unmarshal(content, &reports); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"issue", duplicateLabel + "vulcan-retirejs"}, reports[0].Vulnerabilities[0].Labels); diff != "" {
+		t.Errorf("unexpected labels (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"issue"}, v.Labels); diff != "" {
+		t.Errorf("the labels of the vulnerability were modified (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package reporting
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-local/pkg/config"
+)
+
+// Delta returns the vulnerabilities in current not found in previous, and the
+// ones in previous not found in current. Only the reported vulnerabilities
+// that are not suppressed are compared.
+func Delta(cfg *config.Config, previous, current []ExtendedVulnerability) (added, fixed []ExtendedVulnerability) {
+	requested := cfg.Reporting.Severity.Data()
+	reported := func(vs []ExtendedVulnerability) []ExtendedVulnerability {
+		r := []ExtendedVulnerability{}
+		for i := range vs {
+			if isReported(&vs[i], requested) && !vs[i].Suppressed {
+				r = append(r, vs[i])
+			}
+		}
+		return r
+	}
+	previous, current = reported(previous), reported(current)
+	before, after := NewBaseline(previous), NewBaseline(current)
+	for i := range current {
+		if !before.Contains(&current[i]) {
+			added = append(added, current[i])
+		}
+	}
+	for i := range previous {
+		if !after.Contains(&previous[i]) {
+			fixed = append(fixed, previous[i])
+		}
+	}
+	return added, fixed
+}
+
+// ShowDelta prints the new and fixed vulnerabilities.
+func ShowDelta(added, fixed []ExtendedVulnerability, l log.Logger) {
+	if len(added) == 0 && len(fixed) == 0 {
+		l.Infof("No changes in the vulnerabilities found")
+		return
+	}
+	list := func(title string, vs []ExtendedVulnerability) string {
+		s := fmt.Sprintf("%s: %d\n", title, len(vs))
+		for _, v := range vs {
+			line := fmt.Sprintf("  [%s] %s target=%s", v.Severity.Name, v.Summary, v.Target)
+			if r := affectedResource(&v); r != "" {
+				line = fmt.Sprintf("%s resource=%s", line, r)
+			}
+			s += line + "\n"
+		}
+		return s
+	}
+	l.Infof("\n%s%s", list("New vulnerabilities", added), strings.TrimSuffix(list("Fixed vulnerabilities", fixed), "\n"))
+}
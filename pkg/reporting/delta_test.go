@@ -0,0 +1,41 @@
+/*
+Copyright 2022 Adevinta
+*/
+package reporting
+
+import (
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDelta(t *testing.T) {
+	previous := []ExtendedVulnerability{
+		testVuln("vulcan-gitleaks", ".", "Kept", 8.0),
+		testVuln("vulcan-gitleaks", ".", "Fixed", 8.0),
+		testVuln("vulcan-gitleaks", ".", "Low fixed", 1.0),
+	}
+	current := []ExtendedVulnerability{
+		testVuln("vulcan-gitleaks", ".", "Kept", 8.0),
+		testVuln("vulcan-gitleaks", ".", "New", 9.0),
+		testVuln("vulcan-gitleaks", ".", "Suppressed", 9.0, withSuppressed()),
+		testVuln("vulcan-gitleaks", ".", "Low new", 1.0),
+	}
+	cfg := &config.Config{Reporting: config.Reporting{Severity: config.SeverityHigh}}
+	added, fixed := Delta(cfg, previous, current)
+	summaries := func(vs []ExtendedVulnerability) []string {
+		s := []string{}
+		for _, v := range vs {
+			s = append(s, v.Summary)
+		}
+		return s
+	}
+	if diff := cmp.Diff([]string{"New"}, summaries(added)); diff != "" {
+		t.Errorf("unexpected new vulnerabilities (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"Fixed"}, summaries(fixed)); diff != "" {
+		t.Errorf("unexpected fixed vulnerabilities (-want +got):\n%s", diff)
+	}
+	ShowDelta(added, fixed, loggerUser)
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package reporting
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	report "github.com/adevinta/vulcan-report"
+)
+
+const (
+	githubFormat = "github"
+
+	// githubSummaryEnv is the file where GitHub Actions reads the markdown
+	// summary of the step.
+	githubSummaryEnv = "GITHUB_STEP_SUMMARY"
+)
+
+var (
+	githubDataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	githubPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+	markdownCellEscaper   = strings.NewReplacer("|", "\\|", "\r", " ", "\n", " ")
+)
+
+func githubLevel(s config.Severity) string {
+	switch s {
+	case config.SeverityCritical, config.SeverityHigh:
+		return "error"
+	case config.SeverityMedium:
+		return "warning"
+	default:
+		return "notice"
+	}
+}
+
+// githubReported returns the reported vulnerabilities that are not
+// suppressed sorted by score.
+func githubReported(cfg *config.Config, vs []ExtendedVulnerability) []*ExtendedVulnerability {
+	requested := cfg.Reporting.Severity.Data()
+	reported := []*ExtendedVulnerability{}
+	for i := range vs {
+		if isReported(&vs[i], requested) && !vs[i].Suppressed {
+			reported = append(reported, &vs[i])
+		}
+	}
+	sort.SliceStable(reported, func(i, j int) bool {
+		return reported[i].Score > reported[j].Score
+	})
+	return reported
+}
+
+// githubFile returns the path of the affected file relative to the working
+// directory, as expected by the workflow annotations.
+func githubFile(v *ExtendedVulnerability) (string, int, bool) {
+	file, line, ok := fileLocation(affectedResource(v))
+	if !ok || !isLocalPath(v.Target) {
+		return "", 0, false
+	}
+	path := filepath.Join(v.Target, file)
+	if wd, err := os.Getwd(); err == nil {
+		if abs, err := filepath.Abs(path); err == nil {
+			if rel, err := filepath.Rel(wd, abs); err == nil && !strings.HasPrefix(rel, "..") {
+				path = rel
+			}
+		}
+	}
+	return filepath.ToSlash(path), line, true
+}
+
+// githubReport generates the workflow commands annotating the affected files
+// of the vulnerabilities.
+func githubReport(cfg *config.Config, _ map[string]*report.Report, vs []ExtendedVulnerability) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	for _, v := range githubReported(cfg, vs) {
+		file, line, ok := githubFile(v)
+		if !ok {
+			continue
+		}
+		props := fmt.Sprintf("file=%s", githubPropertyEscaper.Replace(file))
+		if line > 0 {
+			props = fmt.Sprintf("%s,line=%d", props, line)
+		}
+		props = fmt.Sprintf("%s,title=%s", props, githubPropertyEscaper.Replace(fmt.Sprintf("%s (%s)", v.Summary, v.Severity.Name)))
+		msg := fmt.Sprintf("%s reported by %s", v.Summary, strings.Join(v.checktypes(), ", "))
+		if v.Description != "" {
+			msg = fmt.Sprintf("%s\n%s", msg, v.Description)
+		}
+		fmt.Fprintf(buf, "::%s %s::%s\n", githubLevel(v.Severity.Severity), props, githubDataEscaper.Replace(msg))
+	}
+	return buf.Bytes(), nil
+}
+
+// githubStepSummary generates the markdown summary of the vulnerabilities.
+func githubStepSummary(cfg *config.Config, vs []ExtendedVulnerability) []byte {
+	requested := cfg.Reporting.Severity.Data()
+	reported := githubReported(cfg, vs)
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "## vulcan-local results\n\n")
+
+	counts := map[string]int{}
+	suppressed := 0
+	for _, v := range vs {
+		if !isReported(&v, requested) {
+			continue
+		}
+		if v.Suppressed {
+			suppressed++
+			continue
+		}
+		counts[v.Severity.Name]++
+	}
+	fmt.Fprintf(buf, "| Severity | Count |\n| --- | --- |\n")
+	for _, s := range config.Severities() {
+		sd := s.Data()
+		if sd.Threshold >= requested.Threshold {
+			fmt.Fprintf(buf, "| %s | %d |\n", sd.Name, counts[sd.Name])
+		}
+	}
+	if suppressed > 0 {
+		fmt.Fprintf(buf, "\n%d vulnerabilities suppressed by the baseline.\n", suppressed)
+	}
+
+	if len(reported) == 0 {
+		fmt.Fprintf(buf, "\nNo vulnerabilities found over the severity threshold %s.\n", requested.Name)
+		return buf.Bytes()
+	}
+	fmt.Fprintf(buf, "\n| Severity | Score | Check | Target | Summary | Affected resource |\n| --- | --- | --- | --- | --- | --- |\n")
+	for _, v := range reported {
+		fmt.Fprintf(buf, "| %s | %.1f | %s | %s | %s | %s |\n",
+			v.Severity.Name, v.Score,
+			markdownCellEscaper.Replace(v.ChecktypeName),
+			markdownCellEscaper.Replace(v.Target),
+			markdownCellEscaper.Replace(v.Summary),
+			markdownCellEscaper.Replace(affectedResource(v)),
+		)
+	}
+	return buf.Bytes()
+}
+
+// writeStepSummary appends the summary to the step summary file when running
+// in GitHub Actions.
+func writeStepSummary(cfg *config.Config, vs []ExtendedVulnerability) error {
+	path := os.Getenv(githubSummaryEnv)
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("unable to open step summary file %s %+v", path, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(githubStepSummary(cfg, vs)); err != nil {
+		return fmt.Errorf("unable to write step summary file %s %+v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2022 Adevinta
+*/
+package reporting
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGithubReport(t *testing.T) {
+	dir := t.TempDir()
+	details := func(v *ExtendedVulnerability) {
+		v.Description = "Line one\nLine two"
+	}
+	vs := []ExtendedVulnerability{
+		testVuln("vulcan-gitleaks", dir, "Medium, finding", 5.0, withResource("main.go"), details),
+		testVuln("vulcan-gitleaks", dir, "Secret Leaked", 8.9, withResource("config/app.yaml:12"), details),
+		testVuln("vulcan-gitleaks", dir, "Suppressed", 8.9, withResource("main.go"), details, withSuppressed()),
+		testVuln("vulcan-gitleaks", dir, "Low finding", 1.0, withResource("main.go"), details),
+		testVuln("vulcan-gitleaks", "alpine:latest", "Vulnerable | package", 7.5, withResource("openssl"), details),
+	}
+	cfg := &config.Config{Reporting: config.Reporting{Severity: config.SeverityMedium}}
+
+	content, err := githubReport(cfg, nil, vs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := func(name string) string {
+		wd, _ := os.Getwd()
+		rel, _ := filepath.Rel(wd, filepath.Join(dir, name))
+		if strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(filepath.Join(dir, name))
+		}
+		return filepath.ToSlash(rel)
+	}
+	want := []string{
+		"::error file=" + file("config/app.yaml") + ",line=12,title=Secret Leaked (HIGH)::Secret Leaked reported by vulcan-gitleaks%0ALine one%0ALine two",
+		"::warning file=" + file("main.go") + ",title=Medium%2C finding (MEDIUM)::Medium, finding reported by vulcan-gitleaks%0ALine one%0ALine two",
+	}
+	got := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected annotations (-want +got):\n%s", diff)
+	}
+
+	summaryFile := filepath.Join(t.TempDir(), "summary.md")
+	t.Setenv(githubSummaryEnv, summaryFile)
+	if err := writeStepSummary(cfg, vs); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := os.ReadFile(summaryFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"| HIGH | 2 |",
+		"| MEDIUM | 1 |",
+		"1 vulnerabilities suppressed by the baseline.",
+		"| HIGH | 8.9 | vulcan-gitleaks | " + dir + " | Secret Leaked | config/app.yaml:12 |",
+		"| HIGH | 7.5 | vulcan-gitleaks | alpine:latest | Vulnerable \\| package | openssl |",
+	} {
+		if !strings.Contains(string(summary), s) {
+			t.Errorf("expected %q in the summary:\n%s", s, summary)
+		}
+	}
+	if strings.Contains(string(summary), "Low finding") {
+		t.Error("unexpected vulnerability under the threshold in the summary")
+	}
+}
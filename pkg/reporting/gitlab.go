@@ -0,0 +1,240 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package reporting
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/generator"
+	report "github.com/adevinta/vulcan-report"
+)
+
+const (
+	gitlabSchemaVersion = "15.0.4"
+	gitlabTimeLayout    = "2006-01-02T15:04:05"
+
+	gitlabSAST               = "sast"
+	gitlabDependencyScanning = "dependency_scanning"
+)
+
+// gitlabReport follows the GitLab security report schemas
+// (https://gitlab.com/gitlab-org/security-products/security-report-schemas).
+type gitlabReport struct {
+	Version         string                `json:"version"`
+	Scan            gitlabScan            `json:"scan"`
+	Vulnerabilities []gitlabVulnerability `json:"vulnerabilities"`
+}
+
+type gitlabScan struct {
+	Analyzer  gitlabTool `json:"analyzer"`
+	Scanner   gitlabTool `json:"scanner"`
+	Type      string     `json:"type"`
+	StartTime string     `json:"start_time"`
+	EndTime   string     `json:"end_time"`
+	Status    string     `json:"status"`
+}
+
+type gitlabTool struct {
+	ID      string       `json:"id"`
+	Name    string       `json:"name"`
+	Version string       `json:"version"`
+	Vendor  gitlabVendor `json:"vendor"`
+}
+
+type gitlabVendor struct {
+	Name string `json:"name"`
+}
+
+type gitlabVulnerability struct {
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Severity    string             `json:"severity"`
+	Solution    string             `json:"solution,omitempty"`
+	Identifiers []gitlabIdentifier `json:"identifiers"`
+	Links       []gitlabLink       `json:"links,omitempty"`
+	Location    gitlabLocation     `json:"location"`
+}
+
+type gitlabIdentifier struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	URL   string `json:"url,omitempty"`
+}
+
+type gitlabLink struct {
+	URL string `json:"url"`
+}
+
+type gitlabLocation struct {
+	File       string            `json:"file,omitempty"`
+	StartLine  int               `json:"start_line,omitempty"`
+	Dependency *gitlabDependency `json:"dependency,omitempty"`
+}
+
+type gitlabDependency struct {
+	Package gitlabPackage `json:"package"`
+	Version string        `json:"version,omitempty"`
+}
+
+type gitlabPackage struct {
+	Name string `json:"name"`
+}
+
+func gitlabSeverity(s config.Severity) string {
+	switch s {
+	case config.SeverityCritical:
+		return "Critical"
+	case config.SeverityHigh:
+		return "High"
+	case config.SeverityMedium:
+		return "Medium"
+	case config.SeverityLow:
+		return "Low"
+	default:
+		return "Info"
+	}
+}
+
+// toolVersion returns the version of the vulcan-local module.
+func toolVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "dev"
+}
+
+// gitlabID returns a stable id for the vulnerability.
+func gitlabID(v *ExtendedVulnerability) string {
+	key := strings.Join([]string{v.ChecktypeName, v.Target, v.Summary, affectedResource(v), v.Fingerprint}, "|")
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(key)))
+}
+
+// scanTimes returns the start time of the first check and the end time of the
+// last one.
+func scanTimes(reports map[string]*report.Report) (time.Time, time.Time) {
+	var start, end time.Time
+	for _, r := range reports {
+		if r == nil {
+			continue
+		}
+		if !r.StartTime.IsZero() && (start.IsZero() || r.StartTime.Before(start)) {
+			start = r.StartTime
+		}
+		if r.EndTime.After(end) {
+			end = r.EndTime
+		}
+	}
+	now := time.Now()
+	if start.IsZero() {
+		start = now
+	}
+	if end.IsZero() {
+		end = now
+	}
+	return start, end
+}
+
+func newGitlabVulnerability(v *ExtendedVulnerability, scanType string) gitlabVulnerability {
+	gv := gitlabVulnerability{
+		ID:          gitlabID(v),
+		Name:        v.Summary,
+		Description: v.Description,
+		Severity:    gitlabSeverity(v.Severity.Severity),
+		Identifiers: []gitlabIdentifier{
+			{
+				Type:  "vulcan",
+				Name:  fmt.Sprintf("%s: %s", v.ChecktypeName, v.Summary),
+				Value: ruleID(v.Summary),
+			},
+		},
+	}
+	if v.CWEID != 0 {
+		gv.Identifiers = append(gv.Identifiers, gitlabIdentifier{
+			Type:  "cwe",
+			Name:  fmt.Sprintf("CWE-%d", v.CWEID),
+			Value: fmt.Sprintf("%d", v.CWEID),
+			URL:   fmt.Sprintf("https://cwe.mitre.org/data/definitions/%d.html", v.CWEID),
+		})
+	}
+	recommendations := []string{}
+	for _, r := range v.Recommendations {
+		if r != "" {
+			recommendations = append(recommendations, r)
+		}
+	}
+	gv.Solution = strings.Join(recommendations, "\n")
+	for _, r := range v.References {
+		if strings.HasPrefix(r, "http://") || strings.HasPrefix(r, "https://") {
+			gv.Links = append(gv.Links, gitlabLink{URL: r})
+		}
+	}
+
+	resource := affectedResource(v)
+	if scanType == gitlabDependencyScanning {
+		// The affected resource of the dependency checks is the package.
+		if resource == "" {
+			resource = v.Target
+		}
+		gv.Location.File = v.Target
+		gv.Location.Dependency = &gitlabDependency{Package: gitlabPackage{Name: resource}}
+		return gv
+	}
+	if file, line, ok := fileLocation(resource); ok && isLocalPath(v.Target) {
+		gv.Location.File = file
+		gv.Location.StartLine = line
+	}
+	return gv
+}
+
+// gitlabWriter returns a writer generating the GitLab security report of the
+// given scan type. The dependency scanning report only contains the findings
+// of the checks analyzing dependencies.
+func gitlabWriter(scanType string) reportWriter {
+	return func(cfg *config.Config, reports map[string]*report.Report, vs []ExtendedVulnerability) ([]byte, error) {
+		requested := cfg.Reporting.Severity.Data()
+		start, end := scanTimes(reports)
+		tool := gitlabTool{
+			ID:      "vulcan-local",
+			Name:    "vulcan-local",
+			Version: toolVersion(),
+			Vendor:  gitlabVendor{Name: "Adevinta"},
+		}
+		r := gitlabReport{
+			Version: gitlabSchemaVersion,
+			Scan: gitlabScan{
+				Analyzer:  tool,
+				Scanner:   tool,
+				Type:      scanType,
+				StartTime: start.UTC().Format(gitlabTimeLayout),
+				EndTime:   end.UTC().Format(gitlabTimeLayout),
+				Status:    "success",
+			},
+			Vulnerabilities: []gitlabVulnerability{},
+		}
+		for i := range vs {
+			v := &vs[i]
+			if !isReported(v, requested) || v.Suppressed {
+				continue
+			}
+			if (scanType == gitlabDependencyScanning) != generator.IsDependencyChecktype(v.ChecktypeName) {
+				continue
+			}
+			r.Vulnerabilities = append(r.Vulnerabilities, newGitlabVulnerability(v, scanType))
+		}
+		sort.SliceStable(r.Vulnerabilities, func(i, j int) bool {
+			return r.Vulnerabilities[i].ID < r.Vulnerabilities[j].ID
+		})
+		return json.MarshalIndent(r, "", "    ")
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2022 Adevinta
+*/
+package reporting
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	report "github.com/adevinta/vulcan-report"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGitlabReport(t *testing.T) {
+	dir := t.TempDir()
+	details := func(v *ExtendedVulnerability) {
+		v.CWEID = 798
+		v.Recommendations = []string{"Rotate the secret", ""}
+		v.References = []string{"https://example.com/ref", "not a link"}
+	}
+	vs := []ExtendedVulnerability{
+		testVuln("vulcan-gitleaks", dir, "Secret Leaked", 8.9, withResource("config/app.yaml:12"), details),
+		testVuln("vulcan-gitleaks", dir, "Low finding", 1.0, withResource("main.go"), details),
+		testVuln("vulcan-trivy", dir, "Vulnerable package", 9.5, withResource("openssl"), details),
+		testVuln("vulcan-gitleaks", dir, "Suppressed", 8.9, withResource("main.go"), details, withSuppressed()),
+	}
+	start := time.Date(2022, 11, 2, 10, 0, 0, 0, time.UTC)
+	reports := map[string]*report.Report{
+		"1": {CheckData: report.CheckData{StartTime: start.Add(time.Minute), EndTime: start.Add(3 * time.Minute)}},
+		"2": {CheckData: report.CheckData{StartTime: start, EndTime: start.Add(2 * time.Minute)}},
+		"3": nil,
+	}
+	cfg := &config.Config{Reporting: config.Reporting{Severity: config.SeverityHigh}}
+
+	tests := []struct {
+		format       string
+		wantType     string
+		wantLocation []gitlabLocation
+	}{
+		{
+			format:       "gitlab-sast",
+			wantType:     gitlabSAST,
+			wantLocation: []gitlabLocation{{File: "config/app.yaml", StartLine: 12}},
+		},
+		{
+			format:   "gitlab-dependency-scanning",
+			wantType: gitlabDependencyScanning,
+			wantLocation: []gitlabLocation{
+				{File: dir, Dependency: &gitlabDependency{Package: gitlabPackage{Name: "openssl"}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			content, err := writers[tt.format](cfg, reports, vs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got gitlabReport
+			if err := json.Unmarshal(content, &got); err != nil {
+				t.Fatalf("invalid json %v", err)
+			}
+			if got.Version != gitlabSchemaVersion || got.Scan.Type != tt.wantType {
+				t.Errorf("unexpected version=%s type=%s", got.Version, got.Scan.Type)
+			}
+			if got.Scan.StartTime != "2022-11-02T10:00:00" || got.Scan.EndTime != "2022-11-02T10:03:00" {
+				t.Errorf("unexpected scan times start=%s end=%s", got.Scan.StartTime, got.Scan.EndTime)
+			}
+			locations := []gitlabLocation{}
+			for _, v := range got.Vulnerabilities {
+				locations = append(locations, v.Location)
+				if v.Solution != "Rotate the secret" || len(v.Links) != 1 || len(v.Identifiers) != 2 {
+					t.Errorf("unexpected vulnerability %+v", v)
+				}
+			}
+			if diff := cmp.Diff(tt.wantLocation, locations); diff != "" {
+				t.Errorf("unexpected locations (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
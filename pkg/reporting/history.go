@@ -0,0 +1,295 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package reporting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+)
+
+// RunIDFormat is the format of the ids of the runs, their start time.
+const RunIDFormat = "20060102T150405Z"
+
+// NewRunID returns the id of a run started at t, calling create with the id
+// to store the run. If create fails with fs.ErrExist it's called again with
+// the next id, so the runs in the same second get a suffix.
+func NewRunID(t time.Time, create func(id string) error) (string, error) {
+	base := t.UTC().Format(RunIDFormat)
+	id := base
+	for i := 1; ; i++ {
+		err := create(id)
+		if errors.Is(err, fs.ErrExist) {
+			id = fmt.Sprintf("%s-%d", base, i)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return id, nil
+	}
+}
+
+// HistoryRun contains the normalized findings of a scan stored in the
+// history.
+type HistoryRun struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	// Dir is the working directory of the scan, the history of every
+	// directory is compared independently.
+	Dir      string           `json:"dir"`
+	Targets  []string         `json:"targets"`
+	Severity string           `json:"severity"`
+	ExitCode int              `json:"exitCode"`
+	Findings []HistoryFinding `json:"findings"`
+}
+
+// HistoryFinding is a non excluded finding of a run.
+type HistoryFinding struct {
+	BaselineFinding
+	Severity   string  `json:"severity"`
+	Score      float32 `json:"score"`
+	Suppressed bool    `json:"suppressed,omitempty"`
+}
+
+// SaveHistory stores in the history directory the findings of the scan, that
+// finished with the exit code.
+func SaveHistory(dir string, cfg *config.Config, vs []ExtendedVulnerability, exitCode int) (*HistoryRun, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	run := &HistoryRun{
+		Time:     now,
+		Dir:      wd,
+		Targets:  []string{},
+		Severity: cfg.Reporting.Severity.Data().Name,
+		ExitCode: exitCode,
+		Findings: []HistoryFinding{},
+	}
+	seen := map[string]bool{}
+	for _, t := range cfg.Targets {
+		if !seen[t.Target] {
+			seen[t.Target] = true
+			run.Targets = append(run.Targets, t.Target)
+		}
+	}
+	for i := range vs {
+		v := &vs[i]
+		if v.Excluded {
+			continue
+		}
+		run.Findings = append(run.Findings, HistoryFinding{
+			BaselineFinding: newBaselineFinding(v),
+			Severity:        v.Severity.Name,
+			Score:           v.Score,
+			Suppressed:      v.Suppressed,
+		})
+	}
+	sortHistoryFindings(run.Findings)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create the history %s: %w", dir, err)
+	}
+	var f *os.File
+	run.ID, err = NewRunID(now, func(id string) error {
+		var err error
+		f, err = os.OpenFile(filepath.Join(dir, id+".json"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to store the run in the history %s: %w", dir, err)
+	}
+	defer f.Close()
+	content, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(content); err != nil {
+		return nil, fmt.Errorf("unable to store the run in the history %s: %w", dir, err)
+	}
+	return run, nil
+}
+
+// LoadHistory returns the runs stored in the history directory of the
+// working directory, sorted by time. A missing history has no runs.
+func LoadHistory(dir, wd string) ([]HistoryRun, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	runs := []HistoryRun{}
+	for _, f := range files {
+		content, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the run %s: %w", f, err)
+		}
+		var run HistoryRun
+		if err := json.Unmarshal(content, &run); err != nil {
+			return nil, fmt.Errorf("unable to parse the run %s: %w", f, err)
+		}
+		if run.Dir == wd {
+			runs = append(runs, run)
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		if runs[i].Time.Equal(runs[j].Time) {
+			return runs[i].ID < runs[j].ID
+		}
+		return runs[i].Time.Before(runs[j].Time)
+	})
+	return runs, nil
+}
+
+// FindRun returns the run with the id or, if since is a date or a time, the
+// last run before it.
+func FindRun(runs []HistoryRun, since string) (*HistoryRun, error) {
+	for i := range runs {
+		if runs[i].ID == since {
+			return &runs[i], nil
+		}
+	}
+	var t time.Time
+	var err error
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err = time.ParseInLocation(layout, since, time.Local); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("run %s not found", since)
+	}
+	var found *HistoryRun
+	for i := range runs {
+		if runs[i].Time.After(t) {
+			break
+		}
+		found = &runs[i]
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no runs before %s", since)
+	}
+	return found, nil
+}
+
+// HistoryDelta contains the changes of the findings between two runs.
+type HistoryDelta struct {
+	From       string           `json:"from"`
+	To         string           `json:"to"`
+	New        []HistoryFinding `json:"new"`
+	Fixed      []HistoryFinding `json:"fixed"`
+	Persisting []HistoryFinding `json:"persisting"`
+}
+
+// DiffRuns compares the non suppressed findings with the severity or higher
+// of the targets scanned in both runs.
+func DiffRuns(from, to *HistoryRun, severity config.Severity) HistoryDelta {
+	d := HistoryDelta{
+		From:       from.ID,
+		To:         to.ID,
+		New:        []HistoryFinding{},
+		Fixed:      []HistoryFinding{},
+		Persisting: []HistoryFinding{},
+	}
+	common := map[string]bool{}
+	for _, t := range from.Targets {
+		common[t] = true
+	}
+	targets := map[string]bool{}
+	for _, t := range to.Targets {
+		targets[t] = common[t]
+	}
+	threshold := severity.Data().Threshold
+	findings := func(run *HistoryRun) map[BaselineFinding]HistoryFinding {
+		m := map[BaselineFinding]HistoryFinding{}
+		for _, f := range run.Findings {
+			if !f.Suppressed && targets[f.Target] && severityThreshold(f.Severity) >= threshold {
+				m[f.BaselineFinding] = f
+			}
+		}
+		return m
+	}
+	before, after := findings(from), findings(to)
+	for k, f := range after {
+		if _, ok := before[k]; ok {
+			d.Persisting = append(d.Persisting, f)
+		} else {
+			d.New = append(d.New, f)
+		}
+	}
+	for k, f := range before {
+		if _, ok := after[k]; !ok {
+			d.Fixed = append(d.Fixed, f)
+		}
+	}
+	sortHistoryFindings(d.New)
+	sortHistoryFindings(d.Fixed)
+	sortHistoryFindings(d.Persisting)
+	return d
+}
+
+// String returns the delta as text.
+func (d HistoryDelta) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Changes from run %s to %s\n", d.From, d.To)
+	list := func(title string, findings []HistoryFinding) {
+		fmt.Fprintf(&b, "\n%s: %d\n", title, len(findings))
+		for _, f := range findings {
+			line := fmt.Sprintf("  [%s] %s target=%s checktype=%s", f.Severity, f.Summary, f.Target, f.Checktype)
+			if f.AffectedResource != "" {
+				line = fmt.Sprintf("%s resource=%s", line, f.AffectedResource)
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+	list("New vulnerabilities", d.New)
+	list("Fixed vulnerabilities", d.Fixed)
+	list("Persisting vulnerabilities", d.Persisting)
+	return b.String()
+}
+
+// severityThreshold returns the threshold of the severity name.
+func severityThreshold(name string) float32 {
+	var s config.Severity
+	if err := s.UnmarshalText([]byte(name)); err != nil {
+		return 0
+	}
+	return s.Data().Threshold
+}
+
+// sortHistoryFindings sorts the findings by severity, higher first, and
+// identity.
+func sortHistoryFindings(fs []HistoryFinding) {
+	sort.Slice(fs, func(i, j int) bool {
+		fi, fj := fs[i], fs[j]
+		if ti, tj := severityThreshold(fi.Severity), severityThreshold(fj.Severity); ti != tj {
+			return ti > tj
+		}
+		if fi.Score != fj.Score {
+			return fi.Score > fj.Score
+		}
+		if fi.Target != fj.Target {
+			return fi.Target < fj.Target
+		}
+		if fi.Checktype != fj.Checktype {
+			return fi.Checktype < fj.Checktype
+		}
+		if fi.Summary != fj.Summary {
+			return fi.Summary < fj.Summary
+		}
+		if fi.AffectedResource != fj.AffectedResource {
+			return fi.AffectedResource < fj.AffectedResource
+		}
+		return fi.Fingerprint < fj.Fingerprint
+	})
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2022 Adevinta
+*/
+package reporting
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHistory(t *testing.T) {
+	cfg := &config.Config{
+		Targets:   []config.Target{{Target: "."}, {Target: "app:latest"}},
+		Reporting: config.Reporting{Severity: config.SeverityHigh},
+	}
+	dir := t.TempDir()
+	first, err := SaveHistory(dir, cfg, []ExtendedVulnerability{
+		testVuln("vulcan-gitleaks", ".", "Kept", 8.0),
+		testVuln("vulcan-gitleaks", ".", "Fixed", 8.0),
+		testVuln("vulcan-gitleaks", ".", "Low fixed", 1.0),
+		testVuln("vulcan-gitleaks", "app:latest", "Image", 8.0),
+	}, 103)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The second scan doesn't include the image target.
+	cfg.Targets = []config.Target{{Target: "."}}
+	second, err := SaveHistory(dir, cfg, []ExtendedVulnerability{
+		testVuln("vulcan-gitleaks", ".", "Kept", 8.0),
+		testVuln("vulcan-gitleaks", ".", "New", 9.0),
+		testVuln("vulcan-gitleaks", ".", "Excluded", 9.0, withExcluded()),
+		testVuln("vulcan-gitleaks", ".", "Low new", 1.0),
+	}, 104)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first.ID == second.ID {
+		t.Errorf("duplicated run id %s", first.ID)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs, err := LoadHistory(dir, wd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]HistoryRun{*first, *second}, runs); diff != "" {
+		t.Errorf("unexpected runs (-want +got):\n%s", diff)
+	}
+	if others, _ := LoadHistory(dir, "/other"); len(others) != 0 {
+		t.Errorf("unexpected runs of other directory %v", others)
+	}
+
+	summaries := func(fs []HistoryFinding) []string {
+		s := []string{}
+		for _, f := range fs {
+			s = append(s, f.Summary)
+		}
+		return s
+	}
+	d := DiffRuns(&runs[0], &runs[1], config.SeverityHigh)
+	want := map[string][]string{
+		"new":        {"New"},
+		"fixed":      {"Fixed"},
+		"persisting": {"Kept"},
+	}
+	got := map[string][]string{
+		"new":        summaries(d.New),
+		"fixed":      summaries(d.Fixed),
+		"persisting": summaries(d.Persisting),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected delta (-want +got):\n%s", diff)
+	}
+	d = DiffRuns(&runs[0], &runs[1], config.SeverityLow)
+	if diff := cmp.Diff([]string{"New", "Low new"}, summaries(d.New)); diff != "" {
+		t.Errorf("unexpected new findings with LOW severity (-want +got):\n%s", diff)
+	}
+}
+
+func TestFindRun(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02T15:04:05", s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	runs := []HistoryRun{
+		{ID: "a", Time: at("2022-06-01T10:00:00")},
+		{ID: "b", Time: at("2022-06-02T10:00:00")},
+		{ID: "c", Time: at("2022-06-03T10:00:00")},
+	}
+	tests := []struct {
+		since   string
+		want    string
+		wantErr bool
+	}{
+		{since: "b", want: "b"},
+		{since: "2022-06-03", want: "b"},
+		{since: "2022-06-03T11:00:00", want: "c"},
+		{since: "2022-05-01", wantErr: true},
+		{since: "unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.since, func(t *testing.T) {
+			run, err := FindRun(runs, tt.since)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if err == nil && run.ID != tt.want {
+				t.Errorf("unexpected run want=%s got=%s", tt.want, run.ID)
+			}
+		})
+	}
+}
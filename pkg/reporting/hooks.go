@@ -0,0 +1,147 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package reporting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	report "github.com/adevinta/vulcan-report"
+)
+
+const (
+	defaultHookTimeout = 60 * time.Second
+	onFindingHook      = "onFinding"
+	onCompleteHook     = "onComplete"
+)
+
+// hookFinding is the json of a finding sent to the onFinding hook.
+type hookFinding struct {
+	CheckID       string               `json:"checkId"`
+	Checktype     string               `json:"checktype"`
+	Target        string               `json:"target"`
+	Severity      string               `json:"severity"`
+	Override      *Override            `json:"override,omitempty"`
+	Vulnerability report.Vulnerability `json:"vulnerability"`
+}
+
+// runHooks pipes the reported findings to the onFinding hook and the json
+// report to the onComplete hook. The failures are returned unless the hooks
+// are non fatal.
+func runHooks(cfg *config.Config, reports map[string]*report.Report, vs []ExtendedVulnerability, exitCode int, l log.Logger) error {
+	hooks := cfg.Hooks
+	if hooks.OnFinding == "" && hooks.OnComplete == "" {
+		return nil
+	}
+	failed := 0
+	fail := func(name string, err error) {
+		failed++
+		l.Errorf("Hook %s failed: %v", name, err)
+	}
+	env := []string{"VULCAN_EXIT_CODE=" + strconv.Itoa(exitCode)}
+	if hooks.OnFinding != "" {
+		requested := cfg.Reporting.Severity.Data()
+		for _, v := range vs {
+			if !isReported(&v, requested) || v.Suppressed {
+				continue
+			}
+			input, err := json.Marshal(hookFinding{
+				CheckID:       v.CheckID,
+				Checktype:     v.ChecktypeName,
+				Target:        v.Target,
+				Severity:      v.Severity.Name,
+				Override:      v.Override,
+				Vulnerability: *v.Vulnerability,
+			})
+			if err == nil {
+				err = runHook(hooks, onFindingHook, hooks.OnFinding, input, env, l)
+			}
+			if err != nil {
+				fail(onFindingHook, err)
+			}
+		}
+	}
+	if hooks.OnComplete != "" {
+		input, err := jsonReport(cfg, reports, vs)
+		if err == nil {
+			err = runHook(hooks, onCompleteHook, hooks.OnComplete, input, env, l)
+		}
+		if err != nil {
+			fail(onCompleteHook, err)
+		}
+	}
+	if failed > 0 && !hooks.NonFatal {
+		return fmt.Errorf("%d hook executions failed", failed)
+	}
+	return nil
+}
+
+// runHook runs the command in the shell with the input in the stdin.
+func runHook(hooks config.Hooks, name, command string, input []byte, env []string, l log.Logger) error {
+	timeout := defaultHookTimeout
+	if hooks.Timeout > 0 {
+		timeout = time.Duration(hooks.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	cmd.Env = append(append(os.Environ(), "VULCAN_HOOK="+name), env...)
+	// The input and output are files, instead of pipes, so the command
+	// doesn't wait for the processes started by the hook after a timeout.
+	in, err := hookFile(input)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(in.Name())
+	defer in.Close()
+	f, err := hookFile(nil)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	cmd.Stdin = in
+	cmd.Stdout = f
+	cmd.Stderr = f
+	err = cmd.Run()
+	out, _ := os.ReadFile(f.Name())
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timeout after %s", timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%w %s", err, bytes.TrimSpace(out))
+	}
+	l.Debugf("Hook %s executed output=%s", name, bytes.TrimSpace(out))
+	return nil
+}
+
+// hookFile returns a temporary file with the content, ready to be read.
+func hookFile(content []byte) (*os.File, error) {
+	f, err := os.CreateTemp("", "vulcan-hook")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(content); err == nil {
+		_, err = f.Seek(0, 0)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
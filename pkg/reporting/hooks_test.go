@@ -0,0 +1,95 @@
+/*
+Copyright 2022 Adevinta
+*/
+package reporting
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	report "github.com/adevinta/vulcan-report"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunHooks(t *testing.T) {
+	vs := []ExtendedVulnerability{
+		testVuln("vulcan-gitleaks", ".", "Secret", 9.0, withCheckID("check-1")),
+		testVuln("vulcan-gitleaks", ".", "Info", 0, withCheckID("check-1")),
+		testVuln("vulcan-gitleaks", ".", "Suppressed", 9.0, withCheckID("check-1"), withSuppressed()),
+	}
+
+	tests := []struct {
+		name         string
+		hooks        config.Hooks
+		wantErr      bool
+		wantFindings []string
+		wantReport   bool
+	}{
+		{
+			name:         "Hooks",
+			hooks:        config.Hooks{OnFinding: `cat >> "$OUT/findings"; echo >> "$OUT/findings"`, OnComplete: `cat > "$OUT/report"; echo "$VULCAN_EXIT_CODE" > "$OUT/code"`},
+			wantFindings: []string{"Secret"},
+			wantReport:   true,
+		},
+		{
+			name:    "Failure",
+			hooks:   config.Hooks{OnComplete: "exit 1"},
+			wantErr: true,
+		},
+		{
+			name:  "NonFatal",
+			hooks: config.Hooks{OnFinding: "exit 1", NonFatal: true},
+		},
+		{
+			name:    "Timeout",
+			hooks:   config.Hooks{OnComplete: "sleep 5", Timeout: 1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := t.TempDir()
+			t.Setenv("OUT", out)
+			cfg := &config.Config{Hooks: tt.hooks, Reporting: config.Reporting{Severity: config.SeverityLow}}
+			err := runHooks(cfg, nil, vs, 103, loggerUser)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if tt.wantFindings != nil {
+				content, err := os.ReadFile(filepath.Join(out, "findings"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := []string{}
+				for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+					var f hookFinding
+					if err := json.Unmarshal([]byte(line), &f); err != nil {
+						t.Fatal(err)
+					}
+					got = append(got, f.Vulnerability.Summary)
+				}
+				if diff := cmp.Diff(tt.wantFindings, got); diff != "" {
+					t.Errorf("unexpected findings (-want +got):\n%s", diff)
+				}
+			}
+			if tt.wantReport {
+				content, err := os.ReadFile(filepath.Join(out, "report"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				var reports []report.Report
+				if err := json.Unmarshal(content, &reports); err != nil || len(reports) != 1 {
+					t.Errorf("unexpected report %s %v", content, err)
+				}
+				code, _ := os.ReadFile(filepath.Join(out, "code"))
+				if strings.TrimSpace(string(code)) != "103" {
+					t.Errorf("unexpected exit code %q", code)
+				}
+			}
+		})
+	}
+}
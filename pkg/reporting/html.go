@@ -0,0 +1,112 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package reporting
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	report "github.com/adevinta/vulcan-report"
+)
+
+//go:embed html.tmpl
+var htmlTemplate string
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"isLink": func(s string) bool {
+		return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+	},
+	"affectedResource": affectedResource,
+	"lower":            strings.ToLower,
+}).Parse(htmlTemplate))
+
+type htmlReportData struct {
+	Generated time.Time
+	Severity  string
+	Totals    []htmlSeverityGroup
+	Targets   []htmlTarget
+}
+
+type htmlTarget struct {
+	Target     string
+	Count      int
+	Severities []htmlSeverityGroup
+}
+
+type htmlSeverityGroup struct {
+	Name            string
+	Count           int
+	Vulnerabilities []*ExtendedVulnerability
+}
+
+// affectedResource returns the most descriptive affected resource.
+func affectedResource(v *ExtendedVulnerability) string {
+	if v.AffectedResourceString != "" {
+		return v.AffectedResourceString
+	}
+	return v.AffectedResource
+}
+
+// htmlReport generates a standalone html document with the vulnerabilities
+// over the severity threshold grouped by target and severity.
+func htmlReport(cfg *config.Config, _ map[string]*report.Report, vs []ExtendedVulnerability) ([]byte, error) {
+	requested := cfg.Reporting.Severity.Data()
+	byTarget := map[string]map[string][]*ExtendedVulnerability{}
+	totals := map[string]int{}
+	for i := range vs {
+		v := &vs[i]
+		if !isReported(v, requested) {
+			continue
+		}
+		if _, ok := byTarget[v.Target]; !ok {
+			byTarget[v.Target] = map[string][]*ExtendedVulnerability{}
+		}
+		byTarget[v.Target][v.Severity.Name] = append(byTarget[v.Target][v.Severity.Name], v)
+		totals[v.Severity.Name]++
+	}
+
+	data := htmlReportData{
+		Generated: time.Now(),
+		Severity:  requested.Name,
+	}
+	for _, s := range config.Severities() {
+		name := s.Data().Name
+		if s.Data().Threshold >= requested.Threshold {
+			data.Totals = append(data.Totals, htmlSeverityGroup{Name: name, Count: totals[name]})
+		}
+	}
+	targets := []string{}
+	for t := range byTarget {
+		targets = append(targets, t)
+	}
+	sort.Strings(targets)
+	for _, t := range targets {
+		target := htmlTarget{Target: t}
+		for _, s := range config.Severities() {
+			name := s.Data().Name
+			found := byTarget[t][name]
+			if len(found) == 0 {
+				continue
+			}
+			sort.SliceStable(found, func(i, j int) bool {
+				return found[i].Score > found[j].Score
+			})
+			target.Count += len(found)
+			target.Severities = append(target.Severities, htmlSeverityGroup{Name: name, Count: len(found), Vulnerabilities: found})
+		}
+		data.Targets = append(data.Targets, target)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := htmlReportTemplate.Execute(buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2022 Adevinta
+*/
+package reporting
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	report "github.com/adevinta/vulcan-report"
+)
+
+func TestHTMLReport(t *testing.T) {
+	details := func(v *ExtendedVulnerability) {
+		v.CheckData.ChecktypeVersion = "latest"
+		v.Recommendations = []string{"Upgrade the package"}
+		v.References = []string{"https://example.com/ref", "not a link"}
+		v.Resources = []report.ResourcesGroup{
+			{
+				Name:   "Packages",
+				Header: []string{"Name", "Version"},
+				Rows:   []map[string]string{{"Name": "openssl", "Version": "1.0"}},
+			},
+		}
+	}
+	vs := []ExtendedVulnerability{
+		testVuln("vulcan-trivy", "b.example.com", "Medium finding", 5.0, details),
+		testVuln("vulcan-trivy", "a.example.com", "High <script>alert(1)</script>", 8.0, details),
+		testVuln("vulcan-trivy", "a.example.com", "Critical finding", 9.5, details),
+		testVuln("vulcan-trivy", "a.example.com", "Excluded finding", 9.5, details, withExcluded()),
+		testVuln("vulcan-trivy", "a.example.com", "Low finding", 1.0, details),
+	}
+	cfg := &config.Config{Reporting: config.Reporting{Severity: config.SeverityMedium}}
+
+	content, err := htmlReport(cfg, nil, vs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(content)
+	for _, want := range []string{
+		"<summary>a.example.com (2)</summary>",
+		"<summary>b.example.com (1)</summary>",
+		`<a href="https://example.com/ref" target="_blank" rel="noopener">https://example.com/ref</a>`,
+		"<li>not a link</li>",
+		"<li>Upgrade the package</li>",
+		"<td>openssl</td><td>1.0</td>",
+		"High &lt;script&gt;alert(1)&lt;/script&gt;",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected %q in the report", want)
+		}
+	}
+	for _, unwanted := range []string{"<script>", "Excluded finding", "Low finding"} {
+		if strings.Contains(html, unwanted) {
+			t.Errorf("unexpected %q in the report", unwanted)
+		}
+	}
+	// Targets are sorted and severities follow the policy order.
+	order := []string{"a.example.com", "Critical finding", "High &lt;script&gt;", "b.example.com", "Medium finding"}
+	last := -1
+	for _, s := range order {
+		i := strings.Index(html, s)
+		if i < last {
+			t.Errorf("unexpected position of %q", s)
+		}
+		last = i
+	}
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package reporting
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	report "github.com/adevinta/vulcan-report"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitTime formats a duration in seconds as expected by the JUnit consumers.
+func junitTime(d float64) string {
+	return fmt.Sprintf("%.3f", d)
+}
+
+// checkDuration returns the duration in seconds of the check.
+func checkDuration(r *report.Report) float64 {
+	if r.StartTime.IsZero() {
+		return 0
+	}
+	if r.EndTime.IsZero() {
+		return time.Since(r.StartTime).Seconds()
+	}
+	return r.EndTime.Sub(r.StartTime).Seconds()
+}
+
+// junitReport generates a JUnit XML report with a test suite for every target
+// and a test case for every executed check. A test case fails when the check
+// reported vulnerabilities over the severity threshold, and is an error when
+// the check didn't finish.
+func junitReport(cfg *config.Config, reports map[string]*report.Report, vs []ExtendedVulnerability) ([]byte, error) {
+	requested := cfg.Reporting.Severity.Data()
+	byCheck := map[string][]*ExtendedVulnerability{}
+	for i := range vs {
+		v := &vs[i]
+		if isReported(v, requested) && !v.Suppressed {
+			byCheck[v.CheckID] = append(byCheck[v.CheckID], v)
+		}
+	}
+
+	suites := junitTestSuites{Name: "vulcan-local"}
+	index := map[string]int{}
+	durations := map[string]float64{}
+	total := 0.0
+	for _, c := range cfg.Checks {
+		if c.Checktype == nil {
+			// The check was excluded by filters
+			continue
+		}
+		suite := fmt.Sprintf("%s (%s)", c.Target, c.AssetType)
+		i, ok := index[suite]
+		if !ok {
+			i = len(suites.Suites)
+			index[suite] = i
+			suites.Suites = append(suites.Suites, junitTestSuite{Name: suite, TestCases: []junitTestCase{}})
+		}
+		tc := junitTestCase{
+			Name:      c.Checktype.Name,
+			ClassName: suite,
+		}
+		duration := 0.0
+		r, ok := reports[c.Id]
+		switch {
+		case !ok:
+			tc.Error = &junitFailure{Message: "check without results", Type: "UNKNOWN"}
+		case r.Status != "FINISHED":
+			duration = checkDuration(r)
+			tc.Error = &junitFailure{Message: fmt.Sprintf("check status %s", r.Status), Type: r.Status}
+		default:
+			duration = checkDuration(r)
+		}
+		if found := byCheck[c.Id]; len(found) > 0 {
+			max := found[0].Severity
+			lines := []string{}
+			for _, v := range found {
+				if v.Severity.Threshold > max.Threshold {
+					max = v.Severity
+				}
+				line := fmt.Sprintf("[%s] %s", v.Severity.Name, v.Summary)
+				if v.AffectedResource != "" {
+					line = fmt.Sprintf("%s - %s", line, v.AffectedResource)
+				}
+				lines = append(lines, line)
+			}
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d vulnerabilities over %s severity threshold", len(found), requested.Name),
+				Type:    max.Name,
+				Text:    strings.Join(lines, "\n"),
+			}
+		}
+		tc.Time = junitTime(duration)
+		durations[suite] += duration
+		total += duration
+
+		s := &suites.Suites[i]
+		s.Tests++
+		suites.Tests++
+		if tc.Failure != nil {
+			s.Failures++
+			suites.Failures++
+		}
+		if tc.Error != nil {
+			s.Errors++
+			suites.Errors++
+		}
+		s.TestCases = append(s.TestCases, tc)
+	}
+	for i := range suites.Suites {
+		suites.Suites[i].Time = junitTime(durations[suites.Suites[i].Name])
+	}
+	suites.Time = junitTime(total)
+
+	content, err := xml.MarshalIndent(suites, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), content...), nil
+}
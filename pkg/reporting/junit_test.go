@@ -0,0 +1,85 @@
+/*
+Copyright 2022 Adevinta
+*/
+package reporting
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/checktypes"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	report "github.com/adevinta/vulcan-report"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestJunitReport(t *testing.T) {
+	check := func(id, name, target string) config.Check {
+		return config.Check{
+			Id:        id,
+			Type:      checktypes.ChecktypeRef(name),
+			Target:    target,
+			AssetType: "GitRepository",
+			Checktype: &checktypes.Checktype{Name: name},
+		}
+	}
+	cfg := &config.Config{
+		Checks: []config.Check{
+			check("1", "vulcan-gitleaks", "."),
+			check("2", "vulcan-semgrep", "."),
+			check("3", "vulcan-trivy", "."),
+			check("4", "vulcan-gitleaks", "other"),
+			{Type: "filtered", Target: "."},
+		},
+		Reporting: config.Reporting{Severity: config.SeverityHigh},
+	}
+	reports := map[string]*report.Report{
+		"1": {CheckData: report.CheckData{CheckID: "1", Status: "FINISHED"}},
+		"2": {CheckData: report.CheckData{CheckID: "2", Status: "FINISHED"}},
+		"3": {CheckData: report.CheckData{CheckID: "3", Status: "FAILED"}},
+	}
+	vs := []ExtendedVulnerability{
+		testVuln("", "", "Secret Leaked", 8.9, withCheckID("1")),
+		testVuln("", "", "Critical Secret Leaked", 9.5, withCheckID("1")),
+		testVuln("", "", "Excluded", 8.9, withCheckID("2"), withExcluded()),
+		testVuln("", "", "Low", 1.0, withCheckID("2")),
+	}
+
+	content, err := junitReport(cfg, reports, vs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got junitTestSuites
+	if err := xml.Unmarshal(content, &got); err != nil {
+		t.Fatalf("invalid xml %v", err)
+	}
+
+	type testCase struct {
+		Suite, Name, Failure, Error string
+	}
+	gotCases := []testCase{}
+	for _, s := range got.Suites {
+		for _, tc := range s.TestCases {
+			c := testCase{Suite: s.Name, Name: tc.Name}
+			if tc.Failure != nil {
+				c.Failure = tc.Failure.Type
+			}
+			if tc.Error != nil {
+				c.Error = tc.Error.Type
+			}
+			gotCases = append(gotCases, c)
+		}
+	}
+	want := []testCase{
+		{Suite: ". (GitRepository)", Name: "vulcan-gitleaks", Failure: "CRITICAL"},
+		{Suite: ". (GitRepository)", Name: "vulcan-semgrep"},
+		{Suite: ". (GitRepository)", Name: "vulcan-trivy", Error: "FAILED"},
+		{Suite: "other (GitRepository)", Name: "vulcan-gitleaks", Error: "UNKNOWN"},
+	}
+	if diff := cmp.Diff(want, gotCases); diff != "" {
+		t.Errorf("unexpected test cases (-want +got):\n%s", diff)
+	}
+	if got.Tests != 4 || got.Failures != 1 || got.Errors != 2 {
+		t.Errorf("unexpected totals tests=%d failures=%d errors=%d", got.Tests, got.Failures, got.Errors)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package reporting
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-local/pkg/config"
+)
+
+// Override records the change of the severity of a vulnerability by one of
+// the overrides of the config.
+type Override struct {
+	OriginalSeverity *config.SeverityData
+	OriginalScore    float32
+	Reason           string
+}
+
+func (o *Override) String() string {
+	if o.Reason == "" {
+		return fmt.Sprintf("original severity %s", o.OriginalSeverity.Name)
+	}
+	return fmt.Sprintf("original severity %s, %s", o.OriginalSeverity.Name, o.Reason)
+}
+
+// labels returns the labels added to the vulnerability in the json report to
+// preserve its original severity.
+func (o *Override) labels() []string {
+	return []string{
+		"original-severity:" + o.OriginalSeverity.Name,
+		"original-score:" + strconv.FormatFloat(float64(o.OriginalScore), 'f', 1, 32),
+	}
+}
+
+// matchesOverride returns true if the override applies to the vulnerability
+// found by the check.
+func matchesOverride(v *ExtendedVulnerability, c *config.Check, o config.Override) bool {
+	if o.Severity == nil || c.Checktype == nil || o.Check != c.Checktype.Name {
+		return false
+	}
+	if o.Target != "" && o.Target != v.Target {
+		return false
+	}
+	return o.ID == "" || o.ID == v.ID || o.ID == v.Fingerprint || o.ID == v.Summary
+}
+
+// applyOverrides sets the severity, and the score, of the first override
+// matching the vulnerability. The score is the min of the severity, so the
+// thresholds and the exit code are evaluated with the new severity.
+func applyOverrides(v *ExtendedVulnerability, c *config.Check, overrides []config.Override) {
+	for _, o := range overrides {
+		if !matchesOverride(v, c, o) {
+			continue
+		}
+		v.Override = &Override{
+			OriginalSeverity: v.Severity,
+			OriginalScore:    v.Score,
+			Reason:           o.Reason,
+		}
+		v.Severity = o.Severity.Data()
+		v.Score = v.Severity.Threshold
+		return
+	}
+}
+
+// checkOverrides logs the overrides without a reason, and the ones ignored
+// because they don't set the severity.
+func checkOverrides(cfg *config.Config, l log.Logger) {
+	for _, o := range cfg.Reporting.Overrides {
+		if o.Severity == nil {
+			l.Errorf("Ignoring override without severity check=%s id=%s", o.Check, o.ID)
+			continue
+		}
+		if o.Reason == "" {
+			l.Infof("Missing reason for the override check=%s id=%s severity=%s", o.Check, o.ID, o.Severity.Data().Name)
+		}
+	}
+}
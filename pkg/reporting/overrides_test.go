@@ -0,0 +1,92 @@
+/*
+Copyright 2022 Adevinta
+*/
+package reporting
+
+import (
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/checktypes"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	report "github.com/adevinta/vulcan-report"
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func severityPtr(s config.Severity) *config.Severity {
+	return &s
+}
+
+func TestApplyOverrides(t *testing.T) {
+	check := &config.Check{Target: ".", Checktype: &checktypes.Checktype{Name: "vulcan-trivy"}}
+	tests := []struct {
+		name      string
+		overrides string
+		vuln      report.Vulnerability
+		wantScore float32
+		want      *Override
+	}{
+		{
+			name:      "WholeCheck",
+			overrides: `[{check: vulcan-trivy, severity: INFO, reason: dev dependencies}]`,
+			vuln:      report.Vulnerability{Summary: "CVE-2022-1", Score: 9.8},
+			wantScore: 0,
+			want:      &Override{OriginalSeverity: config.SeverityCritical.Data(), OriginalScore: 9.8, Reason: "dev dependencies"},
+		},
+		{
+			name:      "Fingerprint",
+			overrides: `[{check: vulcan-trivy, id: fp1, severity: HIGH}]`,
+			vuln:      report.Vulnerability{Summary: "CVE-2022-1", Fingerprint: "fp1", Score: 5.0},
+			wantScore: 7.0,
+			want:      &Override{OriginalSeverity: config.SeverityMedium.Data(), OriginalScore: 5.0},
+		},
+		{
+			name:      "FirstMatch",
+			overrides: `[{check: vulcan-trivy, id: CVE-2022-1, severity: LOW}, {check: vulcan-trivy, severity: INFO}]`,
+			vuln:      report.Vulnerability{Summary: "CVE-2022-1", Score: 5.0},
+			wantScore: 0.1,
+			want:      &Override{OriginalSeverity: config.SeverityMedium.Data(), OriginalScore: 5.0},
+		},
+		{
+			name:      "OtherCheck",
+			overrides: `[{check: vulcan-zap, severity: INFO}]`,
+			vuln:      report.Vulnerability{Summary: "CVE-2022-1", Score: 5.0},
+			wantScore: 5.0,
+		},
+		{
+			name:      "OtherTarget",
+			overrides: `[{check: vulcan-trivy, target: other, severity: INFO}]`,
+			vuln:      report.Vulnerability{Summary: "CVE-2022-1", Score: 5.0},
+			wantScore: 5.0,
+		},
+		{
+			name:      "WithoutSeverity",
+			overrides: `[{check: vulcan-trivy, reason: missing}]`,
+			vuln:      report.Vulnerability{Summary: "CVE-2022-1", Score: 5.0},
+			wantScore: 5.0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var overrides []config.Override
+			if err := yaml.Unmarshal([]byte(tt.overrides), &overrides); err != nil {
+				t.Fatal(err)
+			}
+			v := ExtendedVulnerability{
+				CheckData:     &report.CheckData{Target: "."},
+				Vulnerability: &tt.vuln,
+				Severity:      config.FindSeverityByScore(tt.vuln.Score).Data(),
+			}
+			applyOverrides(&v, check, overrides)
+			if diff := cmp.Diff(tt.want, v.Override); diff != "" {
+				t.Errorf("unexpected override (-want +got):\n%s", diff)
+			}
+			if v.Score != tt.wantScore {
+				t.Errorf("unexpected score got=%v want=%v", v.Score, tt.wantScore)
+			}
+			if got, want := v.Severity.Severity, config.FindSeverityByScore(tt.wantScore); got != want {
+				t.Errorf("unexpected severity got=%v want=%v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package reporting
+
+import (
+	"github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-local/pkg/config"
+)
+
+// policyExitCode evaluates the fail on rules against the not excluded nor
+// suppressed vulnerabilities. The exit code is the one of the max severity
+// of the vulnerabilities matching the failed rules, and the LOW one when
+// the rules only match INFO vulnerabilities.
+func policyExitCode(rules []config.FailOnRule, vs []ExtendedVulnerability, l log.Logger) int {
+	exit := config.SuccessExitCode
+	for _, r := range rules {
+		min := r.MinSeverity().Data()
+		count := 0
+		var maxScore float32 = -1.0
+		for _, v := range vs {
+			if v.Excluded || v.Suppressed {
+				continue
+			}
+			if r.Check != "" && v.ChecktypeName != r.Check {
+				continue
+			}
+			if v.Severity.Threshold < min.Threshold {
+				continue
+			}
+			count++
+			if v.Score > maxScore {
+				maxScore = v.Score
+			}
+		}
+		if count < r.MinCount() {
+			continue
+		}
+		code := config.FindSeverityByScore(maxScore).Data().Exit
+		if code == config.SuccessExitCode {
+			code = config.SeverityLow.Data().Exit
+		}
+		l.Infof("Failed policy rule %s with %d vulnerabilities", r, count)
+		if code > exit {
+			exit = code
+		}
+	}
+	return exit
+}
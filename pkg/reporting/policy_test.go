@@ -0,0 +1,73 @@
+/*
+Copyright 2022 Adevinta
+*/
+package reporting
+
+import (
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"gopkg.in/yaml.v3"
+)
+
+func TestPolicyExitCode(t *testing.T) {
+	vs := []ExtendedVulnerability{
+		testVuln("vulcan-trivy", "", "", 5.0),
+		testVuln("vulcan-trivy", "", "", 7.5),
+		testVuln("vulcan-gitleaks", "", "", 0),
+		testVuln("vulcan-trivy", "", "", 9.5, withExcluded()),
+		testVuln("vulcan-trivy", "", "", 9.5, withSuppressed()),
+	}
+	tests := []struct {
+		name   string
+		policy string
+		want   int
+	}{
+		{
+			name:   "HighFound",
+			policy: `failOn: [{severity: HIGH, count: 1}]`,
+			want:   config.SeverityHigh.Data().Exit,
+		},
+		{
+			name:   "CriticalIgnoresExcludedAndSuppressed",
+			policy: `failOn: [{severity: CRITICAL}]`,
+			want:   config.SuccessExitCode,
+		},
+		{
+			name:   "CountNotReached",
+			policy: `failOn: [{severity: MEDIUM, count: 3}]`,
+			want:   config.SuccessExitCode,
+		},
+		{
+			name:   "CountReached",
+			policy: `failOn: [{severity: MEDIUM, count: 2}]`,
+			want:   config.SeverityHigh.Data().Exit,
+		},
+		{
+			name:   "Check",
+			policy: `failOn: [{check: vulcan-gitleaks, severity: MEDIUM}, {check: vulcan-trivy, severity: MEDIUM}]`,
+			want:   config.SeverityHigh.Data().Exit,
+		},
+		{
+			name:   "CheckWithoutVulnerabilities",
+			policy: `failOn: [{check: vulcan-zap}]`,
+			want:   config.SuccessExitCode,
+		},
+		{
+			name:   "InfoOnly",
+			policy: `failOn: [{check: vulcan-gitleaks}]`,
+			want:   config.SeverityLow.Data().Exit,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p config.ExitPolicy
+			if err := yaml.Unmarshal([]byte(tt.policy), &p); err != nil {
+				t.Fatal(err)
+			}
+			if got := policyExitCode(p.FailOn, vs, loggerUser); got != tt.want {
+				t.Errorf("unexpected exit code got=%d want=%d", got, tt.want)
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -76,6 +77,7 @@ func parseReports(reports map[string]*report.Report, cfg *config.Config, l log.L
 				Severity:      config.FindSeverityByScore(v.Score).Data(),
 			}
 			updateReport(&extended, &check)
+			applyOverrides(&extended, &check, cfg.Reporting.Overrides)
 			extended.Excluded = isExcluded(&extended, &cfg.Reporting.Exclusions)
 			vulns = append(vulns, extended)
 		}
@@ -175,12 +177,132 @@ func ShowProgress(cfg *config.Config, results *results.ResultsServer, l log.Logg
 	l.Infof("Check progress %s", strings.TrimPrefix(fmt.Sprintf("%v", statusMap), "map"))
 }
 
+// suppressedLabel is added to the vulnerabilities suppressed by the baseline
+// in the json report.
+const suppressedLabel = "suppressed"
+
+// reportWriter encodes the results of a scan in a concrete format. The
+// reports are indexed by check id.
+type reportWriter func(cfg *config.Config, reports map[string]*report.Report, vs []ExtendedVulnerability) ([]byte, error)
+
+// writers contains the supported report formats.
+var writers = map[string]reportWriter{
+	"github":                     githubReport,
+	"gitlab-dependency-scanning": gitlabWriter(gitlabDependencyScanning),
+	"gitlab-sast":                gitlabWriter(gitlabSAST),
+	"html":                       htmlReport,
+	"json":                       jsonReport,
+	"junit":                      junitReport,
+	"sarif":                      sarifReport,
+}
+
+// Formats returns the names of the supported report formats.
+func Formats() []string {
+	formats := []string{}
+	for f := range writers {
+		formats = append(formats, f)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// isReported returns true if the vulnerability must be included in the report.
+func isReported(v *ExtendedVulnerability, requested *config.SeverityData) bool {
+	return !v.Excluded && v.Severity.Threshold >= requested.Threshold
+}
+
+// sortByTarget returns a copy of the vulnerabilities sorted by target,
+// keeping the order of the vulnerabilities of every target.
+func sortByTarget(vs []ExtendedVulnerability) []ExtendedVulnerability {
+	sorted := append([]ExtendedVulnerability{}, vs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Target < sorted[j].Target
+	})
+	return sorted
+}
+
+// jsonReport recreates the original reports filtering the excluded
+// vulnerabilities and the ones under the severity threshold. The reports are
+// grouped by target.
+func jsonReport(cfg *config.Config, _ map[string]*report.Report, vs []ExtendedVulnerability) ([]byte, error) {
+	// TODO: Decide if we want to keep filtering JSON output by threshold and exclusion
+	requested := cfg.Reporting.Severity.Data()
+	m := map[string]*report.Report{}
+	slice := []*report.Report{}
+	for _, e := range sortByTarget(vs) {
+		r, ok := m[e.CheckID]
+		if !ok {
+			r = &report.Report{CheckData: *e.CheckData}
+			m[e.CheckID] = r
+			slice = append(slice, r)
+		}
+		if isReported(&e, requested) {
+			v := *(e.Vulnerability)
+			if e.Suppressed {
+				v.Labels = append(append([]string{}, v.Labels...), suppressedLabel)
+			}
+			if e.Override != nil {
+				v.Labels = append(append([]string{}, v.Labels...), e.Override.labels()...)
+			}
+			if others := e.checktypes()[1:]; len(others) > 0 {
+				labels := append([]string{}, v.Labels...)
+				for _, name := range others {
+					labels = append(labels, duplicateLabel+name)
+				}
+				v.Labels = labels
+			}
+			r.Vulnerabilities = append(r.Vulnerabilities, v)
+		}
+	}
+	return json.MarshalIndent(slice, "", "    ")
+}
+
+// writeOutput writes the content to the output file, or to the standard
+// output if the file is "-".
+func writeOutput(outputFile string, content []byte) error {
+	if outputFile == "-" {
+		fmt.Fprint(os.Stdout, string(content))
+		return nil
+	}
+	dir := filepath.Dir(outputFile)
+	err := os.MkdirAll(dir, 0o744)
+	if err != nil {
+		return fmt.Errorf("failed to create directory %s: %s", dir, err)
+	}
+	f, err := os.OpenFile(outputFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("unable to open report file %s %+v", outputFile, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(content); err != nil {
+		return fmt.Errorf("unable to write report file %s %+v", outputFile, err)
+	}
+	return nil
+}
+
+// Findings returns the vulnerabilities of the reports in the results server,
+// marking the excluded and suppressed ones.
+func Findings(cfg *config.Config, results *results.ResultsServer) ([]ExtendedVulnerability, error) {
+	vs := parseReports(results.Checks, cfg, nil)
+	if cfg.Reporting.Dedup {
+		vs = dedup(vs)
+	}
+	baseline, err := LoadBaseline(cfg.Reporting.Baseline)
+	if err != nil {
+		return nil, err
+	}
+	suppress(vs, baseline)
+	return vs, nil
+}
+
 func Generate(cfg *config.Config, results *results.ResultsServer, l log.Logger) (int, error) {
-	if cfg.Reporting.Format != "json" {
+	writer, ok := writers[cfg.Reporting.Format]
+	if !ok {
 		return config.ErrorExitCode, fmt.Errorf("report format unknown %s", cfg.Reporting.Format)
 	}
 
 	checkExclusionDescriptions(cfg, l)
+	checkOverrides(cfg, l)
 
 	checkRequiredVariables(cfg, results.Checks, l)
 
@@ -188,72 +310,114 @@ func Generate(cfg *config.Config, results *results.ResultsServer, l log.Logger)
 
 	// Print results when no output file is set
 	vs := parseReports(results.Checks, cfg, l)
+	if cfg.Reporting.Dedup {
+		vs = dedup(vs)
+	}
+
+	baseline, err := LoadBaseline(cfg.Reporting.Baseline)
+	if err != nil {
+		return config.ErrorExitCode, err
+	}
+	if cfg.Reporting.UpdateBaseline {
+		baseline = NewBaseline(vs)
+		if err := baseline.Save(cfg.Reporting.Baseline); err != nil {
+			return config.ErrorExitCode, err
+		}
+		l.Infof("Baseline %s updated with %d findings", cfg.Reporting.Baseline, len(baseline.Findings))
+	}
+	suppress(vs, baseline)
 
 	// Print summary table
 	summaryTable(vs, l)
 
+	if t := targetsTable(vs); t != "" {
+		l.Infof(t)
+	}
+
+	// The details of the vulnerabilities are grouped in a section per target
+	// when there are several targets.
 	var rs string
-	for _, s := range config.Severities() {
-		sd := s.Data()
-		for _, v := range vs {
-			if v.Severity.Name == sd.Name && !v.Excluded && v.Severity.Threshold >= requested.Threshold {
-				rs = fmt.Sprintf("%s%s", rs, printVulnerability(&v, l))
+	groups := groupByTarget(vs)
+	for _, g := range groups {
+		var section string
+		for _, s := range config.Severities() {
+			sd := s.Data()
+			for _, v := range g.vulns {
+				if v.Severity.Name == sd.Name && isReported(&v, requested) && !v.Suppressed {
+					section = fmt.Sprintf("%s%s", section, printVulnerability(&v, l))
+				}
 			}
 		}
+		if section != "" && len(groups) > 1 {
+			section = targetHeader(g.target) + section
+		}
+		rs += section
 	}
 	if len(rs) > 0 {
 		l.Infof("\nVulnerabilities details:\n%s", rs)
 	}
 
 	outputFile := cfg.Reporting.OutputFile
+	if cfg.Reporting.Format == githubFormat {
+		// The workflow commands are read from the stdout.
+		if outputFile == "" {
+			outputFile = "-"
+		}
+		if err := writeStepSummary(cfg, vs); err != nil {
+			return config.ErrorExitCode, err
+		}
+	}
 	if outputFile != "" {
-		// TODO: Decide if we want to keep filtering JSON output by threshold and exclusion
-		// Recreates the original report map filtering the Excluded and Threshold
-		// json: Just print the reports as an slice
-		m := map[string]*report.Report{}
-		slice := []*report.Report{}
-		for _, e := range vs {
-			r, ok := m[e.CheckID]
-			if !ok {
-				r = &report.Report{CheckData: *e.CheckData}
-				m[e.CheckID] = r
-				slice = append(slice, r)
-			}
-			if !e.Excluded && e.Severity.Threshold >= requested.Threshold {
-				r.Vulnerabilities = append(r.Vulnerabilities, *(e.Vulnerability))
-			}
+		content, err := writer(cfg, results.Checks, vs)
+		if err != nil {
+			return config.ErrorExitCode, fmt.Errorf("unable to generate %s report: %w", cfg.Reporting.Format, err)
 		}
-		str, _ := json.MarshalIndent(slice, "", "    ")
-		if outputFile == "-" {
-			fmt.Fprint(os.Stdout, string(str))
-		} else {
-			dir := filepath.Dir(outputFile)
-			err := os.MkdirAll(dir, 0o744)
-			if err != nil {
-				return config.ErrorExitCode, fmt.Errorf("failed to create directory %s: %s", dir, err)
-			}
-			f, err := os.OpenFile(outputFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
-			if err != nil {
-				return config.ErrorExitCode, fmt.Errorf("unable to open report file %s %+v", outputFile, err)
-			}
-			defer f.Close()
-			if _, err := f.Write(str); err != nil {
-				return config.ErrorExitCode, fmt.Errorf("unable to write report file %s %+v", outputFile, err)
-			}
+		if err := writeOutput(outputFile, content); err != nil {
+			return config.ErrorExitCode, err
+		}
+	}
+
+	if cfg.Reporting.SBOM != "" {
+		content, err := sbomReport(cfg, results.Checks)
+		if err != nil {
+			return config.ErrorExitCode, fmt.Errorf("unable to generate sbom: %w", err)
 		}
+		if err := writeOutput(cfg.Reporting.SBOM, content); err != nil {
+			return config.ErrorExitCode, err
+		}
+	}
+
+	if cfg.Reporting.Upload.URL != "" {
+		if err := upload(cfg, results.Checks, l); err != nil {
+			return config.ErrorExitCode, err
+		}
+	}
+
+	code := exitCode(cfg, vs, l)
+	if err := runHooks(cfg, results.Checks, vs, code, l); err != nil {
+		return config.ErrorExitCode, err
+	}
+	return code, nil
+}
+
+// exitCode returns the exit code of the findings given by the policy if set,
+// or by the max severity over the severity threshold.
+func exitCode(cfg *config.Config, vs []ExtendedVulnerability, l log.Logger) int {
+	if len(cfg.Reporting.Policy.FailOn) > 0 {
+		return policyExitCode(cfg.Reporting.Policy.FailOn, vs, l)
 	}
 
 	// Get max reported score in vulnerabilities
 	var maxScore float32 = -1.0
 	for _, v := range vs {
-		if v.Score > float32(maxScore) && !v.Excluded {
+		if v.Score > float32(maxScore) && !v.Excluded && !v.Suppressed {
 			maxScore = v.Score
 		}
 	}
 
-	if current := config.FindSeverityByScore(maxScore).Data(); current.Threshold >= requested.Threshold {
-		return current.Exit, nil
+	if current := config.FindSeverityByScore(maxScore).Data(); current.Threshold >= cfg.Reporting.Severity.Data().Threshold {
+		return current.Exit
 	}
 
-	return config.SuccessExitCode, nil
+	return config.SuccessExitCode
 }
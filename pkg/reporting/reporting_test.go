@@ -5,6 +5,7 @@ package reporting
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"strings"
 	"testing"
@@ -35,6 +36,54 @@ func init() {
 	}
 }
 
+// vulnOption sets a field of the findings returned by testVuln.
+type vulnOption func(v *ExtendedVulnerability)
+
+// withResource sets the affected resource of the finding.
+func withResource(resource string) vulnOption {
+	return func(v *ExtendedVulnerability) { v.AffectedResource = resource }
+}
+
+// withCheckID sets the id of the check reporting the finding.
+func withCheckID(id string) vulnOption {
+	return func(v *ExtendedVulnerability) { v.CheckData.CheckID = id }
+}
+
+// withFingerprint sets the fingerprint of the finding.
+func withFingerprint(fp string) vulnOption {
+	return func(v *ExtendedVulnerability) { v.Fingerprint = fp }
+}
+
+// withExcluded marks the finding as excluded.
+func withExcluded() vulnOption {
+	return func(v *ExtendedVulnerability) { v.Excluded = true }
+}
+
+// withSuppressed marks the finding as suppressed.
+func withSuppressed() vulnOption {
+	return func(v *ExtendedVulnerability) { v.Suppressed = true }
+}
+
+// testVuln returns a finding of the checktype in the target with the summary
+// and the severity of the score, modified by the opts.
+func testVuln(checktype, target, summary string, score float32, opts ...vulnOption) ExtendedVulnerability {
+	v := ExtendedVulnerability{
+		CheckData: &report.CheckData{
+			ChecktypeName: checktype,
+			Target:        target,
+		},
+		Vulnerability: &report.Vulnerability{
+			Summary: summary,
+			Score:   score,
+		},
+		Severity: config.FindSeverityByScore(score).Data(),
+	}
+	for _, opt := range opts {
+		opt(&v)
+	}
+	return v
+}
+
 func TestIsExcluded(t *testing.T) {
 
 	tests := []struct {
@@ -247,6 +296,42 @@ func TestParseReports(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Override",
+			cfg: &config.Config{
+				Checks: []config.Check{
+					{
+						Id:        "123456",
+						Type:      "vulcan-zap",
+						Target:    "http://localhost",
+						Checktype: &checktypes.Checktype{Name: "vulcan-zap"},
+					},
+				},
+				Reporting: config.Reporting{
+					Overrides: []config.Override{{Check: "vulcan-zap", ID: "CSP Header Not Set", Severity: severityPtr(config.SeverityLow), Reason: "internal app"}},
+				},
+			},
+			reports: map[string]*report.Report{
+				"123456": {
+					CheckData: report.CheckData{ChecktypeName: "vulcan-zap", Target: "http://localhost"},
+					ResultData: report.ResultData{
+						Vulnerabilities: []report.Vulnerability{{Summary: "CSP Header Not Set", Score: 6.9}},
+					},
+				},
+			},
+			want: []ExtendedVulnerability{
+				{
+					CheckData:     &report.CheckData{ChecktypeName: "vulcan-zap", Target: "http://localhost"},
+					Vulnerability: &report.Vulnerability{Summary: "CSP Header Not Set", Score: 0.1},
+					Severity:      config.SeverityLow.Data(),
+					Override: &Override{
+						OriginalSeverity: config.SeverityMedium.Data(),
+						OriginalScore:    6.9,
+						Reason:           "internal app",
+					},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -471,3 +556,28 @@ func TestUpdateReport(t *testing.T) {
 		})
 	}
 }
+
+func TestJSONReportTargets(t *testing.T) {
+	cfg := &config.Config{Reporting: config.Reporting{Severity: config.SeverityInfo}}
+	vs := []ExtendedVulnerability{
+		testVuln("vulcan-trivy", "./service-b", "CVE-2022-1234", 9, withCheckID("1")),
+		testVuln("vulcan-trivy", "./service-a", "CVE-2022-1234", 9, withCheckID("2")),
+		testVuln("vulcan-gitleaks", "./service-b", "Secret", 8, withCheckID("3")),
+	}
+	content, err := jsonReport(cfg, nil, vs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var reports []report.Report
+	if err := json.Unmarshal(content, &reports); err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, r := range reports {
+		got = append(got, r.Target+" "+r.CheckID)
+	}
+	want := []string{"./service-a 2", "./service-b 1", "./service-b 3"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected reports (-want +got):\n%s", diff)
+	}
+}
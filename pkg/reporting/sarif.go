@@ -0,0 +1,299 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package reporting
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	report "github.com/adevinta/vulcan-report"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+
+	// sarifFingerprintKey is the key of the partial fingerprint containing
+	// the vulcan fingerprint of the vulnerability.
+	sarifFingerprintKey = "vulcanFingerprint/v1"
+)
+
+// The following types define the subset of the SARIF 2.1.0 object model
+// (https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html) used by
+// vulcan-local.
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name    string      `json:"name"`
+	Version string      `json:"version,omitempty"`
+	Rules   []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string                 `json:"id"`
+	Name             string                 `json:"name,omitempty"`
+	ShortDescription sarifMessage           `json:"shortDescription"`
+	FullDescription  *sarifMessage          `json:"fullDescription,omitempty"`
+	Help             *sarifMessage          `json:"help,omitempty"`
+	HelpURI          string                 `json:"helpUri,omitempty"`
+	Properties       map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string                 `json:"ruleId"`
+	RuleIndex           int                    `json:"ruleIndex"`
+	Level               string                 `json:"level"`
+	Message             sarifMessage           `json:"message"`
+	Locations           []sarifLocation        `json:"locations,omitempty"`
+	PartialFingerprints map[string]string      `json:"partialFingerprints,omitempty"`
+	Suppressions        []sarifSuppression     `json:"suppressions,omitempty"`
+	Properties          map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName,omitempty"`
+}
+
+var (
+	nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+
+	// fileLineRegexp matches resources like "path/to/file.go:12" or
+	// "path/to/file.go#L12".
+	fileLineRegexp = regexp.MustCompile(`^([^\s:#]+)(?::|#L)(\d+)(?::\d+)?$`)
+)
+
+// ruleID generates the identifier of the rule for a vulnerability from its
+// summary, as the vulnerability IDs are not stable between scans.
+func ruleID(summary string) string {
+	id := strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToLower(summary), "-"), "-")
+	if id == "" {
+		return "vulnerability"
+	}
+	return id
+}
+
+// sarifLevel maps the severity of a vulnerability to a SARIF result level.
+func sarifLevel(s config.Severity) string {
+	switch s {
+	case config.SeverityCritical, config.SeverityHigh:
+		return "error"
+	case config.SeverityMedium:
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// fileLocation extracts the file and line from an affected resource when
+// it's expressed as a file path.
+func fileLocation(resource string) (string, int, bool) {
+	if resource == "" || strings.Contains(resource, "://") || strings.ContainsAny(resource, " \t\n") {
+		return "", 0, false
+	}
+	if m := fileLineRegexp.FindStringSubmatch(resource); m != nil {
+		line, err := strconv.Atoi(m[2])
+		if err == nil {
+			return m[1], line, true
+		}
+	}
+	return resource, 0, true
+}
+
+// isLocalPath returns true if the target of the check is a local directory.
+func isLocalPath(target string) bool {
+	info, err := os.Stat(target)
+	return err == nil && info.IsDir()
+}
+
+func sarifLocations(v *ExtendedVulnerability) []sarifLocation {
+	resource := v.AffectedResource
+	if resource == "" {
+		resource = v.AffectedResourceString
+	}
+	if file, line, ok := fileLocation(resource); ok && isLocalPath(v.Target) {
+		loc := sarifLocation{
+			PhysicalLocation: &sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: file},
+			},
+		}
+		if line > 0 {
+			loc.PhysicalLocation.Region = &sarifRegion{StartLine: line}
+		}
+		return []sarifLocation{loc}
+	}
+	name := resource
+	if name == "" {
+		name = v.Target
+	}
+	return []sarifLocation{{
+		LogicalLocations: []sarifLogicalLocation{{
+			Name:               name,
+			FullyQualifiedName: fmt.Sprintf("%s/%s", v.Target, name),
+		}},
+	}}
+}
+
+func sarifRuleFor(v *ExtendedVulnerability) sarifRule {
+	r := sarifRule{
+		ID:               ruleID(v.Summary),
+		Name:             v.Summary,
+		ShortDescription: sarifMessage{Text: v.Summary},
+		Properties: map[string]interface{}{
+			"security-severity": strconv.FormatFloat(float64(v.Score), 'f', 1, 32),
+			"tags":              []string{"security"},
+		},
+	}
+	if v.Description != "" {
+		r.FullDescription = &sarifMessage{Text: v.Description}
+	}
+	if v.CWEID != 0 {
+		r.Properties["tags"] = []string{"security", fmt.Sprintf("external/cwe/cwe-%d", v.CWEID)}
+	}
+	help := []string{}
+	if len(v.Recommendations) > 0 && v.Recommendations[0] != "" {
+		help = append(help, "Recommendations:")
+		for _, rec := range v.Recommendations {
+			help = append(help, "- "+rec)
+		}
+	}
+	if len(v.References) > 0 && v.References[0] != "" {
+		help = append(help, "References:")
+		for _, ref := range v.References {
+			help = append(help, "- "+ref)
+		}
+		r.HelpURI = v.References[0]
+	}
+	if len(help) > 0 {
+		r.Help = &sarifMessage{Text: strings.Join(help, "\n")}
+	}
+	return r
+}
+
+// sarifReport generates a SARIF log with a run for every checktype that
+// reported vulnerabilities over the severity threshold. The results of the
+// runs are grouped by target.
+func sarifReport(cfg *config.Config, _ map[string]*report.Report, vs []ExtendedVulnerability) ([]byte, error) {
+	requested := cfg.Reporting.Severity.Data()
+	runs := map[string]*sarifRun{}
+	rules := map[string]map[string]int{}
+	vs = sortByTarget(vs)
+	for i := range vs {
+		v := &vs[i]
+		if !isReported(v, requested) {
+			continue
+		}
+		run, ok := runs[v.ChecktypeName]
+		if !ok {
+			run = &sarifRun{
+				Tool: sarifTool{Driver: sarifDriver{
+					Name:    v.ChecktypeName,
+					Version: v.ChecktypeVersion,
+					Rules:   []sarifRule{},
+				}},
+				Results: []sarifResult{},
+			}
+			runs[v.ChecktypeName] = run
+			rules[v.ChecktypeName] = map[string]int{}
+		}
+		rule := sarifRuleFor(v)
+		index, ok := rules[v.ChecktypeName][rule.ID]
+		if !ok {
+			index = len(run.Tool.Driver.Rules)
+			rules[v.ChecktypeName][rule.ID] = index
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, rule)
+		}
+		message := v.Summary
+		if v.Details != "" {
+			message = fmt.Sprintf("%s\n\n%s", v.Summary, v.Details)
+		}
+		result := sarifResult{
+			RuleID:    rule.ID,
+			RuleIndex: index,
+			Level:     sarifLevel(v.Severity.Severity),
+			Message:   sarifMessage{Text: message},
+			Locations: sarifLocations(v),
+			Properties: map[string]interface{}{
+				"target":   v.Target,
+				"score":    v.Score,
+				"severity": v.Severity.Name,
+			},
+		}
+		if v.Fingerprint != "" {
+			result.PartialFingerprints = map[string]string{sarifFingerprintKey: v.Fingerprint}
+		}
+		if v.Override != nil {
+			result.Properties["originalSeverity"] = v.Override.OriginalSeverity.Name
+			result.Properties["originalScore"] = v.Override.OriginalScore
+			result.Properties["overrideReason"] = v.Override.Reason
+		}
+		if v.Suppressed {
+			result.Suppressions = []sarifSuppression{{Kind: "external", Justification: "accepted in the baseline"}}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	names := []string{}
+	for name := range runs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	log := sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs:    []sarifRun{},
+	}
+	for _, name := range names {
+		log.Runs = append(log.Runs, *runs[name])
+	}
+	return json.MarshalIndent(log, "", "    ")
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2022 Adevinta
+*/
+package reporting
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/google/go-cmp/cmp"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// validateSarif validates the content against the SARIF 2.1.0 schema.
+func validateSarif(t *testing.T, content []byte) {
+	t.Helper()
+	schema, err := jsonschema.Compile("testdata/sarif-schema-2.1.0.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(content, &v); err != nil {
+		t.Fatalf("invalid json %v", err)
+	}
+	if err := schema.Validate(v); err != nil {
+		t.Errorf("invalid SARIF log %#v", err)
+	}
+}
+
+func TestSarifReport(t *testing.T) {
+	dir := t.TempDir()
+	details := func(v *ExtendedVulnerability) {
+		v.CheckData.ChecktypeVersion = "latest"
+		v.Fingerprint = "fp-" + v.Summary
+		v.CWEID = 798
+		v.References = []string{"https://example.com/ref"}
+	}
+	vs := []ExtendedVulnerability{
+		testVuln("vulcan-trivy", "alpine:latest", "Vulnerable package", 7.5, withResource("openssl"), details),
+		testVuln("vulcan-gitleaks", dir, "Secret Leaked", 8.9, withResource("config/app.yaml:12"), details),
+		testVuln("vulcan-gitleaks", dir, "Secret Leaked", 8.9, withResource("main.go"), details),
+		testVuln("vulcan-gitleaks", dir, "Excluded finding", 8.9, withResource("main.go"), details, withExcluded()),
+		testVuln("vulcan-gitleaks", dir, "Low finding", 1.0, withResource("main.go"), details),
+	}
+	cfg := &config.Config{Reporting: config.Reporting{Severity: config.SeverityHigh}}
+
+	content, err := sarifReport(cfg, nil, vs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validateSarif(t, content)
+	var got sarifLog
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatalf("invalid json %v", err)
+	}
+	if got.Version != "2.1.0" || got.Schema != sarifSchema {
+		t.Errorf("unexpected version=%s schema=%s", got.Version, got.Schema)
+	}
+
+	drivers := []string{}
+	for _, run := range got.Runs {
+		drivers = append(drivers, run.Tool.Driver.Name)
+		for _, r := range run.Results {
+			if r.RuleIndex >= len(run.Tool.Driver.Rules) || run.Tool.Driver.Rules[r.RuleIndex].ID != r.RuleID {
+				t.Errorf("result references unknown rule %s in %s", r.RuleID, run.Tool.Driver.Name)
+			}
+			if r.Level != "error" {
+				t.Errorf("unexpected level %s", r.Level)
+			}
+		}
+	}
+	if diff := cmp.Diff([]string{"vulcan-gitleaks", "vulcan-trivy"}, drivers); diff != "" {
+		t.Fatalf("unexpected runs (-want +got):\n%s", diff)
+	}
+
+	gitleaks := got.Runs[0]
+	if len(gitleaks.Tool.Driver.Rules) != 1 || len(gitleaks.Results) != 2 {
+		t.Fatalf("unexpected number of rules=%d results=%d", len(gitleaks.Tool.Driver.Rules), len(gitleaks.Results))
+	}
+	wantLocation := sarifLocation{
+		PhysicalLocation: &sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: "config/app.yaml"},
+			Region:           &sarifRegion{StartLine: 12},
+		},
+	}
+	if diff := cmp.Diff([]sarifLocation{wantLocation}, gitleaks.Results[0].Locations); diff != "" {
+		t.Errorf("unexpected location (-want +got):\n%s", diff)
+	}
+	if fp := gitleaks.Results[0].PartialFingerprints[sarifFingerprintKey]; fp != "fp-Secret Leaked" {
+		t.Errorf("unexpected fingerprint %s", fp)
+	}
+
+	trivy := got.Runs[1]
+	if loc := trivy.Results[0].Locations[0]; loc.PhysicalLocation != nil || len(loc.LogicalLocations) != 1 {
+		t.Errorf("expected a logical location for a non local target %+v", loc)
+	}
+}
+
+func TestSarifReportTargets(t *testing.T) {
+	vs := []ExtendedVulnerability{
+		testVuln("vulcan-trivy", "registry.example.com/b:latest", "Vulnerable openssl", 7.5),
+		testVuln("vulcan-trivy", "registry.example.com/a:latest", "Vulnerable openssl", 7.5),
+		testVuln("vulcan-trivy", "registry.example.com/b:latest", "Vulnerable curl", 7.5),
+	}
+	cfg := &config.Config{Reporting: config.Reporting{Severity: config.SeverityHigh}}
+
+	content, err := sarifReport(cfg, nil, vs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validateSarif(t, content)
+	var got sarifLog
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatalf("invalid json %v", err)
+	}
+	results := []string{}
+	for _, r := range got.Runs[0].Results {
+		results = append(results, r.Properties["target"].(string)+" "+r.RuleID)
+	}
+	want := []string{
+		"registry.example.com/a:latest vulnerable-openssl",
+		"registry.example.com/b:latest vulnerable-openssl",
+		"registry.example.com/b:latest vulnerable-curl",
+	}
+	if diff := cmp.Diff(want, results); diff != "" {
+		t.Errorf("unexpected results (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,270 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package reporting
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/generator"
+	report "github.com/adevinta/vulcan-report"
+	"github.com/google/uuid"
+)
+
+const (
+	cdxFormat      = "CycloneDX"
+	cdxSpecVersion = "1.4"
+	cdxContentType = "application/vnd.cyclonedx+json"
+	// cdxTargetProperty is the property of the components containing the
+	// targets where they were found.
+	cdxTargetProperty = "vulcan:target"
+)
+
+// cdxBOM is a CycloneDX json document (https://cyclonedx.org/docs/1.4/json).
+type cdxBOM struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber,omitempty"`
+	Version      int            `json:"version"`
+	Metadata     *cdxMetadata   `json:"metadata,omitempty"`
+	Components   []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp string    `json:"timestamp"`
+	Tools     []cdxTool `json:"tools"`
+}
+
+type cdxTool struct {
+	Vendor  string `json:"vendor"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type cdxComponent struct {
+	Type       string        `json:"type"`
+	BOMRef     string        `json:"bom-ref,omitempty"`
+	Group      string        `json:"group,omitempty"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	PURL       string        `json:"purl,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// packageColumns and versionColumns are the headers of the columns of the
+// resource tables of the dependency checks containing the packages.
+var (
+	packageColumns = []string{"package", "name", "library", "dependency", "component"}
+	versionColumns = []string{"version", "installed version", "version in use", "installed"}
+)
+
+// inventory aggregates the components found by the checks, deduplicating the
+// ones found in several reports or targets.
+type inventory struct {
+	components map[string]*cdxComponent
+	targets    map[string]map[string]bool
+}
+
+func newInventory() *inventory {
+	return &inventory{
+		components: map[string]*cdxComponent{},
+		targets:    map[string]map[string]bool{},
+	}
+}
+
+// key identifies the component by its name and version, or by its purl if
+// it's different from the one of the component with the same name and
+// version, i.e. packages of different ecosystems.
+func (inv *inventory) key(c cdxComponent) string {
+	k := strings.Join([]string{c.Type, c.Group, c.Name, c.Version}, "|")
+	if current, ok := inv.components[k]; ok && c.PURL != "" && current.PURL != "" && c.PURL != current.PURL {
+		return c.PURL
+	}
+	return k
+}
+
+// add adds the component found in the target, completing the data of the
+// component if it was already found.
+func (inv *inventory) add(c cdxComponent, target string) {
+	if c.Name == "" {
+		return
+	}
+	if c.Type == "" {
+		c.Type = "library"
+	}
+	k := inv.key(c)
+	current, ok := inv.components[k]
+	if !ok {
+		c.Properties = nil
+		current = &c
+		inv.components[k] = current
+		inv.targets[k] = map[string]bool{}
+	}
+	if current.PURL == "" {
+		current.PURL = c.PURL
+	}
+	if target != "" {
+		inv.targets[k][target] = true
+	}
+}
+
+// addReport adds the components of the report of the check: the ones of the
+// CycloneDX documents in the data of the report or in the attachments, and
+// for the dependency checks the packages of the vulnerabilities.
+func (inv *inventory) addReport(r *report.Report, c config.Check) error {
+	var bom cdxBOM
+	if json.Unmarshal(r.Data, &bom) == nil && bom.BOMFormat == cdxFormat {
+		for _, comp := range bom.Components {
+			inv.add(comp, c.Target)
+		}
+	}
+	for _, v := range r.Vulnerabilities {
+		for _, a := range v.Attachments {
+			if a.ContentType != cdxContentType && !strings.HasSuffix(a.Name, ".cdx.json") {
+				continue
+			}
+			var bom cdxBOM
+			if err := json.Unmarshal(a.Data, &bom); err != nil {
+				return fmt.Errorf("invalid CycloneDX attachment %s of check %s: %w", a.Name, c.Id, err)
+			}
+			for _, comp := range bom.Components {
+				inv.add(comp, c.Target)
+			}
+		}
+	}
+	if !generator.IsDependencyChecktype(r.ChecktypeName) {
+		return nil
+	}
+	for _, v := range r.Vulnerabilities {
+		found := false
+		for _, g := range v.Resources {
+			for _, comp := range resourceComponents(g) {
+				inv.add(comp, c.Target)
+				found = true
+			}
+		}
+		if !found {
+			resource := v.AffectedResourceString
+			if resource == "" {
+				resource = v.AffectedResource
+			}
+			inv.add(parseComponent(resource), c.Target)
+		}
+	}
+	return nil
+}
+
+// list returns the components sorted by name and version, with the targets
+// where they were found.
+func (inv *inventory) list() []cdxComponent {
+	keys := []string{}
+	for k := range inv.components {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := inv.components[keys[i]], inv.components[keys[j]]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return keys[i] < keys[j]
+	})
+	components := []cdxComponent{}
+	for _, k := range keys {
+		c := *inv.components[k]
+		c.BOMRef = k
+		if c.PURL != "" {
+			c.BOMRef = c.PURL
+		}
+		targets := []string{}
+		for t := range inv.targets[k] {
+			targets = append(targets, t)
+		}
+		sort.Strings(targets)
+		for _, t := range targets {
+			c.Properties = append(c.Properties, cdxProperty{Name: cdxTargetProperty, Value: t})
+		}
+		components = append(components, c)
+	}
+	return components
+}
+
+// resourceComponents returns the packages in the rows of the resources
+// table, if it has package and version columns.
+func resourceComponents(g report.ResourcesGroup) []cdxComponent {
+	pkgCol, versionCol := "", ""
+	for _, h := range g.Header {
+		switch {
+		case pkgCol == "" && containsFold(packageColumns, h):
+			pkgCol = h
+		case versionCol == "" && containsFold(versionColumns, h):
+			versionCol = h
+		}
+	}
+	if pkgCol == "" || versionCol == "" {
+		return nil
+	}
+	components := []cdxComponent{}
+	for _, row := range g.Rows {
+		components = append(components, cdxComponent{Name: row[pkgCol], Version: row[versionCol]})
+	}
+	return components
+}
+
+// parseComponent returns the component of an affected resource in the
+// name@version form, i.e. @babel/core@7.0.0.
+func parseComponent(resource string) cdxComponent {
+	if i := strings.LastIndex(resource, "@"); i > 0 {
+		return cdxComponent{Name: resource[:i], Version: resource[i+1:]}
+	}
+	return cdxComponent{Name: resource}
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, strings.TrimSpace(s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sbomReport generates a CycloneDX SBOM with the components found by the
+// checks in the targets.
+func sbomReport(cfg *config.Config, reports map[string]*report.Report) ([]byte, error) {
+	inv := newInventory()
+	for _, c := range cfg.Checks {
+		r, ok := reports[c.Id]
+		if c.Id == "" || !ok || r == nil {
+			continue
+		}
+		if err := inv.addReport(r, c); err != nil {
+			return nil, err
+		}
+	}
+	bom := cdxBOM{
+		BOMFormat:    cdxFormat,
+		SpecVersion:  cdxSpecVersion,
+		SerialNumber: "urn:uuid:" + uuid.New().String(),
+		Version:      1,
+		Metadata: &cdxMetadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tools:     []cdxTool{{Vendor: "Adevinta", Name: "vulcan-local", Version: toolVersion()}},
+		},
+		Components: inv.list(),
+	}
+	return json.MarshalIndent(bom, "", "    ")
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2022 Adevinta
+*/
+package reporting
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	report "github.com/adevinta/vulcan-report"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSbomReport(t *testing.T) {
+	attachment := `{"bomFormat": "CycloneDX", "components": [
+		{"type": "library", "name": "lodash", "version": "4.17.20", "purl": "pkg:npm/lodash@4.17.20"}
+	]}`
+	cfg := &config.Config{
+		Checks: []config.Check{
+			{Id: "c1", Target: "app1"},
+			{Id: "c2", Target: "app2"},
+			{Id: "c3", Target: "app3"},
+			{Id: "c4", Target: "app4"},
+		},
+	}
+	reports := map[string]*report.Report{
+		"c1": {ResultData: report.ResultData{Vulnerabilities: []report.Vulnerability{
+			{
+				Summary: "Vulnerable lodash",
+				Resources: []report.ResourcesGroup{{
+					Name:   "Packages",
+					Header: []string{"Package", "Installed Version"},
+					Rows: []map[string]string{
+						{"Package": "lodash", "Installed Version": "4.17.20"},
+						{"Package": "minimist", "Installed Version": "1.2.5"},
+					},
+				}},
+			},
+		}}},
+		"c2": {ResultData: report.ResultData{Vulnerabilities: []report.Vulnerability{
+			{Summary: "Vulnerable babel", AffectedResource: "@babel/core@7.0.0"},
+		}}},
+		"c3": {ResultData: report.ResultData{Vulnerabilities: []report.Vulnerability{
+			{
+				Summary:     "SBOM",
+				Attachments: []report.Attachment{{Name: "sbom.cdx.json", Data: []byte(attachment)}},
+			},
+		}}},
+		"c4": {ResultData: report.ResultData{Vulnerabilities: []report.Vulnerability{
+			{Summary: "Not a dependency", AffectedResource: "http://app4/login"},
+		}}},
+	}
+	reports["c1"].ChecktypeName = "vulcan-trivy"
+	reports["c2"].ChecktypeName = "vulcan-retirejs"
+	reports["c3"].ChecktypeName = "vulcan-zap"
+	reports["c4"].ChecktypeName = "vulcan-zap"
+
+	content, err := sbomReport(cfg, reports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bom cdxBOM
+	if err := json.Unmarshal(content, &bom); err != nil {
+		t.Fatal(err)
+	}
+	if bom.BOMFormat != cdxFormat || bom.SpecVersion != cdxSpecVersion || bom.Metadata == nil {
+		t.Errorf("unexpected bom header %+v", bom)
+	}
+	want := []cdxComponent{
+		{
+			Type: "library", BOMRef: "library||@babel/core|7.0.0", Name: "@babel/core", Version: "7.0.0",
+			Properties: []cdxProperty{{Name: cdxTargetProperty, Value: "app2"}},
+		},
+		{
+			Type: "library", BOMRef: "pkg:npm/lodash@4.17.20", Name: "lodash", Version: "4.17.20", PURL: "pkg:npm/lodash@4.17.20",
+			Properties: []cdxProperty{{Name: cdxTargetProperty, Value: "app1"}, {Name: cdxTargetProperty, Value: "app3"}},
+		},
+		{
+			Type: "library", BOMRef: "library||minimist|1.2.5", Name: "minimist", Version: "1.2.5",
+			Properties: []cdxProperty{{Name: cdxTargetProperty, Value: "app1"}},
+		},
+	}
+	if diff := cmp.Diff(want, bom.Components); diff != "" {
+		t.Errorf("unexpected components (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseComponent(t *testing.T) {
+	tests := []struct {
+		resource string
+		want     cdxComponent
+	}{
+		{resource: "lodash@4.17.20", want: cdxComponent{Name: "lodash", Version: "4.17.20"}},
+		{resource: "@babel/core@7.0.0", want: cdxComponent{Name: "@babel/core", Version: "7.0.0"}},
+		{resource: "@babel/core", want: cdxComponent{Name: "@babel/core"}},
+		{resource: "openssl", want: cdxComponent{Name: "openssl"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.resource, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, parseComponent(tt.resource)); diff != "" {
+				t.Errorf("unexpected component (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package reporting
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/results"
+)
+
+// tuiInterval is the time between the refreshes of the progress view.
+var tuiInterval = time.Second
+
+// tuiTargetWidth is the max width of the targets shown in the table.
+const tuiTargetWidth = 50
+
+// TUI renders in a terminal a live table of the checks with their status,
+// elapsed time and findings, and the running count of findings by severity.
+// The logs written through it are printed above the table.
+type TUI struct {
+	cfg     *config.Config
+	results *results.ResultsServer
+	out     io.Writer
+	now     func() time.Time
+
+	mu    sync.Mutex
+	lines int
+	quit  chan struct{}
+	done  chan struct{}
+}
+
+// NewTUI returns a TUI rendering the progress of the checks of the config in
+// out.
+func NewTUI(cfg *config.Config, rs *results.ResultsServer, out io.Writer) *TUI {
+	return &TUI{
+		cfg:     cfg,
+		results: rs,
+		out:     out,
+		now:     time.Now,
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start renders the table refreshing it periodically until Stop is called.
+func (t *TUI) Start() {
+	t.refresh()
+	go func() {
+		defer close(t.done)
+		for {
+			select {
+			case <-t.quit:
+				return
+			case <-time.After(tuiInterval):
+				t.refresh()
+			}
+		}
+	}()
+}
+
+// Stop stops refreshing the table leaving the last state rendered.
+func (t *TUI) Stop() {
+	close(t.quit)
+	<-t.done
+	t.refresh()
+}
+
+// Write prints p above the table.
+func (t *TUI) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clear()
+	n, err := t.out.Write(p)
+	t.draw()
+	return n, err
+}
+
+func (t *TUI) refresh() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clear()
+	t.draw()
+}
+
+// clear removes the table last rendered moving the cursor to its first line.
+func (t *TUI) clear() {
+	if t.lines > 0 {
+		fmt.Fprintf(t.out, "\x1b[%dA\x1b[J", t.lines)
+		t.lines = 0
+	}
+}
+
+func (t *TUI) draw() {
+	table := t.render()
+	t.lines = strings.Count(table, "\n")
+	io.WriteString(t.out, table)
+}
+
+// render returns the table with the current state of the checks.
+func (t *TUI) render() string {
+	buf := new(bytes.Buffer)
+	tw := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tCHECKTYPE\tTARGET\tELAPSED\tFINDINGS")
+	total, finished := 0, 0
+	severities := map[config.Severity]int{}
+	for _, c := range t.cfg.Checks {
+		if c.Checktype == nil {
+			// The check was excluded by filters
+			continue
+		}
+		total++
+		status := "PENDING"
+		elapsed := time.Duration(0)
+		findings := 0
+		if r := t.results.Report(c.Id); r != nil {
+			status = r.Status
+			if !r.StartTime.IsZero() {
+				end := r.EndTime
+				if end.IsZero() {
+					end = t.now()
+				}
+				elapsed = end.Sub(r.StartTime)
+			}
+			findings = len(r.Vulnerabilities)
+			for _, v := range r.Vulnerabilities {
+				severities[config.FindSeverityByScore(v.Score)]++
+			}
+			if status != "RUNNING" && status != "CREATED" {
+				finished++
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n", status, c.Checktype.Name, truncate(c.Target, tuiTargetWidth), elapsed.Round(time.Second), findings)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(buf, "\nChecks %d/%d finished  Findings", finished, total)
+	for _, s := range config.Severities() {
+		d := s.Data()
+		color := 0
+		if severities[s] != 0 {
+			color = d.Color
+		}
+		fmt.Fprintf(buf, "  %s %d", formatString(d.Name, color), severities[s])
+	}
+	fmt.Fprint(buf, "\n")
+	return buf.String()
+}
+
+// truncate shortens s to n runes, replacing the end with an ellipsis.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package reporting
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adevinta/vulcan-local/pkg/checktypes"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/results"
+	report "github.com/adevinta/vulcan-report"
+)
+
+func TestTUIRender(t *testing.T) {
+	now := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	rs, err := results.Start(loggerUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Shutdown()
+	rs.Checks["1"] = &report.Report{
+		CheckData: report.CheckData{
+			Status:    "FINISHED",
+			StartTime: now.Add(-90 * time.Second),
+			EndTime:   now.Add(-30 * time.Second),
+		},
+		ResultData: report.ResultData{
+			Vulnerabilities: []report.Vulnerability{{Score: 9.8}, {Score: 7.5}, {Score: 7.0}},
+		},
+	}
+	rs.Checks["2"] = &report.Report{
+		CheckData: report.CheckData{
+			Status:    "RUNNING",
+			StartTime: now.Add(-10 * time.Second),
+		},
+	}
+	cfg := &config.Config{
+		Checks: []config.Check{
+			{Id: "1", Target: ".", Checktype: &checktypes.Checktype{Name: "vulcan-trivy"}},
+			{Id: "2", Target: "http://localhost:8080", Checktype: &checktypes.Checktype{Name: "vulcan-zap"}},
+			{Id: "3", Target: strings.Repeat("a", 60), Checktype: &checktypes.Checktype{Name: "vulcan-gitleaks"}},
+			// Excluded by the filters.
+			{Id: "4", Target: "."},
+		},
+	}
+	tui := NewTUI(cfg, rs, nil)
+	tui.now = func() time.Time { return now }
+
+	want := "STATUS    CHECKTYPE        TARGET                                              ELAPSED  FINDINGS\n" +
+		"FINISHED  vulcan-trivy     .                                                   1m0s     3\n" +
+		"RUNNING   vulcan-zap       http://localhost:8080                               10s      0\n" +
+		"PENDING   vulcan-gitleaks  " + strings.Repeat("a", 49) + "…  0s       0\n" +
+		"\nChecks 1/3 finished  Findings" +
+		"  " + formatString("CRITICAL", 35) + " 1" +
+		"  " + formatString("HIGH", 31) + " 2" +
+		"  " + formatString("MEDIUM", 0) + " 0" +
+		"  " + formatString("LOW", 0) + " 0" +
+		"  " + formatString("INFO", 0) + " 0\n"
+	if got := tui.render(); got != want {
+		t.Errorf("unexpected table got:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestTUIWrite(t *testing.T) {
+	rs, err := results.Start(loggerUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.Shutdown()
+	var out bytes.Buffer
+	tui := NewTUI(&config.Config{}, rs, &out)
+	tui.refresh()
+	table := out.String()
+	lines := strings.Count(table, "\n")
+
+	out.Reset()
+	if _, err := tui.Write([]byte("log line\n")); err != nil {
+		t.Fatal(err)
+	}
+	// The table is cleared, the log printed and the table rendered again.
+	want := "\x1b[" + strconv.Itoa(lines) + "A\x1b[J" + "log line\n" + table
+	if got := out.String(); got != want {
+		t.Errorf("unexpected output got=%q want=%q", got, want)
+	}
+}
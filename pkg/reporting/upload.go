@@ -0,0 +1,127 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package reporting
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-agent/stateupdater"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	report "github.com/adevinta/vulcan-report"
+)
+
+const (
+	defaultUploadBatchSize = 20
+	uploadRetries          = 3
+)
+
+// uploadInterval is the base interval between retries of a failed request.
+var uploadInterval = 2 * time.Second
+
+// uploadBatch is the body of the requests sent to the upload endpoint.
+type uploadBatch struct {
+	Team    string           `json:"team,omitempty"`
+	Reports []*report.Report `json:"reports"`
+}
+
+// retryableError is a failed request that can be retried.
+type retryableError struct {
+	err error
+}
+
+func (e retryableError) Error() string {
+	return e.err.Error()
+}
+
+// finalReports returns the reports of the checks that reached a terminal
+// status sorted by check id.
+func finalReports(cfg *config.Config, reports map[string]*report.Report) []*report.Report {
+	final := []*report.Report{}
+	for _, c := range cfg.Checks {
+		if c.Id == "" {
+			continue
+		}
+		r, ok := reports[c.Id]
+		if !ok || r == nil {
+			continue
+		}
+		if _, ok := stateupdater.TerminalStatuses[r.Status]; ok {
+			final = append(final, r)
+		}
+	}
+	sort.Slice(final, func(i, j int) bool {
+		return final[i].CheckID < final[j].CheckID
+	})
+	return final
+}
+
+// upload sends the final reports to the upload endpoint in batches, retrying
+// the requests failing with network or server errors.
+func upload(cfg *config.Config, reports map[string]*report.Report, l log.Logger) error {
+	u := cfg.Reporting.Upload
+	size := u.BatchSize
+	if size <= 0 {
+		size = defaultUploadBatchSize
+	}
+	final := finalReports(cfg, reports)
+	client := &http.Client{Timeout: 30 * time.Second}
+	for start := 0; start < len(final); start += size {
+		end := start + size
+		if end > len(final) {
+			end = len(final)
+		}
+		body, err := json.Marshal(uploadBatch{Team: u.Team, Reports: final[start:end]})
+		if err != nil {
+			return err
+		}
+		for attempt := 0; ; attempt++ {
+			err = postBatch(client, u, body)
+			if err == nil {
+				break
+			}
+			if _, ok := err.(retryableError); !ok || attempt >= uploadRetries {
+				return fmt.Errorf("unable to upload reports to %s: %w", u.URL, err)
+			}
+			wait := uploadInterval * (1 << attempt)
+			l.Infof("Retrying upload of reports in %s: %v", wait, err)
+			time.Sleep(wait)
+		}
+		l.Debugf("Uploaded %d reports to %s", end-start, u.URL)
+	}
+	l.Infof("Uploaded %d reports to %s", len(final), u.URL)
+	return nil
+}
+
+func postBatch(client *http.Client, u config.Upload, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, u.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if u.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+u.Token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return retryableError{err}
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("unexpected status %s %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return retryableError{err}
+	}
+	return err
+}
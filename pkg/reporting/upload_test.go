@@ -0,0 +1,109 @@
+/*
+Copyright 2022 Adevinta
+*/
+package reporting
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	report "github.com/adevinta/vulcan-report"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUpload(t *testing.T) {
+	uploadInterval = 0
+	checks := []config.Check{}
+	reports := map[string]*report.Report{}
+	for i := 0; i < 5; i++ {
+		id := fmt.Sprintf("check-%d", i)
+		checks = append(checks, config.Check{Id: id})
+		reports[id] = &report.Report{CheckData: report.CheckData{CheckID: id, Status: "FINISHED"}}
+	}
+	reports["check-4"].Status = "RUNNING"
+	checks = append(checks, config.Check{Id: ""})
+
+	tests := []struct {
+		name      string
+		statuses  []int
+		wantErr   bool
+		wantCalls int
+		wantIDs   [][]string
+	}{
+		{
+			name:      "Batches",
+			wantCalls: 2,
+			wantIDs:   [][]string{{"check-0", "check-1", "check-2"}, {"check-3"}},
+		},
+		{
+			name:      "RetryServerErrors",
+			statuses:  []int{http.StatusInternalServerError, http.StatusTooManyRequests},
+			wantCalls: 4,
+			wantIDs:   [][]string{{"check-0", "check-1", "check-2"}, {"check-3"}},
+		},
+		{
+			name:      "ClientError",
+			statuses:  []int{http.StatusUnauthorized},
+			wantErr:   true,
+			wantCalls: 1,
+		},
+		{
+			name:      "TooManyRetries",
+			statuses:  []int{500, 500, 500, 500},
+			wantErr:   true,
+			wantCalls: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			ids := [][]string{}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if r.Header.Get("Authorization") != "Bearer secret" {
+					t.Errorf("unexpected authorization header %s", r.Header.Get("Authorization"))
+				}
+				if calls <= len(tt.statuses) {
+					w.WriteHeader(tt.statuses[calls-1])
+					return
+				}
+				var batch uploadBatch
+				if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+					t.Errorf("invalid body %v", err)
+				}
+				if batch.Team != "security" {
+					t.Errorf("unexpected team %s", batch.Team)
+				}
+				batchIDs := []string{}
+				for _, r := range batch.Reports {
+					batchIDs = append(batchIDs, r.CheckID)
+				}
+				ids = append(ids, batchIDs)
+			}))
+			defer srv.Close()
+
+			cfg := &config.Config{
+				Checks: checks,
+				Reporting: config.Reporting{
+					Upload: config.Upload{URL: srv.URL, Token: "secret", Team: "security", BatchSize: 3},
+				},
+			}
+			err := upload(cfg, reports, loggerUser)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("unexpected number of requests got=%d want=%d", calls, tt.wantCalls)
+			}
+			if tt.wantIDs != nil {
+				if diff := cmp.Diff(tt.wantIDs, ids); diff != "" {
+					t.Errorf("unexpected batches (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package results
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	report "github.com/adevinta/vulcan-report"
+)
+
+// Cache stores in a local directory the reports of the checks indexed by a
+// key identifying what was scanned, so the checks that would produce the
+// same report are not run again.
+type Cache struct {
+	Dir string
+	// TTL is the time the reports are valid, they don't expire if zero.
+	TTL time.Duration
+
+	now func() time.Time
+}
+
+type cachedReport struct {
+	Time   time.Time     `json:"time"`
+	Report report.Report `json:"report"`
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+func (c *Cache) time() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// Get returns the report stored with the key, nil if not found or expired.
+func (c *Cache) Get(key string) (*report.Report, error) {
+	content, err := os.ReadFile(c.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cr cachedReport
+	if err := json.Unmarshal(content, &cr); err != nil {
+		return nil, fmt.Errorf("invalid cached report %s: %w", key, err)
+	}
+	if c.TTL > 0 && c.time().Sub(cr.Time) > c.TTL {
+		return nil, nil
+	}
+	return &cr.Report, nil
+}
+
+// Put stores the report with the key.
+func (c *Cache) Put(key string, r *report.Report) error {
+	content, err := json.Marshal(cachedReport{Time: c.time(), Report: *r})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path(key), content, 0o644)
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package results
+
+import (
+	"testing"
+	"time"
+
+	report "github.com/adevinta/vulcan-report"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	r := &report.Report{
+		CheckData:  report.CheckData{CheckID: "id", Status: "FINISHED"},
+		ResultData: report.ResultData{Vulnerabilities: []report.Vulnerability{{Summary: "v1"}}},
+	}
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		elapsed time.Duration
+		key     string
+		want    *report.Report
+	}{
+		{
+			name:    "Hit",
+			ttl:     time.Hour,
+			elapsed: 30 * time.Minute,
+			key:     "key",
+			want:    r,
+		},
+		{
+			name:    "Expired",
+			ttl:     time.Hour,
+			elapsed: 2 * time.Hour,
+			key:     "key",
+		},
+		{
+			name:    "NoExpiration",
+			elapsed: 1000 * time.Hour,
+			key:     "key",
+			want:    r,
+		},
+		{
+			name: "Miss",
+			key:  "other",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Cache{Dir: t.TempDir(), TTL: tt.ttl, now: func() time.Time { return now }}
+			if err := c.Put("key", r); err != nil {
+				t.Fatal(err)
+			}
+			c.now = func() time.Time { return now.Add(tt.elapsed) }
+			got, err := c.Get(tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected report (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/adevinta/vulcan-agent/log"
 	report "github.com/adevinta/vulcan-report"
@@ -36,6 +37,12 @@ type ResultsServer struct {
 	server   *http.Server
 	log      log.Logger
 	mu       sync.Mutex
+
+	// OnLogs, if not nil, is called with the raw output of every check.
+	OnLogs func(checkID string, logs []byte)
+	// OnReport, if not nil, is called with the time taken to receive and
+	// parse the report of every check.
+	OnReport func(checkID string, d time.Duration)
 }
 
 func Start(l log.Logger) (*ResultsServer, error) {
@@ -78,7 +85,36 @@ func (srv *ResultsServer) Shutdown() {
 	}
 }
 
+// Report returns the last report received for the check, nil if none.
+func (srv *ResultsServer) Report(checkID string) *report.Report {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.Checks[checkID]
+}
+
+// SetReport sets the report of the check.
+func (srv *ResultsServer) SetReport(checkID string, r *report.Report) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.Checks[checkID] = r
+}
+
+// SetStatus sets the status of the check, creating an empty report if the
+// check didn't send any.
+func (srv *ResultsServer) SetStatus(checkID, status string) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	r, ok := srv.Checks[checkID]
+	if !ok {
+		r = &report.Report{CheckData: report.CheckData{CheckID: checkID}}
+		srv.Checks[checkID] = r
+	}
+	srv.log.Debugf("check-status id=%s status=%s", checkID, status)
+	r.Status = status
+}
+
 func (srv *ResultsServer) handleReport(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	start := time.Now()
 	payload, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		w.WriteHeader(http.StatusUnprocessableEntity)
@@ -114,6 +150,9 @@ func (srv *ResultsServer) handleReport(w http.ResponseWriter, r *http.Request, p
 	srv.mu.Lock()
 	srv.Checks[pl.CheckId] = report
 	srv.mu.Unlock()
+	if srv.OnReport != nil {
+		srv.OnReport(pl.CheckId, time.Since(start))
+	}
 
 	w.Header().Add("location", "http://dummy/report/"+pl.CheckId)
 	w.WriteHeader(http.StatusCreated)
@@ -144,6 +183,9 @@ func (srv *ResultsServer) handleLogs(w http.ResponseWriter, r *http.Request, ps
 	sDec, _ := base64.StdEncoding.DecodeString(pl.B64Logs)
 
 	srv.log.Debugf("check-logs id=%s\n%s\n\n", pl.CheckId, string(sDec))
+	if srv.OnLogs != nil {
+		srv.OnLogs(pl.CheckId, sDec)
+	}
 
 	w.Header().Add("location", "http://dummy/raw/"+pl.CheckId)
 	w.WriteHeader(http.StatusCreated)
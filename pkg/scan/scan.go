@@ -0,0 +1,208 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+// Package scan runs the scans of vulcan-local from other Go programs, i.e.
+// IDE plugins or internal CLIs, without running the vulcan-local binary.
+//
+//	cfg := scan.DefaultConfig()
+//	cfg.Targets = []config.Target{{Target: "."}}
+//	report, err := scan.New(cfg, scan.WithLogger(log)).Run(ctx)
+//
+// The config files are read into an empty config, before setting the
+// defaults, so their values are not hidden by them.
+//
+//	cfg := &config.Config{}
+//	err := config.ReadConfig("vulcan.yaml", cfg, log)
+//	...
+//	err = scan.SetDefaults(cfg)
+package scan
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/adevinta/vulcan-local/pkg/checktypes"
+	"github.com/adevinta/vulcan-local/pkg/cmd"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/container"
+	"github.com/adevinta/vulcan-local/pkg/gitservice"
+	"github.com/adevinta/vulcan-local/pkg/reporting"
+	report "github.com/adevinta/vulcan-report"
+	"github.com/imdario/mergo"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultChecktypesURL is the catalog of checktypes used when the config
+// doesn't define any repository.
+const DefaultChecktypesURL = "https://raw.githubusercontent.com/adevinta/vulcan-local/master/script/checktypes-stable.json"
+
+// DefaultConfig returns the config with the defaults of the vulcan-local
+// command.
+func DefaultConfig() *config.Config {
+	return &config.Config{
+		Conf: config.Conf{
+			Runtime:     "docker",
+			DockerBin:   "docker",
+			PodmanBin:   "podman",
+			GitBin:      "git",
+			LogLevel:    logrus.InfoLevel,
+			LogFormat:   "text",
+			Concurrency: 3,
+			IfName:      "docker0",
+			Vars:        map[string]string{},
+			CacheDir:    defaultCacheDir(),
+			CacheTTL:    "24h",
+			Snapshot:    gitservice.SnapshotCopy,
+			LockFile:    "vulcan.lock",
+			LFS:         config.LFS{MaxSize: "100MB"},
+		},
+		Reporting: config.Reporting{
+			Format:   "json",
+			Severity: config.SeverityHigh,
+			Baseline: ".vulcan-baseline.yml",
+			History:  DefaultHistoryDir(),
+		},
+		CheckTypes: map[checktypes.ChecktypeRef]checktypes.Checktype{},
+		Checks:     []config.Check{},
+	}
+}
+
+// SetDefaults sets the values of DefaultConfig to the fields of the config
+// that are empty, i.e. after reading the config files with config.ReadConfig.
+func SetDefaults(cfg *config.Config) error {
+	return mergo.Merge(cfg, DefaultConfig())
+}
+
+// defaultCacheDir returns the directory in the user cache used by default to
+// cache the checktypes, empty if it can't be determined.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "vulcan-local")
+}
+
+// DefaultHistoryDir returns the directory of the history of the scans in the
+// cache dir.
+func DefaultHistoryDir() string {
+	dir := defaultCacheDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "history")
+}
+
+// Report is the result of a scan.
+type Report struct {
+	// ExitCode is the exit code of the vulcan-local command for the
+	// findings, given by the severity threshold or the policy of the
+	// reporting config.
+	ExitCode int
+	// Checks are the checks of the scan. The ones filtered have no id.
+	Checks []config.Check
+	// Reports are the reports of the finished checks indexed by check id.
+	Reports map[string]*report.Report
+	// Findings are the vulnerabilities of the reports, with the excluded and
+	// suppressed ones marked.
+	Findings []reporting.ExtendedVulnerability
+}
+
+// Reporter receives the report of every scan, i.e. to show the findings in
+// an editor or send them to another service.
+type Reporter interface {
+	Report(ctx context.Context, r Report) error
+}
+
+// ReporterFunc is a function used as a Reporter.
+type ReporterFunc func(ctx context.Context, r Report) error
+
+// Report calls f.
+func (f ReporterFunc) Report(ctx context.Context, r Report) error {
+	return f(ctx, r)
+}
+
+// Option configures a Scan.
+type Option func(*Scan)
+
+// WithLogger logs the progress of the scan in the logger. Its level is set
+// to the log level of the config.
+func WithLogger(log *logrus.Logger) Option {
+	return func(s *Scan) {
+		s.log = log
+	}
+}
+
+// WithRuntime runs the checks in the container runtime instead of the one of
+// the config. The runtime is not closed by the scan.
+func WithRuntime(rt container.Runtime) Option {
+	return func(s *Scan) {
+		s.rt = rt
+	}
+}
+
+// WithReporter adds a reporter of the results of the scan. The reporters are
+// called in order, after the reports of the config are generated.
+func WithReporter(r Reporter) Option {
+	return func(s *Scan) {
+		s.reporters = append(s.reporters, r)
+	}
+}
+
+// Scan runs the checks of a config against its targets.
+type Scan struct {
+	cfg       *config.Config
+	log       *logrus.Logger
+	rt        container.Runtime
+	reporters []Reporter
+}
+
+// New returns a scan of the config. The config is modified by the scan, so
+// it must not be shared by concurrent scans. The checktypes of
+// DefaultChecktypesURL are used if the config has no repositories.
+//
+// The scans are not safe for concurrent use in the same process: while
+// running they set the env vars of the process read by the agent, the docker
+// clients and git, i.e. AWS_*, DOCKER_HOST and the proxy ones, and restore
+// them when they finish.
+func New(cfg *config.Config, opts ...Option) *Scan {
+	s := &Scan{cfg: cfg}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.log == nil {
+		s.log = logrus.New()
+	}
+	return s
+}
+
+// Run runs the scan until it finishes or the context is done. When the
+// context is done the running checks are stopped and the report contains the
+// results of the finished ones. The error of the scan is returned before the
+// errors of the reporters.
+func (s *Scan) Run(ctx context.Context) (Report, error) {
+	if len(s.cfg.Conf.Repositories) == 0 {
+		s.log.Infof("No checktypes specified. Using default %s", DefaultChecktypesURL)
+		s.cfg.Conf.Repositories = []string{DefaultChecktypesURL}
+	}
+	res, err := cmd.Scan(ctx, s.cfg, s.log, cmd.Options{Runtime: s.rt})
+	r := Report{
+		ExitCode: res.ExitCode,
+		Checks:   res.Checks,
+		Reports:  res.Reports,
+		Findings: res.Findings,
+	}
+	if err != nil && r.Reports == nil {
+		// The scan failed before running the checks.
+		return r, err
+	}
+	for _, rep := range s.reporters {
+		if rerr := rep.Report(ctx, r); rerr != nil && err == nil {
+			err = fmt.Errorf("unable to report the results: %w", rerr)
+		}
+	}
+	return r, err
+}
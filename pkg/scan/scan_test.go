@@ -0,0 +1,157 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package scan
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/gitservice"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/sirupsen/logrus"
+)
+
+const testChecktypes = `{
+    "checktypes": [
+        {
+            "name": "vulcan-tls",
+            "image": "vulcansec/vulcan-tls:edge",
+            "assets": ["Hostname"]
+        },
+        {
+            "name": "vulcan-trivy",
+            "image": "vulcansec/vulcan-trivy:edge",
+            "assets": ["DockerImage"]
+        }
+    ]
+}`
+
+func testConfig(t *testing.T) *config.Config {
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "checktypes.json")
+	if err := os.WriteFile(repo, []byte(testChecktypes), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.Conf.Repositories = []string{repo}
+	cfg.Conf.CacheDir = ""
+	cfg.Conf.LockFile = ""
+	cfg.Conf.DryRun = true
+	cfg.Reporting.History = ""
+	cfg.Reporting.OutputFile = filepath.Join(dir, "plan.json")
+	cfg.Targets = []config.Target{{Target: "example.com", AssetType: "Hostname"}}
+	return cfg
+}
+
+func TestScanRun(t *testing.T) {
+	cfg := testConfig(t)
+	var reported []Report
+	s := New(cfg,
+		WithLogger(logrus.New()),
+		WithReporter(ReporterFunc(func(_ context.Context, r Report) error {
+			reported = append(reported, r)
+			return nil
+		})),
+	)
+	r, err := s.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ExitCode != config.SuccessExitCode {
+		t.Errorf("unexpected exit code %d", r.ExitCode)
+	}
+	if len(r.Checks) != 1 || r.Checks[0].Type != "vulcan-tls" || r.Checks[0].Target != "example.com" {
+		t.Errorf("unexpected checks %+v", r.Checks)
+	}
+	if len(reported) != 1 {
+		t.Fatalf("unexpected reports %d", len(reported))
+	}
+	if _, err := os.Stat(cfg.Reporting.OutputFile); err != nil {
+		t.Errorf("plan not written: %v", err)
+	}
+}
+
+func TestScanRunReporterError(t *testing.T) {
+	errReport := errors.New("unavailable")
+	var called bool
+	s := New(testConfig(t),
+		WithReporter(ReporterFunc(func(context.Context, Report) error {
+			return errReport
+		})),
+		WithReporter(ReporterFunc(func(context.Context, Report) error {
+			called = true
+			return nil
+		})),
+	)
+	if _, err := s.Run(context.Background()); !errors.Is(err, errReport) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if !called {
+		t.Error("the reporters after the failing one were not called")
+	}
+}
+
+func TestScanRunError(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Conf.Concurrency = 0
+	called := false
+	s := New(cfg, WithReporter(ReporterFunc(func(context.Context, Report) error {
+		called = true
+		return nil
+	})))
+	r, err := s.Run(context.Background())
+	if err == nil || r.ExitCode != config.ErrorExitCode {
+		t.Errorf("unexpected result code=%d err=%v", r.ExitCode, err)
+	}
+	if called {
+		t.Error("reporter called for a failed scan")
+	}
+}
+
+func TestReadConfigDefaults(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "vulcan.yaml")
+	content := `
+conf:
+  runtime: podman
+  snapshotStrategy: hardlink
+  logFormat: json
+  cacheTTL: 1h
+  lfs:
+    maxSize: 1GB
+  lockFile: checks.lock
+  cacheDir: /var/cache/vulcan
+reporting:
+  baseline: baseline.yml
+  history: /var/lib/vulcan/history
+`
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{}
+	if err := config.ReadConfig(file, cfg, logrus.New()); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetDefaults(cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := DefaultConfig()
+	want.Conf.Runtime = "podman"
+	want.Conf.Snapshot = gitservice.SnapshotHardlink
+	want.Conf.LogFormat = "json"
+	want.Conf.CacheTTL = "1h"
+	want.Conf.LFS.MaxSize = "1GB"
+	want.Conf.LockFile = "checks.lock"
+	want.Reporting.Baseline = "baseline.yml"
+	want.Conf.CacheDir = "/var/cache/vulcan"
+	want.Reporting.History = "/var/lib/vulcan/history"
+	if diff := cmp.Diff(want, cfg, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("unexpected config (-want +got):\n%s", diff)
+	}
+}
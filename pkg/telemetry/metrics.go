@@ -0,0 +1,275 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+// Package telemetry exposes the progress events of the scans as Prometheus
+// metrics and exports them as OpenTelemetry traces.
+package telemetry
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adevinta/vulcan-local/pkg/events"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the buckets of the
+// duration histograms.
+var durationBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200, 3600}
+
+// Metrics aggregates the events of the scans in the Prometheus text format.
+type Metrics struct {
+	mu         sync.Mutex
+	counters   map[string]map[string]float64
+	gauges     map[string]map[string]float64
+	histograms map[string]map[string]*histogram
+
+	// scheduled and started are the times the running checks were
+	// scheduled and started.
+	scheduled map[string]time.Time
+	started   map[string]time.Time
+	scanStart time.Time
+}
+
+// metricHelp contains the help and the type of the metrics.
+var metricHelp = map[string][2]string{
+	"vulcan_local_scans_total":                 {"Scans finished by exit code.", "counter"},
+	"vulcan_local_scan_duration_seconds":       {"Duration of the last scan.", "gauge"},
+	"vulcan_local_checks_total":                {"Checks finished by checktype and status.", "counter"},
+	"vulcan_local_checks_running":              {"Checks running.", "gauge"},
+	"vulcan_local_check_retries_total":         {"Retries of the checks by checktype.", "counter"},
+	"vulcan_local_check_findings_total":        {"Vulnerabilities reported by the checks by checktype.", "counter"},
+	"vulcan_local_check_queue_seconds":         {"Time the checks waited to be started.", "histogram"},
+	"vulcan_local_check_duration_seconds":      {"Duration of the checks, including the retries.", "histogram"},
+	"vulcan_local_image_pull_duration_seconds": {"Duration of the pre-pulls of the images.", "histogram"},
+	"vulcan_local_image_pull_errors_total":     {"Pre-pulls of the images failed.", "counter"},
+	"vulcan_local_report_duration_seconds":     {"Duration of the reporting of the results.", "histogram"},
+	"vulcan_local_errors_total":                {"Errors logged.", "counter"},
+	"vulcan_local_last_scan_timestamp_seconds": {"Time the last scan finished.", "gauge"},
+	"vulcan_local_last_scan_exit_code":         {"Exit code of the last scan.", "gauge"},
+	"vulcan_local_checks_scheduled_total":      {"Checks scheduled by checktype.", "counter"},
+	"vulcan_local_last_scan_findings":          {"Vulnerabilities reported by the checks of the last scan.", "gauge"},
+}
+
+// NewMetrics returns empty metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		counters:   map[string]map[string]float64{},
+		gauges:     map[string]map[string]float64{},
+		histograms: map[string]map[string]*histogram{},
+		scheduled:  map[string]time.Time{},
+		started:    map[string]time.Time{},
+	}
+}
+
+// Observe updates the metrics with the event, it's an events.Listener.
+func (m *Metrics) Observe(ev events.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	checktype := labels("checktype", ev.Checktype)
+	switch ev.Type {
+	case events.ScanStarted:
+		m.scanStart = ev.Time
+		m.set("vulcan_local_last_scan_findings", "", 0)
+	case events.CheckScheduled:
+		m.scheduled[ev.CheckID] = ev.Time
+		m.add("vulcan_local_checks_scheduled_total", checktype, 1)
+	case events.CheckStarted:
+		if t, ok := m.scheduled[ev.CheckID]; ok {
+			m.observe("vulcan_local_check_queue_seconds", checktype, ev.Time.Sub(t).Seconds())
+		}
+		m.started[ev.CheckID] = ev.Time
+		m.add("vulcan_local_checks_running", "", 1)
+	case events.CheckRetried:
+		m.add("vulcan_local_check_retries_total", checktype, 1)
+	case events.CheckFinished:
+		if t, ok := m.started[ev.CheckID]; ok {
+			m.observe("vulcan_local_check_duration_seconds", checktype, ev.Time.Sub(t).Seconds())
+			m.add("vulcan_local_checks_running", "", -1)
+		}
+		delete(m.scheduled, ev.CheckID)
+		delete(m.started, ev.CheckID)
+		status := ev.Status
+		if status == "" {
+			status = "UNKNOWN"
+		}
+		m.add("vulcan_local_checks_total", labels("checktype", ev.Checktype, "status", status), 1)
+		if ev.Findings != nil {
+			m.add("vulcan_local_check_findings_total", checktype, float64(*ev.Findings))
+			m.add("vulcan_local_last_scan_findings", "", float64(*ev.Findings))
+		}
+	case events.ImagePulled:
+		m.observe("vulcan_local_image_pull_duration_seconds", "", ev.Duration)
+		if ev.Message != "" {
+			m.add("vulcan_local_image_pull_errors_total", "", 1)
+		}
+	case events.ReportGenerated:
+		m.observe("vulcan_local_report_duration_seconds", "", ev.Duration)
+	case events.Error:
+		m.add("vulcan_local_errors_total", "", 1)
+	case events.ScanFinished:
+		code := 0
+		if ev.ExitCode != nil {
+			code = *ev.ExitCode
+		}
+		m.add("vulcan_local_scans_total", labels("exit_code", strconv.Itoa(code)), 1)
+		m.set("vulcan_local_last_scan_exit_code", "", float64(code))
+		m.set("vulcan_local_last_scan_timestamp_seconds", "", float64(ev.Time.Unix()))
+		if !m.scanStart.IsZero() {
+			m.set("vulcan_local_scan_duration_seconds", "", ev.Time.Sub(m.scanStart).Seconds())
+		}
+		// The checks not finished are not running anymore.
+		m.set("vulcan_local_checks_running", "", 0)
+		m.scheduled = map[string]time.Time{}
+		m.started = map[string]time.Time{}
+	}
+}
+
+// add adds the value to the counter, or to the gauge, with the labels.
+func (m *Metrics) add(name, labels string, v float64) {
+	values := m.counters
+	if metricHelp[name][1] == "gauge" {
+		values = m.gauges
+	}
+	if values[name] == nil {
+		values[name] = map[string]float64{}
+	}
+	values[name][labels] += v
+}
+
+func (m *Metrics) set(name, labels string, v float64) {
+	if m.gauges[name] == nil {
+		m.gauges[name] = map[string]float64{}
+	}
+	m.gauges[name][labels] = v
+}
+
+func (m *Metrics) observe(name, labels string, v float64) {
+	if m.histograms[name] == nil {
+		m.histograms[name] = map[string]*histogram{}
+	}
+	h, ok := m.histograms[name][labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		m.histograms[name][labels] = h
+	}
+	h.observe(v)
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var b strings.Builder
+	names := []string{}
+	for name := range metricHelp {
+		if len(m.counters[name]) > 0 || len(m.gauges[name]) > 0 || len(m.histograms[name]) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		help := metricHelp[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help[0], name, help[1])
+		switch help[1] {
+		case "counter":
+			writeSamples(&b, name, m.counters[name])
+		case "gauge":
+			writeSamples(&b, name, m.gauges[name])
+		case "histogram":
+			for _, l := range sortedKeys(m.histograms[name]) {
+				m.histograms[name][l].write(&b, name, l)
+			}
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the metrics.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// Handler returns the handler serving the metrics in /metrics.
+func (m *Metrics) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	return mux
+}
+
+func writeSamples(b *strings.Builder, name string, samples map[string]float64) {
+	for _, l := range sortedKeys(samples) {
+		fmt.Fprintf(b, "%s%s %s\n", name, braces(l), formatFloat(samples[l]))
+	}
+}
+
+// histogram counts the observations in the duration buckets.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, le := range durationBuckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) write(b *strings.Builder, name, l string) {
+	sep := ""
+	if l != "" {
+		sep = ","
+	}
+	for i, le := range durationBuckets {
+		fmt.Fprintf(b, "%s_bucket{%s%sle=\"%s\"} %d\n", name, l, sep, formatFloat(le), h.counts[i])
+	}
+	fmt.Fprintf(b, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, l, sep, h.count)
+	fmt.Fprintf(b, "%s_sum%s %s\n", name, braces(l), formatFloat(h.sum))
+	fmt.Fprintf(b, "%s_count%s %d\n", name, braces(l), h.count)
+}
+
+// labels returns the labels of the pairs of names and values, in the
+// Prometheus format without braces, omitting the empty values.
+func labels(pairs ...string) string {
+	l := []string{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] == "" {
+			continue
+		}
+		l = append(l, fmt.Sprintf("%s=%s", pairs[i], strconv.Quote(pairs[i+1])))
+	}
+	return strings.Join(l, ",")
+}
+
+func braces(l string) string {
+	if l == "" {
+		return ""
+	}
+	return "{" + l + "}"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package telemetry
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adevinta/vulcan-local/pkg/events"
+)
+
+// scanEvents returns the events of a scan with a check retried once and
+// finished with two findings, and a check failed.
+func scanEvents(start time.Time) []events.Event {
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+	return []events.Event{
+		{Type: events.ScanStarted, Time: at(0)},
+		{Type: events.CheckScheduled, Time: at(3), CheckID: "1", Checktype: "vulcan-trivy", Target: ".", AssetType: "GitRepository", Image: "vulcansec/vulcan-trivy:edge"},
+		{Type: events.CheckScheduled, Time: at(3), CheckID: "2", Checktype: "vulcan-nuclei", Target: "example.com", AssetType: "Hostname", Image: "vulcansec/vulcan-nuclei:edge"},
+		{Type: events.ImagePulled, Time: at(6), Image: "vulcansec/vulcan-trivy:edge", Duration: 3},
+		{Type: events.ImagePulled, Time: at(6), Image: "vulcansec/vulcan-nuclei:edge", Duration: 2, Message: "not found"},
+		{Type: events.ImagePulled, Time: at(6), Image: "vulcansec/vulcan-zap:edge", Duration: 1},
+		{Type: events.CheckStarted, Time: at(7), CheckID: "1", Checktype: "vulcan-trivy"},
+		{Type: events.CheckStarted, Time: at(8), CheckID: "2", Checktype: "vulcan-nuclei"},
+		{Type: events.CheckRetried, Time: at(20), CheckID: "1", Checktype: "vulcan-trivy", Attempt: 2, Message: "timeout"},
+		{Type: events.ReportReceived, Time: at(25), CheckID: "2", Duration: 0.5},
+		{Type: events.CheckFinished, Time: at(25), CheckID: "2", Checktype: "vulcan-nuclei", Status: "FAILED", Findings: events.Int(0)},
+		{Type: events.Error, Time: at(25), Message: "check failed"},
+		{Type: events.ReportReceived, Time: at(46), CheckID: "1", Duration: 1},
+		{Type: events.CheckFinished, Time: at(47), CheckID: "1", Checktype: "vulcan-trivy", Status: "FINISHED", Findings: events.Int(2)},
+		{Type: events.ReportGenerated, Time: at(48), Duration: 0.5},
+		{Type: events.ScanFinished, Time: at(50), ExitCode: events.Int(103)},
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	for _, ev := range scanEvents(time.Unix(1640000000, 0)) {
+		m.Observe(ev)
+	}
+	srv := httptest.NewServer(m.Handler())
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(b)
+	for _, want := range []string{
+		"# TYPE vulcan_local_scans_total counter\nvulcan_local_scans_total{exit_code=\"103\"} 1\n",
+		"vulcan_local_scan_duration_seconds 50\n",
+		"vulcan_local_checks_total{checktype=\"vulcan-nuclei\",status=\"FAILED\"} 1\n",
+		"vulcan_local_checks_total{checktype=\"vulcan-trivy\",status=\"FINISHED\"} 1\n",
+		"vulcan_local_checks_running 0\n",
+		"vulcan_local_check_retries_total{checktype=\"vulcan-trivy\"} 1\n",
+		"vulcan_local_check_findings_total{checktype=\"vulcan-trivy\"} 2\n",
+		"vulcan_local_last_scan_findings 2\n",
+		"vulcan_local_check_queue_seconds_bucket{checktype=\"vulcan-trivy\",le=\"1\"} 0\n",
+		"vulcan_local_check_queue_seconds_bucket{checktype=\"vulcan-trivy\",le=\"5\"} 1\n",
+		"vulcan_local_check_duration_seconds_bucket{checktype=\"vulcan-trivy\",le=\"30\"} 0\n",
+		"vulcan_local_check_duration_seconds_bucket{checktype=\"vulcan-trivy\",le=\"60\"} 1\n",
+		"vulcan_local_check_duration_seconds_sum{checktype=\"vulcan-trivy\"} 40\n",
+		"vulcan_local_check_duration_seconds_count{checktype=\"vulcan-trivy\"} 1\n",
+		"vulcan_local_image_pull_duration_seconds_bucket{le=\"+Inf\"} 3\n",
+		"vulcan_local_image_pull_duration_seconds_sum 6\n",
+		"vulcan_local_image_pull_errors_total 1\n",
+		"vulcan_local_report_duration_seconds_sum 0.5\n",
+		"vulcan_local_errors_total 1\n",
+		"vulcan_local_last_scan_exit_code 103\n",
+		"vulcan_local_last_scan_timestamp_seconds 1.64000005e+09\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metric %q not found in:\n%s", want, got)
+		}
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %s", ct)
+	}
+}
@@ -0,0 +1,438 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-local/pkg/config"
+	"github.com/adevinta/vulcan-local/pkg/events"
+)
+
+const (
+	// defaultServiceName is the name of the service in the traces if
+	// OTEL_SERVICE_NAME is not set.
+	defaultServiceName = "vulcan-local"
+	// defaultExportTimeout is the timeout of the exports if
+	// OTEL_EXPORTER_OTLP_TIMEOUT is not set.
+	defaultExportTimeout = 10 * time.Second
+
+	spanKindInternal = 1
+	statusCodeOk     = 1
+	statusCodeError  = 2
+)
+
+// getenv allows to replace the environment in the tests.
+var getenv = os.Getenv
+
+// Tracer builds a trace for every scan from its events, with a span per
+// check and its phases, and exports it to an OTLP/HTTP endpoint with the json
+// encoding when the scan finishes.
+type Tracer struct {
+	endpoint string
+	headers  map[string]string
+	resource []keyValue
+	client   *http.Client
+	log      log.Logger
+
+	mu      sync.Mutex
+	traceID string
+	scan    *span
+	checks  map[string]*checkSpans
+	spans   []*span
+	wg      sync.WaitGroup
+}
+
+// checkSpans are the spans of a running check.
+type checkSpans struct {
+	check *span
+	queue *span
+	run   *span
+	image string
+}
+
+// NewTracerFromEnv returns a Tracer configured with the standard
+// OpenTelemetry env vars, or nil if no OTLP endpoint is set or the traces
+// exporter is not otlp. Only the http/json protocol is supported.
+func NewTracerFromEnv(l log.Logger) (*Tracer, error) {
+	if exporter := getenv("OTEL_TRACES_EXPORTER"); exporter != "" && exporter != "otlp" {
+		return nil, nil
+	}
+	endpoint := getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return nil, nil
+	}
+	if _, err := url.ParseRequestURI(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint %s: %w", endpoint, err)
+	}
+	protocol := envFirst("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL")
+	if protocol != "" && protocol != "http/json" {
+		return nil, fmt.Errorf("unsupported OTLP protocol %s, only http/json is supported", protocol)
+	}
+	if protocol == "" {
+		l.Infof("OTEL_EXPORTER_OTLP_PROTOCOL not set, exporting the traces with http/json instead of http/protobuf")
+	}
+	timeout := defaultExportTimeout
+	if ms := envFirst("OTEL_EXPORTER_OTLP_TRACES_TIMEOUT", "OTEL_EXPORTER_OTLP_TIMEOUT"); ms != "" {
+		n, err := strconv.Atoi(ms)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTLP timeout %s: %w", ms, err)
+		}
+		timeout = time.Duration(n) * time.Millisecond
+	}
+	headers, err := parsePairs(envFirst("OTEL_EXPORTER_OTLP_TRACES_HEADERS", "OTEL_EXPORTER_OTLP_HEADERS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP headers: %w", err)
+	}
+	attrs, err := parsePairs(getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTEL_RESOURCE_ATTRIBUTES: %w", err)
+	}
+	if name := getenv("OTEL_SERVICE_NAME"); name != "" {
+		attrs["service.name"] = name
+	}
+	if attrs["service.name"] == "" {
+		attrs["service.name"] = defaultServiceName
+	}
+	resource := []keyValue{}
+	for _, k := range sortedKeys(attrs) {
+		resource = append(resource, stringAttr(k, attrs[k]))
+	}
+	return &Tracer{
+		endpoint: endpoint,
+		headers:  headers,
+		resource: resource,
+		client:   &http.Client{Timeout: timeout},
+		log:      l,
+		checks:   map[string]*checkSpans{},
+	}, nil
+}
+
+// Observe adds the event to the trace of the scan, it's an events.Listener.
+func (t *Tracer) Observe(ev events.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ev.Type == events.ScanStarted {
+		t.traceID = newID(16)
+		t.scan = t.newSpan("scan", "", ev.Time)
+		t.checks = map[string]*checkSpans{}
+		t.spans = []*span{t.scan}
+		return
+	}
+	if t.scan == nil {
+		return
+	}
+	switch ev.Type {
+	case events.CheckScheduled:
+		c := t.newSpan("check "+ev.Checktype, t.scan.SpanID, ev.Time)
+		c.Attributes = append(c.Attributes,
+			stringAttr("vulcan.check.id", ev.CheckID),
+			stringAttr("vulcan.checktype", ev.Checktype),
+			stringAttr("vulcan.target", ev.Target),
+			stringAttr("vulcan.asset_type", ev.AssetType),
+		)
+		t.checks[ev.CheckID] = &checkSpans{check: c, queue: t.newSpan("queue", c.SpanID, ev.Time), image: ev.Image}
+	case events.CheckStarted:
+		c, ok := t.checks[ev.CheckID]
+		if !ok {
+			return
+		}
+		if c.queue != nil {
+			c.queue.setStatus("")
+			c.queue.end(ev.Time)
+			t.spans = append(t.spans, c.queue)
+			c.queue = nil
+		}
+		c.run = t.newSpan("run", c.check.SpanID, ev.Time)
+	case events.CheckRetried:
+		if c, ok := t.checks[ev.CheckID]; ok && c.run != nil {
+			c.run.Events = append(c.run.Events, spanEvent{
+				TimeUnixNano: unixNano(ev.Time),
+				Name:         "retry",
+				Attributes:   []keyValue{intAttr("vulcan.attempt", ev.Attempt), stringAttr("vulcan.error", ev.Message)},
+			})
+		}
+	case events.CheckFinished:
+		c, ok := t.checks[ev.CheckID]
+		if !ok {
+			return
+		}
+		delete(t.checks, ev.CheckID)
+		if c.run != nil {
+			c.run.end(ev.Time)
+			c.run.setStatus(ev.Message)
+			t.spans = append(t.spans, c.run)
+		}
+		c.check.Attributes = append(c.check.Attributes, stringAttr("vulcan.status", ev.Status))
+		if ev.Findings != nil {
+			c.check.Attributes = append(c.check.Attributes, intAttr("vulcan.findings", *ev.Findings))
+		}
+		msg := ev.Message
+		if msg == "" && ev.Status != "FINISHED" {
+			msg = "check " + strings.ToLower(ev.Status)
+		}
+		c.check.setStatus(msg)
+		c.check.end(ev.Time)
+		t.spans = append(t.spans, c.check)
+	case events.ImagePulled:
+		// The pull is a span of every check of the image, or of the scan
+		// if no check runs it.
+		parents := []string{}
+		for _, c := range t.checks {
+			if c.image == ev.Image {
+				parents = append(parents, c.check.SpanID)
+			}
+		}
+		if len(parents) == 0 {
+			parents = append(parents, t.scan.SpanID)
+		}
+		for _, parent := range parents {
+			s := t.newSpan("pull", parent, ev.Time.Add(-seconds(ev.Duration)))
+			s.Attributes = append(s.Attributes, stringAttr("vulcan.image", ev.Image))
+			s.setStatus(ev.Message)
+			s.end(ev.Time)
+			t.spans = append(t.spans, s)
+		}
+	case events.ReportReceived:
+		c, ok := t.checks[ev.CheckID]
+		if !ok {
+			return
+		}
+		s := t.newSpan("report", c.check.SpanID, ev.Time.Add(-seconds(ev.Duration)))
+		s.setStatus("")
+		s.end(ev.Time)
+		t.spans = append(t.spans, s)
+	case events.ReportGenerated:
+		s := t.newSpan("report", t.scan.SpanID, ev.Time.Add(-seconds(ev.Duration)))
+		s.setStatus(ev.Message)
+		s.end(ev.Time)
+		t.spans = append(t.spans, s)
+	case events.ScanFinished:
+		code := 0
+		if ev.ExitCode != nil {
+			code = *ev.ExitCode
+		}
+		t.scan.Attributes = append(t.scan.Attributes, intAttr("vulcan.exit_code", code))
+		msg := ""
+		if code == config.ErrorExitCode {
+			msg = "scan failed"
+		}
+		t.scan.setStatus(msg)
+		// The checks not finished are exported as interrupted.
+		for _, c := range t.checks {
+			for _, s := range []*span{c.queue, c.run, c.check} {
+				if s != nil {
+					s.setStatus("interrupted")
+					s.end(ev.Time)
+					t.spans = append(t.spans, s)
+				}
+			}
+		}
+		t.scan.end(ev.Time)
+		spans := t.spans
+		t.scan, t.spans, t.checks = nil, nil, map[string]*checkSpans{}
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			if err := t.export(spans); err != nil {
+				t.log.Errorf("Unable to export the traces to %s: %v", t.endpoint, err)
+			}
+		}()
+	}
+}
+
+// Shutdown waits for the pending exports.
+func (t *Tracer) Shutdown() {
+	t.wg.Wait()
+}
+
+func (t *Tracer) newSpan(name, parent string, start time.Time) *span {
+	return &span{
+		TraceID:           t.traceID,
+		SpanID:            newID(8),
+		ParentSpanID:      parent,
+		Name:              name,
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: unixNano(start),
+	}
+}
+
+// export sends the spans to the endpoint.
+func (t *Tracer) export(spans []*span) error {
+	body := exportRequest{ResourceSpans: []resourceSpans{{
+		Resource: resource{Attributes: t.resource},
+		ScopeSpans: []scopeSpans{{
+			Scope: scope{Name: defaultServiceName},
+			Spans: spans,
+		}},
+	}}}
+	content, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, t.endpoint, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// The types below are the OTLP/HTTP json encoding of the traces.
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope   `json:"scope"`
+	Spans []*span `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type span struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              int         `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []keyValue  `json:"attributes,omitempty"`
+	Events            []spanEvent `json:"events,omitempty"`
+	Status            *spanStatus `json:"status,omitempty"`
+}
+
+func (s *span) end(t time.Time) {
+	s.EndTimeUnixNano = unixNano(t)
+}
+
+// setStatus sets the status of the span to error with the message, or to ok
+// if empty.
+func (s *span) setStatus(msg string) {
+	if msg == "" {
+		s.Status = &spanStatus{Code: statusCodeOk}
+		return
+	}
+	s.Status = &spanStatus{Code: statusCodeError, Message: msg}
+}
+
+type spanEvent struct {
+	TimeUnixNano string     `json:"timeUnixNano"`
+	Name         string     `json:"name"`
+	Attributes   []keyValue `json:"attributes,omitempty"`
+}
+
+type spanStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	// IntValue is an int64, encoded as a string.
+	IntValue *string `json:"intValue,omitempty"`
+}
+
+func stringAttr(k, v string) keyValue {
+	return keyValue{Key: k, Value: anyValue{StringValue: &v}}
+}
+
+func intAttr(k string, v int) keyValue {
+	s := strconv.Itoa(v)
+	return keyValue{Key: k, Value: anyValue{IntValue: &s}}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// newID returns a random id of n bytes, hex encoded.
+func newID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// envFirst returns the value of the first env var set.
+func envFirst(names ...string) string {
+	for _, n := range names {
+		if v := getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parsePairs parses a list of comma separated key=value pairs with url
+// encoded values, the format of the OpenTelemetry env vars.
+func parsePairs(s string) (map[string]string, error) {
+	pairs := map[string]string{}
+	for _, p := range strings.Split(s, ",") {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(p, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid pair %s", p)
+		}
+		v, err := url.QueryUnescape(strings.TrimSpace(v))
+		if err != nil {
+			return nil, err
+		}
+		pairs[strings.TrimSpace(k)] = v
+	}
+	return pairs, nil
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package telemetry
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	loggerUser *logrus.Logger
+)
+
+func init() {
+	if len(os.Args) > 1 && os.Args[1][:5] == "-test" {
+		loggerUser = logrus.New()
+		loggerUser.SetFormatter(&logrus.TextFormatter{
+			DisableColors:   false,
+			FullTimestamp:   true,
+			TimestampFormat: time.RFC3339,
+			ForceColors:     true,
+		})
+	}
+}
+
+// setEnv replaces the environment read by the tracer during the test.
+func setEnv(t *testing.T, env map[string]string) {
+	old := getenv
+	getenv = func(k string) string { return env[k] }
+	t.Cleanup(func() { getenv = old })
+}
+
+func TestNewTracerFromEnv(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		wantEndpoint string
+		wantHeaders  map[string]string
+		wantService  string
+		wantErr      bool
+	}{
+		{
+			name: "NotConfigured",
+			env:  map[string]string{},
+		},
+		{
+			name: "Endpoint",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "http://localhost:4318/",
+				"OTEL_EXPORTER_OTLP_HEADERS":  "x-api-key=secret%3D,tenant = local",
+				"OTEL_RESOURCE_ATTRIBUTES":    "service.name=scanner,deployment.environment=ci",
+			},
+			wantEndpoint: "http://localhost:4318/v1/traces",
+			wantHeaders:  map[string]string{"x-api-key": "secret=", "tenant": "local"},
+			wantService:  "scanner",
+		},
+		{
+			name: "TracesEndpoint",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT":        "http://localhost:4318",
+				"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://collector:4318/traces",
+				"OTEL_SERVICE_NAME":                  "ci-scanner",
+				"OTEL_EXPORTER_OTLP_PROTOCOL":        "http/json",
+			},
+			wantEndpoint: "http://collector:4318/traces",
+			wantHeaders:  map[string]string{},
+			wantService:  "ci-scanner",
+		},
+		{
+			name: "Disabled",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "http://localhost:4318",
+				"OTEL_TRACES_EXPORTER":        "none",
+			},
+		},
+		{
+			name: "UnsupportedProtocol",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "http://localhost:4317",
+				"OTEL_EXPORTER_OTLP_PROTOCOL": "grpc",
+			},
+			wantErr: true,
+		},
+		{
+			name: "InvalidTimeout",
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "http://localhost:4318",
+				"OTEL_EXPORTER_OTLP_TIMEOUT":  "10s",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.env)
+			tracer, err := NewTracerFromEnv(loggerUser)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if tt.wantEndpoint == "" {
+				if tracer != nil {
+					t.Fatalf("unexpected tracer for %s", tracer.endpoint)
+				}
+				return
+			}
+			if tracer.endpoint != tt.wantEndpoint {
+				t.Errorf("unexpected endpoint got=%s want=%s", tracer.endpoint, tt.wantEndpoint)
+			}
+			if diff := cmp.Diff(tt.wantHeaders, tracer.headers); diff != "" {
+				t.Errorf("unexpected headers (-want +got):\n%s", diff)
+			}
+			service := ""
+			for _, kv := range tracer.resource {
+				if kv.Key == "service.name" {
+					service = *kv.Value.StringValue
+				}
+			}
+			if service != tt.wantService {
+				t.Errorf("unexpected service name got=%s want=%s", service, tt.wantService)
+			}
+		})
+	}
+}
+
+func TestTracer(t *testing.T) {
+	received := make(chan exportRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("unexpected content type %s", ct)
+		}
+		if key := r.Header.Get("x-api-key"); key != "secret" {
+			t.Errorf("unexpected api key %s", key)
+		}
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		var req exportRequest
+		if err := json.Unmarshal(b, &req); err != nil {
+			t.Errorf("invalid export request %v: %s", err, b)
+		}
+		received <- req
+	}))
+	defer srv.Close()
+	setEnv(t, map[string]string{
+		"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": srv.URL + "/v1/traces",
+		"OTEL_EXPORTER_OTLP_HEADERS":         "x-api-key=secret",
+	})
+	tracer, err := NewTracerFromEnv(loggerUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1640000000, 0)
+	for _, ev := range scanEvents(start) {
+		tracer.Observe(ev)
+	}
+	tracer.Shutdown()
+
+	var req exportRequest
+	select {
+	case req = <-received:
+	default:
+		t.Fatal("the traces were not exported")
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	byID := map[string]*span{}
+	for _, s := range spans {
+		byID[s.SpanID] = s
+	}
+	// tree describes every span by its name, the name of its parent, its
+	// status code and its duration in seconds.
+	type node struct {
+		Name, Parent string
+		Status       int
+		Seconds      int
+	}
+	tree := []node{}
+	for _, s := range spans {
+		if s.TraceID != spans[0].TraceID {
+			t.Errorf("span %s in a different trace", s.Name)
+		}
+		n := node{Name: s.Name, Status: s.Status.Code, Seconds: int(duration(t, s).Seconds())}
+		if p, ok := byID[s.ParentSpanID]; ok {
+			n.Parent = p.Name
+		}
+		tree = append(tree, n)
+	}
+	sort.Slice(tree, func(i, j int) bool {
+		if tree[i].Name != tree[j].Name {
+			return tree[i].Name < tree[j].Name
+		}
+		if tree[i].Parent != tree[j].Parent {
+			return tree[i].Parent < tree[j].Parent
+		}
+		return tree[i].Seconds < tree[j].Seconds
+	})
+	want := []node{
+		{Name: "check vulcan-nuclei", Parent: "scan", Status: statusCodeError, Seconds: 22},
+		{Name: "check vulcan-trivy", Parent: "scan", Status: statusCodeOk, Seconds: 44},
+		{Name: "pull", Parent: "check vulcan-nuclei", Status: statusCodeError, Seconds: 2},
+		{Name: "pull", Parent: "check vulcan-trivy", Status: statusCodeOk, Seconds: 3},
+		{Name: "pull", Parent: "scan", Status: statusCodeOk, Seconds: 1},
+		{Name: "queue", Parent: "check vulcan-nuclei", Status: statusCodeOk, Seconds: 5},
+		{Name: "queue", Parent: "check vulcan-trivy", Status: statusCodeOk, Seconds: 4},
+		{Name: "report", Parent: "check vulcan-nuclei", Status: statusCodeOk, Seconds: 0},
+		{Name: "report", Parent: "check vulcan-trivy", Status: statusCodeOk, Seconds: 1},
+		{Name: "report", Parent: "scan", Status: statusCodeOk, Seconds: 0},
+		{Name: "run", Parent: "check vulcan-nuclei", Status: statusCodeOk, Seconds: 17},
+		{Name: "run", Parent: "check vulcan-trivy", Status: statusCodeOk, Seconds: 40},
+		{Name: "scan", Parent: "", Status: statusCodeOk, Seconds: 50},
+	}
+	if diff := cmp.Diff(want, tree); diff != "" {
+		t.Errorf("unexpected spans (-want +got):\n%s", diff)
+	}
+	for _, s := range spans {
+		if s.Name == "run" && s.ParentSpanID != "" && byID[s.ParentSpanID].Name == "check vulcan-trivy" {
+			if len(s.Events) != 1 || s.Events[0].Name != "retry" {
+				t.Errorf("unexpected events of the run span %+v", s.Events)
+			}
+		}
+	}
+}
+
+// duration returns the duration of the span.
+func duration(t *testing.T, s *span) time.Duration {
+	start, err := strconv.ParseInt(s.StartTimeUnixNano, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	end, err := strconv.ParseInt(s.EndTimeUnixNano, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return time.Duration(end - start)
+}
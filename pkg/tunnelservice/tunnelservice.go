@@ -0,0 +1,205 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package tunnelservice
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/adevinta/vulcan-agent/log"
+	"github.com/adevinta/vulcan-local/pkg/ports"
+)
+
+// TunnelService exposes to the checks the web services listening only in the
+// loopback interface of the host, that are not reachable from the containers.
+type TunnelService interface {
+	// Expose returns the url the checks must use to reach the target. The
+	// targets not pointing to the loopback interface are returned as is.
+	Expose(target string) (string, error)
+	Shutdown()
+}
+
+// Config defines how the tunnel service exposes the services.
+type Config struct {
+	// Host is the address, reachable by the checks, where the proxies listen.
+	Host string
+
+	// Ports is the range of ports of the proxies that can't listen in the
+	// port of their service, random ports if nil.
+	Ports *ports.Range
+}
+
+type tunnelService struct {
+	log     log.Logger
+	cfg     Config
+	exposed map[string]string // loopback address -> exposed address
+	proxies []*proxy
+	mu      sync.Mutex
+}
+
+// proxy forwards the connections accepted in the listener to the backend.
+type proxy struct {
+	ln      net.Listener
+	backend string
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	conns   map[net.Conn]bool
+}
+
+func New(l log.Logger, cfg Config) TunnelService {
+	return &tunnelService{
+		log:     l,
+		cfg:     cfg,
+		exposed: map[string]string{},
+	}
+}
+
+func (ts *tunnelService) Expose(target string) (string, error) {
+	u, err := neturl.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !isLoopback(u.Hostname()) {
+		return target, nil
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultPort(u.Scheme)
+	}
+	backend := net.JoinHostPort(u.Hostname(), port)
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	addr, ok := ts.exposed[backend]
+	if !ok {
+		if addr, err = ts.listen(backend, port); err != nil {
+			return "", err
+		}
+		ts.exposed[backend] = addr
+	}
+	u.Host = addr
+	if host, p, _ := net.SplitHostPort(addr); u.Port() == "" && p == defaultPort(u.Scheme) {
+		u.Host = host
+	}
+	return u.String(), nil
+}
+
+// listen starts a proxy to the backend listening, if possible, in the same
+// port, so the urls generated by the service keep working, and returns its
+// address. If the port is already in use in the host the service is assumed
+// to listen in all the interfaces and no proxy is needed.
+func (ts *tunnelService) listen(backend, port string) (string, error) {
+	ln, err := net.Listen("tcp", net.JoinHostPort(ts.cfg.Host, port))
+	if errors.Is(err, syscall.EADDRINUSE) {
+		ts.log.Debugf("Service %s reachable in %s", backend, ts.cfg.Host)
+		return net.JoinHostPort(ts.cfg.Host, port), nil
+	}
+	if err != nil {
+		// i.e. privileged ports.
+		ln, err = ts.cfg.Ports.Listen(ts.cfg.Host)
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to start proxy for %s: %w", backend, err)
+	}
+	p := &proxy{ln: ln, backend: backend, conns: map[net.Conn]bool{}}
+	ts.proxies = append(ts.proxies, p)
+	p.wg.Add(1)
+	go p.serve(ts.log)
+	ts.log.Debugf("Proxying %s from %s", backend, ln.Addr())
+	_, lport, _ := net.SplitHostPort(ln.Addr().String())
+	return net.JoinHostPort(ts.cfg.Host, lport), nil
+}
+
+func (ts *tunnelService) Shutdown() {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	for _, p := range ts.proxies {
+		p.close()
+	}
+	ts.proxies = nil
+}
+
+func (p *proxy) serve(l log.Logger) {
+	defer p.wg.Done()
+	for {
+		conn, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			if err := p.forward(conn); err != nil {
+				l.Debugf("Proxy to %s error: %v", p.backend, err)
+			}
+		}()
+	}
+}
+
+func (p *proxy) forward(conn net.Conn) error {
+	defer p.untrack(conn)
+	p.track(conn)
+	backend, err := net.Dial("tcp", p.backend)
+	if err != nil {
+		return err
+	}
+	defer p.untrack(backend)
+	p.track(backend)
+	done := make(chan struct{}, 2)
+	cp := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		// Propagate the end of the stream.
+		if c, ok := dst.(*net.TCPConn); ok {
+			c.CloseWrite()
+		}
+		done <- struct{}{}
+	}
+	go cp(backend, conn)
+	go cp(conn, backend)
+	<-done
+	<-done
+	return nil
+}
+
+func (p *proxy) track(c net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.conns[c] = true
+}
+
+func (p *proxy) untrack(c net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c.Close()
+	delete(p.conns, c)
+}
+
+func (p *proxy) close() {
+	p.ln.Close()
+	p.mu.Lock()
+	for c := range p.conns {
+		c.Close()
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func defaultPort(scheme string) string {
+	if scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
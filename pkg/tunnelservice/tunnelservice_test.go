@@ -0,0 +1,113 @@
+/*
+Copyright 2022 Adevinta
+*/
+
+package tunnelservice
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	loggerUser *logrus.Logger
+)
+
+func init() {
+	if len(os.Args) > 1 && os.Args[1][:5] == "-test" {
+		loggerUser = logrus.New()
+		loggerUser.SetFormatter(&logrus.TextFormatter{
+			DisableColors:   false,
+			FullTimestamp:   true,
+			TimestampFormat: time.RFC3339,
+			ForceColors:     true,
+		})
+	}
+}
+
+// proxyHost is an address of the loopback network, different from the one
+// of the services, where the proxies can listen.
+const proxyHost = "127.0.0.2"
+
+func get(t *testing.T, url string) string {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestExpose(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("requires the 127.0.0.0/8 loopback network")
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "path=%s", r.URL.Path)
+	})
+	loopback := httptest.NewServer(handler)
+	defer loopback.Close()
+
+	// A service listening in all the interfaces.
+	ln, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := httptest.NewUnstartedServer(handler)
+	all.Listener.Close()
+	all.Listener = ln
+	all.Start()
+	defer all.Close()
+	_, allPort, _ := net.SplitHostPort(ln.Addr().String())
+
+	ts := New(loggerUser, Config{Host: proxyHost})
+	defer ts.Shutdown()
+
+	u, _ := neturl.Parse(loopback.URL)
+	target := fmt.Sprintf("http://localhost:%s/app", u.Port())
+	exposed, err := ts.Expose(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("http://%s:%s/app", proxyHost, u.Port()); exposed != want {
+		t.Errorf("unexpected url got=%s want=%s", exposed, want)
+	}
+	if body := get(t, exposed); body != "path=/app" {
+		t.Errorf("unexpected response %s", body)
+	}
+	again, err := ts.Expose(target)
+	if err != nil || again != exposed {
+		t.Errorf("unexpected url exposing again got=%s err=%v", again, err)
+	}
+
+	exposed, err = ts.Expose(fmt.Sprintf("http://127.0.0.1:%s/", allPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("http://%s:%s/", proxyHost, allPort); exposed != want {
+		t.Errorf("unexpected url got=%s want=%s", exposed, want)
+	}
+	if body := get(t, exposed); body != "path=/" {
+		t.Errorf("unexpected response %s", body)
+	}
+
+	for _, target := range []string{"https://example.com/", "localhost", "ftp://localhost/"} {
+		if got, err := ts.Expose(target); err != nil || got != target {
+			t.Errorf("unexpected url for %s got=%s err=%v", target, got, err)
+		}
+	}
+}